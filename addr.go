@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// canonicalAddr returns the canonical host:port form of the given address.
+//
+// The formatting of addresses varies depending on the source: for example,
+// [*net.TCPAddr] formats IPv4-mapped IPv6 addresses as IPv4, while
+// [netip.AddrPort] does not, and callers may provide IPv6 addresses using
+// uppercase hex digits. To make events comparable, we unmap IPv4-mapped IPv6
+// addresses and use the [netip.AddrPort] formatting, which uses lowercase hex
+// digits, compresses zeros, and preserves the IPv6 zone (e.g., the interface
+// of a link-local address, as in "[fe80::1%eth0]:53"). Addresses that are not
+// an IP address and a port (e.g., "example.com:443") are returned unchanged.
+func canonicalAddr(address string) string {
+	epnt, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return address
+	}
+	return netip.AddrPortFrom(epnt.Addr().Unmap(), epnt.Port()).String()
+}
+
+// connLocalAddr returns the canonical local address of conn or the empty string.
+func connLocalAddr(conn net.Conn) string {
+	return canonicalAddr(safeconn.LocalAddr(conn))
+}
+
+// connRemoteAddr returns the canonical remote address of conn or the empty string.
+func connRemoteAddr(conn net.Conn) string {
+	return canonicalAddr(safeconn.RemoteAddr(conn))
+}
@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// canonicalAddr normalizes IP addresses and ports and preserves IPv6 zones.
+func TestCanonicalAddr(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// address is the address to normalize.
+		address string
+
+		// want is the expected canonical address.
+		want string
+	}{
+		{name: "IPv4", address: "8.8.8.8:53", want: "8.8.8.8:53"},
+		{name: "IPv6", address: "[2001:4860:4860::8888]:53", want: "[2001:4860:4860::8888]:53"},
+		{name: "IPv6 uppercase and uncompressed", address: "[2001:4860:4860:0:0:0:0:8888]:53", want: "[2001:4860:4860::8888]:53"},
+		{name: "IPv6 link-local with zone", address: "[fe80::1%eth0]:53", want: "[fe80::1%eth0]:53"},
+		{name: "IPv6 link-local uppercase with zone", address: "[FE80::A%eth0]:53", want: "[fe80::a%eth0]:53"},
+		{name: "IPv4-mapped IPv6", address: "[::ffff:8.8.8.8]:53", want: "8.8.8.8:53"},
+		{name: "hostname", address: "dns.google:853", want: "dns.google:853"},
+		{name: "empty", address: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, canonicalAddr(tt.address))
+		})
+	}
+}
+
+// connLocalAddr and connRemoteAddr return canonical addresses, preserving
+// the zone of IPv6 link-local addresses, or the empty string.
+func TestConnAddrs(t *testing.T) {
+	conn := newMinimalConn()
+	conn.LocalAddrFunc = func() net.Addr {
+		return &net.UDPAddr{IP: net.ParseIP("fe80::2"), Port: 54321, Zone: "eth0"}
+	}
+	conn.RemoteAddrFunc = func() net.Addr {
+		return &net.UDPAddr{IP: net.ParseIP("FE80::1"), Port: 53, Zone: "eth0"}
+	}
+
+	assert.Equal(t, "[fe80::2%eth0]:54321", connLocalAddr(conn))
+	assert.Equal(t, "[fe80::1%eth0]:53", connRemoteAddr(conn))
+	assert.Equal(t, "", connLocalAddr(nil))
+	assert.Equal(t, "", connRemoteAddr(nil))
+}
+
+// ConnectFunc logs the same canonical remoteAddr on connectStart and connectDone.
+func TestConnectFuncLogsCanonicalRemoteAddr(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn := newMinimalConn()
+			conn.RemoteAddrFunc = func() net.Addr {
+				return &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 53, Zone: "eth0"}
+			}
+			return conn, nil
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	_, err := NewConnectFunc(cfg, "udp", logger).Call(
+		context.Background(), netip.MustParseAddrPort("[FE80::1%eth0]:53"))
+
+	require.NoError(t, err)
+	require.Len(t, *records, 2)
+	for _, record := range *records {
+		value, found := findAttr(record, "remoteAddr")
+		require.True(t, found)
+		assert.Equal(t, "[fe80::1%eth0]:53", value.String())
+	}
+}
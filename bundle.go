@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// NewBundleSLogger returns a new [*BundleSLogger] writing bundles to w.
+func NewBundleSLogger(w io.Writer) *BundleSLogger {
+	logger, trace := NewTraceSLogger()
+	return &BundleSLogger{
+		Logger: logger.(*slog.Logger),
+		trace:  trace,
+		writer: w,
+	}
+}
+
+// BundleSLogger is an [SLogger] buffering all the events of a measurement
+// run, regardless of their level, for archiving them as a single JSON object.
+//
+// Call [*BundleSLogger.Flush] at the end of the run to write the bundle.
+// Unlike a JSONL handler, which emits one line per event, the bundle is
+// a JSON object mapping each spanID to the array of the events emitted
+// within that span, in order of emission, each encoded as described by
+// [ToRBMKEvent]. Events without a spanID are bundled under the empty key.
+//
+// Use [*slog.Logger.With] to attach the spanID. The loggers it returns
+// share the buffer, so their events are included in the next Flush.
+//
+// Methods are safe for concurrent use.
+type BundleSLogger struct {
+	*slog.Logger
+
+	// flushMu serializes flushes.
+	flushMu sync.Mutex
+
+	// trace buffers the events in order of emission.
+	trace *Trace
+
+	// writer is where we write the bundles.
+	writer io.Writer
+}
+
+var _ SLogger = &BundleSLogger{}
+
+// Flush writes the bundle containing the buffered events, followed by a
+// newline, and clears the buffer. When there are no buffered events, the
+// bundle is an empty JSON object.
+//
+// The buffer is cleared only after the bundle has been written. On error,
+// the events remain buffered and are included in the next Flush, along
+// with those emitted in the meanwhile.
+func (l *BundleSLogger) Flush() error {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+	records := l.trace.snapshot()
+	bundle := make(map[string][]map[string]any)
+	for _, record := range records {
+		event, err := ToRBMKEvent(record)
+		if err != nil {
+			return err
+		}
+		var spanID string
+		if value, found := event["spanID"].(string); found {
+			spanID = value
+		}
+		bundle[spanID] = append(bundle[spanID], event)
+	}
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	if _, err := l.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.trace.discard(len(records))
+	return nil
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeBundle decodes a bundle written by [*BundleSLogger.Flush].
+func decodeBundle(t *testing.T, data []byte) map[string][]map[string]any {
+	var bundle map[string][]map[string]any
+	require.NoError(t, json.Unmarshal(data, &bundle))
+	return bundle
+}
+
+// The bundle contains all the events of a pipeline run in order, keyed by spanID.
+func TestBundleSLoggerFlush(t *testing.T) {
+	var buf bytes.Buffer
+	bundler := NewBundleSLogger(&buf)
+	spanID := NewSpanID()
+
+	_, err := newTracePipeline(bundler.With("spanID", spanID), nil).Call(
+		context.Background(), netip.MustParseAddrPort("93.184.216.34:443"))
+	require.NoError(t, err)
+	assert.Empty(t, buf.Bytes(), "should not write before Flush")
+
+	require.NoError(t, bundler.Flush())
+	assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+	bundle := decodeBundle(t, buf.Bytes())
+	require.Len(t, bundle, 1)
+	events := bundle[spanID]
+	var names []string
+	for _, event := range events {
+		names = append(names, event["msg"].(string))
+		assert.Equal(t, spanID, event["spanID"])
+	}
+	assert.Equal(t, []string{
+		"connectStart",
+		"connectDone",
+		"tlsHandshakeStart",
+		"tlsHandshakeDone",
+	}, names)
+}
+
+// Events are grouped by spanID, and events without a spanID use the empty key.
+func TestBundleSLoggerMultipleSpans(t *testing.T) {
+	var buf bytes.Buffer
+	bundler := NewBundleSLogger(&buf)
+
+	first := bundler.With("spanID", "first")
+	second := bundler.With("spanID", "second")
+	first.Info("connectStart")
+	second.Info("connectStart")
+	second.Debug("read", "ioBytesCount", 4)
+	first.Info("connectDone")
+	bundler.Info("orphan")
+
+	require.NoError(t, bundler.Flush())
+	bundle := decodeBundle(t, buf.Bytes())
+	require.Len(t, bundle, 3)
+
+	msgs := func(events []map[string]any) (names []string) {
+		for _, event := range events {
+			names = append(names, event["msg"].(string))
+		}
+		return
+	}
+	assert.Equal(t, []string{"connectStart", "connectDone"}, msgs(bundle["first"]))
+	assert.Equal(t, []string{"connectStart", "read"}, msgs(bundle["second"]))
+	assert.Equal(t, []string{"orphan"}, msgs(bundle[""]))
+	assert.Equal(t, float64(4), bundle["second"][1]["ioBytesCount"])
+}
+
+// Flush clears the buffer, so each run produces its own bundle.
+func TestBundleSLoggerFlushClearsBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	bundler := NewBundleSLogger(&buf)
+	bundler.Info("connectStart")
+	require.NoError(t, bundler.Flush())
+
+	buf.Reset()
+	require.NoError(t, bundler.Flush())
+	assert.Equal(t, "{}\n", buf.String())
+}
+
+// Flush returns the error occurred when writing the bundle and keeps the events buffered.
+func TestBundleSLoggerFlushWriteError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	var buf bytes.Buffer
+	conn := &netstub.FuncConn{
+		WriteFunc: func(b []byte) (int, error) {
+			if wantErr != nil {
+				return 0, wantErr
+			}
+			return buf.Write(b)
+		},
+	}
+	bundler := NewBundleSLogger(conn)
+	bundler.Info("connectStart")
+
+	assert.ErrorIs(t, bundler.Flush(), wantErr)
+
+	wantErr = nil
+	bundler.Info("connectDone")
+	require.NoError(t, bundler.Flush())
+	bundle := decodeBundle(t, buf.Bytes())
+	require.Len(t, bundle[""], 2)
+	assert.Equal(t, "connectStart", bundle[""][0]["msg"])
+	assert.Equal(t, "connectDone", bundle[""][1]["msg"])
+}
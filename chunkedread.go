@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// NewChunkedReadFunc returns a new [*ChunkedReadFunc].
+//
+// The chunk argument is the maximum number of bytes returned by each Read.
+//
+// This function panics if chunk is not positive.
+func NewChunkedReadFunc(chunk int) *ChunkedReadFunc {
+	runtimex.Assert(chunk > 0)
+	return &ChunkedReadFunc{Chunk: chunk}
+}
+
+// ChunkedReadFunc wraps a [net.Conn] such that each Read returns at most
+// Chunk bytes, regardless of the size of the buffer provided by the caller.
+//
+// This is useful to stress-test the reassembly logic of downstream protocol
+// parsers against fragmentation. The wrapper does not emit any event.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type ChunkedReadFunc struct {
+	// Chunk is the maximum number of bytes returned by each Read.
+	//
+	// Set by [NewChunkedReadFunc] to the user-provided value.
+	Chunk int
+}
+
+var _ Func[net.Conn, net.Conn] = &ChunkedReadFunc{}
+
+// Call wraps the given [net.Conn] to limit the size of each Read.
+func (op *ChunkedReadFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &chunkedReadConn{Conn: conn, chunk: op.Chunk}, nil
+}
+
+// chunkedReadConn limits the size of each Read of a [net.Conn].
+type chunkedReadConn struct {
+	net.Conn
+	chunk int
+}
+
+// Read implements [net.Conn].
+func (c *chunkedReadConn) Read(b []byte) (int, error) {
+	if len(b) > c.chunk {
+		b = b[:c.chunk]
+	}
+	return c.Conn.Read(b)
+}
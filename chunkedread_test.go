@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewChunkedReadFunc configures the chunk size.
+func TestNewChunkedReadFunc(t *testing.T) {
+	fn := NewChunkedReadFunc(7)
+
+	require.NotNil(t, fn)
+	assert.Equal(t, 7, fn.Chunk)
+}
+
+// NewChunkedReadFunc panics when the chunk size is not positive.
+func TestNewChunkedReadFuncInvalidChunk(t *testing.T) {
+	assert.Panics(t, func() { NewChunkedReadFunc(0) })
+}
+
+// Reads never exceed the chunk size even with a large buffer.
+func TestChunkedReadFunc(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	source := bytes.NewReader(payload)
+	var sizes []int
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		sizes = append(sizes, len(b))
+		return source.Read(b)
+	}
+
+	conn, err := NewChunkedReadFunc(7).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	var got []byte
+	buffer := make([]byte, 4096)
+	for {
+		count, err := conn.Read(buffer)
+		assert.LessOrEqual(t, count, 7)
+		got = append(got, buffer[:count]...)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, payload, got)
+	for _, size := range sizes {
+		assert.LessOrEqual(t, size, 7)
+	}
+}
+
+// Reads with a buffer smaller than the chunk size are not modified.
+func TestChunkedReadFuncSmallBuffer(t *testing.T) {
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		return copy(b, "abcdef"), nil
+	}
+
+	conn, err := NewChunkedReadFunc(16).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	buffer := make([]byte, 4)
+	count, err := conn.Read(buffer)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []byte("abcd"), buffer)
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a deterministic clock for testing.
+//
+// The time only changes when calling [*FakeClock.Advance]. Use
+// [*Config.WithClock] to make all the Funcs constructed from a [*Config]
+// share the same clock, such that the t0 and t fields of the events emitted
+// by a pipeline are deterministic and consistent across its stages.
+//
+// Methods are safe for concurrent use.
+type FakeClock struct {
+	// mu protects now.
+	mu sync.Mutex
+
+	// now is the current time.
+	now time.Time
+}
+
+// NewFakeClock returns a new [*FakeClock] whose current time is t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{now: t}
+}
+
+// Advance moves the current time forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// Now returns the current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// WithClock sets [Config.TimeNow] to use the given [*FakeClock] and returns
+// the [*Config] itself, to allow chaining with [NewConfig].
+//
+// Funcs copy [Config.TimeNow] when constructed, so this method only affects
+// the Funcs constructed afterwards.
+func (cfg *Config) WithClock(clock *FakeClock) *Config {
+	cfg.TimeNow = clock.Now
+	return cfg
+}
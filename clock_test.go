@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Advance moves the time returned by Now forward.
+func TestFakeClock(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	assert.Equal(t, t0, clock.Now())
+	assert.Equal(t, t0, clock.Now(), "should not change without Advance")
+	clock.Advance(150 * time.Millisecond)
+	assert.Equal(t, t0.Add(150*time.Millisecond), clock.Now())
+}
+
+// WithClock wires TimeNow to the clock and returns the same config.
+func TestConfigWithClock(t *testing.T) {
+	t0 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+	cfg := NewConfig()
+
+	assert.Same(t, cfg, cfg.WithClock(clock))
+	assert.Equal(t, t0, cfg.TimeNow())
+	clock.Advance(time.Second)
+	assert.Equal(t, t0.Add(time.Second), cfg.TimeNow())
+}
+
+// A pipeline constructed using WithClock emits consistent t0 and t values
+// across the connect and DNS events.
+func TestConfigWithClockPipeline(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	var query *dns.Msg
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		clock.Advance(20 * time.Millisecond)
+		return copy(b, runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())), nil
+	}
+	cfg := NewConfig().WithClock(clock)
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			clock.Advance(10 * time.Millisecond)
+			return mockConn, nil
+		},
+	}
+
+	logger, trace := NewTraceSLogger()
+	pipeline := Compose2(NewConnectFunc(cfg, "udp", logger), NewDNSOverUDPConnFunc(cfg, logger))
+	conn, err := pipeline.Call(context.Background(), netip.MustParseAddrPort("8.8.8.8:53"))
+	require.NoError(t, err)
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+
+	// timeAttr returns the value of the given time attribute of the given event.
+	timeAttr := func(event, key string) time.Time {
+		record, found := trace.Find(event)
+		require.True(t, found, event)
+		value, found := findAttr(record, key)
+		require.True(t, found, key)
+		require.Equal(t, slog.KindTime, value.Kind())
+		return value.Time()
+	}
+
+	connected := start.Add(10 * time.Millisecond)
+	assert.Equal(t, start, timeAttr("connectStart", "t"))
+	assert.Equal(t, start, timeAttr("connectDone", "t0"))
+	assert.Equal(t, connected, timeAttr("connectDone", "t"))
+	assert.Equal(t, connected, timeAttr("dnsExchangeStart", "t"))
+	assert.Equal(t, connected, timeAttr("dnsResponse", "t0"))
+	assert.Equal(t, connected.Add(20*time.Millisecond), timeAttr("dnsResponse", "t"))
+	assert.Equal(t, connected, timeAttr("dnsExchangeDone", "t0"))
+	assert.Equal(t, connected.Add(20*time.Millisecond), timeAttr("dnsExchangeDone", "t"))
+}
@@ -8,7 +8,12 @@
 
 package nop
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 // Compose2 chains two [Func] instances together into a pipeline.
 //
@@ -97,3 +102,36 @@ type constFunc[B any] struct {
 func (c *constFunc[B]) Call(ctx context.Context, _ Unit) (B, error) {
 	return c.value, nil
 }
+
+// Timeout wraps a [Func] such that each call uses a child context bounded by
+// the given timeout, regardless of the deadline of the caller's context.
+//
+// This is useful to cap individual measurements when the caller provides a
+// long-lived context. If the call fails after the timeout has expired, the
+// returned error wraps both [context.DeadlineExceeded] and the original error,
+// so that [errors.Is] works for either while preserving the failure details.
+//
+// The child context is canceled when Call returns. Therefore, do not wrap
+// [Func] instances whose result remains bound to the context after they
+// return (e.g., [CancelWatchFunc], which would close the connection as
+// soon as Call returns). Wrap the whole pipeline including the code using
+// the connection, or use the caller's context to control the lifetime instead.
+func Timeout[A, B any](fn Func[A, B], d time.Duration) Func[A, B] {
+	return &timeoutFunc[A, B]{fn, d}
+}
+
+type timeoutFunc[A, B any] struct {
+	fn Func[A, B]
+	d  time.Duration
+}
+
+func (t *timeoutFunc[A, B]) Call(ctx context.Context, input A) (B, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.d)
+	defer cancel()
+	res, err := t.fn.Call(ctx, input)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		var zero B
+		return zero, fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return res, err
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -188,3 +189,61 @@ func TestConstFunc(t *testing.T) {
 		assert.Equal(t, want, result)
 	})
 }
+
+func TestTimeout(t *testing.T) {
+	t.Run("slow operation is interrupted", func(t *testing.T) {
+		interrupted := errors.New("interrupted")
+		fn := FuncAdapter[int, int](func(ctx context.Context, n int) (int, error) {
+			select {
+			case <-ctx.Done():
+				return 0, interrupted
+			case <-time.After(10 * time.Second):
+				return n, nil
+			}
+		})
+
+		wrapped := Timeout(fn, 10*time.Millisecond)
+		_, err := wrapped.Call(context.Background(), 42)
+
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, err, interrupted)
+	})
+
+	t.Run("deadline errors are not wrapped twice", func(t *testing.T) {
+		fn := FuncAdapter[int, int](func(ctx context.Context, n int) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+
+		wrapped := Timeout(fn, 10*time.Millisecond)
+		_, err := wrapped.Call(context.Background(), 42)
+
+		require.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("fast operation is unaffected", func(t *testing.T) {
+		fn := FuncAdapter[int, int](func(ctx context.Context, n int) (int, error) {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok, "context should have a deadline")
+			return n * 2, nil
+		})
+
+		wrapped := Timeout(fn, 10*time.Second)
+		result, err := wrapped.Call(context.Background(), 21)
+
+		require.NoError(t, err)
+		assert.Equal(t, 42, result)
+	})
+
+	t.Run("errors before the timeout are propagated", func(t *testing.T) {
+		wantErr := errors.New("failed")
+		fn := FuncAdapter[int, int](func(ctx context.Context, n int) (int, error) {
+			return 0, wantErr
+		})
+
+		wrapped := Timeout(fn, 10*time.Second)
+		_, err := wrapped.Call(context.Background(), 21)
+
+		require.ErrorIs(t, err, wantErr)
+	})
+}
@@ -4,6 +4,7 @@ package nop
 
 import (
 	"net"
+	"syscall"
 	"time"
 )
 
@@ -12,6 +13,36 @@ import (
 // Pass this to constructor functions to pre-wire dependencies.
 // All fields have sensible defaults set by [NewConfig].
 type Config struct {
+	// Control optionally sets socket options (e.g., SO_MARK, IP_TOS, or
+	// SO_BINDTODEVICE) on the sockets created by [*ConnectFunc].
+	//
+	// [*ConnectFunc] invokes Control after creating the socket and before
+	// connecting, using the [net.Dialer.ControlContext] hook, with the
+	// actual network (e.g., "tcp4") and the address to connect to. When
+	// Control returns an error, the dial is aborted and fails with that
+	// error.
+	//
+	// [NewConfig] does not install Control into the default Dialer. Rather,
+	// [*ConnectFunc] applies it on each dial to a copy of Dialer, which must
+	// be a [*net.Dialer] (the default), chaining it after the hooks that the
+	// Dialer already has, if any. With any other Dialer, dialing fails with
+	// [ErrControlUnsupported].
+	//
+	// Set by [NewConfig] to nil.
+	Control func(network, address string, c syscall.RawConn) error
+
+	// DSCP optionally configures the Differentiated Services Code Point
+	// (a value between 0 and 63) marking the packets sent by connections
+	// established by [*ConnectFunc], which is useful for QoS measurements.
+	// When zero, the packets are not marked.
+	//
+	// [*ConnectFunc] sets IP_TOS or IPV6_TCLASS before connecting using the
+	// [net.Dialer.ControlContext] hook, so that the marking also applies to
+	// the TCP handshake. This is a no-op on non-Unix systems.
+	//
+	// Set by [NewConfig] to zero.
+	DSCP int
+
 	// Dialer is used by [*ConnectFunc].
 	//
 	// Set by [NewConfig] to [*net.Dialer].
@@ -23,6 +54,35 @@ type Config struct {
 	// [errclass] package to map errors to Unix-like names.
 	ErrClassifier ErrClassifier
 
+	// LocalAddr optionally binds the connections established by [*ConnectFunc]
+	// to the given local address (e.g., a [*net.TCPAddr] with the source IP to
+	// use on a multi-homed host). The address type must match the network.
+	//
+	// [*ConnectFunc] uses a copy of Dialer with the [net.Dialer.LocalAddr]
+	// field set, so this requires Dialer to be a [*net.Dialer], which is
+	// the default. When binding fails, the dial fails with that error.
+	//
+	// Set by [NewConfig] to nil.
+	LocalAddr net.Addr
+
+	// Resolver is used by [*ResolveConnectFunc].
+	//
+	// Set by [NewConfig] to [net.DefaultResolver].
+	Resolver Resolver
+
+	// TCPNoDelay optionally configures TCP_NODELAY for TCP connections
+	// established by [*ConnectFunc]. When true, Nagle's algorithm is disabled;
+	// when false, it is enabled. When nil, the Go default applies, which is to
+	// disable Nagle's algorithm.
+	//
+	// Go sets TCP_NODELAY after connecting, which would override a value set
+	// using [net.Dialer.Control], so [*ConnectFunc] sets the option on the
+	// connected socket instead. This is a no-op on non-Unix systems and for
+	// connections not implementing [syscall.Conn].
+	//
+	// Set by [NewConfig] to nil.
+	TCPNoDelay *bool
+
 	// TimeNow returns the current time.
 	//
 	// Set by [NewConfig] to [time.Now].
@@ -34,6 +94,7 @@ func NewConfig() *Config {
 	return &Config{
 		Dialer:        &net.Dialer{},
 		ErrClassifier: DefaultErrClassifier,
+		Resolver:      net.DefaultResolver,
 		TimeNow:       time.Now,
 	}
 }
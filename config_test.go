@@ -16,6 +16,9 @@ func TestNewConfig(t *testing.T) {
 
 	require.NotNil(t, cfg)
 
+	// Control should be unset
+	assert.Nil(t, cfg.Control)
+
 	// Dialer should be set to *net.Dialer
 	_, ok := cfg.Dialer.(*net.Dialer)
 	assert.True(t, ok, "Dialer should be *net.Dialer")
@@ -24,6 +27,12 @@ func TestNewConfig(t *testing.T) {
 	assert.Equal(t, "", cfg.ErrClassifier.Classify(nil))
 	assert.Equal(t, "ETIMEDOUT", cfg.ErrClassifier.Classify(context.DeadlineExceeded))
 
+	// LocalAddr should be unset
+	assert.Nil(t, cfg.LocalAddr)
+
+	// Resolver should be set to net.DefaultResolver
+	assert.Same(t, net.DefaultResolver, cfg.Resolver)
+
 	// TimeNow should be set and return a valid time
 	now := cfg.TimeNow()
 	assert.False(t, now.IsZero())
@@ -9,12 +9,14 @@ package nop
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"net"
 	"net/netip"
+	"syscall"
 	"time"
 
-	"github.com/bassosimone/safeconn"
+	"github.com/bassosimone/runtimex"
 )
 
 // Dialer abstracts the [*net.Dialer] behavior.
@@ -32,12 +34,19 @@ type Dialer interface {
 // The network argument must be either "tcp" or "udp".
 //
 // The logger argument is the [SLogger] to use for structured logging.
+//
+// This function panics if cfg.DSCP is not between 0 and 63.
 func NewConnectFunc(cfg *Config, network string, logger SLogger) *ConnectFunc {
+	runtimex.Assert(cfg.DSCP >= 0 && cfg.DSCP <= connectMaxDSCP)
 	return &ConnectFunc{
+		Control:       cfg.Control,
+		DSCP:          cfg.DSCP,
 		Dialer:        cfg.Dialer,
 		ErrClassifier: cfg.ErrClassifier,
+		LocalAddr:     cfg.LocalAddr,
 		Logger:        logger,
 		Network:       network,
+		TCPNoDelay:    cfg.TCPNoDelay,
 		TimeNow:       cfg.TimeNow,
 	}
 }
@@ -49,6 +58,25 @@ func NewConnectFunc(cfg *Config, network string, logger SLogger) *ConnectFunc {
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type ConnectFunc struct {
+	// Control optionally sets socket options before connecting
+	// (see [Config.Control]).
+	//
+	// Like LocalAddr, the hook requires Dialer to be a [*net.Dialer]. With
+	// any other [Dialer], Call fails with [ErrControlUnsupported].
+	//
+	// Set by [NewConnectFunc] from [Config.Control].
+	Control func(network, address string, c syscall.RawConn) error
+
+	// DSCP optionally marks the packets sent by the connection using
+	// the given Differentiated Services Code Point (see [Config.DSCP]).
+	// When not zero, connectStart includes the dscp field.
+	//
+	// Like LocalAddr, marking requires Dialer to be a [*net.Dialer]. With
+	// any other [Dialer], Call fails with [ErrDSCPUnsupported].
+	//
+	// Set by [NewConnectFunc] from [Config.DSCP].
+	DSCP int
+
 	// Dialer is the [Dialer] to use.
 	//
 	// Set by [NewConnectFunc] from [Config.Dialer].
@@ -59,6 +87,18 @@ type ConnectFunc struct {
 	// Set by [NewConnectFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// LocalAddr optionally binds the connection to the given local address
+	// (e.g., a [*net.UDPAddr] with a specific source port for studying
+	// port-based blocking). The address type must match the network. When
+	// not nil, connectStart includes the requestedLocalAddr field.
+	//
+	// Binding requires Dialer to be a [*net.Dialer], whose copy with the
+	// LocalAddr field set is used for dialing. With any other [Dialer], Call
+	// fails with [ErrLocalAddrUnsupported].
+	//
+	// Set by [NewConnectFunc] from [Config.LocalAddr].
+	LocalAddr net.Addr
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewConnectFunc] to the user-provided logger.
@@ -69,6 +109,13 @@ type ConnectFunc struct {
 	// Set by [NewConnectFunc] to the user-provided value.
 	Network string
 
+	// TCPNoDelay optionally configures TCP_NODELAY for TCP connections
+	// (see [Config.TCPNoDelay]). When not nil, connectStart includes the
+	// tcpNoDelay field containing the configured value.
+	//
+	// Set by [NewConnectFunc] from [Config.TCPNoDelay].
+	TCPNoDelay *bool
+
 	// TimeNow is the function to get the current time (configurable for testing).
 	//
 	// Set by [NewConnectFunc] from [Config.TimeNow].
@@ -82,32 +129,119 @@ func (op *ConnectFunc) Call(ctx context.Context, address netip.AddrPort) (net.Co
 	t0 := op.TimeNow()
 	deadline, _ := ctx.Deadline()
 	op.logConnectStart(op.Network, address.String(), t0, deadline)
-	conn, err := op.Dialer.DialContext(ctx, op.Network, address.String())
-	op.logConnectDone(op.Network, address.String(), t0, deadline, conn, err)
+	conn, err := op.dial(ctx, address.String())
+	if err == nil && op.TCPNoDelay != nil && op.Network == "tcp" {
+		if err = connectSetNoDelay(conn, *op.TCPNoDelay); err != nil {
+			conn.Close()
+			conn = nil
+		}
+	}
+	t := op.TimeNow()
+	op.logConnectDone(op.Network, address.String(), t0, t, deadline, conn, err)
+	if summary := ConnectionSummaryFromContext(ctx); summary != nil {
+		summary.recordConnect(connLocalAddr(conn), op.Network,
+			canonicalAddr(address.String()), t.Sub(t0), op.ErrClassifier.Classify(err))
+	}
 	return conn, err
 }
 
+// ErrLocalAddrUnsupported indicates that [*ConnectFunc] cannot bind to
+// [ConnectFunc.LocalAddr] because the [Dialer] is not a [*net.Dialer].
+var ErrLocalAddrUnsupported = errors.New("nop: dialer does not support binding to a local address")
+
+// ErrDSCPUnsupported indicates that [*ConnectFunc] cannot mark packets
+// using [ConnectFunc.DSCP] because the [Dialer] is not a [*net.Dialer].
+var ErrDSCPUnsupported = errors.New("nop: dialer does not support setting the DSCP")
+
+// ErrControlUnsupported indicates that [*ConnectFunc] cannot invoke
+// [ConnectFunc.Control] because the [Dialer] is not a [*net.Dialer].
+var ErrControlUnsupported = errors.New("nop: dialer does not support the control hook")
+
+// connectMaxDSCP is the largest DSCP value, which is a 6-bit field.
+const connectMaxDSCP = 63
+
+// dial dials the address, honoring LocalAddr, DSCP, and Control if set.
+func (op *ConnectFunc) dial(ctx context.Context, address string) (net.Conn, error) {
+	if op.LocalAddr == nil && op.DSCP == 0 && op.Control == nil {
+		return op.Dialer.DialContext(ctx, op.Network, address)
+	}
+	dialer, ok := op.Dialer.(*net.Dialer)
+	switch {
+	case !ok && op.LocalAddr != nil:
+		return nil, ErrLocalAddrUnsupported
+	case !ok && op.DSCP != 0:
+		return nil, ErrDSCPUnsupported
+	case !ok:
+		return nil, ErrControlUnsupported
+	}
+	child := *dialer
+	if op.LocalAddr != nil {
+		child.LocalAddr = op.LocalAddr
+	}
+	if op.DSCP != 0 || op.Control != nil {
+		child.ControlContext = connectControl(dialer, op.Control, op.DSCP)
+	}
+	return child.DialContext(ctx, op.Network, address)
+}
+
+// connectControl returns a [net.Dialer.ControlContext] hook that invokes
+// the hook configured by the parent dialer, if any, then the control hook,
+// if any, and finally sets the DSCP, if not zero.
+func connectControl(parent *net.Dialer, control func(network, address string, c syscall.RawConn) error,
+	dscp int) func(ctx context.Context, network, address string, c syscall.RawConn) error {
+	return func(ctx context.Context, network, address string, c syscall.RawConn) error {
+		var err error
+		switch {
+		case parent.ControlContext != nil:
+			err = parent.ControlContext(ctx, network, address, c)
+		case parent.Control != nil:
+			err = parent.Control(network, address, c)
+		}
+		if err != nil {
+			return err
+		}
+		if control != nil {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		if dscp == 0 {
+			return nil
+		}
+		return connectSetDSCP(network, c, dscp)
+	}
+}
+
 func (op *ConnectFunc) logConnectStart(network, address string, t0 time.Time, deadline time.Time) {
-	op.Logger.Info(
-		"connectStart",
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.String("protocol", network),
-		slog.String("remoteAddr", address),
+		slog.String("remoteAddr", canonicalAddr(address)),
 		slog.Time("t", t0),
-	)
+	}
+	if op.DSCP != 0 {
+		attrs = append(attrs, slog.Int("dscp", op.DSCP))
+	}
+	if op.LocalAddr != nil {
+		attrs = append(attrs, slog.String("requestedLocalAddr", op.LocalAddr.String()))
+	}
+	if op.TCPNoDelay != nil {
+		attrs = append(attrs, slog.Bool("tcpNoDelay", *op.TCPNoDelay))
+	}
+	op.Logger.Info("connectStart", attrs...)
 }
 
 func (op *ConnectFunc) logConnectDone(
-	network, address string, t0 time.Time, deadline time.Time, conn net.Conn, err error) {
+	network, address string, t0, t time.Time, deadline time.Time, conn net.Conn, err error) {
 	op.Logger.Info(
 		"connectDone",
 		slog.Time("deadline", deadline),
 		slog.Any("err", err),
 		slog.String("errClass", op.ErrClassifier.Classify(err)),
-		slog.String("localAddr", safeconn.LocalAddr(conn)),
+		slog.String("localAddr", connLocalAddr(conn)),
 		slog.String("protocol", network),
-		slog.String("remoteAddr", address),
+		slog.String("remoteAddr", canonicalAddr(address)),
 		slog.Time("t0", t0),
-		slog.Time("t", op.TimeNow()),
+		slog.Time("t", t),
 	)
 }
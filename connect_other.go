@@ -0,0 +1,20 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !unix
+
+package nop
+
+import (
+	"net"
+	"syscall"
+)
+
+// connectSetNoDelay is a no-op on this platform.
+func connectSetNoDelay(conn net.Conn, value bool) error {
+	return nil
+}
+
+// connectSetDSCP is a no-op on this platform.
+func connectSetDSCP(network string, c syscall.RawConn, dscp int) error {
+	return nil
+}
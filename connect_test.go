@@ -7,6 +7,7 @@ import (
 	"errors"
 	"net"
 	"net/netip"
+	"syscall"
 	"testing"
 	"time"
 
@@ -232,3 +233,323 @@ func TestConnectFuncLogging(t *testing.T) {
 	assert.Equal(t, "connectStart", (*records)[0].Message)
 	assert.Equal(t, "connectDone", (*records)[1].Message)
 }
+
+// Call logs tcpNoDelay on connectStart only when configured.
+func TestConnectFuncTCPNoDelay(t *testing.T) {
+	noDelay := false
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// tcpNoDelay is the configured value.
+		tcpNoDelay *bool
+
+		// wantFound indicates whether we expect the attribute.
+		wantFound bool
+	}{
+		{name: "not configured", tcpNoDelay: nil, wantFound: false},
+		{name: "configured", tcpNoDelay: &noDelay, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.TCPNoDelay = tt.tcpNoDelay
+			cfg.Dialer = &netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					// The mock does not implement syscall.Conn, so this
+					// also exercises the no-op fallback path.
+					conn := newMinimalConn()
+					conn.CloseFunc = func() error { return nil }
+					return conn, nil
+				},
+			}
+			logger, records := newCapturingLogger()
+
+			conn, err := NewConnectFunc(cfg, "tcp", logger).Call(
+				context.Background(), netip.MustParseAddrPort("93.184.216.34:443"))
+
+			require.NoError(t, err)
+			require.NotNil(t, conn)
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[0], "tcpNoDelay")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.False(t, value.Bool())
+			}
+		})
+	}
+}
+
+// Call fails with ErrLocalAddrUnsupported when LocalAddr is set and the
+// dialer is not a *net.Dialer, logging the requested address.
+func TestConnectFuncLocalAddrUnsupported(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			panic("should not be called")
+		},
+	}
+	logger, records := newCapturingLogger()
+	fn := NewConnectFunc(cfg, "udp", logger)
+	fn.LocalAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 5353}
+
+	conn, err := fn.Call(context.Background(), netip.MustParseAddrPort("8.8.8.8:53"))
+
+	require.ErrorIs(t, err, ErrLocalAddrUnsupported)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	value, found := findAttr((*records)[0], "requestedLocalAddr")
+	require.True(t, found)
+	assert.Equal(t, "127.0.0.1:5353", value.String())
+}
+
+// NewConnectFunc copies Config.DSCP and panics when it is out of range.
+func TestNewConnectFuncDSCP(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DSCP = 46
+
+	fn := NewConnectFunc(cfg, "tcp", DefaultSLogger())
+
+	assert.Equal(t, 46, fn.DSCP)
+	for _, dscp := range []int{-1, 64} {
+		cfg.DSCP = dscp
+		assert.Panics(t, func() { NewConnectFunc(cfg, "tcp", DefaultSLogger()) })
+	}
+}
+
+// Call logs dscp on connectStart only when configured. On platforms where
+// setting the DSCP is a no-op, dialing succeeds anyway.
+func TestConnectFuncDSCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	for _, dscp := range []int{0, 46} {
+		cfg := NewConfig()
+		cfg.DSCP = dscp
+		logger, records := newCapturingLogger()
+
+		conn, err := NewConnectFunc(cfg, "tcp", logger).Call(context.Background(), address)
+
+		require.NoError(t, err)
+		conn.Close()
+		require.Len(t, *records, 2)
+		value, found := findAttr((*records)[0], "dscp")
+		require.Equal(t, dscp != 0, found)
+		if found {
+			assert.Equal(t, int64(dscp), value.Int64())
+		}
+	}
+}
+
+// Call invokes the Control hook of the configured *net.Dialer before
+// setting the DSCP and fails when the hook fails.
+func TestConnectFuncDSCPParentControl(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+	wantErr := errors.New("control error")
+
+	cfg := NewConfig()
+	cfg.DSCP = 46
+	var network string
+	cfg.Dialer = &net.Dialer{
+		Control: func(n, address string, c syscall.RawConn) error {
+			network = n
+			return wantErr
+		},
+	}
+
+	conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(context.Background(), address)
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, conn)
+	assert.Equal(t, "tcp4", network)
+}
+
+// Call fails with ErrDSCPUnsupported when DSCP is set and the
+// dialer is not a *net.Dialer, logging the requested DSCP.
+func TestConnectFuncDSCPUnsupported(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DSCP = 46
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			panic("should not be called")
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	conn, err := NewConnectFunc(cfg, "udp", logger).Call(
+		context.Background(), netip.MustParseAddrPort("8.8.8.8:53"))
+
+	require.ErrorIs(t, err, ErrDSCPUnsupported)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	value, found := findAttr((*records)[0], "dscp")
+	require.True(t, found)
+	assert.Equal(t, int64(46), value.Int64())
+}
+
+// Call invokes Config.Control with the actual network and address before
+// connecting, after the Control hook of the configured *net.Dialer.
+func TestConnectFuncControl(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	var calls []string
+	cfg := NewConfig()
+	cfg.Dialer = &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			calls = append(calls, "dialer")
+			return nil
+		},
+	}
+	var gotNetwork, gotAddress string
+	cfg.Control = func(network, address string, c syscall.RawConn) error {
+		calls = append(calls, "config")
+		gotNetwork, gotAddress = network, address
+		return nil
+	}
+	fn := NewConnectFunc(cfg, "tcp", DefaultSLogger())
+	require.NotNil(t, fn.Control)
+
+	conn, err := fn.Call(context.Background(), address)
+
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"dialer", "config"}, calls)
+	assert.Equal(t, "tcp4", gotNetwork)
+	assert.Equal(t, address.String(), gotAddress)
+}
+
+// Config.Control runs when dialing using the default dialer created by
+// NewConfig, which is not modified.
+func TestConnectFuncControlDefaultDialer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	var calls int
+	cfg := NewConfig()
+	cfg.Control = func(network, address string, c syscall.RawConn) error {
+		calls++
+		return nil
+	}
+
+	conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(context.Background(), address)
+
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, 1, calls)
+	dialer, ok := cfg.Dialer.(*net.Dialer)
+	require.True(t, ok)
+	assert.Nil(t, dialer.Control)
+	assert.Nil(t, dialer.ControlContext)
+}
+
+// Call fails with the error returned by Config.Control without connecting.
+func TestConnectFuncControlError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+	wantErr := errors.New("control error")
+
+	cfg := NewConfig()
+	cfg.Control = func(network, address string, c syscall.RawConn) error {
+		return wantErr
+	}
+
+	conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(context.Background(), address)
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, conn)
+}
+
+// Call fails with ErrControlUnsupported when Control is set and the
+// dialer is not a *net.Dialer.
+func TestConnectFuncControlUnsupported(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Control = func(network, address string, c syscall.RawConn) error {
+		panic("should not be called")
+	}
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			panic("should not be called")
+		},
+	}
+
+	conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(
+		context.Background(), netip.MustParseAddrPort("8.8.8.8:443"))
+
+	require.ErrorIs(t, err, ErrControlUnsupported)
+	assert.Nil(t, conn)
+}
+
+// Call binds to Config.LocalAddr using a copy of the configured *net.Dialer
+// and logs requestedLocalAddr on connectStart.
+func TestConnectFuncLocalAddr(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	// Reserve a free local port to bind to
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	localAddr := reserved.Addr().(*net.TCPAddr)
+	require.NoError(t, reserved.Close())
+
+	cfg := NewConfig()
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	cfg.Dialer = dialer
+	cfg.LocalAddr = localAddr
+	logger, records := newCapturingLogger()
+	fn := NewConnectFunc(cfg, "tcp", logger)
+	assert.Same(t, localAddr, fn.LocalAddr)
+
+	conn, err := fn.Call(context.Background(), address)
+
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, localAddr.String(), conn.LocalAddr().String())
+	assert.Nil(t, dialer.LocalAddr, "the configured dialer must not be modified")
+	require.Len(t, *records, 2)
+	value, found := findAttr((*records)[0], "requestedLocalAddr")
+	require.True(t, found)
+	assert.Equal(t, localAddr.String(), value.String())
+	value, found = findAttr((*records)[1], "localAddr")
+	require.True(t, found)
+	assert.Equal(t, localAddr.String(), value.String())
+}
+
+// Call reports bind failures through connectDone with the error class.
+func TestConnectFuncLocalAddrBindError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	// Binding to the address of the listener fails because it is in use
+	cfg := NewConfig()
+	cfg.LocalAddr = listener.Addr()
+	logger, records := newCapturingLogger()
+
+	conn, err := NewConnectFunc(cfg, "tcp", logger).Call(context.Background(), address)
+
+	require.Error(t, err)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	assert.Equal(t, "connectDone", (*records)[1].Message)
+	errClass, found := findAttr((*records)[1], "errClass")
+	require.True(t, found)
+	assert.NotEmpty(t, errClass.String())
+	assert.Equal(t, cfg.ErrClassifier.Classify(err), errClass.String())
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build unix
+
+package nop
+
+import (
+	"net"
+	"strings"
+	"syscall"
+)
+
+// connectSetNoDelay sets TCP_NODELAY on the given connection.
+//
+// This is a no-op when the connection does not implement [syscall.Conn].
+func connectSetNoDelay(conn net.Conn, value bool) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var optval int
+	if value {
+		optval = 1
+	}
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY, optval)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+// connectSetDSCP sets the DSCP on the given socket before connecting, using
+// IPV6_TCLASS for IPv6 networks and IP_TOS otherwise.
+func connectSetDSCP(network string, c syscall.RawConn, dscp int) error {
+	level, option := syscall.IPPROTO_IP, syscall.IP_TOS
+	if strings.HasSuffix(network, "6") {
+		level, option = syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	}
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		// The DSCP occupies the six most significant bits of the byte
+		serr = syscall.SetsockoptInt(int(fd), level, option, dscp<<2)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build unix
+
+package nop
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Call sets TCP_NODELAY on the connected socket when configured.
+func TestConnectFuncTCPNoDelaySocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	address := netip.MustParseAddrPort(listener.Addr().String())
+
+	for _, value := range []bool{false, true} {
+		cfg := NewConfig()
+		cfg.TCPNoDelay = &value
+
+		conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(context.Background(), address)
+		require.NoError(t, err)
+
+		rc, err := conn.(syscall.Conn).SyscallConn()
+		require.NoError(t, err)
+		var optval int
+		var serr error
+		require.NoError(t, rc.Control(func(fd uintptr) {
+			optval, serr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+		}))
+		require.NoError(t, serr)
+		assert.Equal(t, value, optval != 0)
+		conn.Close()
+	}
+}
+
+// Call sets IP_TOS or IPV6_TCLASS on the socket when DSCP is configured.
+func TestConnectFuncDSCPSocket(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// listenAddr is the address to listen on.
+		listenAddr string
+
+		// level and option identify the socket option to check.
+		level, option int
+	}{
+		{
+			name:       "IPv4",
+			listenAddr: "127.0.0.1:0",
+			level:      syscall.IPPROTO_IP,
+			option:     syscall.IP_TOS,
+		},
+
+		{
+			name:       "IPv6",
+			listenAddr: "[::1]:0",
+			level:      syscall.IPPROTO_IPV6,
+			option:     syscall.IPV6_TCLASS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", tt.listenAddr)
+			if err != nil {
+				t.Skip("cannot listen:", err)
+			}
+			defer listener.Close()
+			address := netip.MustParseAddrPort(listener.Addr().String())
+			cfg := NewConfig()
+			cfg.DSCP = 46
+
+			conn, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(context.Background(), address)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			rc, err := conn.(syscall.Conn).SyscallConn()
+			require.NoError(t, err)
+			var optval int
+			var serr error
+			require.NoError(t, rc.Control(func(fd uintptr) {
+				optval, serr = syscall.GetsockoptInt(int(fd), tt.level, tt.option)
+			}))
+			require.NoError(t, serr)
+			assert.Equal(t, 46<<2, optval)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// NewDNSBlocklistFunc returns a new [*DNSBlocklistFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The blocklist argument contains the prefixes of the known sinkhole or
+// blockpage addresses (e.g., 10.10.34.34/32). We copy the slice.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewDNSBlocklistFunc(cfg *Config, blocklist []netip.Prefix, logger SLogger) *DNSBlocklistFunc {
+	return &DNSBlocklistFunc{
+		Blocklist: slices.Clone(blocklist),
+		Logger:    logger,
+		TimeNow:   cfg.TimeNow,
+	}
+}
+
+// DNSBlocklistFunc checks whether a DNS response contains blocklisted addresses.
+//
+// Censoring resolvers often answer with the addresses of sinkholes or of
+// servers hosting blockpages. Place this Func after a DNS exchange to check
+// the addresses in the A and AAAA answers against the blocklist. Call emits
+// a dnsBlocklistCheck event whose dnsBlocklistHit field indicates whether any
+// address belongs to a blocklisted prefix. On hit, the event also includes
+// the first matching address as dnsBlocklistAddr and the prefix containing
+// it as dnsBlocklistPrefix. The response is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type DNSBlocklistFunc struct {
+	// Blocklist contains the blocklisted prefixes.
+	//
+	// Set by [NewDNSBlocklistFunc] to a copy of the user-provided blocklist.
+	Blocklist []netip.Prefix
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewDNSBlocklistFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewDNSBlocklistFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[*dnscodec.Response, *dnscodec.Response] = &DNSBlocklistFunc{}
+
+// Call checks the addresses of the given response and returns it.
+func (op *DNSBlocklistFunc) Call(ctx context.Context, resp *dnscodec.Response) (*dnscodec.Response, error) {
+	addr, prefix, hit := op.match(resp)
+	attrs := []any{
+		slog.Bool("dnsBlocklistHit", hit),
+		slog.Time("t", op.TimeNow()),
+	}
+	if hit {
+		attrs = append(attrs,
+			slog.String("dnsBlocklistAddr", addr.String()),
+			slog.String("dnsBlocklistPrefix", prefix.String()),
+		)
+	}
+	op.Logger.Info("dnsBlocklistCheck", attrs...)
+	return resp, nil
+}
+
+// match returns the first address of the response belonging to a blocklisted
+// prefix, along with the prefix, and whether there is such an address.
+func (op *DNSBlocklistFunc) match(resp *dnscodec.Response) (netip.Addr, netip.Prefix, bool) {
+	if resp == nil {
+		return netip.Addr{}, netip.Prefix{}, false
+	}
+	for _, addr := range dnsResponseAddrs(resp) {
+		for _, prefix := range op.Blocklist {
+			if prefix.Contains(addr) {
+				return addr, prefix, true
+			}
+		}
+	}
+	return netip.Addr{}, netip.Prefix{}, false
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBlocklistAResponse returns a parsed A response containing the given addresses.
+func newTestBlocklistAResponse(addrs ...string) *dnscodec.Response {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	return runtimex.PanicOnError1(dnscodec.ParseResponse(query, newDNSResponse(query, addrs...)))
+}
+
+// newTestBlocklistAAAAResponse returns a parsed AAAA response containing the given addresses.
+func newTestBlocklistAAAAResponse(addrs ...string) *dnscodec.Response {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeAAAA)
+	resp := new(dns.Msg).SetReply(query)
+	for _, addr := range addrs {
+		resp.Answer = append(resp.Answer, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 300},
+			AAAA: net.ParseIP(addr),
+		})
+	}
+	return runtimex.PanicOnError1(dnscodec.ParseResponse(query, resp))
+}
+
+// NewDNSBlocklistFunc populates all fields and copies the blocklist.
+func TestNewDNSBlocklistFunc(t *testing.T) {
+	blocklist := []netip.Prefix{netip.MustParsePrefix("10.10.34.34/31")}
+
+	fn := NewDNSBlocklistFunc(NewConfig(), blocklist, DefaultSLogger())
+	blocklist[0] = netip.MustParsePrefix("192.0.2.0/24")
+
+	require.NotNil(t, fn)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.10.34.34/31")}, fn.Blocklist)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call logs whether the response contains blocklisted addresses and returns it unchanged.
+func TestDNSBlocklistFunc(t *testing.T) {
+	blocklist := []netip.Prefix{
+		netip.MustParsePrefix("10.10.34.34/31"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// resp is the response to check.
+		resp *dnscodec.Response
+
+		// wantHit is the expected dnsBlocklistHit.
+		wantHit bool
+
+		// wantAddr and wantPrefix are the expected match on hit.
+		wantAddr, wantPrefix string
+	}{
+		{
+			name:    "outside the blocklist",
+			resp:    newTestBlocklistAResponse("130.192.91.211"),
+			wantHit: false,
+		},
+
+		{
+			name:       "IPv4 sinkhole",
+			resp:       newTestBlocklistAResponse("130.192.91.211", "10.10.34.35"),
+			wantHit:    true,
+			wantAddr:   "10.10.34.35",
+			wantPrefix: "10.10.34.34/31",
+		},
+
+		{
+			name:       "IPv6 sinkhole",
+			resp:       newTestBlocklistAAAAResponse("2001:db8::1"),
+			wantHit:    true,
+			wantAddr:   "2001:db8::1",
+			wantPrefix: "2001:db8::/32",
+		},
+
+		{
+			name:    "nil response",
+			resp:    nil,
+			wantHit: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			fn := NewDNSBlocklistFunc(NewConfig(), blocklist, logger)
+
+			resp, err := fn.Call(context.Background(), tt.resp)
+
+			require.NoError(t, err)
+			assert.Same(t, tt.resp, resp)
+			require.Len(t, *records, 1)
+			assert.Equal(t, "dnsBlocklistCheck", (*records)[0].Message)
+			value, found := findAttr((*records)[0], "dnsBlocklistHit")
+			require.True(t, found)
+			assert.Equal(t, tt.wantHit, value.Bool())
+			addr, foundAddr := findAttr((*records)[0], "dnsBlocklistAddr")
+			prefix, foundPrefix := findAttr((*records)[0], "dnsBlocklistPrefix")
+			require.Equal(t, tt.wantHit, foundAddr)
+			require.Equal(t, tt.wantHit, foundPrefix)
+			if tt.wantHit {
+				assert.Equal(t, tt.wantAddr, addr.String())
+				assert.Equal(t, tt.wantPrefix, prefix.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DNSComparison is the result of [CompareDNSResponses].
+type DNSComparison struct {
+	// AnswersAgree indicates whether both responses contain the same answers.
+	AnswersAgree bool
+
+	// OnlyInA contains the sorted answers only present in the first response.
+	OnlyInA []string
+
+	// OnlyInB contains the sorted answers only present in the second response.
+	OnlyInB []string
+}
+
+// CompareDNSResponses compares the answers of two responses to the same query,
+// e.g., obtained using DNS-over-UDP and DNS-over-HTTPS, to detect tampering.
+//
+// We compare the ValidRRs of the responses as sets, ignoring the order of the
+// records, their TTLs, and the case of their names. Each differing record uses
+// the zone file format with a zero TTL (e.g., "example.com.\t0\tIN\tA\t1.2.3.4").
+// A nil response is equivalent to a response without answers.
+//
+// This function is pure: use [DNSComparison.Log] to log the result.
+func CompareDNSResponses(a, b *dnscodec.Response) DNSComparison {
+	answersA, answersB := dnsCompareAnswers(a), dnsCompareAnswers(b)
+	cmp := DNSComparison{
+		OnlyInA: dnsCompareDifference(answersA, answersB),
+		OnlyInB: dnsCompareDifference(answersB, answersA),
+	}
+	cmp.AnswersAgree = len(cmp.OnlyInA) <= 0 && len(cmp.OnlyInB) <= 0
+	return cmp
+}
+
+// Log emits a dnsCompareResponses event containing dnsAnswersAgree and, when
+// the answers disagree, the differing records as dnsAnswersOnlyInA and
+// dnsAnswersOnlyInB.
+//
+// The t argument is the time to log, typically obtained from [Config.TimeNow].
+func (c DNSComparison) Log(logger SLogger, t time.Time) {
+	attrs := []any{
+		slog.Bool("dnsAnswersAgree", c.AnswersAgree),
+		slog.Time("t", t),
+	}
+	if !c.AnswersAgree {
+		attrs = append(attrs,
+			slog.Any("dnsAnswersOnlyInA", c.OnlyInA),
+			slog.Any("dnsAnswersOnlyInB", c.OnlyInB),
+		)
+	}
+	logger.Info("dnsCompareResponses", attrs...)
+}
+
+// dnsCompareAnswers returns the normalized answers of the given response.
+func dnsCompareAnswers(resp *dnscodec.Response) map[string]struct{} {
+	out := make(map[string]struct{})
+	if resp == nil {
+		return out
+	}
+	for _, rr := range resp.ValidRRs {
+		rr = dns.Copy(rr)
+		rr.Header().Name = strings.ToLower(rr.Header().Name)
+		rr.Header().Ttl = 0
+		out[rr.String()] = struct{}{}
+	}
+	return out
+}
+
+// dnsCompareDifference returns the sorted answers in a but not in b.
+func dnsCompareDifference(a, b map[string]struct{}) []string {
+	out := []string{}
+	for answer := range a {
+		if _, found := b[answer]; !found {
+			out = append(out, answer)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDNSCompareResponse returns a parsed response for example.com
+// containing one A record for each of the given addresses.
+func newTestDNSCompareResponse(ttl uint32, addrs ...string) *dnscodec.Response {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	resp := newDNSResponse(query, addrs...)
+	for _, rr := range resp.Answer {
+		rr.Header().Ttl = ttl
+	}
+	return runtimex.PanicOnError1(dnscodec.ParseResponse(query, resp))
+}
+
+// CompareDNSResponses compares the answers as sets.
+func TestCompareDNSResponses(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// a is the first response.
+		a *dnscodec.Response
+
+		// b is the second response.
+		b *dnscodec.Response
+
+		// want is the expected comparison.
+		want DNSComparison
+	}{
+		{
+			name: "same answers in different order and with different TTLs",
+			a:    newTestDNSCompareResponse(300, "8.8.8.8", "8.8.4.4"),
+			b:    newTestDNSCompareResponse(60, "8.8.4.4", "8.8.8.8"),
+			want: DNSComparison{AnswersAgree: true, OnlyInA: []string{}, OnlyInB: []string{}},
+		},
+
+		{
+			name: "divergent answers",
+			a:    newTestDNSCompareResponse(300, "8.8.8.8", "8.8.4.4"),
+			b:    newTestDNSCompareResponse(300, "8.8.8.8", "10.10.34.35"),
+			want: DNSComparison{
+				AnswersAgree: false,
+				OnlyInA:      []string{"example.com.\t0\tIN\tA\t8.8.4.4"},
+				OnlyInB:      []string{"example.com.\t0\tIN\tA\t10.10.34.35"},
+			},
+		},
+
+		{
+			name: "nil response",
+			a:    newTestDNSCompareResponse(300, "8.8.8.8"),
+			b:    nil,
+			want: DNSComparison{
+				AnswersAgree: false,
+				OnlyInA:      []string{"example.com.\t0\tIN\tA\t8.8.8.8"},
+				OnlyInB:      []string{},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CompareDNSResponses(tt.a, tt.b))
+		})
+	}
+}
+
+// CompareDNSResponses does not modify the records of the responses.
+func TestCompareDNSResponsesPreservesRecords(t *testing.T) {
+	a := newTestDNSCompareResponse(300, "8.8.8.8")
+
+	CompareDNSResponses(a, a)
+
+	assert.Equal(t, uint32(300), a.ValidRRs[0].Header().Ttl)
+}
+
+// Log emits dnsAnswersAgree and, on disagreement, the differing records.
+func TestDNSComparisonLog(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("agree", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		cmp := CompareDNSResponses(newTestDNSCompareResponse(300, "8.8.8.8"), newTestDNSCompareResponse(60, "8.8.8.8"))
+
+		cmp.Log(logger, t0)
+
+		require.Len(t, *records, 1)
+		assert.Equal(t, "dnsCompareResponses", (*records)[0].Message)
+		value, found := findAttr((*records)[0], "dnsAnswersAgree")
+		require.True(t, found)
+		assert.True(t, value.Bool())
+		value, found = findAttr((*records)[0], "t")
+		require.True(t, found)
+		assert.Equal(t, t0, value.Time())
+		_, found = findAttr((*records)[0], "dnsAnswersOnlyInA")
+		assert.False(t, found)
+		_, found = findAttr((*records)[0], "dnsAnswersOnlyInB")
+		assert.False(t, found)
+	})
+
+	t.Run("disagree", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		cmp := CompareDNSResponses(newTestDNSCompareResponse(300, "8.8.8.8"), newTestDNSCompareResponse(300, "10.10.34.35"))
+
+		cmp.Log(logger, t0)
+
+		require.Len(t, *records, 1)
+		value, found := findAttr((*records)[0], "dnsAnswersAgree")
+		require.True(t, found)
+		assert.False(t, value.Bool())
+		value, found = findAttr((*records)[0], "dnsAnswersOnlyInA")
+		require.True(t, found)
+		assert.Equal(t, []string{"example.com.\t0\tIN\tA\t8.8.8.8"}, value.Any())
+		value, found = findAttr((*records)[0], "dnsAnswersOnlyInB")
+		require.True(t, found)
+		assert.Equal(t, []string{"example.com.\t0\tIN\tA\t10.10.34.35"}, value.Any())
+	})
+}
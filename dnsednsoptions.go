@@ -0,0 +1,200 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverstream"
+	"github.com/bassosimone/minest"
+	"github.com/miekg/dns"
+)
+
+// errDNSQueryTooLarge indicates that a query with extra EDNS options does
+// not fit into the 2-byte length prefix of DNS-over-TCP and DNS-over-TLS.
+var errDNSQueryTooLarge = errors.New("nop: DNS query too large")
+
+// dnsAddEDNSOptions adds the given EDNS options to the OPT record of the
+// given query message. When the query has no OPT record, we add one
+// advertising the default size.
+//
+// When the query is padded (RFC 8467), we remove the padding, add the
+// options, and pad again, so that the padded length accounts for them.
+func dnsAddEDNSOptions(msg *dns.Msg, options []dns.EDNS0) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		msg.SetEdns0(dns.DefaultMsgSize, false)
+		opt = msg.IsEdns0()
+	}
+	var (
+		existing []dns.EDNS0
+		padded   bool
+	)
+	for _, option := range opt.Option {
+		if _, ok := option.(*dns.EDNS0_PADDING); ok {
+			padded = true
+			continue
+		}
+		existing = append(existing, option)
+	}
+	opt.Option = append(existing, options...)
+	if padded {
+		// Same as [*dnscodec.Query.NewMsg]: pad to the closest multiple of
+		// 128 octets, accounting for the 4 octets of the option header.
+		const desiredSize = 128
+		remainder := (desiredSize - uint16(msg.Len()+4)) % desiredSize
+		opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, remainder)})
+	}
+}
+
+// dnsExtraEDNSOptionsAttrs returns the dnsExchangeStart attributes
+// describing the extra EDNS options, or nil when there are none.
+//
+// We log the option codes as dnsExtraEdnsOptions, in order.
+func dnsExtraEDNSOptionsAttrs(options []dns.EDNS0) []any {
+	if len(options) <= 0 {
+		return nil
+	}
+	codes := make([]int, 0, len(options))
+	for _, option := range options {
+		codes = append(codes, int(option.Option()))
+	}
+	return []any{slog.Any("dnsExtraEdnsOptions", codes)}
+}
+
+// dnsSendQueryUDP is like [*minest.DNSOverUDPTransport.SendQuery] but adds
+// the given EDNS options to the query message when creating it. Without
+// options, it defers to the transport.
+//
+// Like the transport, we invoke txp.ObserveRawQuery, if not nil, with a
+// copy of the raw query including the options.
+//
+// This function forks SendQuery in the dnsoverudp.go file of the
+// github.com/bassosimone/minest module, because the transport does not
+// allow adding EDNS options. Keep it in sync when updating the module.
+func dnsSendQueryUDP(ctx context.Context, txp *minest.DNSOverUDPTransport,
+	conn net.Conn, query *dnscodec.Query, options []dns.EDNS0) (*dns.Msg, error) {
+	// 1. Without options, defer to the transport
+	if len(options) <= 0 {
+		return txp.SendQuery(ctx, conn, query)
+	}
+
+	// 2. Use the context deadline to limit the lifetime
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// 3. Mutate and serialize the query including the options
+	query = query.Clone()
+	query.MaxSize = dnscodec.QueryMaxResponseSizeUDP
+	queryMsg, rawQuery, err := dnsNewQueryWithEDNSOptions(query, options)
+	if err != nil {
+		return nil, err
+	}
+	if txp.ObserveRawQuery != nil {
+		txp.ObserveRawQuery(bytes.Clone(rawQuery))
+	}
+
+	// 4. Send the query
+	if _, err := conn.Write(rawQuery); err != nil {
+		return nil, err
+	}
+	return queryMsg, nil
+}
+
+// dnsExchangeStream is like [*dnsoverstream.Transport.ExchangeWithStreamOpener]
+// for a stream opener wrapping conn, which must be a DNS-over-TCP or
+// DNS-over-TLS connection, but adds the given EDNS options to the query
+// message when creating it. Without options, it defers to the transport.
+//
+// Like the transport, we invoke the txp.ObserveRawQuery and
+// txp.ObserveRawResponse observers, if not nil, with a copy of the raw query
+// including the options and of the raw response, respectively.
+//
+// This function forks ExchangeWithStreamOpener in the stream.go file of the
+// github.com/bassosimone/dnsoverstream module, because the transport does
+// not allow adding EDNS options. Keep it in sync when updating the module.
+func dnsExchangeStream(ctx context.Context, txp *dnsoverstream.Transport, so dnsoverstream.StreamOpener,
+	conn net.Conn, query *dnscodec.Query, options []dns.EDNS0) (*dnscodec.Response, error) {
+	// 1. Without options, defer to the transport
+	if len(options) <= 0 {
+		return txp.ExchangeWithStreamOpener(ctx, so, query)
+	}
+
+	// 2. Use the context deadline to limit the lifetime
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// 3. Mutate and serialize the query including the options
+	query = query.Clone()
+	so.MutateQuery(query)
+	queryMsg, rawQuery, err := dnsNewQueryWithEDNSOptions(query, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(rawQuery) > math.MaxUint16 {
+		return nil, errDNSQueryTooLarge
+	}
+	if txp.ObserveRawQuery != nil {
+		txp.ObserveRawQuery(bytes.Clone(rawQuery))
+	}
+
+	// 4. Send the length-prefixed query
+	frame := append([]byte{byte(len(rawQuery) >> 8), byte(len(rawQuery))}, rawQuery...)
+	if _, err := conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	// 5. Read the length-prefixed response
+	br := bufio.NewReader(conn)
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, err
+	}
+	length := int(header[0])<<8 | int(header[1])
+	if length > int(query.MaxSize) {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	rawResp := make([]byte, length)
+	if _, err := io.ReadFull(br, rawResp); err != nil {
+		return nil, err
+	}
+	if txp.ObserveRawResponse != nil {
+		txp.ObserveRawResponse(bytes.Clone(rawResp))
+	}
+
+	// 6. Parse the response
+	respMsg := new(dns.Msg)
+	if err := respMsg.Unpack(rawResp); err != nil {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	return dnscodec.ParseResponse(queryMsg, respMsg)
+}
+
+// dnsNewQueryWithEDNSOptions creates the query message including the
+// given EDNS options and returns it along with its serialization.
+func dnsNewQueryWithEDNSOptions(
+	query *dnscodec.Query, options []dns.EDNS0) (*dns.Msg, []byte, error) {
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, nil, err
+	}
+	dnsAddEDNSOptions(queryMsg, options)
+	rawQuery, err := queryMsg.Pack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return queryMsg, rawQuery, nil
+}
@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/tlsstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestExtraEDNSOptions returns EDNS options including an unknown code.
+func newTestExtraEDNSOptions() []dns.EDNS0 {
+	return []dns.EDNS0{
+		&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{0xde, 0xad, 0xbe, 0xef}},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+	}
+}
+
+// requireExtraEDNSOptions asserts that the query carries the options
+// returned by [newTestExtraEDNSOptions] after its existing options, except
+// for the padding, which must be the last option, if present.
+func requireExtraEDNSOptions(t *testing.T, query *dns.Msg) {
+	require.NotNil(t, query)
+	opt := query.IsEdns0()
+	require.NotNil(t, opt)
+	options := opt.Option
+	if len(options) > 0 {
+		if _, ok := options[len(options)-1].(*dns.EDNS0_PADDING); ok {
+			options = options[:len(options)-1]
+		}
+	}
+	require.True(t, len(options) >= 2)
+	options = options[len(options)-2:]
+	local, ok := options[0].(*dns.EDNS0_LOCAL)
+	require.True(t, ok)
+	assert.Equal(t, uint16(65001), local.Code)
+	assert.Equal(t, []byte{0xde, 0xad, 0xbe, 0xef}, local.Data)
+	cookie, ok := options[1].(*dns.EDNS0_COOKIE)
+	require.True(t, ok)
+	assert.Equal(t, "0102030405060708", cookie.Cookie)
+}
+
+// requireExtraEDNSOptionsLogged asserts that dnsExchangeStart lists the
+// option codes and that dnsQuery contains the query including the options.
+func requireExtraEDNSOptionsLogged(t *testing.T, records []slog.Record) {
+	var start, query *slog.Record
+	for idx := range records {
+		switch records[idx].Message {
+		case "dnsExchangeStart":
+			start = &records[idx]
+		case "dnsQuery":
+			query = &records[idx]
+		}
+	}
+	require.NotNil(t, start)
+	value, found := findAttr(*start, "dnsExtraEdnsOptions")
+	require.True(t, found)
+	assert.Equal(t, []int{65001, int(dns.EDNS0COOKIE)}, value.Any())
+
+	require.NotNil(t, query)
+	value, found = findAttr(*query, "dnsRawQuery")
+	require.True(t, found)
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(value.Any().([]byte)))
+	requireExtraEDNSOptions(t, msg)
+}
+
+// dnsAddEDNSOptions appends the options to an existing OPT record or adds one.
+func TestDNSAddEDNSOptions(t *testing.T) {
+	t.Run("existing OPT record", func(t *testing.T) {
+		msg := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+		msg.SetEdns0(1232, true)
+		msg.IsEdns0().Option = append(msg.IsEdns0().Option, &dns.EDNS0_COOKIE{
+			Code: dns.EDNS0COOKIE, Cookie: "0807060504030201"})
+
+		dnsAddEDNSOptions(msg, newTestExtraEDNSOptions())
+
+		requireExtraEDNSOptions(t, msg)
+		assert.Len(t, msg.IsEdns0().Option, 3)
+		assert.Equal(t, uint16(1232), msg.IsEdns0().UDPSize())
+		assert.True(t, msg.IsEdns0().Do())
+	})
+
+	t.Run("missing OPT record", func(t *testing.T) {
+		msg := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+
+		dnsAddEDNSOptions(msg, newTestExtraEDNSOptions())
+
+		requireExtraEDNSOptions(t, msg)
+		assert.Equal(t, uint16(dns.DefaultMsgSize), msg.IsEdns0().UDPSize())
+	})
+
+	t.Run("padded query", func(t *testing.T) {
+		query := dnscodec.NewQuery("example.com", dns.TypeA)
+		query.Flags |= dnscodec.QueryFlagBlockLengthPadding
+		msg := runtimex.PanicOnError1(query.NewMsg())
+
+		dnsAddEDNSOptions(msg, newTestExtraEDNSOptions())
+
+		requireExtraEDNSOptions(t, msg)
+		options := msg.IsEdns0().Option
+		require.Len(t, options, 3)
+		_, ok := options[2].(*dns.EDNS0_PADDING)
+		require.True(t, ok)
+		assert.Equal(t, 0, len(runtimex.PanicOnError1(msg.Pack()))%128)
+	})
+}
+
+// Without extra options, we do not log any attribute.
+func TestDNSExtraEDNSOptionsAttrsEmpty(t *testing.T) {
+	assert.Nil(t, dnsExtraEDNSOptionsAttrs(nil))
+}
+
+// DNSOverUDPConn encodes the extra options into the query.
+func TestDNSOverUDPConnExchangeExtraEDNSOptions(t *testing.T) {
+	var query *dns.Msg
+	mockConn := newDNSServerUDPConn(54321)
+	mockWrite := mockConn.WriteFunc
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return mockWrite(b)
+	}
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverUDPConnFunc(NewConfig(), logger)
+	fn.ExtraEDNSOptions = newTestExtraEDNSOptions()
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	requireExtraEDNSOptions(t, query)
+	requireExtraEDNSOptionsLogged(t, *records)
+}
+
+// DNSOverTCPConn encodes the extra options into the length-prefixed query.
+func TestDNSOverTCPConnExchangeExtraEDNSOptions(t *testing.T) {
+	var query *dns.Msg
+	mockConn := newDNSStreamServerConn(func(q *dns.Msg) *dns.Msg {
+		query = q
+		return newDNSResponse(q, "130.192.91.211")
+	})
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTCPConnFunc(NewConfig(), logger)
+	fn.ExtraEDNSOptions = newTestExtraEDNSOptions()
+	fn.LogLengthPrefix = true
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	requireExtraEDNSOptions(t, query)
+	requireExtraEDNSOptionsLogged(t, *records)
+
+	// The length prefix accounts for the extra options
+	for _, record := range *records {
+		if record.Message != "dnsTcpLengthPrefix" {
+			continue
+		}
+		prefix, found := findAttr(record, "dnsTcpLengthPrefixWritten")
+		require.True(t, found)
+		count, found := findAttr(record, "dnsTcpQueryBytes")
+		require.True(t, found)
+		assert.Equal(t, int64(query.Len()), prefix.Int64())
+		assert.Equal(t, prefix.Int64(), count.Int64())
+	}
+}
+
+// DNSOverTLSConn encodes the extra options into the length-prefixed query.
+func TestDNSOverTLSConnExchangeExtraEDNSOptions(t *testing.T) {
+	var query *dns.Msg
+	mockTLSConn := &tlsstub.FuncTLSConn{
+		FuncConn: newDNSStreamServerConn(func(q *dns.Msg) *dns.Msg {
+			query = q
+			return newDNSResponse(q, "130.192.91.211")
+		}),
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+	}
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTLSConnFunc(NewConfig(), logger)
+	fn.ExtraEDNSOptions = newTestExtraEDNSOptions()
+	conn, err := fn.Call(context.Background(), mockTLSConn)
+	require.NoError(t, err)
+
+	resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+	requireExtraEDNSOptions(t, query)
+	requireExtraEDNSOptionsLogged(t, *records)
+
+	// The padding accounts for the extra options
+	assert.Equal(t, 0, query.Len()%128)
+}
+
+// DNSOverHTTPSConn encodes the extra options into the query sent using POST or GET.
+func TestDNSOverHTTPSConnExchangeExtraEDNSOptions(t *testing.T) {
+	for _, useGET := range []bool{false, true} {
+		t.Run(map[bool]string{false: "POST", true: "GET"}[useGET], func(t *testing.T) {
+			var query *dns.Msg
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					var rawQuery []byte
+					if req.Method == http.MethodGet {
+						rawQuery = runtimex.PanicOnError1(
+							base64.RawURLEncoding.DecodeString(req.URL.Query().Get("dns")))
+					} else {
+						assert.Equal(t, "application/dns-message", req.Header.Get("Content-Type"))
+						rawQuery = runtimex.PanicOnError1(io.ReadAll(req.Body))
+						assert.Equal(t, int64(len(rawQuery)), req.ContentLength)
+					}
+					query = new(dns.Msg)
+					runtimex.PanicOnError0(query.Unpack(rawQuery))
+					rawResp := runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"application/dns-message"}},
+						Body:       io.NopCloser(bytes.NewReader(rawResp)),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        DefaultSLogger(),
+				TimeNow:       time.Now,
+			}
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverHTTPSConnFunc(NewConfig(), "https://dns.google/dns-query", logger)
+			fn.ExtraEDNSOptions = newTestExtraEDNSOptions()
+			fn.UseGET = useGET
+			conn, err := fn.Call(context.Background(), httpConn)
+			require.NoError(t, err)
+
+			resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+			requireExtraEDNSOptions(t, query)
+			requireExtraEDNSOptionsLogged(t, *records)
+		})
+	}
+}
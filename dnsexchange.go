@@ -3,8 +3,13 @@
 package nop
 
 import (
+	"errors"
 	"log/slog"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 // DNSExchangeLogContext holds common logging state for DNS exchanges.
@@ -21,6 +26,11 @@ import (
 // built-in exchange methods while driving [minest.DNSOverUDPTransport]
 // send/receive directly.
 type DNSExchangeLogContext struct {
+	// DecodeResponses enables decoding the last response observed via the
+	// observer returned by [DNSExchangeLogContext.MakeResponseObserver] to
+	// include decoded fields (e.g., dnsFlagRA) in the dnsExchangeDone event.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
@@ -41,25 +51,75 @@ type DNSExchangeLogContext struct {
 
 	// TimeNow is the function to get the current time.
 	TimeNow func() time.Time
+
+	// lastResponseTime is when the last response was observed.
+	lastResponseTime time.Time
+
+	// rawQuery is the last raw query observed.
+	rawQuery []byte
+
+	// rawResponse is the last raw response observed.
+	rawResponse []byte
 }
 
 // LogStart logs the start of a DNS exchange.
-func (lc *DNSExchangeLogContext) LogStart(t0 time.Time, deadline time.Time) {
-	lc.Logger.Info(
-		"dnsExchangeStart",
+//
+// The extra arguments are protocol-specific attributes (e.g., the
+// dohRequestMethod logged by [*DNSOverHTTPSConn]) appended to the event.
+//
+// This method also resets the state tracking the last observed query and
+// response, so the same context can be reused for several exchanges without
+// correlating the events of an exchange with the ones of the previous one.
+func (lc *DNSExchangeLogContext) LogStart(t0 time.Time, deadline time.Time, extra ...any) {
+	lc.lastResponseTime = time.Time{}
+	lc.rawQuery = nil
+	lc.rawResponse = nil
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.String("localAddr", lc.LocalAddr),
 		slog.String("protocol", lc.Protocol),
 		slog.String("remoteAddr", lc.RemoteAddr),
 		slog.String("serverProtocol", lc.ServerProtocol),
 		slog.Time("t", t0),
-	)
+	}
+	lc.Logger.Info("dnsExchangeStart", append(attrs, extra...)...)
 }
 
 // LogDone logs the completion of a DNS exchange.
-func (lc *DNSExchangeLogContext) LogDone(t0 time.Time, deadline time.Time, err error) {
-	lc.Logger.Info(
-		"dnsExchangeDone",
+//
+// When the protocol is "udp" and the error was caused by an ICMP error
+// message (host, network, or port unreachable), the dnsExchangeDone event
+// also includes the dnsIcmpError field describing the reason.
+//
+// When both a query and a response were observed, the event includes the
+// dnsIdMatched field indicating whether the ID of the last observed response
+// matches the one of the last observed query, which is the primary defense
+// against spoofed DNS-over-UDP responses (see [ErrDNSIdMismatch]).
+//
+// When DecodeResponses is true and a response was observed, the event also
+// includes these fields decoded from the last observed response:
+//
+//   - dnsFlagRA, dnsFlagAA, and dnsFlagAD: the Recursion Available,
+//     Authoritative Answer, and Authentic Data flags;
+//
+//   - dnsMinTTL: the minimum TTL of the answer section, which drives the
+//     lifetime of cached answers, or -1 when there are no answers;
+//
+//   - dnsResponseUsesCompression: whether the response uses name compression
+//     (see [dnsResponseUsesCompression]);
+//
+//   - dnsCnameChainLength and dnsFinalCname: the number of CNAME hops in
+//     the answer section and the canonical name at the end of the chain,
+//     which is the query name when there are no CNAME records
+//     (see [dnsCnameChain]);
+//
+//   - dnsEdnsVersion and dnsEdnsDO: the EDNS(0) version and DNSSEC OK bit
+//     of the OPT record, only when the response contains an OPT record.
+//
+// Like in [DNSExchangeLogContext.LogStart], the extra arguments are
+// protocol-specific attributes appended to the event.
+func (lc *DNSExchangeLogContext) LogDone(t0 time.Time, deadline time.Time, err error, extra ...any) {
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.Any("err", err),
 		slog.String("errClass", lc.ErrClassifier.Classify(err)),
@@ -69,25 +129,166 @@ func (lc *DNSExchangeLogContext) LogDone(t0 time.Time, deadline time.Time, err e
 		slog.String("serverProtocol", lc.ServerProtocol),
 		slog.Time("t0", t0),
 		slog.Time("t", lc.TimeNow()),
-	)
+	}
+	if reason := dnsICMPErrorReason(lc.Protocol, err); reason != "" {
+		attrs = append(attrs, slog.String("dnsIcmpError", reason))
+	}
+	if matched, ok := lc.idMatched(); ok {
+		attrs = append(attrs, slog.Bool("dnsIdMatched", matched))
+	}
+	if lc.DecodeResponses {
+		attrs = append(attrs, dnsDecodeResponseAttrs(lc.rawResponse)...)
+	}
+	lc.Logger.Info("dnsExchangeDone", append(attrs, extra...)...)
+}
+
+// idMatched returns whether the ID of the last observed response matches the
+// ID of the last observed query, and whether both have been observed.
+func (lc *DNSExchangeLogContext) idMatched() (matched bool, ok bool) {
+	if len(lc.rawQuery) < 2 || len(lc.rawResponse) < 2 {
+		return false, false
+	}
+	return lc.rawQuery[0] == lc.rawResponse[0] && lc.rawQuery[1] == lc.rawResponse[1], true
+}
+
+// dnsICMPErrorReason maps the error of a failed UDP exchange to the
+// ICMP error that most likely caused it, or returns an empty string.
+//
+// With connected UDP sockets, the kernel reports ICMP destination unreachable
+// messages as errors on subsequent I/O: port unreachable as ECONNREFUSED, and
+// host or network unreachable as EHOSTUNREACH or ENETUNREACH.
+func dnsICMPErrorReason(protocol string, err error) string {
+	if protocol != "udp" {
+		return ""
+	}
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "portUnreachable"
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return "hostUnreachable"
+	case errors.Is(err, syscall.ENETUNREACH):
+		return "networkUnreachable"
+	default:
+		return ""
+	}
+}
+
+// dnsDecodeResponseAttrs returns the attributes decoded from the given raw
+// response, or nil when there is no response or it cannot be parsed.
+func dnsDecodeResponseAttrs(rawResp []byte) []any {
+	if rawResp == nil {
+		return nil
+	}
+	msg := new(dns.Msg)
+	if err := msg.Unpack(rawResp); err != nil {
+		return nil
+	}
+	minTTL := int64(-1)
+	for _, rr := range msg.Answer {
+		if ttl := int64(rr.Header().Ttl); minTTL < 0 || ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+	cnameChainLength, finalCname := dnsCnameChain(msg)
+	attrs := []any{
+		slog.Int("dnsCnameChainLength", cnameChainLength),
+		slog.String("dnsFinalCname", finalCname),
+		slog.Bool("dnsFlagAA", msg.Authoritative),
+		slog.Bool("dnsFlagAD", msg.AuthenticatedData),
+		slog.Bool("dnsFlagRA", msg.RecursionAvailable),
+		slog.Int64("dnsMinTTL", minTTL),
+		slog.Bool("dnsResponseUsesCompression", dnsResponseUsesCompression(msg, rawResp)),
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		attrs = append(attrs,
+			slog.Bool("dnsEdnsDO", opt.Do()),
+			slog.Int("dnsEdnsVersion", int(opt.Version())),
+		)
+	}
+	return attrs
+}
+
+// dnsCnameChain follows the CNAME records in the answer section of msg
+// starting from the query name and returns the number of hops along with
+// the final canonical name. When the response has no question, it returns
+// zero and an empty string.
+//
+// Names are compared case-insensitively. The number of hops is bounded by
+// the number of answers, so CNAME loops cannot cause an infinite loop.
+func dnsCnameChain(msg *dns.Msg) (int, string) {
+	if len(msg.Question) < 1 {
+		return 0, ""
+	}
+	name, hops := msg.Question[0].Name, 0
+	for hops < len(msg.Answer) {
+		next := ""
+		for _, rr := range msg.Answer {
+			if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+				next = cname.Target
+				break
+			}
+		}
+		if next == "" {
+			break
+		}
+		name, hops = next, hops+1
+	}
+	return hops, name
+}
+
+// dnsResponseUsesCompression returns whether the raw response, which has been
+// parsed into msg, uses name compression pointers.
+//
+// Since parsing expands compressed names, we detect compression by checking
+// whether the uncompressed serialization of msg is longer than the raw response.
+func dnsResponseUsesCompression(msg *dns.Msg, rawResp []byte) bool {
+	msg = msg.Copy()
+	msg.Compress = false
+	return msg.Len() > len(rawResp)
 }
 
 // MakeQueryObserver returns an observer function for raw DNS queries.
 //
 // The rqr pointer is used to capture the raw query for correlation
 // with the response observer.
+//
+// The dnsQuery event includes the flags of the query actually sent, which is
+// useful to study how resolvers react to them: dnsQueryFlagRD (Recursion
+// Desired), dnsQueryFlagAD (Authenticated Data), dnsQueryFlagCD (Checking
+// Disabled), and dnsQueryFlagDO (DNSSEC OK, false without an OPT record).
+// The flags are omitted when the raw query cannot be parsed.
 func (lc *DNSExchangeLogContext) MakeQueryObserver(t0 time.Time, rqr *[]byte) func([]byte) {
 	return func(rawQuery []byte) {
-		lc.Logger.Info(
-			"dnsQuery",
+		attrs := []any{
 			slog.String("serverProtocol", lc.ServerProtocol),
 			slog.Any("dnsRawQuery", rawQuery),
 			slog.String("localAddr", lc.LocalAddr),
 			slog.String("protocol", lc.Protocol),
 			slog.String("remoteAddr", lc.RemoteAddr),
 			slog.Time("t", t0),
-		)
+		}
+		lc.Logger.Info("dnsQuery", append(attrs, dnsQueryFlagsAttrs(rawQuery)...)...)
 		*rqr = rawQuery
+		lc.rawQuery = rawQuery
+	}
+}
+
+// dnsQueryFlagsAttrs returns the dnsQuery attributes containing the flags
+// of the given raw query, or nil when the query cannot be parsed.
+func dnsQueryFlagsAttrs(rawQuery []byte) []any {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(rawQuery); err != nil {
+		return nil
+	}
+	var do bool
+	if opt := msg.IsEdns0(); opt != nil {
+		do = opt.Do()
+	}
+	return []any{
+		slog.Bool("dnsQueryFlagAD", msg.AuthenticatedData),
+		slog.Bool("dnsQueryFlagCD", msg.CheckingDisabled),
+		slog.Bool("dnsQueryFlagDO", do),
+		slog.Bool("dnsQueryFlagRD", msg.RecursionDesired),
 	}
 }
 
@@ -95,18 +296,30 @@ func (lc *DNSExchangeLogContext) MakeQueryObserver(t0 time.Time, rqr *[]byte) fu
 //
 // The rqr pointer should be the same one passed to [DNSExchangeLogContext.MakeQueryObserver],
 // allowing the response to be correlated with the original query.
+//
+// When the observer is invoked more than once (e.g., when collecting duplicate
+// DNS-over-UDP responses), each dnsResponse event after the first also includes
+// the dnsResponseInterarrivalMs field, which is the time elapsed since the
+// previous response was observed, in milliseconds.
 func (lc *DNSExchangeLogContext) MakeResponseObserver(t0 time.Time, rqr *[]byte) func([]byte) {
 	return func(rawResp []byte) {
-		lc.Logger.Info(
-			"dnsResponse",
+		t := lc.TimeNow()
+		attrs := []any{
 			slog.String("serverProtocol", lc.ServerProtocol),
 			slog.Any("dnsRawQuery", *rqr),
 			slog.String("localAddr", lc.LocalAddr),
 			slog.String("protocol", lc.Protocol),
 			slog.String("remoteAddr", lc.RemoteAddr),
 			slog.Time("t0", t0),
-			slog.Time("t", lc.TimeNow()),
+			slog.Time("t", t),
 			slog.Any("dnsRawResponse", rawResp),
-		)
+		}
+		if !lc.lastResponseTime.IsZero() {
+			interarrival := t.Sub(lc.lastResponseTime).Milliseconds()
+			attrs = append(attrs, slog.Int64("dnsResponseInterarrivalMs", interarrival))
+		}
+		lc.Logger.Info("dnsResponse", attrs...)
+		lc.lastResponseTime = t
+		lc.rawResponse = rawResp
 	}
 }
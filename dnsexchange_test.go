@@ -5,9 +5,13 @@ package nop
 import (
 	"errors"
 	"log/slog"
+	"net"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/bassosimone/runtimex"
+	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -127,3 +131,584 @@ func TestDNSExchangeLogContextMakeResponseObserver(t *testing.T) {
 	assert.Equal(t, rawQuery, gotQuery)
 	assert.Equal(t, rawResp, gotResp)
 }
+
+// makeResponseObserver includes dnsResponseInterarrivalMs in the events
+// following the first, measured from the previous response.
+func TestDNSExchangeLogContextMakeResponseObserverInterarrival(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	lc.TimeNow = func() time.Time { return now }
+
+	var rqr []byte
+	observer := lc.MakeResponseObserver(now, &rqr)
+	observer([]byte{0x01})
+	now = now.Add(15 * time.Millisecond)
+	observer([]byte{0x02})
+	now = now.Add(40 * time.Millisecond)
+	observer([]byte{0x03})
+
+	require.Len(t, *records, 3)
+	_, found := findAttr((*records)[0], "dnsResponseInterarrivalMs")
+	assert.False(t, found)
+	value, found := findAttr((*records)[1], "dnsResponseInterarrivalMs")
+	require.True(t, found)
+	assert.Equal(t, int64(15), value.Int64())
+	value, found = findAttr((*records)[2], "dnsResponseInterarrivalMs")
+	require.True(t, found)
+	assert.Equal(t, int64(40), value.Int64())
+}
+
+// LogStart resets the per-exchange state so a context can be reused.
+func TestDNSExchangeLogContextReusedAcrossExchanges(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+	lc.DecodeResponses = true
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	lc.TimeNow = func() time.Time { return now }
+
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeA)
+	rawQuery := runtimex.PanicOnError1(query.Pack())
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	rawResp := runtimex.PanicOnError1(resp.Pack())
+
+	// First exchange: observe both the query and the response
+	var rqr1 []byte
+	lc.LogStart(now, time.Time{})
+	lc.MakeQueryObserver(now, &rqr1)(rawQuery)
+	lc.MakeResponseObserver(now, &rqr1)(rawResp)
+	lc.LogDone(now, time.Time{}, nil)
+
+	// Second exchange: observe the response only, one second later
+	now = now.Add(time.Second)
+	var rqr2 []byte
+	lc.LogStart(now, time.Time{})
+	lc.MakeResponseObserver(now, &rqr2)(rawResp)
+	lc.LogDone(now, time.Time{}, errors.New("mocked error"))
+
+	// Third exchange: no response at all
+	lc.LogStart(now, time.Time{})
+	lc.LogDone(now, time.Time{}, errors.New("mocked error"))
+
+	require.Len(t, *records, 9)
+	_, found := findAttr((*records)[3], "dnsIdMatched")
+	assert.True(t, found)
+
+	second := (*records)[5]
+	require.Equal(t, "dnsResponse", second.Message)
+	_, found = findAttr(second, "dnsResponseInterarrivalMs")
+	assert.False(t, found)
+	_, found = findAttr((*records)[6], "dnsIdMatched")
+	assert.False(t, found)
+
+	third := (*records)[8]
+	require.Equal(t, "dnsExchangeDone", third.Message)
+	_, found = findAttr(third, "dnsFlagRA")
+	assert.False(t, found)
+}
+
+// logDone only reports dnsIcmpError for UDP exchanges.
+func TestDNSExchangeLogContextLogDoneICMPErrorOnlyForUDP(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+	lc.Protocol = "tcp"
+
+	lc.LogDone(time.Now(), time.Time{}, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNREFUSED})
+
+	require.Len(t, *records, 1)
+	_, found := findAttr((*records)[0], "dnsIcmpError")
+	assert.False(t, found)
+}
+
+// logDone detects ICMP errors from the error itself rather than from its class.
+func TestDNSExchangeLogContextLogDoneICMPErrorIgnoresClass(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+	lc.ErrClassifier = ErrClassifierFunc(func(err error) string { return "ECONNREFUSED" })
+	lc.Protocol = "udp"
+
+	lc.LogDone(time.Now(), time.Time{}, errors.New("connection refused"))
+
+	require.Len(t, *records, 1)
+	_, found := findAttr((*records)[0], "dnsIcmpError")
+	assert.False(t, found)
+}
+
+// logDone includes the decoded response flags when DecodeResponses is set.
+func TestDNSExchangeLogContextLogDoneDecodeResponses(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// mutate sets the flags of the crafted response.
+		mutate func(resp *dns.Msg)
+
+		// wantFlags maps each flag field to its expected value.
+		wantFlags map[string]bool
+	}{
+		{
+			name:      "no flags",
+			mutate:    func(resp *dns.Msg) {},
+			wantFlags: map[string]bool{"dnsFlagRA": false, "dnsFlagAA": false, "dnsFlagAD": false},
+		},
+
+		{
+			name:      "recursion available",
+			mutate:    func(resp *dns.Msg) { resp.RecursionAvailable = true },
+			wantFlags: map[string]bool{"dnsFlagRA": true, "dnsFlagAA": false, "dnsFlagAD": false},
+		},
+
+		{
+			name:      "authoritative answer",
+			mutate:    func(resp *dns.Msg) { resp.Authoritative = true },
+			wantFlags: map[string]bool{"dnsFlagRA": false, "dnsFlagAA": true, "dnsFlagAD": false},
+		},
+
+		{
+			name:      "authentic data",
+			mutate:    func(resp *dns.Msg) { resp.AuthenticatedData = true },
+			wantFlags: map[string]bool{"dnsFlagRA": false, "dnsFlagAA": false, "dnsFlagAD": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = true
+
+			resp := new(dns.Msg)
+			resp.SetReply(new(dns.Msg).SetQuestion("example.com.", dns.TypeA))
+			tt.mutate(resp)
+			var rqr []byte
+			lc.MakeResponseObserver(time.Now(), &rqr)(runtimex.PanicOnError1(resp.Pack()))
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			require.Len(t, *records, 2)
+			for key, want := range tt.wantFlags {
+				value, found := findAttr((*records)[1], key)
+				require.True(t, found, key)
+				assert.Equal(t, want, value.Bool(), key)
+			}
+		})
+	}
+}
+
+// logDone omits the decoded response flags when they are not available.
+func TestDNSExchangeLogContextLogDoneDecodeResponsesOmitted(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// decode is the value of DecodeResponses.
+		decode bool
+
+		// rawResp is the raw response to observe, if any.
+		rawResp []byte
+	}{
+		{name: "decoding disabled", decode: false, rawResp: newTestRawResponse()},
+		{name: "no response observed", decode: true, rawResp: nil},
+		{name: "unparseable response", decode: true, rawResp: []byte{0x00, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = tt.decode
+			if tt.rawResp != nil {
+				var rqr []byte
+				lc.MakeResponseObserver(time.Now(), &rqr)(tt.rawResp)
+			}
+
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			done := (*records)[len(*records)-1]
+			for _, key := range []string{"dnsFlagRA", "dnsFlagAA", "dnsFlagAD", "dnsResponseUsesCompression", "dnsCnameChainLength"} {
+				_, found := findAttr(done, key)
+				assert.False(t, found, key)
+			}
+		})
+	}
+}
+
+// newTestRawResponse returns a valid raw response with the RA flag set.
+func newTestRawResponse() []byte {
+	query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+	return runtimex.PanicOnError1(newDNSResponse(query).Pack())
+}
+
+// logDone includes the minimum answer TTL when DecodeResponses is set.
+func TestDNSExchangeLogContextLogDoneMinTTL(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// ttls contains the TTLs of the A records in the answer section.
+		ttls []uint32
+
+		// want is the expected dnsMinTTL value.
+		want int64
+	}{
+		{name: "several answers", ttls: []uint32{300, 60, 3600}, want: 60},
+		{name: "single answer", ttls: []uint32{86400}, want: 86400},
+		{name: "zero TTL", ttls: []uint32{300, 0}, want: 0},
+		{name: "empty answer section", ttls: nil, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = true
+
+			query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			resp := newDNSResponse(query)
+			for _, ttl := range tt.ttls {
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+					A:   net.IPv4(93, 184, 216, 34),
+				})
+			}
+			var rqr []byte
+			lc.MakeResponseObserver(time.Now(), &rqr)(runtimex.PanicOnError1(resp.Pack()))
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "dnsMinTTL")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.Int64())
+		})
+	}
+}
+
+// logDone includes the EDNS(0) version and DO bit when DecodeResponses is
+// set and the response contains an OPT record.
+func TestDNSExchangeLogContextLogDoneEDNS(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// mutate adds the OPT record, if any, to the crafted response.
+		mutate func(resp *dns.Msg)
+
+		// wantFound indicates whether we expect the EDNS fields.
+		wantFound bool
+
+		// wantVersion is the expected dnsEdnsVersion value.
+		wantVersion int64
+
+		// wantDO is the expected dnsEdnsDO value.
+		wantDO bool
+	}{
+		{
+			name:      "no OPT record",
+			mutate:    func(resp *dns.Msg) {},
+			wantFound: false,
+		},
+
+		{
+			name:        "OPT record without DO bit",
+			mutate:      func(resp *dns.Msg) { resp.SetEdns0(1232, false) },
+			wantFound:   true,
+			wantVersion: 0,
+			wantDO:      false,
+		},
+
+		{
+			name:        "OPT record with DO bit",
+			mutate:      func(resp *dns.Msg) { resp.SetEdns0(1232, true) },
+			wantFound:   true,
+			wantVersion: 0,
+			wantDO:      true,
+		},
+
+		{
+			name: "OPT record with nonzero version",
+			mutate: func(resp *dns.Msg) {
+				resp.SetEdns0(1232, true)
+				resp.IsEdns0().SetVersion(1)
+			},
+			wantFound:   true,
+			wantVersion: 1,
+			wantDO:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = true
+
+			query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			resp := newDNSResponse(query)
+			tt.mutate(resp)
+			var rqr []byte
+			lc.MakeResponseObserver(time.Now(), &rqr)(runtimex.PanicOnError1(resp.Pack()))
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			require.Len(t, *records, 2)
+			version, foundVersion := findAttr((*records)[1], "dnsEdnsVersion")
+			do, foundDO := findAttr((*records)[1], "dnsEdnsDO")
+			require.Equal(t, tt.wantFound, foundVersion)
+			require.Equal(t, tt.wantFound, foundDO)
+			if tt.wantFound {
+				assert.Equal(t, tt.wantVersion, version.Int64())
+				assert.Equal(t, tt.wantDO, do.Bool())
+			}
+		})
+	}
+}
+
+// logDone includes whether the response uses name compression when DecodeResponses is set.
+func TestDNSExchangeLogContextLogDoneCompression(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// compress indicates whether to pack the response using compression.
+		compress bool
+
+		// want is the expected dnsResponseUsesCompression value.
+		want bool
+	}{
+		{name: "compressed response", compress: true, want: true},
+		{name: "uncompressed response", compress: false, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = true
+
+			query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			resp := newDNSResponse(query, "93.184.216.34", "93.184.216.35")
+			resp.Compress = tt.compress
+			var rqr []byte
+			lc.MakeResponseObserver(time.Now(), &rqr)(runtimex.PanicOnError1(resp.Pack()))
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "dnsResponseUsesCompression")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.Bool())
+		})
+	}
+}
+
+// logDone includes dnsIdMatched only when both a query and a response were observed.
+func TestDNSExchangeLogContextLogDoneIDMatched(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// rawQuery is the raw query to observe, if any.
+		rawQuery []byte
+
+		// rawResp is the raw response to observe, if any.
+		rawResp []byte
+
+		// wantFound indicates whether we expect dnsIdMatched.
+		wantFound bool
+
+		// wantMatched is the expected dnsIdMatched value.
+		wantMatched bool
+	}{
+		{name: "matching IDs", rawQuery: []byte{0x12, 0x34, 0x01}, rawResp: []byte{0x12, 0x34, 0x81}, wantFound: true, wantMatched: true},
+		{name: "mismatched IDs", rawQuery: []byte{0x12, 0x34, 0x01}, rawResp: []byte{0x12, 0x35, 0x81}, wantFound: true, wantMatched: false},
+		{name: "no response", rawQuery: []byte{0x12, 0x34, 0x01}, rawResp: nil, wantFound: false},
+		{name: "no query", rawQuery: nil, rawResp: []byte{0x12, 0x34, 0x81}, wantFound: false},
+		{name: "truncated response", rawQuery: []byte{0x12, 0x34, 0x01}, rawResp: []byte{0x12}, wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			var rqr []byte
+			if tt.rawQuery != nil {
+				lc.MakeQueryObserver(time.Now(), &rqr)(tt.rawQuery)
+			}
+			if tt.rawResp != nil {
+				lc.MakeResponseObserver(time.Now(), &rqr)(tt.rawResp)
+			}
+
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			done := (*records)[len(*records)-1]
+			value, found := findAttr(done, "dnsIdMatched")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.wantMatched, value.Bool())
+			}
+		})
+	}
+}
+
+// logDone includes the CNAME chain length and final name when DecodeResponses is set.
+func TestDNSExchangeLogContextLogDoneCnameChain(t *testing.T) {
+	// cname returns a CNAME record from name to target.
+	cname := func(name, target string) dns.RR {
+		return &dns.CNAME{
+			Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+			Target: target,
+		}
+	}
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// cnames contains the CNAME records to prepend to the answer section.
+		cnames []dns.RR
+
+		// wantLength is the expected dnsCnameChainLength value.
+		wantLength int64
+
+		// wantFinal is the expected dnsFinalCname value.
+		wantFinal string
+	}{
+		{
+			name:       "no CNAME",
+			cnames:     nil,
+			wantLength: 0,
+			wantFinal:  "www.example.com.",
+		},
+
+		{
+			name: "multi-hop chain",
+			cnames: []dns.RR{
+				cname("www.example.com.", "www.example.com.cdn.net."),
+				cname("www.example.com.cdn.net.", "edge.cdn.net."),
+				cname("EDGE.cdn.net.", "e1.edge.cdn.net."),
+			},
+			wantLength: 3,
+			wantFinal:  "e1.edge.cdn.net.",
+		},
+
+		{
+			name: "out of order chain",
+			cnames: []dns.RR{
+				cname("alias.example.com.", "target.example.net."),
+				cname("www.example.com.", "alias.example.com."),
+			},
+			wantLength: 2,
+			wantFinal:  "target.example.net.",
+		},
+
+		{
+			name: "loop",
+			cnames: []dns.RR{
+				cname("www.example.com.", "alias.example.com."),
+				cname("alias.example.com.", "www.example.com."),
+			},
+			wantLength: 3,
+			wantFinal:  "alias.example.com.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			lc.DecodeResponses = true
+
+			query := new(dns.Msg).SetQuestion("www.example.com.", dns.TypeA)
+			resp := newDNSResponse(query, "93.184.216.34")
+			resp.Answer = append(tt.cnames, resp.Answer...)
+			var rqr []byte
+			lc.MakeResponseObserver(time.Now(), &rqr)(runtimex.PanicOnError1(resp.Pack()))
+			lc.LogDone(time.Now(), time.Time{}, nil)
+
+			require.Len(t, *records, 2)
+			length, found := findAttr((*records)[1], "dnsCnameChainLength")
+			require.True(t, found)
+			assert.Equal(t, tt.wantLength, length.Int64())
+			final, found := findAttr((*records)[1], "dnsFinalCname")
+			require.True(t, found)
+			assert.Equal(t, tt.wantFinal, final.String())
+		})
+	}
+}
+
+// MakeQueryObserver logs the flags of the query actually sent.
+func TestDNSExchangeLogContextMakeQueryObserverLogsFlags(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// newQuery returns the query to observe.
+		newQuery func() *dns.Msg
+
+		// want maps each flag field to its expected value.
+		want map[string]bool
+	}{
+		{
+			name: "recursion desired with DNSSEC",
+			newQuery: func() *dns.Msg {
+				query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+				query.RecursionDesired = true
+				query.CheckingDisabled = true
+				query.SetEdns0(1232, true)
+				return query
+			},
+			want: map[string]bool{
+				"dnsQueryFlagAD": false,
+				"dnsQueryFlagCD": true,
+				"dnsQueryFlagDO": true,
+				"dnsQueryFlagRD": true,
+			},
+		},
+
+		{
+			name: "iterative query without OPT record",
+			newQuery: func() *dns.Msg {
+				query := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+				query.RecursionDesired = false
+				query.AuthenticatedData = true
+				return query
+			},
+			want: map[string]bool{
+				"dnsQueryFlagAD": true,
+				"dnsQueryFlagCD": false,
+				"dnsQueryFlagDO": false,
+				"dnsQueryFlagRD": false,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			lc := newTestLogContext(logger)
+			var rqr []byte
+
+			lc.MakeQueryObserver(time.Now(), &rqr)(runtimex.PanicOnError1(tt.newQuery().Pack()))
+
+			require.Len(t, *records, 1)
+			require.Equal(t, "dnsQuery", (*records)[0].Message)
+			for key, want := range tt.want {
+				value, found := findAttr((*records)[0], key)
+				require.True(t, found, key)
+				assert.Equal(t, want, value.Bool(), key)
+			}
+		})
+	}
+}
+
+// MakeQueryObserver omits the flags when the raw query cannot be parsed.
+func TestDNSExchangeLogContextMakeQueryObserverInvalidQuery(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+	var rqr []byte
+
+	lc.MakeQueryObserver(time.Now(), &rqr)([]byte{0x00})
+
+	require.Len(t, *records, 1)
+	_, found := findAttr((*records)[0], "dnsQueryFlagRD")
+	assert.False(t, found)
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"log/slog"
+	"net"
+	"time"
+)
+
+// dnsLengthPrefixConn wraps a [net.Conn] used by a single DNS-over-TCP or
+// DNS-over-TLS exchange to record the 2-byte length prefixes it writes and
+// reads along with the number of message bytes following each prefix.
+//
+// This assumes that the exchange writes the whole frame using a single
+// Write call, which is how [dnsoverstream.Transport] sends queries.
+type dnsLengthPrefixConn struct {
+	net.Conn
+
+	// written contains the first two bytes written.
+	written []byte
+
+	// writtenBytes is the number of bytes written after the prefix.
+	writtenBytes int
+
+	// read contains the first two bytes read.
+	read []byte
+
+	// readBytes is the number of bytes read after the prefix.
+	readBytes int
+}
+
+// Write implements [net.Conn].
+func (c *dnsLengthPrefixConn) Write(b []byte) (int, error) {
+	count, err := c.Conn.Write(b)
+	c.written, c.writtenBytes = dnsLengthPrefixAccount(c.written, c.writtenBytes, b[:max(count, 0)])
+	return count, err
+}
+
+// Read implements [net.Conn].
+func (c *dnsLengthPrefixConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	c.read, c.readBytes = dnsLengthPrefixAccount(c.read, c.readBytes, b[:max(count, 0)])
+	return count, err
+}
+
+// dnsLengthPrefixAccount accounts for the given data, filling the prefix first
+// and then counting the remaining bytes as message bytes.
+func dnsLengthPrefixAccount(prefix []byte, count int, data []byte) ([]byte, int) {
+	if need := 2 - len(prefix); need > 0 {
+		need = min(need, len(data))
+		prefix = append(prefix, data[:need]...)
+		data = data[need:]
+	}
+	return prefix, count + len(data)
+}
+
+// logDNSLengthPrefix emits the dnsTcpLengthPrefix event.
+//
+// The dnsTcpLengthPrefixWritten and dnsTcpLengthPrefixRead fields contain the
+// value of the prefixes and are omitted when the exchange did not write or read
+// a complete prefix. The dnsTcpQueryBytes and dnsTcpResponseBytes fields contain
+// the number of bytes actually written and read after each prefix, such that
+// a prefix that disagrees with the message length is visible.
+func (c *dnsLengthPrefixConn) logDNSLengthPrefix(lc *DNSExchangeLogContext, t0 time.Time) {
+	attrs := []any{
+		slog.String("localAddr", lc.LocalAddr),
+		slog.String("protocol", lc.Protocol),
+		slog.String("remoteAddr", lc.RemoteAddr),
+		slog.String("serverProtocol", lc.ServerProtocol),
+		slog.Time("t0", t0),
+		slog.Time("t", lc.TimeNow()),
+	}
+	if len(c.written) == 2 {
+		attrs = append(attrs,
+			slog.Int("dnsTcpLengthPrefixWritten", int(c.written[0])<<8|int(c.written[1])),
+			slog.Int("dnsTcpQueryBytes", c.writtenBytes),
+		)
+	}
+	if len(c.read) == 2 {
+		attrs = append(attrs,
+			slog.Int("dnsTcpLengthPrefixRead", int(c.read[0])<<8|int(c.read[1])),
+			slog.Int("dnsTcpResponseBytes", c.readBytes),
+		)
+	}
+	lc.Logger.Info("dnsTcpLengthPrefix", attrs...)
+}
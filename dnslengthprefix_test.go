@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/tlsstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDNSMisframedServerConn is like [newDNSStreamServerConn] except that the
+// length prefix of the response is the actual length plus delta.
+func newDNSMisframedServerConn(delta int) *netstub.FuncConn {
+	var pending bytes.Buffer
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query := new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b[2:]))
+		rawResp := runtimex.PanicOnError1(newDNSResponse(query, "93.184.216.34").Pack())
+		prefix := len(rawResp) + delta
+		pending.Write([]byte{byte(prefix >> 8), byte(prefix)})
+		pending.Write(rawResp)
+		return len(b), nil
+	}
+	conn.ReadFunc = pending.Read
+	conn.CloseFunc = func() error { return nil }
+	return conn
+}
+
+// Exchange logs the length prefixes when LogLengthPrefix is enabled.
+func TestDNSOverTCPConnExchangeLogLengthPrefix(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// delta is added to the response length to compute the prefix.
+		delta int
+
+		// wantErr indicates whether we expect the exchange to fail.
+		wantErr bool
+	}{
+		{name: "prefix matching the payload", delta: 0, wantErr: false},
+		{name: "prefix larger than the payload", delta: 10, wantErr: true},
+		{name: "prefix smaller than the payload", delta: -10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverTCPConnFunc(NewConfig(), logger)
+			fn.LogLengthPrefix = true
+			conn := runtimex.PanicOnError1(fn.Call(context.Background(), newDNSMisframedServerConn(tt.delta)))
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			_, err := conn.Exchange(context.Background(), query)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			record, found := findRecord(*records, "dnsTcpLengthPrefix")
+			require.True(t, found)
+
+			written, found := findAttr(record, "dnsTcpLengthPrefixWritten")
+			require.True(t, found)
+			queryBytes, found := findAttr(record, "dnsTcpQueryBytes")
+			require.True(t, found)
+			assert.Equal(t, written.Int64(), queryBytes.Int64())
+
+			read, found := findAttr(record, "dnsTcpLengthPrefixRead")
+			require.True(t, found)
+			responseBytes, found := findAttr(record, "dnsTcpResponseBytes")
+			require.True(t, found)
+			assert.Equal(t, int64(tt.delta), read.Int64()-responseBytes.Int64())
+		})
+	}
+}
+
+// Exchange omits the length prefixes event by default.
+func TestDNSOverTCPConnExchangeNoLengthPrefixByDefault(t *testing.T) {
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTCPConnFunc(NewConfig(), logger)
+	conn := runtimex.PanicOnError1(fn.Call(context.Background(), newDNSMisframedServerConn(0)))
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	_, err := conn.Exchange(context.Background(), query)
+
+	require.NoError(t, err)
+	_, found := findRecord(*records, "dnsTcpLengthPrefix")
+	assert.False(t, found)
+}
+
+// Exchange logs the length prefixes over TLS when LogLengthPrefix is enabled.
+func TestDNSOverTLSConnExchangeLogLengthPrefix(t *testing.T) {
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTLSConnFunc(NewConfig(), logger)
+	fn.LogLengthPrefix = true
+	mockTLSConn := &tlsstub.FuncTLSConn{
+		FuncConn: newDNSMisframedServerConn(10),
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+	conn := runtimex.PanicOnError1(fn.Call(context.Background(), mockTLSConn))
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	_, err := conn.Exchange(context.Background(), query)
+
+	require.Error(t, err)
+	record, found := findRecord(*records, "dnsTcpLengthPrefix")
+	require.True(t, found)
+	read, found := findAttr(record, "dnsTcpLengthPrefixRead")
+	require.True(t, found)
+	responseBytes, found := findAttr(record, "dnsTcpResponseBytes")
+	require.True(t, found)
+	assert.Equal(t, int64(10), read.Int64()-responseBytes.Int64())
+}
@@ -3,12 +3,19 @@
 package nop
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/dnsoverhttps"
 	"github.com/bassosimone/safeconn"
+	"github.com/miekg/dns"
 )
 
 // DNSOverHTTPSConn wraps an HTTPConn for DNS-over-HTTPS exchanges.
@@ -27,14 +34,25 @@ type DNSOverHTTPSConn struct {
 	// url is the DoH endpoint URL.
 	url string
 
+	// DecodeResponses enables logging fields decoded from the
+	// response (e.g., dnsFlagRA) in the dnsExchangeDone event.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains the EDNS options to add
+	// to the OPT record of each query.
+	ExtraEDNSOptions []dns.EDNS0
+
 	// Logger is the SLogger to use.
 	Logger SLogger
 
 	// TimeNow is the function to get the current time.
 	TimeNow func() time.Time
+
+	// UseGET enables sending queries using GET rather than POST.
+	UseGET bool
 }
 
 // Close closes the underlying HTTPConn.
@@ -49,6 +67,11 @@ func (c *DNSOverHTTPSConn) HTTPConn() *HTTPConn {
 
 // Exchange performs a DNS exchange over HTTPS.
 // This method may be called multiple times on the same connection.
+//
+// When the HTTP transport reports obtaining a connection for the request
+// through the [httptrace.ClientTrace] GotConn hook, the dnsExchangeDone
+// event includes dohConnectionReused, indicating whether the connection
+// was reused from a previous exchange, which allows validating keep-alive.
 func (c *DNSOverHTTPSConn) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
 	// 1. Get the owned HTTPConn and underlying connection for logging
 	hc := c.httpConn
@@ -59,36 +82,160 @@ func (c *DNSOverHTTPSConn) Exchange(ctx context.Context, query *dnscodec.Query)
 	deadline, _ := ctx.Deadline()
 	var rqr []byte
 	lc := &DNSExchangeLogContext{
-		ErrClassifier:  c.ErrClassifier,
-		LocalAddr:      safeconn.LocalAddr(conn),
-		Logger:         c.Logger,
-		Protocol:       safeconn.Network(conn),
-		RemoteAddr:     safeconn.RemoteAddr(conn),
-		ServerProtocol: "doh",
-		TimeNow:        c.TimeNow,
+		DecodeResponses: c.DecodeResponses,
+		ErrClassifier:   c.ErrClassifier,
+		LocalAddr:       connLocalAddr(conn),
+		Logger:          c.Logger,
+		Protocol:        safeconn.Network(conn),
+		RemoteAddr:      connRemoteAddr(conn),
+		ServerProtocol:  "doh",
+		TimeNow:         c.TimeNow,
 	}
 
 	// 3. Create the HTTP request and the query message
-	lc.LogStart(t0, deadline)
-	httpReq, queryMsg, err := dnsoverhttps.NewRequestWithHook(ctx, query, c.url, lc.MakeQueryObserver(t0, &rqr))
+	//
+	// We log dnsExchangeStart after creating the request, so that it can
+	// describe the request, and then we log the dnsQuery event.
+	httpReq, queryMsg, err := c.newRequest(ctx, query, &rqr)
 	if err != nil {
+		lc.LogStart(t0, deadline)
 		lc.LogDone(t0, deadline, err)
 		return nil, err
 	}
+	lc.LogStart(t0, deadline, append(dnsDoHRequestAttrs(httpReq), dnsExtraEDNSOptionsAttrs(c.ExtraEDNSOptions)...)...)
+	lc.MakeQueryObserver(t0, &rqr)(rqr)
 
-	// 4. Perform the HTTP round trip
+	// 4. Perform the HTTP round trip tracing connection reuse
+	httpReq, connReuse := dnsDoHTraceConnReuse(httpReq)
 	httpResp, err := hc.RoundTrip(httpReq)
 	if err != nil {
-		lc.LogDone(t0, deadline, err)
+		lc.LogDone(t0, deadline, err, connReuse.attrs()...)
 		return nil, err
 	}
 
 	// 5. Read the response and validate it
 	resp, err := dnsoverhttps.ReadResponseWithHook(ctx, httpResp, queryMsg, lc.MakeResponseObserver(t0, &rqr))
-	lc.LogDone(t0, deadline, err)
+	lc.LogDone(t0, deadline, err, connReuse.attrs()...)
 	return resp, err
 }
 
+// dnsDoHConnReuse records whether the HTTP transport reused a connection.
+type dnsDoHConnReuse struct {
+	// gotConn indicates whether the transport reported obtaining a connection.
+	gotConn bool
+
+	// reused indicates whether the connection was previously used.
+	reused bool
+}
+
+// dnsDoHTraceConnReuse returns a copy of httpReq whose context carries an
+// [*httptrace.ClientTrace] recording, via the GotConn hook, whether the
+// transport reused a connection for the request.
+func dnsDoHTraceConnReuse(httpReq *http.Request) (*http.Request, *dnsDoHConnReuse) {
+	connReuse := &dnsDoHConnReuse{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connReuse.gotConn = true
+			connReuse.reused = info.Reused
+		},
+	}
+	return httpReq.WithContext(httptrace.WithClientTrace(httpReq.Context(), trace)), connReuse
+}
+
+// attrs returns the dnsExchangeDone attributes describing connection
+// reuse, or nil when the transport did not report obtaining a connection.
+func (cr *dnsDoHConnReuse) attrs() []any {
+	if !cr.gotConn {
+		return nil
+	}
+	return []any{slog.Bool("dohConnectionReused", cr.reused)}
+}
+
+// newRequest creates the HTTP request for the given query using POST or,
+// when UseGET is true, GET with the base64url-encoded query in the dns
+// parameter as described by RFC 8484. It saves the raw query, including
+// the ExtraEDNSOptions, if any, into rqr.
+func (c *DNSOverHTTPSConn) newRequest(
+	ctx context.Context, query *dnscodec.Query, rqr *[]byte) (*http.Request, *dns.Msg, error) {
+	saveQuery := func(rawQuery []byte) { *rqr = rawQuery }
+	httpReq, queryMsg, err := dnsoverhttps.NewRequestWithHook(ctx, query, c.url, saveQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(c.ExtraEDNSOptions) > 0 {
+		dnsAddEDNSOptions(queryMsg, c.ExtraEDNSOptions)
+		if *rqr, err = queryMsg.Pack(); err != nil {
+			return nil, nil, err
+		}
+		if !c.UseGET {
+			header := httpReq.Header.Clone()
+			httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, httpReq.URL.String(), bytes.NewReader(*rqr))
+			if err != nil {
+				return nil, nil, err
+			}
+			httpReq.Header = header
+		}
+	}
+	if !c.UseGET {
+		return httpReq, queryMsg, nil
+	}
+	URL := *httpReq.URL
+	params := URL.Query()
+	params.Set("dns", base64.RawURLEncoding.EncodeToString(*rqr))
+	URL.RawQuery = params.Encode()
+	httpReq, err = http.NewRequestWithContext(ctx, http.MethodGet, URL.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Accept", "application/dns-message")
+	return httpReq, queryMsg, nil
+}
+
+// dnsDoHRequestAttrs returns the dnsExchangeStart attributes describing
+// the given DNS-over-HTTPS request.
+//
+// For POST, the attributes include dohRequestContentLength, the declared
+// Content-Length, and dohRequestBodyLength, the actual length of the body,
+// along with dohContentLengthMismatch when they disagree, since a wrong
+// Content-Length breaks some servers.
+func dnsDoHRequestAttrs(httpReq *http.Request) []any {
+	attrs := []any{
+		slog.String("dohRequestMethod", httpReq.Method),
+		slog.String("dohRequestPath", httpReq.URL.EscapedPath()),
+	}
+	if httpReq.Method == http.MethodGet {
+		attrs = append(attrs, slog.Int("dohGetParamLength", len(httpReq.URL.Query().Get("dns"))))
+	}
+	if httpReq.Method == http.MethodPost {
+		attrs = append(attrs, slog.Int64("dohRequestContentLength", httpReq.ContentLength))
+		if bodyLength, ok := dnsDoHRequestBodyLength(httpReq); ok {
+			attrs = append(attrs, slog.Int64("dohRequestBodyLength", bodyLength))
+			if bodyLength != httpReq.ContentLength {
+				attrs = append(attrs, slog.Bool("dohContentLengthMismatch", true))
+			}
+		}
+	}
+	return attrs
+}
+
+// dnsDoHRequestBodyLength returns the length of the request body, which it
+// reads from a copy obtained using GetBody, so that the request is not consumed.
+func dnsDoHRequestBodyLength(httpReq *http.Request) (int64, bool) {
+	if httpReq.GetBody == nil {
+		return 0, false
+	}
+	body, err := httpReq.GetBody()
+	if err != nil {
+		return 0, false
+	}
+	defer body.Close()
+	count, err := io.Copy(io.Discard, body)
+	if err != nil {
+		return 0, false
+	}
+	return count, true
+}
+
 // DNSOverHTTPSConnFunc wraps an *HTTPConn into a [*DNSOverHTTPSConn].
 //
 // This is a [Func] that can be composed into pipelines.
@@ -101,11 +248,26 @@ type DNSOverHTTPSConnFunc struct {
 	// Set by [NewDNSOverHTTPSConnFunc] to the user-provided value.
 	URL string
 
+	// DecodeResponses enables logging fields decoded from the response
+	// in the dnsExchangeDone event (see [DNSExchangeLogContext.LogDone]).
+	//
+	// Set by [NewDNSOverHTTPSConnFunc] to false.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	//
 	// Set by [NewDNSOverHTTPSConnFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains arbitrary EDNS options, including options
+	// using unknown codes, to add to the OPT record of each query, which is
+	// useful for robustness testing of resolvers. When not empty, the
+	// dnsExchangeStart event lists their codes as dnsExtraEdnsOptions and
+	// the dnsQuery event contains the query including them.
+	//
+	// Set by [NewDNSOverHTTPSConnFunc] to nil.
+	ExtraEDNSOptions []dns.EDNS0
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewDNSOverHTTPSConnFunc] to the user-provided logger.
@@ -115,6 +277,17 @@ type DNSOverHTTPSConnFunc struct {
 	//
 	// Set by [NewDNSOverHTTPSConnFunc] from [Config.TimeNow].
 	TimeNow func() time.Time
+
+	// UseGET enables sending queries using GET with the base64url-encoded
+	// query in the dns URL parameter, rather than using POST with the query
+	// in the request body (see RFC 8484 Section 4.1). In both cases, the
+	// dnsExchangeStart event includes dohRequestMethod and dohRequestPath and,
+	// for GET, dohGetParamLength, the length of the dns parameter, while, for
+	// POST, dohRequestContentLength and dohRequestBodyLength, along with
+	// dohContentLengthMismatch when they disagree.
+	//
+	// Set by [NewDNSOverHTTPSConnFunc] to false.
+	UseGET bool
 }
 
 // NewDNSOverHTTPSConnFunc returns a new [*DNSOverHTTPSConnFunc].
@@ -138,10 +311,13 @@ var _ Func[*HTTPConn, *DNSOverHTTPSConn] = &DNSOverHTTPSConnFunc{}
 // Call wraps the HTTPConn into a DNSOverHTTPSConn.
 func (op *DNSOverHTTPSConnFunc) Call(ctx context.Context, httpConn *HTTPConn) (*DNSOverHTTPSConn, error) {
 	return &DNSOverHTTPSConn{
-		httpConn:      httpConn,
-		url:           op.URL,
-		ErrClassifier: op.ErrClassifier,
-		Logger:        op.Logger,
-		TimeNow:       op.TimeNow,
+		httpConn:         httpConn,
+		url:              op.URL,
+		DecodeResponses:  op.DecodeResponses,
+		ErrClassifier:    op.ErrClassifier,
+		ExtraEDNSOptions: op.ExtraEDNSOptions,
+		Logger:           op.Logger,
+		TimeNow:          op.TimeNow,
+		UseGET:           op.UseGET,
 	}, nil
 }
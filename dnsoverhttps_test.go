@@ -3,13 +3,18 @@
 package nop
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
+	"io"
 	"net/http"
+	"net/http/httptrace"
 	"testing"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/runtimex"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -138,3 +143,242 @@ func TestDNSOverHTTPSConnExchangeInvalidURL(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+// Exchange logs the request method and path on dnsExchangeStart and
+// encodes the query according to the configured method.
+func TestDNSOverHTTPSConnExchangeRequestMethod(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// useGET is the value of UseGET.
+		useGET bool
+
+		// wantMethod is the expected dohRequestMethod value.
+		wantMethod string
+	}{
+		{name: "POST", useGET: false, wantMethod: http.MethodPost},
+		{name: "GET", useGET: true, wantMethod: http.MethodGet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotParam string
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					var rawQuery []byte
+					if req.Method == http.MethodGet {
+						gotParam = req.URL.Query().Get("dns")
+						rawQuery = runtimex.PanicOnError1(base64.RawURLEncoding.DecodeString(gotParam))
+					} else {
+						rawQuery = runtimex.PanicOnError1(io.ReadAll(req.Body))
+					}
+					query := new(dns.Msg)
+					runtimex.PanicOnError0(query.Unpack(rawQuery))
+					rawResp := runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"application/dns-message"}},
+						Body:       io.NopCloser(bytes.NewReader(rawResp)),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        DefaultSLogger(),
+				TimeNow:       time.Now,
+			}
+
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverHTTPSConnFunc(NewConfig(), "https://dns.google/dns-query?ct=x", logger)
+			fn.UseGET = tt.useGET
+			result, err := fn.Call(context.Background(), httpConn)
+			require.NoError(t, err)
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			resp, err := result.Exchange(context.Background(), query)
+			require.NoError(t, err)
+			addrs, err := resp.RecordsA()
+			require.NoError(t, err)
+			assert.Equal(t, []string{"130.192.91.211"}, addrs)
+
+			require.True(t, len(*records) >= 2)
+			start := (*records)[0]
+			require.Equal(t, "dnsExchangeStart", start.Message)
+			assert.Equal(t, "dnsQuery", (*records)[1].Message)
+			method, found := findAttr(start, "dohRequestMethod")
+			require.True(t, found)
+			assert.Equal(t, tt.wantMethod, method.String())
+			path, found := findAttr(start, "dohRequestPath")
+			require.True(t, found)
+			assert.Equal(t, "/dns-query", path.String())
+			length, found := findAttr(start, "dohGetParamLength")
+			if !tt.useGET {
+				assert.False(t, found)
+				return
+			}
+			require.True(t, found)
+			assert.NotEmpty(t, gotParam)
+			assert.Equal(t, int64(len(gotParam)), length.Int64())
+		})
+	}
+}
+
+// Exchange sends POST requests with a Content-Length matching the body and
+// logs both lengths on dnsExchangeStart, including with extra EDNS options.
+func TestDNSOverHTTPSConnExchangeContentLength(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// extraEDNSOptions is the value of ExtraEDNSOptions.
+		extraEDNSOptions []dns.EDNS0
+	}{
+		{name: "plain query"},
+		{name: "extra EDNS options", extraEDNSOptions: newTestExtraEDNSOptions()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotContentLength, gotBodyLength int64
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					rawQuery := runtimex.PanicOnError1(io.ReadAll(req.Body))
+					gotContentLength, gotBodyLength = req.ContentLength, int64(len(rawQuery))
+					query := new(dns.Msg)
+					runtimex.PanicOnError0(query.Unpack(rawQuery))
+					rawResp := runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"application/dns-message"}},
+						Body:       io.NopCloser(bytes.NewReader(rawResp)),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        DefaultSLogger(),
+				TimeNow:       time.Now,
+			}
+
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverHTTPSConnFunc(NewConfig(), "https://dns.google/dns-query", logger)
+			fn.ExtraEDNSOptions = tt.extraEDNSOptions
+			result, err := fn.Call(context.Background(), httpConn)
+			require.NoError(t, err)
+
+			_, err = result.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+			require.NoError(t, err)
+
+			assert.Greater(t, gotBodyLength, int64(0))
+			assert.Equal(t, gotBodyLength, gotContentLength)
+			start, found := findRecord(*records, "dnsExchangeStart")
+			require.True(t, found)
+			contentLength, found := findAttr(start, "dohRequestContentLength")
+			require.True(t, found)
+			assert.Equal(t, gotContentLength, contentLength.Int64())
+			bodyLength, found := findAttr(start, "dohRequestBodyLength")
+			require.True(t, found)
+			assert.Equal(t, gotBodyLength, bodyLength.Int64())
+			_, found = findAttr(start, "dohContentLengthMismatch")
+			assert.False(t, found)
+		})
+	}
+}
+
+// dnsDoHRequestAttrs flags dohContentLengthMismatch when the declared
+// Content-Length disagrees with the body length.
+func TestDNSDoHRequestAttrsContentLengthMismatch(t *testing.T) {
+	httpReq := runtimex.PanicOnError1(http.NewRequest(
+		http.MethodPost, "https://dns.google/dns-query", bytes.NewReader(make([]byte, 33))))
+	httpReq.ContentLength = 44
+
+	logger, records := newCapturingLogger()
+	logger.Info("dnsExchangeStart", dnsDoHRequestAttrs(httpReq)...)
+
+	require.Len(t, *records, 1)
+	contentLength, _ := findAttr((*records)[0], "dohRequestContentLength")
+	assert.Equal(t, int64(44), contentLength.Int64())
+	bodyLength, _ := findAttr((*records)[0], "dohRequestBodyLength")
+	assert.Equal(t, int64(33), bodyLength.Int64())
+	mismatch, found := findAttr((*records)[0], "dohContentLengthMismatch")
+	require.True(t, found)
+	assert.True(t, mismatch.Bool())
+
+	// Without GetBody, we cannot measure the body and only log the Content-Length
+	httpReq.GetBody = nil
+	logger.Info("dnsExchangeStart", dnsDoHRequestAttrs(httpReq)...)
+	require.Len(t, *records, 2)
+	_, found = findAttr((*records)[1], "dohRequestBodyLength")
+	assert.False(t, found)
+	_, found = findAttr((*records)[1], "dohContentLengthMismatch")
+	assert.False(t, found)
+}
+
+// Exchange logs dohConnectionReused on dnsExchangeDone when the transport
+// reports obtaining a connection, and omits it otherwise.
+func TestDNSOverHTTPSConnExchangeConnectionReused(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// reportConn indicates whether the transport invokes GotConn.
+		reportConn bool
+
+		// want contains the expected dohConnectionReused values.
+		want []bool
+	}{
+		{name: "transport reporting reuse", reportConn: true, want: []bool{false, true, true}},
+		{name: "transport not reporting", reportConn: false, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					if trace := httptrace.ContextClientTrace(req.Context()); tt.reportConn && trace != nil {
+						trace.GotConn(httptrace.GotConnInfo{Reused: count > 0})
+					}
+					count++
+					query := new(dns.Msg)
+					runtimex.PanicOnError0(query.Unpack(runtimex.PanicOnError1(io.ReadAll(req.Body))))
+					rawResp := runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": {"application/dns-message"}},
+						Body:       io.NopCloser(bytes.NewReader(rawResp)),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        DefaultSLogger(),
+				TimeNow:       time.Now,
+			}
+
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverHTTPSConnFunc(NewConfig(), "https://dns.google/dns-query", logger)
+			result, err := fn.Call(context.Background(), httpConn)
+			require.NoError(t, err)
+
+			for range 3 {
+				query := dnscodec.NewQuery("example.com", dns.TypeA)
+				_, err := result.Exchange(context.Background(), query)
+				require.NoError(t, err)
+			}
+
+			var got []bool
+			for _, record := range *records {
+				if record.Message != "dnsExchangeDone" {
+					continue
+				}
+				value, found := findAttr(record, "dohConnectionReused")
+				if found {
+					got = append(got, value.Bool())
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
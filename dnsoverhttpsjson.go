@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/safeconn"
+	"github.com/miekg/dns"
+)
+
+// DNSOverHTTPSJSONConn wraps an HTTPConn for exchanges using the JSON API
+// for DNS over HTTPS offered by resolvers such as Google and Cloudflare,
+// rather than the RFC 8484 wire format used by [*DNSOverHTTPSConn].
+//
+// Since no DNS wire-format messages are exchanged, Exchange does not emit
+// the dnsQuery and dnsResponse events, and the dnsExchangeDone event does
+// not include the fields decoded from the raw response.
+//
+// This type owns the underlying HTTPConn. The caller is responsible for
+// calling Close() when done.
+//
+// All fields are safe to modify after construction but before first use of
+// Exchange(). Fields must not be mutated concurrently with Exchange().
+//
+// Construct via [*DNSOverHTTPSJSONConnFunc].
+type DNSOverHTTPSJSONConn struct {
+	// httpConn is the owned HTTPConn.
+	httpConn *HTTPConn
+
+	// url is the JSON API endpoint URL.
+	url string
+
+	// ErrClassifier classifies errors for structured logging.
+	ErrClassifier ErrClassifier
+
+	// Logger is the SLogger to use.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time.
+	TimeNow func() time.Time
+}
+
+// Close closes the underlying HTTPConn.
+func (c *DNSOverHTTPSJSONConn) Close() error {
+	return c.httpConn.Close()
+}
+
+// HTTPConn returns the underlying *HTTPConn for logging purposes.
+func (c *DNSOverHTTPSJSONConn) HTTPConn() *HTTPConn {
+	return c.httpConn
+}
+
+// Exchange performs a DNS exchange using the JSON API.
+// This method may be called multiple times on the same connection.
+//
+// The request uses GET with the query name and numeric type in the name and
+// type URL parameters and "Accept: application/dns-json". The JSON answer is
+// converted into a [*dns.Msg] and validated using [dnscodec.ParseResponse].
+//
+// This method returns [dnscodec.ErrServerMisbehaving] when the HTTP status
+// is not 200, the content type is neither application/dns-json nor
+// application/json, or the JSON answer cannot be parsed.
+func (c *DNSOverHTTPSJSONConn) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. Get the owned HTTPConn and underlying connection for logging
+	hc := c.httpConn
+	conn := hc.Conn()
+
+	// 2. Create the log context
+	t0 := c.TimeNow()
+	deadline, _ := ctx.Deadline()
+	lc := &DNSExchangeLogContext{
+		ErrClassifier:  c.ErrClassifier,
+		LocalAddr:      connLocalAddr(conn),
+		Logger:         c.Logger,
+		Protocol:       safeconn.Network(conn),
+		RemoteAddr:     connRemoteAddr(conn),
+		ServerProtocol: "doh-json",
+		TimeNow:        c.TimeNow,
+	}
+
+	// 3. Create the HTTP request and the query message
+	httpReq, queryMsg, err := c.newRequest(ctx, query)
+	if err != nil {
+		lc.LogStart(t0, deadline)
+		lc.LogDone(t0, deadline, err)
+		return nil, err
+	}
+	lc.LogStart(t0, deadline,
+		slog.String("dohRequestMethod", httpReq.Method),
+		slog.String("dohRequestPath", httpReq.URL.EscapedPath()),
+	)
+
+	// 4. Perform the HTTP round trip tracing connection reuse
+	httpReq, connReuse := dnsDoHTraceConnReuse(httpReq)
+	httpResp, err := hc.RoundTrip(httpReq)
+	if err != nil {
+		lc.LogDone(t0, deadline, err, connReuse.attrs()...)
+		return nil, err
+	}
+
+	// 5. Read the response and validate it
+	resp, err := dnsDoHJSONReadResponse(ctx, httpResp, queryMsg)
+	lc.LogDone(t0, deadline, err, connReuse.attrs()...)
+	return resp, err
+}
+
+// newRequest creates the HTTP GET request for the given query.
+func (c *DNSOverHTTPSJSONConn) newRequest(
+	ctx context.Context, query *dnscodec.Query) (*http.Request, *dns.Msg, error) {
+	queryMsg, err := query.NewMsg()
+	if err != nil {
+		return nil, nil, err
+	}
+	URL, err := url.Parse(c.url)
+	if err != nil {
+		return nil, nil, err
+	}
+	params := URL.Query()
+	params.Set("name", queryMsg.Question[0].Name)
+	params.Set("type", strconv.Itoa(int(queryMsg.Question[0].Qtype)))
+	URL.RawQuery = params.Encode()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, URL.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Accept", "application/dns-json")
+	return httpReq, queryMsg, nil
+}
+
+// dnsDoHJSONMaxResponseSize is the maximum size of a JSON answer we read.
+const dnsDoHJSONMaxResponseSize = 1 << 16
+
+// dnsDoHJSONReadResponse reads the JSON answer from httpResp and parses it
+// as the response to queryMsg. It always closes the response body.
+func dnsDoHJSONReadResponse(
+	ctx context.Context, httpResp *http.Response, queryMsg *dns.Msg) (*dnscodec.Response, error) {
+	// 1. make sure we eventually close the body
+	defer httpResp.Body.Close()
+
+	// 2. Ensure that the response makes sense
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if mediaType != "application/dns-json" && mediaType != "application/json" {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+
+	// 3. Limit response body to a reasonable size and read it
+	//
+	// - When the error is caused by the context, avoid ErrServerMisbehaving
+	rawResp, err := io.ReadAll(io.LimitReader(httpResp.Body, dnsDoHJSONMaxResponseSize))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+
+	// 4. Attempt to convert the JSON answer into a DNS message
+	var jsonResp dnsDoHJSONResponse
+	if err := json.Unmarshal(rawResp, &jsonResp); err != nil {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	respMsg, err := jsonResp.toMsg(queryMsg.Id)
+	if err != nil {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+
+	// 5. Parse the response and return the parsing result
+	return dnscodec.ParseResponse(queryMsg, respMsg)
+}
+
+// dnsDoHJSONResponse is the JSON answer returned by the JSON API.
+type dnsDoHJSONResponse struct {
+	Status    int                  `json:"Status"`
+	TC        bool                 `json:"TC"`
+	RD        bool                 `json:"RD"`
+	RA        bool                 `json:"RA"`
+	AD        bool                 `json:"AD"`
+	CD        bool                 `json:"CD"`
+	Question  []dnsDoHJSONQuestion `json:"Question"`
+	Answer    []dnsDoHJSONRecord   `json:"Answer"`
+	Authority []dnsDoHJSONRecord   `json:"Authority"`
+}
+
+// dnsDoHJSONQuestion is a question within a [dnsDoHJSONResponse].
+type dnsDoHJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+// dnsDoHJSONRecord is a resource record within a [dnsDoHJSONResponse].
+type dnsDoHJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// toMsg converts the JSON answer into a [*dns.Msg] with the given ID.
+//
+// The JSON answer does not include the ID, so we use the query ID.
+func (r *dnsDoHJSONResponse) toMsg(id uint16) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.Id = id
+	msg.Response = true
+	msg.Rcode = r.Status
+	msg.Truncated = r.TC
+	msg.RecursionDesired = r.RD
+	msg.RecursionAvailable = r.RA
+	msg.AuthenticatedData = r.AD
+	msg.CheckingDisabled = r.CD
+	for _, q := range r.Question {
+		msg.Question = append(msg.Question, dns.Question{
+			Name:   dns.Fqdn(q.Name),
+			Qtype:  q.Type,
+			Qclass: dns.ClassINET,
+		})
+	}
+	var err error
+	if msg.Answer, err = dnsDoHJSONRecordsToRRs(r.Answer); err != nil {
+		return nil, err
+	}
+	if msg.Ns, err = dnsDoHJSONRecordsToRRs(r.Authority); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// dnsDoHJSONRecordsToRRs converts JSON records into [dns.RR] values by
+// parsing their presentation format.
+func dnsDoHJSONRecordsToRRs(records []dnsDoHJSONRecord) ([]dns.RR, error) {
+	var rrs []dns.RR
+	for _, record := range records {
+		typeName, found := dns.TypeToString[record.Type]
+		if !found {
+			return nil, fmt.Errorf("unsupported record type: %d", record.Type)
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s",
+			dns.Fqdn(record.Name), record.TTL, typeName, record.Data))
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, fmt.Errorf("empty record: %q", record.Name)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs, nil
+}
+
+// DNSOverHTTPSJSONConnFunc wraps an *HTTPConn into a [*DNSOverHTTPSJSONConn].
+//
+// This is a [Func] that can be composed into pipelines.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type DNSOverHTTPSJSONConnFunc struct {
+	// URL is the JSON API endpoint URL (e.g., "https://dns.google/resolve").
+	//
+	// Set by [NewDNSOverHTTPSJSONConnFunc] to the user-provided value.
+	URL string
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewDNSOverHTTPSJSONConnFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewDNSOverHTTPSJSONConnFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewDNSOverHTTPSJSONConnFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+// NewDNSOverHTTPSJSONConnFunc returns a new [*DNSOverHTTPSJSONConnFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The url parameter is the JSON API endpoint (e.g., "https://dns.google/resolve"
+// or "https://cloudflare-dns.com/dns-query").
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewDNSOverHTTPSJSONConnFunc(cfg *Config, url string, logger SLogger) *DNSOverHTTPSJSONConnFunc {
+	return &DNSOverHTTPSJSONConnFunc{
+		URL:           url,
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+var _ Func[*HTTPConn, *DNSOverHTTPSJSONConn] = &DNSOverHTTPSJSONConnFunc{}
+
+// Call wraps the HTTPConn into a DNSOverHTTPSJSONConn.
+func (op *DNSOverHTTPSJSONConnFunc) Call(ctx context.Context, httpConn *HTTPConn) (*DNSOverHTTPSJSONConn, error) {
+	return &DNSOverHTTPSJSONConn{
+		httpConn:      httpConn,
+		url:           op.URL,
+		ErrClassifier: op.ErrClassifier,
+		Logger:        op.Logger,
+		TimeNow:       op.TimeNow,
+	}, nil
+}
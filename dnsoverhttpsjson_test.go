@@ -0,0 +1,233 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnsDoHJSONSampleAnswer is a sample JSON answer containing a CNAME chain.
+const dnsDoHJSONSampleAnswer = `{
+	"Status": 0, "TC": false, "RD": true, "RA": true, "AD": false, "CD": false,
+	"Question": [{"name": "www.example.com.", "type": 1}],
+	"Answer": [
+		{"name": "www.example.com.", "type": 5, "TTL": 300, "data": "www.example.com-v4.edgesuite.net."},
+		{"name": "www.example.com-v4.edgesuite.net.", "type": 1, "TTL": 20, "data": "93.184.216.34"}
+	]
+}`
+
+// newDNSOverHTTPSJSONTestConn returns a [*DNSOverHTTPSJSONConn] whose
+// transport uses the given round trip function.
+func newDNSOverHTTPSJSONTestConn(
+	t *testing.T, logger SLogger, fx func(req *http.Request) (*http.Response, error)) *DNSOverHTTPSJSONConn {
+	httpConn := &HTTPConn{
+		conn:          newMinimalConn(),
+		txp:           funcRoundTripper(fx),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        DefaultSLogger(),
+		TimeNow:       time.Now,
+	}
+	fn := NewDNSOverHTTPSJSONConnFunc(NewConfig(), "https://dns.google/resolve", logger)
+	result, err := fn.Call(context.Background(), httpConn)
+	require.NoError(t, err)
+	return result
+}
+
+// newDNSOverHTTPSJSONResponse returns an HTTP response with the given fields.
+func newDNSOverHTTPSJSONResponse(statusCode int, contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// NewDNSOverHTTPSJSONConnFunc populates all fields from Config and the provided logger.
+func TestNewDNSOverHTTPSJSONConnFunc(t *testing.T) {
+	fn := NewDNSOverHTTPSJSONConnFunc(NewConfig(), "https://dns.google/resolve", DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.Equal(t, "https://dns.google/resolve", fn.URL)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Close delegates to the underlying HTTPConn.
+func TestDNSOverHTTPSJSONConnClose(t *testing.T) {
+	closeCalled := false
+	mockConn := newMinimalConn()
+	mockConn.CloseFunc = func() error {
+		closeCalled = true
+		return nil
+	}
+	cfg := NewConfig()
+	httpConn, err := NewHTTPConnFuncPlain(cfg, DefaultSLogger()).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	result, err := NewDNSOverHTTPSJSONConnFunc(cfg, "https://dns.google/resolve", DefaultSLogger()).Call(
+		context.Background(), httpConn)
+	require.NoError(t, err)
+
+	require.NoError(t, result.Close())
+	assert.True(t, closeCalled)
+	assert.Equal(t, httpConn, result.HTTPConn())
+}
+
+// Exchange sends a GET request with the name and type parameters and parses
+// the JSON answer into a response, logging serverProtocol="doh-json".
+func TestDNSOverHTTPSJSONConnExchange(t *testing.T) {
+	var gotReq *http.Request
+	logger, records := newCapturingLogger()
+	conn := newDNSOverHTTPSJSONTestConn(t, logger, func(req *http.Request) (*http.Response, error) {
+		gotReq = req
+		return newDNSOverHTTPSJSONResponse(
+			http.StatusOK, "application/dns-json", dnsDoHJSONSampleAnswer), nil
+	})
+
+	resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	require.NotNil(t, gotReq)
+	assert.Equal(t, http.MethodGet, gotReq.Method)
+	assert.Equal(t, "application/dns-json", gotReq.Header.Get("Accept"))
+	assert.Equal(t, "www.example.com.", gotReq.URL.Query().Get("name"))
+	assert.Equal(t, "1", gotReq.URL.Query().Get("type"))
+
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+	cnames, err := resp.RecordsCNAME()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"www.example.com-v4.edgesuite.net."}, cnames)
+	assert.True(t, resp.Response.RecursionAvailable)
+
+	require.Len(t, *records, 2)
+	assert.Equal(t, "dnsExchangeStart", (*records)[0].Message)
+	assert.Equal(t, "dnsExchangeDone", (*records)[1].Message)
+	for _, record := range *records {
+		value, found := findAttr(record, "serverProtocol")
+		require.True(t, found)
+		assert.Equal(t, "doh-json", value.String())
+	}
+	method, found := findAttr((*records)[0], "dohRequestMethod")
+	require.True(t, found)
+	assert.Equal(t, http.MethodGet, method.String())
+	path, found := findAttr((*records)[0], "dohRequestPath")
+	require.True(t, found)
+	assert.Equal(t, "/resolve", path.String())
+}
+
+// Exchange fails when the HTTP response or the JSON answer is not valid.
+func TestDNSOverHTTPSJSONConnExchangeErrors(t *testing.T) {
+	roundTripErr := errors.New("round trip error")
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// resp is the HTTP response returned by the round tripper.
+		resp *http.Response
+
+		// err is the error returned by the round tripper.
+		err error
+
+		// wantErr is the expected error.
+		wantErr error
+	}{
+		{
+			name:    "round trip error",
+			err:     roundTripErr,
+			wantErr: roundTripErr,
+		},
+
+		{
+			name:    "non-200 status",
+			resp:    newDNSOverHTTPSJSONResponse(http.StatusBadRequest, "application/dns-json", "{}"),
+			wantErr: dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name:    "unexpected content type",
+			resp:    newDNSOverHTTPSJSONResponse(http.StatusOK, "text/html", dnsDoHJSONSampleAnswer),
+			wantErr: dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name:    "invalid JSON",
+			resp:    newDNSOverHTTPSJSONResponse(http.StatusOK, "application/json", "{"),
+			wantErr: dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name: "invalid record data",
+			resp: newDNSOverHTTPSJSONResponse(http.StatusOK, "application/json", `{
+				"Status": 0, "RA": true,
+				"Question": [{"name": "www.example.com.", "type": 1}],
+				"Answer": [{"name": "www.example.com.", "type": 1, "TTL": 20, "data": "not-an-ip"}]
+			}`),
+			wantErr: dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name: "mismatched question",
+			resp: newDNSOverHTTPSJSONResponse(http.StatusOK, "application/json", `{
+				"Status": 0, "RA": true,
+				"Question": [{"name": "example.org.", "type": 1}]
+			}`),
+			wantErr: dnscodec.ErrInvalidResponse,
+		},
+
+		{
+			name: "NXDOMAIN",
+			resp: newDNSOverHTTPSJSONResponse(http.StatusOK, "application/json; charset=UTF-8", `{
+				"Status": 3, "RA": true,
+				"Question": [{"name": "www.example.com.", "type": 1}]
+			}`),
+			wantErr: dnscodec.ErrNoName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			conn := newDNSOverHTTPSJSONTestConn(t, logger, func(req *http.Request) (*http.Response, error) {
+				return tt.resp, tt.err
+			})
+
+			resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, resp)
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "err")
+			require.True(t, found)
+			assert.ErrorIs(t, value.Any().(error), tt.wantErr)
+		})
+	}
+}
+
+// Exchange returns an error when the URL is invalid.
+func TestDNSOverHTTPSJSONConnExchangeInvalidURL(t *testing.T) {
+	logger, records := newCapturingLogger()
+	conn := newDNSOverHTTPSJSONTestConn(t, logger, func(req *http.Request) (*http.Response, error) {
+		panic("should not be called")
+	})
+	conn.url = "\t"
+
+	_, err := conn.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+
+	require.Error(t, err)
+	require.Len(t, *records, 2)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/dnsoverstream"
 	"github.com/bassosimone/safeconn"
+	"github.com/miekg/dns"
 )
 
 // DNSOverTCPConn wraps a TCP connection for DNS-over-TCP exchanges.
@@ -26,9 +27,21 @@ type DNSOverTCPConn struct {
 	// conn is the owned TCP connection.
 	conn net.Conn
 
+	// DecodeResponses enables logging fields decoded from the
+	// response (e.g., dnsFlagRA) in the dnsExchangeDone event.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains the EDNS options to add
+	// to the OPT record of each query.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LogLengthPrefix enables logging the dnsTcpLengthPrefix event containing
+	// the 2-byte length prefixes written and read by each exchange.
+	LogLengthPrefix bool
+
 	// Logger is the SLogger to use.
 	Logger SLogger
 
@@ -48,6 +61,11 @@ func (c *DNSOverTCPConn) Conn() net.Conn {
 
 // Exchange performs a DNS exchange over TCP.
 // This method may be called multiple times on the same connection.
+//
+// When the exchange fails after reading some bytes, the dnsExchangeDone event
+// includes the dnsPartialResponse field containing the raw bytes read before
+// the error, including the 2-byte length prefix, to help investigating
+// truncated or injected responses.
 func (c *DNSOverTCPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
 	// 1. Get the owned connection
 	conn := c.conn
@@ -57,13 +75,14 @@ func (c *DNSOverTCPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 	deadline, _ := ctx.Deadline()
 	var rqr []byte
 	lc := &DNSExchangeLogContext{
-		ErrClassifier:  c.ErrClassifier,
-		LocalAddr:      safeconn.LocalAddr(conn),
-		Logger:         c.Logger,
-		Protocol:       safeconn.Network(conn),
-		RemoteAddr:     safeconn.RemoteAddr(conn),
-		ServerProtocol: "tcp",
-		TimeNow:        c.TimeNow,
+		DecodeResponses: c.DecodeResponses,
+		ErrClassifier:   c.ErrClassifier,
+		LocalAddr:       connLocalAddr(conn),
+		Logger:          c.Logger,
+		Protocol:        safeconn.Network(conn),
+		RemoteAddr:      connRemoteAddr(conn),
+		ServerProtocol:  "tcp",
+		TimeNow:         c.TimeNow,
 	}
 
 	// 3. Create the transport
@@ -78,10 +97,20 @@ func (c *DNSOverTCPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 	txp.ObserveRawResponse = lc.MakeResponseObserver(t0, &rqr)
 
 	// 5. Execute with logging
-	lc.LogStart(t0, deadline)
-	so := dnsoverstream.NewTCPStreamOpener(conn)
-	resp, err := txp.ExchangeWithStreamOpener(ctx, so, query)
-	lc.LogDone(t0, deadline, err)
+	lc.LogStart(t0, deadline, dnsExtraEDNSOptionsAttrs(c.ExtraEDNSOptions)...)
+	prc := &dnsPartialResponseConn{Conn: conn}
+	var streamConn net.Conn = prc
+	var lpc *dnsLengthPrefixConn
+	if c.LogLengthPrefix {
+		lpc = &dnsLengthPrefixConn{Conn: prc}
+		streamConn = lpc
+	}
+	so := dnsoverstream.NewTCPStreamOpener(streamConn)
+	resp, err := dnsExchangeStream(ctx, txp, so, streamConn, query, c.ExtraEDNSOptions)
+	if lpc != nil {
+		lpc.logDNSLengthPrefix(lc, t0)
+	}
+	lc.LogDone(t0, deadline, err, prc.attrs(err)...)
 
 	return resp, err
 }
@@ -93,11 +122,33 @@ func (c *DNSOverTCPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type DNSOverTCPConnFunc struct {
+	// DecodeResponses enables logging fields decoded from the response
+	// in the dnsExchangeDone event (see [DNSExchangeLogContext.LogDone]).
+	//
+	// Set by [NewDNSOverTCPConnFunc] to false.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	//
 	// Set by [NewDNSOverTCPConnFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains arbitrary EDNS options, including options
+	// using unknown codes, to add to the OPT record of each query, which is
+	// useful for robustness testing of resolvers. When not empty, the
+	// dnsExchangeStart event lists their codes as dnsExtraEdnsOptions and
+	// the dnsQuery event contains the query including them.
+	//
+	// Set by [NewDNSOverTCPConnFunc] to nil.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LogLengthPrefix enables logging the dnsTcpLengthPrefix event containing
+	// the 2-byte length prefixes written and read by each exchange, which helps
+	// to investigate framing bugs.
+	//
+	// Set by [NewDNSOverTCPConnFunc] to false.
+	LogLengthPrefix bool
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewDNSOverTCPConnFunc] to the user-provided logger.
@@ -127,9 +178,12 @@ var _ Func[net.Conn, *DNSOverTCPConn] = &DNSOverTCPConnFunc{}
 // Call wraps the net.Conn into a DNSOverTCPConn.
 func (op *DNSOverTCPConnFunc) Call(ctx context.Context, conn net.Conn) (*DNSOverTCPConn, error) {
 	return &DNSOverTCPConn{
-		conn:          conn,
-		ErrClassifier: op.ErrClassifier,
-		Logger:        op.Logger,
-		TimeNow:       op.TimeNow,
+		conn:             conn,
+		DecodeResponses:  op.DecodeResponses,
+		ErrClassifier:    op.ErrClassifier,
+		ExtraEDNSOptions: op.ExtraEDNSOptions,
+		LogLengthPrefix:  op.LogLengthPrefix,
+		Logger:           op.Logger,
+		TimeNow:          op.TimeNow,
 	}, nil
 }
@@ -94,3 +94,49 @@ func TestDNSOverTCPConnExchangeWriteError(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+// Exchange logs the decoded response flags when DecodeResponses is set.
+func TestDNSOverTCPConnExchangeDecodeResponses(t *testing.T) {
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTCPConnFunc(NewConfig(), logger)
+	fn.DecodeResponses = true
+	serverConn := newDNSStreamServerConn(func(query *dns.Msg) *dns.Msg {
+		resp := newDNSResponse(query, "93.184.216.34")
+		resp.Authoritative = true
+		return resp
+	})
+	conn, err := fn.Call(context.Background(), serverConn)
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.NoError(t, err)
+
+	done, found := findRecord(*records, "dnsExchangeDone")
+	require.True(t, found)
+	for key, want := range map[string]bool{"dnsFlagRA": true, "dnsFlagAA": true, "dnsFlagAD": false} {
+		value, found := findAttr(done, key)
+		require.True(t, found, key)
+		assert.Equal(t, want, value.Bool(), key)
+	}
+}
+
+// Exchange logs dnsIdMatched=false when the response ID differs from the query ID.
+func TestDNSOverTCPConnExchangeIDMismatch(t *testing.T) {
+	logger, records := newCapturingLogger()
+	serverConn := newDNSStreamServerConn(func(query *dns.Msg) *dns.Msg {
+		resp := newDNSResponse(query, "93.184.216.34")
+		resp.Id++
+		return resp
+	})
+	conn, err := NewDNSOverTCPConnFunc(NewConfig(), logger).Call(context.Background(), serverConn)
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+
+	done, found := findRecord(*records, "dnsExchangeDone")
+	require.True(t, found)
+	matched, found := findAttr(done, "dnsIdMatched")
+	require.True(t, found)
+	assert.False(t, matched.Bool())
+}
@@ -4,12 +4,16 @@ package nop
 
 import (
 	"context"
+	"log/slog"
+	"net"
 	"net/netip"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/dnsoverstream"
+	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/safeconn"
+	"github.com/miekg/dns"
 )
 
 // DNSOverTLSConn wraps a TLS connection for DNS-over-TLS exchanges.
@@ -25,9 +29,21 @@ type DNSOverTLSConn struct {
 	// conn is the owned TLS connection.
 	conn TLSConn
 
+	// DecodeResponses enables logging fields decoded from the
+	// response (e.g., dnsFlagRA) in the dnsExchangeDone event.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains the EDNS options to add
+	// to the OPT record of each query.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LogLengthPrefix enables logging the dnsTcpLengthPrefix event containing
+	// the 2-byte length prefixes written and read by each exchange.
+	LogLengthPrefix bool
+
 	// Logger is the SLogger to use.
 	Logger SLogger
 
@@ -47,6 +63,15 @@ func (c *DNSOverTLSConn) Conn() TLSConn {
 
 // Exchange performs a DNS exchange over TLS.
 // This method may be called multiple times on the same connection.
+//
+// The dnsExchangeStart and dnsExchangeDone events include the tlsDidResume
+// field indicating whether the TLS connection was established by resuming
+// a previous session, which is useful to measure resumption rates.
+//
+// When the exchange fails after reading some bytes, the dnsExchangeDone event
+// includes the dnsPartialResponse field containing the raw bytes read before
+// the error, including the 2-byte length prefix, to help investigating
+// truncated or injected responses.
 func (c *DNSOverTLSConn) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
 	// 1. Get the owned connection
 	conn := c.conn
@@ -56,13 +81,14 @@ func (c *DNSOverTLSConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 	deadline, _ := ctx.Deadline()
 	var rqr []byte
 	lc := &DNSExchangeLogContext{
-		ErrClassifier:  c.ErrClassifier,
-		LocalAddr:      safeconn.LocalAddr(conn),
-		Logger:         c.Logger,
-		Protocol:       safeconn.Network(conn),
-		RemoteAddr:     safeconn.RemoteAddr(conn),
-		ServerProtocol: "dot",
-		TimeNow:        c.TimeNow,
+		DecodeResponses: c.DecodeResponses,
+		ErrClassifier:   c.ErrClassifier,
+		LocalAddr:       connLocalAddr(conn),
+		Logger:          c.Logger,
+		Protocol:        safeconn.Network(conn),
+		RemoteAddr:      connRemoteAddr(conn),
+		ServerProtocol:  "dot",
+		TimeNow:         c.TimeNow,
 	}
 
 	// 3. Create the transport
@@ -77,14 +103,121 @@ func (c *DNSOverTLSConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 	txp.ObserveRawResponse = lc.MakeResponseObserver(t0, &rqr)
 
 	// 5. Execute with logging
-	lc.LogStart(t0, deadline)
-	so := dnsoverstream.NewTLSStreamOpener(conn) // turns on padding and DNSSEC
-	resp, err := txp.ExchangeWithStreamOpener(ctx, so, query)
-	lc.LogDone(t0, deadline, err)
+	//
+	// We include tlsDidResume to measure resumption rates per exchange.
+	resumeAttr := slog.Bool("tlsDidResume", conn.ConnectionState().DidResume)
+	lc.LogStart(t0, deadline, append([]any{resumeAttr}, dnsExtraEDNSOptionsAttrs(c.ExtraEDNSOptions)...)...)
+	prc := &dnsPartialResponseConn{Conn: conn}
+	var streamConn net.Conn = prc
+	var lpc *dnsLengthPrefixConn
+	if c.LogLengthPrefix {
+		lpc = &dnsLengthPrefixConn{Conn: prc}
+		streamConn = lpc
+	}
+	so := dnsoverstream.NewTLSStreamOpener(streamConn) // turns on padding and DNSSEC
+	resp, err := dnsExchangeStream(ctx, txp, so, streamConn, query, c.ExtraEDNSOptions)
+	if lpc != nil {
+		lpc.logDNSLengthPrefix(lc, t0)
+	}
+	lc.LogDone(t0, deadline, err, append([]any{resumeAttr}, prc.attrs(err)...)...)
 
 	return resp, err
 }
 
+// BenchmarkResult contains the result of [*DNSOverTLSConn.ExchangeBenchmark].
+type BenchmarkResult struct {
+	// Count is the number of exchanges performed.
+	Count int
+
+	// Min is the duration of the fastest exchange.
+	Min time.Duration
+
+	// Avg is the average duration of the exchanges.
+	Avg time.Duration
+
+	// Max is the duration of the slowest exchange.
+	Max time.Duration
+
+	// Response is the response received by the last exchange.
+	Response *dnscodec.Response
+}
+
+// ExchangeBenchmark performs n sequential DNS exchanges over TLS using the
+// same query and returns timing statistics along with the last response.
+//
+// Each exchange emits the same events as [*DNSOverTLSConn.Exchange] followed
+// by a dnsBenchmarkIteration event. A final dnsBenchmarkDone event summarizes
+// the whole benchmark, including the average, minimum, and maximum exchange
+// times in milliseconds (dnsBenchmarkAvgMs, dnsBenchmarkMinMs, and
+// dnsBenchmarkMaxMs). The benchmark stops at the first failed exchange, in
+// which case this method returns the corresponding error.
+//
+// This method panics if n is not positive.
+func (c *DNSOverTLSConn) ExchangeBenchmark(
+	ctx context.Context, query *dnscodec.Query, n int) (BenchmarkResult, error) {
+	runtimex.Assert(n > 0)
+	conn := c.conn
+	t0 := c.TimeNow()
+	var (
+		result BenchmarkResult
+		total  time.Duration
+		err    error
+	)
+	for idx := 0; idx < n && err == nil; idx++ {
+		it0 := c.TimeNow()
+		var resp *dnscodec.Response
+		resp, err = c.Exchange(ctx, query)
+		it := c.TimeNow()
+		elapsed := it.Sub(it0)
+		c.Logger.Info(
+			"dnsBenchmarkIteration",
+			slog.Int("dnsBenchmarkIteration", idx),
+			slog.Any("err", err),
+			slog.String("errClass", c.ErrClassifier.Classify(err)),
+			slog.String("localAddr", connLocalAddr(conn)),
+			slog.String("protocol", safeconn.Network(conn)),
+			slog.String("remoteAddr", connRemoteAddr(conn)),
+			slog.String("serverProtocol", "dot"),
+			slog.Time("t0", it0),
+			slog.Time("t", it),
+		)
+		if err != nil {
+			break
+		}
+		if result.Count == 0 || elapsed < result.Min {
+			result.Min = elapsed
+		}
+		if elapsed > result.Max {
+			result.Max = elapsed
+		}
+		total += elapsed
+		result.Count++
+		result.Response = resp
+	}
+	if result.Count > 0 {
+		result.Avg = total / time.Duration(result.Count)
+	}
+	c.Logger.Info(
+		"dnsBenchmarkDone",
+		slog.Int64("dnsBenchmarkAvgMs", result.Avg.Milliseconds()),
+		slog.Int("dnsBenchmarkCount", result.Count),
+		slog.Int64("dnsBenchmarkMaxMs", result.Max.Milliseconds()),
+		slog.Int64("dnsBenchmarkMinMs", result.Min.Milliseconds()),
+		slog.Any("err", err),
+		slog.String("errClass", c.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.String("serverProtocol", "dot"),
+		slog.Time("t0", t0),
+		slog.Time("t", c.TimeNow()),
+	)
+	if err != nil {
+		return BenchmarkResult{}, err
+	}
+	return result, nil
+}
+
 // DNSOverTLSConnFunc wraps a TLS connection into a [*DNSOverTLSConn].
 //
 // This is a [Func] that can be composed into pipelines.
@@ -92,11 +225,33 @@ func (c *DNSOverTLSConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type DNSOverTLSConnFunc struct {
+	// DecodeResponses enables logging fields decoded from the response
+	// in the dnsExchangeDone event (see [DNSExchangeLogContext.LogDone]).
+	//
+	// Set by [NewDNSOverTLSConnFunc] to false.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	//
 	// Set by [NewDNSOverTLSConnFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains arbitrary EDNS options, including options
+	// using unknown codes, to add to the OPT record of each query, which is
+	// useful for robustness testing of resolvers. When not empty, the
+	// dnsExchangeStart event lists their codes as dnsExtraEdnsOptions and
+	// the dnsQuery event contains the query including them.
+	//
+	// Set by [NewDNSOverTLSConnFunc] to nil.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LogLengthPrefix enables logging the dnsTcpLengthPrefix event containing
+	// the 2-byte length prefixes written and read by each exchange, which helps
+	// to investigate framing bugs.
+	//
+	// Set by [NewDNSOverTLSConnFunc] to false.
+	LogLengthPrefix bool
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewDNSOverTLSConnFunc] to the user-provided logger.
@@ -126,9 +281,12 @@ var _ Func[TLSConn, *DNSOverTLSConn] = &DNSOverTLSConnFunc{}
 // Call wraps the TLSConn into a DNSOverTLSConn.
 func (op *DNSOverTLSConnFunc) Call(ctx context.Context, conn TLSConn) (*DNSOverTLSConn, error) {
 	return &DNSOverTLSConn{
-		conn:          conn,
-		ErrClassifier: op.ErrClassifier,
-		Logger:        op.Logger,
-		TimeNow:       op.TimeNow,
+		conn:             conn,
+		DecodeResponses:  op.DecodeResponses,
+		ErrClassifier:    op.ErrClassifier,
+		ExtraEDNSOptions: op.ExtraEDNSOptions,
+		LogLengthPrefix:  op.LogLengthPrefix,
+		Logger:           op.Logger,
+		TimeNow:          op.TimeNow,
 	}, nil
 }
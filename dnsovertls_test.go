@@ -6,7 +6,10 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
+	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/tlsstub"
@@ -128,3 +131,133 @@ func TestDNSOverTLSConnExchangeWriteError(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+// ExchangeBenchmark performs n exchanges and computes min/avg/max durations.
+func TestDNSOverTLSConnExchangeBenchmark(t *testing.T) {
+	// Simulate a server whose latency is scripted per exchange by advancing
+	// the fake clock while producing the response.
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	latencies := []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond}
+	var count int
+	mockConn := newDNSStreamServerConn(func(query *dns.Msg) *dns.Msg {
+		now = now.Add(latencies[count])
+		count++
+		return newDNSResponse(query, fmt.Sprintf("10.0.0.%d", count))
+	})
+	mockTLSConn := &tlsstub.FuncTLSConn{
+		FuncConn: mockConn,
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+
+	cfg := NewConfig()
+	cfg.TimeNow = func() time.Time { return now }
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTLSConnFunc(cfg, logger)
+	result, err := fn.Call(context.Background(), mockTLSConn)
+	require.NoError(t, err)
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	bench, err := result.ExchangeBenchmark(context.Background(), query, len(latencies))
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, bench.Count)
+	assert.Equal(t, 10*time.Millisecond, bench.Min)
+	assert.Equal(t, 20*time.Millisecond, bench.Avg)
+	assert.Equal(t, 30*time.Millisecond, bench.Max)
+	require.NotNil(t, bench.Response)
+	addrs, err := bench.Response.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.3"}, addrs)
+
+	// Verify we emitted one iteration event per exchange plus the rollup
+	var iterations int
+	for _, record := range *records {
+		if record.Message == "dnsBenchmarkIteration" {
+			iterations++
+		}
+	}
+	assert.Equal(t, 3, iterations)
+	last := (*records)[len(*records)-1]
+	assert.Equal(t, "dnsBenchmarkDone", last.Message)
+	for key, want := range map[string]int64{
+		"dnsBenchmarkAvgMs": 20,
+		"dnsBenchmarkMaxMs": 30,
+		"dnsBenchmarkMinMs": 10,
+	} {
+		value, found := findAttr(last, key)
+		require.True(t, found, key)
+		assert.Equal(t, slog.KindInt64, value.Kind(), key)
+		assert.Equal(t, want, value.Int64(), key)
+	}
+}
+
+// ExchangeBenchmark stops and returns the error of the first failed exchange.
+func TestDNSOverTLSConnExchangeBenchmarkError(t *testing.T) {
+	wantErr := errors.New("write error")
+
+	var writes int
+	mockTLSConn := &tlsstub.FuncTLSConn{
+		FuncConn: newMinimalConn(),
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+	mockTLSConn.FuncConn.WriteFunc = func(b []byte) (int, error) {
+		writes++
+		return 0, wantErr
+	}
+
+	cfg := NewConfig()
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverTLSConnFunc(cfg, logger)
+	result, err := fn.Call(context.Background(), mockTLSConn)
+	require.NoError(t, err)
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	bench, err := result.ExchangeBenchmark(context.Background(), query, 5)
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Equal(t, BenchmarkResult{}, bench)
+	assert.Equal(t, 1, writes)
+	last := (*records)[len(*records)-1]
+	assert.Equal(t, "dnsBenchmarkDone", last.Message)
+}
+
+// Exchange logs tlsDidResume on dnsExchangeStart and dnsExchangeDone.
+func TestDNSOverTLSConnExchangeLogsDidResume(t *testing.T) {
+	for _, didResume := range []bool{false, true} {
+		t.Run(fmt.Sprintf("didResume=%v", didResume), func(t *testing.T) {
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newDNSStreamServerConn(func(query *dns.Msg) *dns.Msg {
+					return newDNSResponse(query, "130.192.91.211")
+				}),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{DidResume: didResume}
+				},
+			}
+			logger, records := newCapturingLogger()
+			result, err := NewDNSOverTLSConnFunc(NewConfig(), logger).Call(context.Background(), mockTLSConn)
+			require.NoError(t, err)
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			_, err = result.Exchange(context.Background(), query)
+			require.NoError(t, err)
+
+			for _, msg := range []string{"dnsExchangeStart", "dnsExchangeDone"} {
+				record, found := findRecord(*records, msg)
+				require.True(t, found)
+				value, found := findAttr(record, "tlsDidResume")
+				require.True(t, found)
+				assert.Equal(t, didResume, value.Bool())
+			}
+		})
+	}
+}
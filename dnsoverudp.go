@@ -3,16 +3,29 @@
 package nop
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/netip"
+	"os"
 	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/minest"
+	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/safeconn"
+	"github.com/miekg/dns"
 )
 
+// ErrDNSIdMismatch indicates that the ID of a DNS-over-UDP response does not
+// match the ID of the query, which suggests that the response is spoofed.
+//
+// This error wraps [dnscodec.ErrInvalidResponse].
+var ErrDNSIdMismatch = fmt.Errorf("%w: response ID does not match query ID", dnscodec.ErrInvalidResponse)
+
 // DNSOverUDPConn wraps a UDP connection for DNS-over-UDP exchanges.
 //
 // This type owns the underlying connection. The caller is responsible for
@@ -26,12 +39,36 @@ type DNSOverUDPConn struct {
 	// conn is the owned UDP connection.
 	conn net.Conn
 
+	// Connect is the [Func] used to create a new socket for each
+	// query when RotateSourcePort is true.
+	Connect Func[netip.AddrPort, net.Conn]
+
+	// DecodeResponses enables logging fields decoded from the
+	// response (e.g., dnsFlagRA) in the dnsExchangeDone event.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains the EDNS options to add
+	// to the OPT record of each query.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LateResponseGrace is the time Exchange keeps reading after the
+	// exchange timed out to log late responses, or zero to disable it.
+	LateResponseGrace time.Duration
+
 	// Logger is the SLogger to use.
 	Logger SLogger
 
+	// NearTruncationMargin is the margin, in bytes, below the advertised
+	// buffer size within which Exchange flags responses as near truncation.
+	NearTruncationMargin int
+
+	// RotateSourcePort enables sending each query from a new socket
+	// connected to the same remote address, thus using a new source port.
+	RotateSourcePort bool
+
 	// TimeNow is the function to get the current time.
 	TimeNow func() time.Time
 }
@@ -48,7 +85,218 @@ func (c *DNSOverUDPConn) Conn() net.Conn {
 
 // Exchange performs a DNS exchange over UDP.
 // This method may be called multiple times on the same connection.
+//
+// This method sends the query once and never retransmits it, since retry
+// logic is outside the scope of nop (see the package documentation).
+//
+// By default, all the queries use the owned connection, hence the same source
+// port. When RotateSourcePort is true, each query instead uses a new socket,
+// created by calling Connect with the remote address and closed after the
+// exchange, whose address is the localAddr of the events. When Connect fails,
+// the events have an empty localAddr. In all cases, the dnsExchangeDone event
+// includes dnsSourcePortStable, which is true unless RotateSourcePort is true.
+//
+// Since UDP responses are easily spoofed, this method returns [ErrDNSIdMismatch]
+// when the ID of the response does not match the ID of the query. We do not
+// log whether the source address of the response matches the server: since
+// the socket is connected, the kernel discards datagrams coming from other
+// addresses, so the source always matches and spoofers must forge it.
+//
+// When LateResponseGrace is positive and the exchange fails because the
+// deadline expired, this method keeps reading for LateResponseGrace after
+// emitting dnsExchangeDone and emits a dnsLateResponse event for each datagram
+// received, containing dnsRawResponse and dnsLateByMs, the time elapsed since
+// the exchange timed out in milliseconds. Late responses are only logged and
+// never returned, so the result is still the deadline error. Reading late
+// responses is synchronous, so this method returns up to LateResponseGrace
+// after the deadline. It also requires the connection to remain open after
+// the context is done, hence a pipeline with a [CancelWatchFunc] bound to the
+// same context, which closes the connection when the deadline expires, makes
+// the first read fail and prevents logging late responses.
+//
+// For fragmentation and truncation studies, when a response has been read,
+// the dnsExchangeDone event includes the size of the last response read as
+// dnsResponseSize, the UDP buffer size advertised by the query as
+// dnsEdnsBufferSize (or 512 when the query lacks an OPT record), and
+// dnsNearTruncation, which is true when the response size is within
+// NearTruncationMargin bytes of the buffer size.
 func (c *DNSOverUDPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	resp, _, err := c.exchange(ctx, query)
+	return resp, err
+}
+
+// exchange implements [*DNSOverUDPConn.Exchange] and additionally returns
+// the RCODE of the last datagram read, or -1 if no datagram was read.
+func (c *DNSOverUDPConn) exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, int, error) {
+	// 1. Get the owned connection or create a new one
+	t0 := c.TimeNow()
+	deadline, _ := ctx.Deadline()
+	conn, err := c.exchangeConn(ctx)
+	if err != nil {
+		lc := c.newLogContext(c.conn)
+		lc.LocalAddr = ""
+		lc.LogStart(t0, deadline)
+		lc.LogDone(t0, deadline, err, slog.Bool("dnsSourcePortStable", false))
+		return nil, -1, err
+	}
+	if conn != c.conn {
+		defer conn.Close()
+	}
+
+	// 2. Create the log context
+	var rqr []byte
+	lc := c.newLogContext(conn)
+
+	// 3. Create the transport
+	txp := dnsNewUDPTransport()
+
+	// 4. Set observers for raw messages, keeping track of the RCODE
+	rcode := -1
+	observeResponse := lc.MakeResponseObserver(t0, &rqr)
+	txp.ObserveRawQuery = lc.MakeQueryObserver(t0, &rqr)
+	txp.ObserveRawResponse = func(rawResp []byte) {
+		rcode = dnsRawRcode(rawResp)
+		observeResponse(rawResp)
+	}
+
+	// 5. Execute with logging
+	lc.LogStart(t0, deadline, dnsExtraEDNSOptionsAttrs(c.ExtraEDNSOptions)...)
+	resp, err := c.sendAndRecv(ctx, conn, txp, query)
+	if matched, ok := lc.idMatched(); ok && !matched && errors.Is(err, dnscodec.ErrInvalidResponse) {
+		err = ErrDNSIdMismatch
+	}
+	extra := []any{slog.Bool("dnsSourcePortStable", !c.RotateSourcePort)}
+	extra = append(extra, dnsResponseSizeAttrs(lc.rawQuery, lc.rawResponse, c.NearTruncationMargin)...)
+	lc.LogDone(t0, deadline, err, extra...)
+
+	// 6. Optionally log the responses arriving after the deadline
+	if c.LateResponseGrace > 0 && dnsDeadlineExceeded(err) {
+		c.readLateResponses(conn, lc, t0)
+	}
+
+	return resp, rcode, err
+}
+
+// dnsRawRcode returns the RCODE in the header of the raw message, or -1
+// when the message is too short to contain a header.
+func dnsRawRcode(rawMsg []byte) int {
+	if len(rawMsg) < 12 {
+		return -1
+	}
+	return int(rawMsg[3] & 0x0f)
+}
+
+// dnsResponseSizeAttrs returns the dnsExchangeDone attributes comparing the
+// size of the raw response to the UDP buffer size advertised by the raw query,
+// or nil when no response has been read.
+//
+// Without an OPT record in the query, the buffer size is the 512 bytes
+// limit of DNS over UDP (see RFC 1035, Section 2.3.4).
+func dnsResponseSizeAttrs(rawQuery, rawResp []byte, margin int) []any {
+	if rawResp == nil {
+		return nil
+	}
+	bufferSize := 512
+	query := new(dns.Msg)
+	if err := query.Unpack(rawQuery); err == nil {
+		if opt := query.IsEdns0(); opt != nil {
+			bufferSize = int(max(opt.UDPSize(), 512))
+		}
+	}
+	return []any{
+		slog.Int("dnsEdnsBufferSize", bufferSize),
+		slog.Bool("dnsNearTruncation", len(rawResp) >= bufferSize-margin),
+		slog.Int("dnsResponseSize", len(rawResp)),
+	}
+}
+
+// dnsDeadlineExceeded returns whether err is caused by an expired deadline.
+func dnsDeadlineExceeded(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// readLateResponses reads from conn for LateResponseGrace and logs each
+// datagram received as a dnsLateResponse event.
+//
+// Note: we use the real clock for the read deadline, since TimeNow may be
+// a fake clock, and we clear the read deadline when done.
+func (c *DNSOverUDPConn) readLateResponses(conn net.Conn, lc *DNSExchangeLogContext, t0 time.Time) {
+	timedOut := c.TimeNow()
+	if err := conn.SetReadDeadline(time.Now().Add(c.LateResponseGrace)); err != nil {
+		return
+	}
+	defer conn.SetReadDeadline(time.Time{})
+	buffer := make([]byte, dns.MaxMsgSize)
+	for {
+		count, err := conn.Read(buffer)
+		if err != nil {
+			return
+		}
+		t := c.TimeNow()
+		lc.Logger.Info(
+			"dnsLateResponse",
+			slog.Int64("dnsLateByMs", t.Sub(timedOut).Milliseconds()),
+			slog.Any("dnsRawResponse", bytes.Clone(buffer[:count])),
+			slog.String("localAddr", lc.LocalAddr),
+			slog.String("protocol", lc.Protocol),
+			slog.String("remoteAddr", lc.RemoteAddr),
+			slog.String("serverProtocol", lc.ServerProtocol),
+			slog.Time("t0", t0),
+			slog.Time("t", t),
+		)
+	}
+}
+
+// exchangeConn returns the owned connection or, when RotateSourcePort is
+// true, a new connection to the same remote address that the caller owns.
+func (c *DNSOverUDPConn) exchangeConn(ctx context.Context) (net.Conn, error) {
+	if !c.RotateSourcePort {
+		return c.conn, nil
+	}
+	runtimex.Assert(c.Connect != nil)
+	address, err := netip.ParseAddrPort(connRemoteAddr(c.conn))
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect.Call(ctx, address)
+}
+
+// sendAndRecv sends the query, including the extra EDNS options, if
+// any, and waits for the response.
+func (c *DNSOverUDPConn) sendAndRecv(ctx context.Context,
+	conn net.Conn, txp *minest.DNSOverUDPTransport, query *dnscodec.Query) (*dnscodec.Response, error) {
+	queryMsg, err := dnsSendQueryUDP(ctx, txp, conn, query, c.ExtraEDNSOptions)
+	if err != nil {
+		return nil, err
+	}
+	return txp.RecvResponse(ctx, conn, queryMsg)
+}
+
+// ExchangeCollectDuplicates performs a DNS exchange over UDP and keeps
+// reading responses until the context is done, which is useful to detect
+// censorship based on injecting spoofed responses. Each dnsResponse event
+// after the first includes dnsResponseInterarrivalMs (see
+// [DNSExchangeLogContext.MakeResponseObserver]).
+//
+// The caller should use a context with a deadline, otherwise this method
+// blocks until the context is canceled or reading fails.
+//
+// Received datagrams that do not parse into a successful response to the
+// query (e.g., because the ID does not match) are logged as dnsResponse events
+// and skipped. Reading stops at the first read error or when the context is done.
+//
+// Returns the valid responses in order of arrival, or an error when no valid
+// response has been received. In the latter case, the error is the one that
+// stopped the collection or the last validation error, if any.
+//
+// Since a single server should send a single response, receiving more than
+// one valid response to the same query is a strong signal of injection. In
+// such a case, the dnsExchangeDone event includes dnsDuplicateResponses, the
+// number of valid responses received after the first one.
+//
+// This method may be called multiple times on the same connection.
+func (c *DNSOverUDPConn) ExchangeCollectDuplicates(
+	ctx context.Context, query *dnscodec.Query) ([]*dnscodec.Response, error) {
 	// 1. Get the owned connection
 	conn := c.conn
 
@@ -56,32 +304,293 @@ func (c *DNSOverUDPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 	t0 := c.TimeNow()
 	deadline, _ := ctx.Deadline()
 	var rqr []byte
-	lc := &DNSExchangeLogContext{
-		ErrClassifier:  c.ErrClassifier,
-		LocalAddr:      safeconn.LocalAddr(conn),
-		Logger:         c.Logger,
-		Protocol:       safeconn.Network(conn),
-		RemoteAddr:     safeconn.RemoteAddr(conn),
-		ServerProtocol: "udp",
-		TimeNow:        c.TimeNow,
-	}
+	lc := c.newLogContext(conn)
 
 	// 3. Create the transport
-	//
-	// Note: we're not going to dial, so let's use a dialer that panics
-	// if we attempt to dial (programmer error).
-	txp := minest.NewDNSOverUDPTransport(dnsUnusedDialer{}, netip.AddrPortFrom(netip.IPv4Unspecified(), 0))
+	txp := dnsNewUDPTransport()
 
-	// 4. Set observers for raw messages
+	// 4. Set observers for raw messages, keeping track of whether we have
+	// read a datagram, to distinguish read errors from validation errors
+	var received bool
+	observeResponse := lc.MakeResponseObserver(t0, &rqr)
 	txp.ObserveRawQuery = lc.MakeQueryObserver(t0, &rqr)
-	txp.ObserveRawResponse = lc.MakeResponseObserver(t0, &rqr)
+	txp.ObserveRawResponse = func(rawResp []byte) {
+		received = true
+		observeResponse(rawResp)
+	}
 
-	// 5. Execute with logging
-	lc.LogStart(t0, deadline)
-	resp, err := txp.ExchangeWithConn(ctx, conn, query)
-	lc.LogDone(t0, deadline, err)
+	// 5. Send the query
+	lc.LogStart(t0, deadline, dnsExtraEDNSOptionsAttrs(c.ExtraEDNSOptions)...)
+	queryMsg, err := dnsSendQueryUDP(ctx, txp, conn, query, c.ExtraEDNSOptions)
+	if err != nil {
+		lc.LogDone(t0, deadline, err)
+		return nil, err
+	}
 
-	return resp, err
+	// 6. Collect responses until the context is done or reading fails
+	var (
+		lastErr   error
+		responses []*dnscodec.Response
+	)
+	for ctx.Err() == nil {
+		received = false
+		resp, err := txp.RecvResponse(ctx, conn, queryMsg)
+		if err == nil {
+			responses = append(responses, resp)
+			continue
+		}
+		if !received {
+			// Preserve the validation error, if any, when the read
+			// fails because the context deadline has expired
+			if lastErr == nil || ctx.Err() == nil {
+				lastErr = err
+			}
+			break
+		}
+		lastErr = err
+	}
+
+	// 7. Log and return the outcome
+	switch {
+	case len(responses) > 0:
+		lastErr = nil
+	case lastErr == nil:
+		lastErr = ctx.Err()
+	}
+	var extra []any
+	if len(responses) > 1 {
+		extra = append(extra, slog.Int("dnsDuplicateResponses", len(responses)-1))
+	}
+	lc.LogDone(t0, deadline, lastErr, extra...)
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return responses, nil
+}
+
+// ExchangeDistinct performs n DNS exchanges over UDP using the same query and
+// returns how many times each address occurred in the A and AAAA answers, which
+// is useful to map load balancing and CDN behavior.
+//
+// Each exchange emits the same events as [*DNSOverUDPConn.Exchange]. When done,
+// this method emits a dnsDistinctDone event containing the frequency of each
+// address (dnsDistinctAddrs), the number of distinct addresses
+// (dnsDistinctCount), and the number of exchanges performed (dnsQueryCount)
+// and failed (dnsQueryFailures).
+//
+// A failed exchange does not stop the iteration. Returns an error, the one
+// from the last exchange, only when all the exchanges fail.
+//
+// This function panics if n is not positive.
+func (c *DNSOverUDPConn) ExchangeDistinct(
+	ctx context.Context, query *dnscodec.Query, n int) (map[netip.Addr]int, error) {
+	runtimex.Assert(n > 0)
+	t0 := c.TimeNow()
+	var (
+		failures int
+		lastErr  error
+	)
+	addrs := make(map[netip.Addr]int)
+	for range n {
+		resp, err := c.Exchange(ctx, query)
+		if err != nil {
+			failures++
+			lastErr = err
+			continue
+		}
+		for _, addr := range dnsResponseAddrs(resp) {
+			addrs[addr]++
+		}
+	}
+	if failures < n {
+		lastErr = nil
+	}
+	c.logDistinctDone(t0, addrs, n, failures, lastErr)
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return addrs, nil
+}
+
+// dnsResponseAddrs returns the addresses in the A and AAAA answers.
+func dnsResponseAddrs(resp *dnscodec.Response) (addrs []netip.Addr) {
+	for _, rr := range resp.ValidRRs {
+		var ip net.IP
+		switch rr := rr.(type) {
+		case *dns.A:
+			ip = rr.A
+		case *dns.AAAA:
+			ip = rr.AAAA
+		default:
+			continue
+		}
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return
+}
+
+func (c *DNSOverUDPConn) logDistinctDone(
+	t0 time.Time, addrs map[netip.Addr]int, count, failures int, err error) {
+	distinct := make(map[string]int, len(addrs))
+	for addr, freq := range addrs {
+		distinct[addr.String()] = freq
+	}
+	c.Logger.Info(
+		"dnsDistinctDone",
+		slog.Any("dnsDistinctAddrs", distinct),
+		slog.Int("dnsDistinctCount", len(distinct)),
+		slog.Int("dnsQueryCount", count),
+		slog.Int("dnsQueryFailures", failures),
+		slog.Any("err", err),
+		slog.String("errClass", c.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(c.conn)),
+		slog.String("protocol", safeconn.Network(c.conn)),
+		slog.String("remoteAddr", connRemoteAddr(c.conn)),
+		slog.String("serverProtocol", "udp"),
+		slog.Time("t0", t0),
+		slog.Time("t", c.TimeNow()),
+	)
+}
+
+// ReliabilityStats tallies the outcomes of the exchanges performed by
+// [*DNSOverUDPConn.ExchangeReliability].
+type ReliabilityStats struct {
+	// Queries is the number of exchanges performed.
+	Queries int
+
+	// NoError is the number of responses with the NOERROR RCODE.
+	NoError int
+
+	// NXDomain is the number of responses with the NXDOMAIN RCODE.
+	NXDomain int
+
+	// ServFail is the number of responses with the SERVFAIL RCODE.
+	ServFail int
+
+	// Refused is the number of responses with the REFUSED RCODE.
+	Refused int
+
+	// Timeout is the number of exchanges that did not receive
+	// a response before the deadline expired.
+	Timeout int
+
+	// Other is the number of exchanges with any other outcome, including
+	// other RCODEs, invalid responses, and network errors.
+	Other int
+}
+
+// ExchangeReliability performs n DNS exchanges over UDP using the same query
+// and tallies their outcomes by RCODE, which is useful to study the reliability
+// of resolvers (e.g., the rate of SERVFAIL and REFUSED responses).
+//
+// Each exchange emits the same events as [*DNSOverUDPConn.Exchange], and
+// all the exchanges share ctx. When done, this method emits a
+// dnsReliabilityDone event containing the number of exchanges performed
+// (dnsQueryCount) and the counters of [ReliabilityStats] as dnsRcodeNoError,
+// dnsRcodeNXDomain, dnsRcodeServFail, dnsRcodeRefused, dnsTimeouts, and
+// dnsOtherFailures.
+//
+// The returned stats are always valid. The returned error, the one from the
+// last exchange, is not nil only when no exchange received a response.
+//
+// This function panics if n is not positive.
+func (c *DNSOverUDPConn) ExchangeReliability(
+	ctx context.Context, query *dnscodec.Query, n int) (ReliabilityStats, error) {
+	runtimex.Assert(n > 0)
+	t0 := c.TimeNow()
+	var (
+		lastErr   error
+		responses int
+		stats     ReliabilityStats
+	)
+	for range n {
+		_, rcode, err := c.exchange(ctx, query)
+		stats.Queries++
+		if err != nil {
+			lastErr = err
+		}
+		switch {
+		case err != nil && dnsDeadlineExceeded(err):
+			stats.Timeout++
+			continue
+		case err != nil && !dnsIsRcodeError(err):
+			stats.Other++
+			continue
+		}
+		responses++
+		switch rcode {
+		case dns.RcodeSuccess:
+			stats.NoError++
+		case dns.RcodeNameError:
+			stats.NXDomain++
+		case dns.RcodeServerFailure:
+			stats.ServFail++
+		case dns.RcodeRefused:
+			stats.Refused++
+		default:
+			stats.Other++
+		}
+	}
+	if responses > 0 {
+		lastErr = nil
+	}
+	c.logReliabilityDone(t0, stats, lastErr)
+	return stats, lastErr
+}
+
+// dnsIsRcodeError returns whether err derives from the RCODE of a valid
+// response (see [dnscodec.ResponseErrorFromRCODE]) or from the response
+// lacking pertinent answers.
+func dnsIsRcodeError(err error) bool {
+	return errors.Is(err, dnscodec.ErrNoName) ||
+		errors.Is(err, dnscodec.ErrServerMisbehaving) ||
+		errors.Is(err, dnscodec.ErrServerTemporarilyMisbehaving) ||
+		errors.Is(err, dnscodec.ErrNoData)
+}
+
+func (c *DNSOverUDPConn) logReliabilityDone(t0 time.Time, stats ReliabilityStats, err error) {
+	c.Logger.Info(
+		"dnsReliabilityDone",
+		slog.Int("dnsOtherFailures", stats.Other),
+		slog.Int("dnsQueryCount", stats.Queries),
+		slog.Int("dnsRcodeNXDomain", stats.NXDomain),
+		slog.Int("dnsRcodeNoError", stats.NoError),
+		slog.Int("dnsRcodeRefused", stats.Refused),
+		slog.Int("dnsRcodeServFail", stats.ServFail),
+		slog.Int("dnsTimeouts", stats.Timeout),
+		slog.Any("err", err),
+		slog.String("errClass", c.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(c.conn)),
+		slog.String("protocol", safeconn.Network(c.conn)),
+		slog.String("remoteAddr", connRemoteAddr(c.conn)),
+		slog.String("serverProtocol", "udp"),
+		slog.Time("t0", t0),
+		slog.Time("t", c.TimeNow()),
+	)
+}
+
+// newLogContext returns the [*DNSExchangeLogContext] for an exchange using conn.
+func (c *DNSOverUDPConn) newLogContext(conn net.Conn) *DNSExchangeLogContext {
+	return &DNSExchangeLogContext{
+		DecodeResponses: c.DecodeResponses,
+		ErrClassifier:   c.ErrClassifier,
+		LocalAddr:       connLocalAddr(conn),
+		Logger:          c.Logger,
+		Protocol:        safeconn.Network(conn),
+		RemoteAddr:      connRemoteAddr(conn),
+		ServerProtocol:  "udp",
+		TimeNow:         c.TimeNow,
+	}
+}
+
+// dnsNewUDPTransport returns the [*minest.DNSOverUDPTransport] for an exchange.
+//
+// Note: we're not going to dial, so let's use a dialer that panics
+// if we attempt to dial (programmer error).
+func dnsNewUDPTransport() *minest.DNSOverUDPTransport {
+	return minest.NewDNSOverUDPTransport(dnsUnusedDialer{}, netip.AddrPortFrom(netip.IPv4Unspecified(), 0))
 }
 
 // DNSOverUDPConnFunc wraps a net.Conn into a [*DNSOverUDPConn].
@@ -91,16 +600,66 @@ func (c *DNSOverUDPConn) Exchange(ctx context.Context, query *dnscodec.Query) (*
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type DNSOverUDPConnFunc struct {
+	// Connect is the [Func] used to create a new socket for each query
+	// when RotateSourcePort is true. Set it to a pipeline starting with a
+	// [*ConnectFunc] (e.g., followed by an [*ObserveConnFunc]) to observe
+	// the new sockets like any other connection.
+	//
+	// Set by [NewDNSOverUDPConnFunc] to a [*ConnectFunc] constructed
+	// from cfg and logger using the "udp" network.
+	Connect Func[netip.AddrPort, net.Conn]
+
+	// DecodeResponses enables logging fields decoded from the response
+	// in the dnsExchangeDone event (see [DNSExchangeLogContext.LogDone]).
+	//
+	// Set by [NewDNSOverUDPConnFunc] to false.
+	DecodeResponses bool
+
 	// ErrClassifier classifies errors for structured logging.
 	//
 	// Set by [NewDNSOverUDPConnFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// ExtraEDNSOptions contains arbitrary EDNS options, including options
+	// using unknown codes, to add to the OPT record of each query, which is
+	// useful for robustness testing of resolvers. When not empty, the
+	// dnsExchangeStart event lists their codes as dnsExtraEdnsOptions and
+	// the dnsQuery event contains the query including them.
+	//
+	// Set by [NewDNSOverUDPConnFunc] to nil.
+	ExtraEDNSOptions []dns.EDNS0
+
+	// LateResponseGrace is the time [*DNSOverUDPConn.Exchange] keeps reading
+	// after the exchange timed out to log the responses arriving after the
+	// deadline, which is useful for spoofing and latency studies, or zero to
+	// disable reading late responses. Exchange blocks while reading and the
+	// connection must outlive the context (i.e., do not use a [CancelWatchFunc]
+	// bound to the exchange context), as documented by [*DNSOverUDPConn.Exchange].
+	//
+	// Set by [NewDNSOverUDPConnFunc] to zero.
+	LateResponseGrace time.Duration
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewDNSOverUDPConnFunc] to the user-provided logger.
 	Logger SLogger
 
+	// NearTruncationMargin is the margin, in bytes, below the UDP buffer
+	// size advertised by the query within which [*DNSOverUDPConn.Exchange]
+	// logs dnsNearTruncation=true, which reveals responses close to being
+	// truncated or fragmented. With zero, only responses filling the buffer
+	// are flagged.
+	//
+	// Set by [NewDNSOverUDPConnFunc] to zero.
+	NearTruncationMargin int
+
+	// RotateSourcePort enables sending each query from a new socket, thus
+	// using a new source port, rather than from the wrapped connection (see
+	// [*DNSOverUDPConn.Exchange]), which is useful for anti-spoofing research.
+	//
+	// Set by [NewDNSOverUDPConnFunc] to false.
+	RotateSourcePort bool
+
 	// TimeNow is the function to get the current time (configurable for testing).
 	//
 	// Set by [NewDNSOverUDPConnFunc] from [Config.TimeNow].
@@ -114,6 +673,7 @@ type DNSOverUDPConnFunc struct {
 // The logger argument is the [SLogger] to use for structured logging.
 func NewDNSOverUDPConnFunc(cfg *Config, logger SLogger) *DNSOverUDPConnFunc {
 	return &DNSOverUDPConnFunc{
+		Connect:       NewConnectFunc(cfg, "udp", logger),
 		ErrClassifier: cfg.ErrClassifier,
 		Logger:        logger,
 		TimeNow:       cfg.TimeNow,
@@ -125,9 +685,15 @@ var _ Func[net.Conn, *DNSOverUDPConn] = &DNSOverUDPConnFunc{}
 // Call wraps the net.Conn into a DNSOverUDPConn.
 func (op *DNSOverUDPConnFunc) Call(ctx context.Context, conn net.Conn) (*DNSOverUDPConn, error) {
 	return &DNSOverUDPConn{
-		conn:          conn,
-		ErrClassifier: op.ErrClassifier,
-		Logger:        op.Logger,
-		TimeNow:       op.TimeNow,
+		conn:                 conn,
+		Connect:              op.Connect,
+		DecodeResponses:      op.DecodeResponses,
+		ErrClassifier:        op.ErrClassifier,
+		ExtraEDNSOptions:     op.ExtraEDNSOptions,
+		LateResponseGrace:    op.LateResponseGrace,
+		Logger:               op.Logger,
+		NearTruncationMargin: op.NearTruncationMargin,
+		RotateSourcePort:     op.RotateSourcePort,
+		TimeNow:              op.TimeNow,
 	}, nil
 }
@@ -5,9 +5,17 @@ package nop
 import (
 	"context"
 	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
 	"github.com/miekg/dns"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,6 +29,8 @@ func TestNewDNSOverUDPConnFunc(t *testing.T) {
 	fn := NewDNSOverUDPConnFunc(cfg, logger)
 
 	require.NotNil(t, fn)
+	require.IsType(t, &ConnectFunc{}, fn.Connect)
+	assert.Equal(t, "udp", fn.Connect.(*ConnectFunc).Network)
 	assert.NotNil(t, fn.Logger)
 	assert.NotNil(t, fn.TimeNow)
 	assert.NotNil(t, fn.ErrClassifier)
@@ -94,3 +104,1014 @@ func TestDNSOverUDPConnExchangeWriteError(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+// Exchange logs dnsIcmpError when the read fails because of an ICMP error.
+func TestDNSOverUDPConnExchangeICMPError(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// errno is the error returned by the read.
+		errno syscall.Errno
+
+		// wantReason is the expected dnsIcmpError value (empty if absent).
+		wantReason string
+	}{
+		{name: "port unreachable", errno: syscall.ECONNREFUSED, wantReason: "portUnreachable"},
+		{name: "host unreachable", errno: syscall.EHOSTUNREACH, wantReason: "hostUnreachable"},
+		{name: "network unreachable", errno: syscall.ENETUNREACH, wantReason: "networkUnreachable"},
+		{name: "other error", errno: syscall.ECONNRESET, wantReason: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockConn := newMinimalConn()
+			mockConn.LocalAddrFunc = func() net.Addr {
+				return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 54321}
+			}
+			mockConn.WriteFunc = func(b []byte) (int, error) {
+				return len(b), nil
+			}
+			mockConn.ReadFunc = func(b []byte) (int, error) {
+				return 0, &net.OpError{Op: "read", Net: "udp", Err: os.NewSyscallError("recvfrom", tt.errno)}
+			}
+
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverUDPConnFunc(NewConfig(), logger)
+			result, err := fn.Call(context.Background(), mockConn)
+			require.NoError(t, err)
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			_, err = result.Exchange(context.Background(), query)
+			require.ErrorIs(t, err, tt.errno)
+
+			done := (*records)[len(*records)-1]
+			require.Equal(t, "dnsExchangeDone", done.Message)
+			reason, found := findAttr(done, "dnsIcmpError")
+			if tt.wantReason == "" {
+				assert.False(t, found)
+				return
+			}
+			require.True(t, found)
+			assert.Equal(t, tt.wantReason, reason.String())
+		})
+	}
+}
+
+// newDNSDatagramServerConn returns a [*netstub.FuncConn] emulating a DNS
+// server sending one datagram for each entry of script after the query.
+//
+// Before delivering each datagram, the read advances the clock returned by
+// the timeNow function by the entry's delay. Once the script is exhausted, the
+// read cancels the context using cancel and fails with a deadline error.
+func newDNSDatagramServerConn(cancel context.CancelFunc, script []dnsScriptedDatagram) (
+	*netstub.FuncConn, func() time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var query *dns.Msg
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	conn.ReadFunc = func(b []byte) (int, error) {
+		if len(script) <= 0 {
+			cancel()
+			return 0, os.ErrDeadlineExceeded
+		}
+		entry := script[0]
+		script = script[1:]
+		now = now.Add(entry.delay)
+		resp := newDNSResponse(query, entry.addr)
+		resp.Id += entry.idDelta
+		return copy(b, runtimex.PanicOnError1(resp.Pack())), nil
+	}
+	return conn, func() time.Time { return now }
+}
+
+// dnsScriptedDatagram is a datagram sent by [newDNSDatagramServerConn].
+type dnsScriptedDatagram struct {
+	// addr is the A record to include in the response.
+	addr string
+
+	// delay is the time elapsed since the previous datagram.
+	delay time.Duration
+
+	// idDelta is added to the response ID to make it mismatch.
+	idDelta uint16
+}
+
+// ExchangeCollectDuplicates collects the valid responses, skips the
+// invalid ones, and logs the interarrival time of each response.
+func TestDNSOverUDPConnExchangeCollectDuplicates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mockConn, timeNow := newDNSDatagramServerConn(cancel, []dnsScriptedDatagram{
+		{addr: "10.10.34.35", delay: 5 * time.Millisecond},
+		{addr: "130.192.91.211", delay: 12 * time.Millisecond, idDelta: 1},
+		{addr: "130.192.91.211", delay: 30 * time.Millisecond},
+	})
+
+	logger, records := newCapturingLogger()
+	cfg := NewConfig()
+	cfg.TimeNow = timeNow
+	fn := NewDNSOverUDPConnFunc(cfg, logger)
+	conn, err := fn.Call(ctx, mockConn)
+	require.NoError(t, err)
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	responses, err := conn.ExchangeCollectDuplicates(ctx, query)
+	require.NoError(t, err)
+	require.Len(t, responses, 2)
+	addrs0, err := responses[0].RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.10.34.35"}, addrs0)
+	addrs1, err := responses[1].RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"130.192.91.211"}, addrs1)
+
+	var interarrivals []int64
+	for _, record := range *records {
+		if record.Message != "dnsResponse" {
+			continue
+		}
+		if value, found := findAttr(record, "dnsResponseInterarrivalMs"); found {
+			interarrivals = append(interarrivals, value.Int64())
+		}
+	}
+	assert.Equal(t, []int64{12, 30}, interarrivals)
+
+	done := (*records)[len(*records)-1]
+	require.Equal(t, "dnsExchangeDone", done.Message)
+	errValue, found := findAttr(done, "err")
+	require.True(t, found)
+	assert.Nil(t, errValue.Any())
+}
+
+// ExchangeCollectDuplicates fails when no valid response is received.
+func TestDNSOverUDPConnExchangeCollectDuplicatesNoResponse(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// script is the sequence of datagrams to send.
+		script []dnsScriptedDatagram
+
+		// wantErr is the expected error.
+		wantErr error
+	}{
+		{
+			name:    "no datagrams",
+			script:  nil,
+			wantErr: os.ErrDeadlineExceeded,
+		},
+		{
+			name:    "only invalid datagrams",
+			script:  []dnsScriptedDatagram{{addr: "10.10.34.35", idDelta: 1}},
+			wantErr: dnscodec.ErrInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mockConn, timeNow := newDNSDatagramServerConn(cancel, tt.script)
+
+			logger, records := newCapturingLogger()
+			cfg := NewConfig()
+			cfg.TimeNow = timeNow
+			fn := NewDNSOverUDPConnFunc(cfg, logger)
+			conn, err := fn.Call(ctx, mockConn)
+			require.NoError(t, err)
+
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			responses, err := conn.ExchangeCollectDuplicates(ctx, query)
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, responses)
+
+			done := (*records)[len(*records)-1]
+			require.Equal(t, "dnsExchangeDone", done.Message)
+			errValue, found := findAttr(done, "err")
+			require.True(t, found)
+			assert.ErrorIs(t, errValue.Any().(error), tt.wantErr)
+		})
+	}
+}
+
+// ExchangeCollectDuplicates logs dnsDuplicateResponses on dnsExchangeDone when
+// more than one valid response arrives, ignoring invalid ones.
+func TestDNSOverUDPConnExchangeCollectDuplicatesLogsDuplicateResponses(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// script is the sequence of datagrams to send.
+		script []dnsScriptedDatagram
+
+		// wantFound indicates whether we expect dnsDuplicateResponses.
+		wantFound bool
+
+		// want is the expected dnsDuplicateResponses.
+		want int64
+	}{
+		{
+			name:      "single response",
+			script:    []dnsScriptedDatagram{{addr: "130.192.91.211", delay: 5 * time.Millisecond}},
+			wantFound: false,
+		},
+
+		{
+			name: "single valid response and invalid ones",
+			script: []dnsScriptedDatagram{
+				{addr: "10.10.34.35", delay: 5 * time.Millisecond, idDelta: 1},
+				{addr: "130.192.91.211", delay: 12 * time.Millisecond},
+			},
+			wantFound: false,
+		},
+
+		{
+			name: "injected responses",
+			script: []dnsScriptedDatagram{
+				{addr: "10.10.34.35", delay: 5 * time.Millisecond},
+				{addr: "10.10.34.36", delay: 7 * time.Millisecond},
+				{addr: "130.192.91.211", delay: 30 * time.Millisecond},
+			},
+			wantFound: true,
+			want:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mockConn, timeNow := newDNSDatagramServerConn(cancel, tt.script)
+
+			logger, records := newCapturingLogger()
+			cfg := NewConfig()
+			cfg.TimeNow = timeNow
+			conn, err := NewDNSOverUDPConnFunc(cfg, logger).Call(ctx, mockConn)
+			require.NoError(t, err)
+
+			_, err = conn.ExchangeCollectDuplicates(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+
+			require.NoError(t, err)
+			done := (*records)[len(*records)-1]
+			require.Equal(t, "dnsExchangeDone", done.Message)
+			value, found := findAttr(done, "dnsDuplicateResponses")
+			require.Equal(t, tt.wantFound, found)
+			if tt.wantFound {
+				assert.Equal(t, tt.want, value.Int64())
+			}
+		})
+	}
+}
+
+// ExchangeCollectDuplicates propagates write errors from the underlying connection.
+func TestDNSOverUDPConnExchangeCollectDuplicatesWriteError(t *testing.T) {
+	wantErr := errors.New("write error")
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return 0, wantErr
+	}
+
+	fn := NewDNSOverUDPConnFunc(NewConfig(), DefaultSLogger())
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	responses, err := conn.ExchangeCollectDuplicates(context.Background(), query)
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, responses)
+}
+
+// Exchange over a connection bound to a specific source port logs
+// that port as part of localAddr in dnsQuery and dnsResponse.
+func TestDNSOverUDPConnExchangeLocalAddr(t *testing.T) {
+	// 1. Start a DNS server on the loopback interface
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+	go func() {
+		buffer := make([]byte, 1500)
+		count, addr, err := server.ReadFrom(buffer)
+		if err != nil {
+			return
+		}
+		query := new(dns.Msg)
+		if err := query.Unpack(buffer[:count]); err != nil {
+			return
+		}
+		server.WriteTo(runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack()), addr)
+	}()
+
+	// 2. Find an available source port
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	localAddr := probe.LocalAddr().(*net.UDPAddr)
+	probe.Close()
+
+	// 3. Connect using the source port and perform the exchange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	logger, records := newCapturingLogger()
+	cfg := NewConfig()
+	connectOp := NewConnectFunc(cfg, "udp", logger)
+	connectOp.LocalAddr = localAddr
+	pipeline := Compose2(connectOp, NewDNSOverUDPConnFunc(cfg, logger))
+	conn, err := pipeline.Call(ctx, netip.MustParseAddrPort(server.LocalAddr().String()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	_, err = conn.Exchange(ctx, query)
+	require.NoError(t, err)
+
+	// 4. Make sure the source port was honored and logged
+	start, found := findRecord(*records, "connectStart")
+	require.True(t, found)
+	requested, found := findAttr(start, "requestedLocalAddr")
+	require.True(t, found)
+	assert.Equal(t, localAddr.String(), requested.String())
+	for _, msg := range []string{"dnsQuery", "dnsResponse"} {
+		record, found := findRecord(*records, msg)
+		require.True(t, found)
+		value, found := findAttr(record, "localAddr")
+		require.True(t, found)
+		assert.Equal(t, localAddr.String(), value.String())
+	}
+}
+
+// ExchangeDistinct tallies the addresses returned across the exchanges,
+// tolerates failed exchanges, and logs the dnsDistinctDone rollup.
+func TestDNSOverUDPConnExchangeDistinct(t *testing.T) {
+	// The server rotates among these address sets and fails the third read
+	addrSets := [][]string{
+		{"104.16.132.229", "104.16.133.229"},
+		{"104.16.133.229", "2606:4700::6810:84e5"},
+	}
+	var (
+		query *dns.Msg
+		reads int
+	)
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		defer func() { reads++ }()
+		if reads == 2 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(query)
+		for _, addr := range addrSets[reads%len(addrSets)] {
+			ip := net.ParseIP(addr)
+			hdr := dns.RR_Header{Name: query.Question[0].Name, Class: dns.ClassINET, Ttl: 300}
+			if ip.To4() != nil {
+				hdr.Rrtype = dns.TypeA
+				resp.Answer = append(resp.Answer, &dns.A{Hdr: hdr, A: ip})
+				continue
+			}
+			hdr.Rrtype = dns.TypeAAAA
+			resp.Answer = append(resp.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+		}
+		return copy(b, runtimex.PanicOnError1(resp.Pack())), nil
+	}
+
+	logger, records := newCapturingLogger()
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	// Note: the query type does not matter because the mock server
+	// includes both A and AAAA records in the responses
+	query0 := dnscodec.NewQuery("example.com", dns.TypeA)
+	addrs, err := conn.ExchangeDistinct(context.Background(), query0, 4)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[netip.Addr]int{
+		netip.MustParseAddr("104.16.132.229"):       1,
+		netip.MustParseAddr("104.16.133.229"):       3,
+		netip.MustParseAddr("2606:4700::6810:84e5"): 2,
+	}, addrs)
+
+	var exchanges int
+	for _, record := range *records {
+		if record.Message == "dnsExchangeDone" {
+			exchanges++
+		}
+	}
+	assert.Equal(t, 4, exchanges)
+
+	done := (*records)[len(*records)-1]
+	require.Equal(t, "dnsDistinctDone", done.Message)
+	count, found := findAttr(done, "dnsDistinctCount")
+	require.True(t, found)
+	assert.Equal(t, int64(3), count.Int64())
+	failures, found := findAttr(done, "dnsQueryFailures")
+	require.True(t, found)
+	assert.Equal(t, int64(1), failures.Int64())
+	distinct, found := findAttr(done, "dnsDistinctAddrs")
+	require.True(t, found)
+	assert.Equal(t, map[string]int{
+		"104.16.132.229":       1,
+		"104.16.133.229":       3,
+		"2606:4700::6810:84e5": 2,
+	}, distinct.Any())
+}
+
+// ExchangeDistinct fails when all the exchanges fail.
+func TestDNSOverUDPConnExchangeDistinctAllFailed(t *testing.T) {
+	wantErr := errors.New("write error")
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return 0, wantErr
+	}
+
+	logger, records := newCapturingLogger()
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	addrs, err := conn.ExchangeDistinct(context.Background(), query, 2)
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, addrs)
+	done := (*records)[len(*records)-1]
+	require.Equal(t, "dnsDistinctDone", done.Message)
+	failures, found := findAttr(done, "dnsQueryFailures")
+	require.True(t, found)
+	assert.Equal(t, int64(2), failures.Int64())
+}
+
+// ExchangeReliability tallies the outcomes of the exchanges by RCODE.
+func TestDNSOverUDPConnExchangeReliability(t *testing.T) {
+	// The server answers with these RCODEs in order, where -1 means timing out
+	script := []int{
+		dns.RcodeSuccess, dns.RcodeServerFailure, dns.RcodeRefused, -1,
+		dns.RcodeNameError, dns.RcodeServerFailure, dns.RcodeFormatError, dns.RcodeSuccess,
+	}
+	var query *dns.Msg
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		rcode := script[0]
+		script = script[1:]
+		if rcode < 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		resp := newDNSResponse(query, "130.192.91.211")
+		resp.Rcode = rcode
+		return copy(b, runtimex.PanicOnError1(resp.Pack())), nil
+	}
+
+	logger, records := newCapturingLogger()
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	stats, err := conn.ExchangeReliability(
+		context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), 8)
+
+	require.NoError(t, err)
+	assert.Equal(t, ReliabilityStats{
+		Queries:  8,
+		NoError:  2,
+		NXDomain: 1,
+		ServFail: 2,
+		Refused:  1,
+		Timeout:  1,
+		Other:    1,
+	}, stats)
+
+	done := (*records)[len(*records)-1]
+	require.Equal(t, "dnsReliabilityDone", done.Message)
+	for key, want := range map[string]int64{
+		"dnsQueryCount":    8,
+		"dnsRcodeNoError":  2,
+		"dnsRcodeNXDomain": 1,
+		"dnsRcodeServFail": 2,
+		"dnsRcodeRefused":  1,
+		"dnsTimeouts":      1,
+		"dnsOtherFailures": 1,
+	} {
+		value, found := findAttr(done, key)
+		require.True(t, found, key)
+		assert.Equal(t, want, value.Int64(), key)
+	}
+	value, found := findAttr(done, "err")
+	require.True(t, found)
+	assert.Nil(t, value.Any())
+}
+
+// ExchangeReliability fails when no exchange receives a response.
+func TestDNSOverUDPConnExchangeReliabilityNoResponse(t *testing.T) {
+	wantErr := errors.New("write error")
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return 0, wantErr
+	}
+
+	logger, records := newCapturingLogger()
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	stats, err := conn.ExchangeReliability(
+		context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), 2)
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Equal(t, ReliabilityStats{Queries: 2, Other: 2}, stats)
+	done := (*records)[len(*records)-1]
+	require.Equal(t, "dnsReliabilityDone", done.Message)
+	value, found := findAttr(done, "dnsOtherFailures")
+	require.True(t, found)
+	assert.Equal(t, int64(2), value.Int64())
+}
+
+// ExchangeReliability panics when n is not positive.
+func TestDNSOverUDPConnExchangeReliabilityPanics(t *testing.T) {
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), DefaultSLogger()).Call(
+		context.Background(), newMinimalConn())
+	require.NoError(t, err)
+
+	assert.Panics(t, func() {
+		conn.ExchangeReliability(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA), 0)
+	})
+}
+
+// newDNSServerUDPConn returns a [*netstub.FuncConn] connected to 8.8.8.8:53
+// using the given local port and answering each query.
+func newDNSServerUDPConn(localPort int) *netstub.FuncConn {
+	var query *dns.Msg
+	conn := newMinimalConn()
+	conn.LocalAddrFunc = func() net.Addr {
+		return &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: localPort}
+	}
+	conn.RemoteAddrFunc = func() net.Addr {
+		return &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 53}
+	}
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	conn.ReadFunc = func(b []byte) (int, error) {
+		return copy(b, runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())), nil
+	}
+	return conn
+}
+
+// Exchange uses the same source port for all the queries by default and
+// a new source port for each query when RotateSourcePort is true.
+func TestDNSOverUDPConnExchangeSourcePort(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// rotate is the value of RotateSourcePort.
+		rotate bool
+
+		// wantLocalAddrs contains the expected localAddr of each exchange.
+		wantLocalAddrs []string
+	}{
+		{
+			name:           "stable",
+			rotate:         false,
+			wantLocalAddrs: []string{"10.0.0.1:40000", "10.0.0.1:40000", "10.0.0.1:40000"},
+		},
+
+		{
+			name:           "rotating",
+			rotate:         true,
+			wantLocalAddrs: []string{"10.0.0.1:40001", "10.0.0.1:40002", "10.0.0.1:40003"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var closed int
+			cfg := NewConfig()
+			cfg.Dialer = &netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					assert.Equal(t, "udp", network)
+					assert.Equal(t, "8.8.8.8:53", address)
+					conn := newDNSServerUDPConn(40001 + closed)
+					conn.CloseFunc = func() error {
+						closed++
+						return nil
+					}
+					return conn, nil
+				},
+			}
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverUDPConnFunc(cfg, logger)
+			fn.RotateSourcePort = tt.rotate
+			conn, err := fn.Call(context.Background(), newDNSServerUDPConn(40000))
+			require.NoError(t, err)
+
+			for range len(tt.wantLocalAddrs) {
+				_, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+				require.NoError(t, err)
+			}
+
+			var localAddrs []string
+			for _, record := range *records {
+				if record.Message != "dnsExchangeDone" {
+					continue
+				}
+				localAddr, found := findAttr(record, "localAddr")
+				require.True(t, found)
+				localAddrs = append(localAddrs, localAddr.String())
+				stable, found := findAttr(record, "dnsSourcePortStable")
+				require.True(t, found)
+				assert.Equal(t, !tt.rotate, stable.Bool())
+			}
+			assert.Equal(t, tt.wantLocalAddrs, localAddrs)
+			var connects int
+			for _, record := range *records {
+				if record.Message == "connectDone" {
+					connects++
+				}
+			}
+			if tt.rotate {
+				assert.Equal(t, len(tt.wantLocalAddrs), connects, "should connect each rotated socket")
+			} else {
+				assert.Equal(t, 0, connects)
+			}
+			if tt.rotate {
+				assert.Equal(t, len(tt.wantLocalAddrs), closed, "should close each rotated socket")
+			}
+		})
+	}
+}
+
+// Exchange logs and returns the error when creating a new socket fails.
+func TestDNSOverUDPConnExchangeRotateSourcePortDialError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, wantErr
+		},
+	}
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverUDPConnFunc(cfg, logger)
+	fn.RotateSourcePort = true
+	conn, err := fn.Call(context.Background(), newDNSServerUDPConn(40000))
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.ErrorIs(t, err, wantErr)
+	require.Len(t, *records, 4)
+	assert.Equal(t, "connectStart", (*records)[0].Message)
+	assert.Equal(t, "connectDone", (*records)[1].Message)
+	assert.Equal(t, "dnsExchangeStart", (*records)[2].Message)
+	assert.Equal(t, "dnsExchangeDone", (*records)[3].Message)
+	value, found := findAttr((*records)[3], "err")
+	require.True(t, found)
+	assert.Equal(t, wantErr, value.Any())
+	localAddr, found := findAttr((*records)[3], "localAddr")
+	require.True(t, found)
+	assert.Equal(t, "", localAddr.String(), "should not log the address of the owned socket")
+}
+
+// Exchange creates the rotated sockets using the configured Connect pipeline.
+func TestDNSOverUDPConnExchangeRotateSourcePortCustomConnect(t *testing.T) {
+	var addresses []netip.AddrPort
+	fn := NewDNSOverUDPConnFunc(NewConfig(), DefaultSLogger())
+	fn.Connect = FuncAdapter[netip.AddrPort, net.Conn](func(ctx context.Context, address netip.AddrPort) (net.Conn, error) {
+		addresses = append(addresses, address)
+		conn := newDNSServerUDPConn(40001)
+		conn.CloseFunc = func() error {
+			return nil
+		}
+		return conn, nil
+	})
+	fn.RotateSourcePort = true
+	conn, err := fn.Call(context.Background(), newDNSServerUDPConn(40000))
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	assert.Equal(t, []netip.AddrPort{netip.MustParseAddrPort("8.8.8.8:53")}, addresses)
+}
+
+// Exchange logs dnsIdMatched and returns ErrDNSIdMismatch when the response ID differs.
+func TestDNSOverUDPConnExchangeIDMismatch(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// idDelta is added to the response ID.
+		idDelta uint16
+
+		// wantErr is the expected error, if any.
+		wantErr error
+
+		// wantMatched is the expected dnsIdMatched value.
+		wantMatched bool
+	}{
+		{name: "matching ID", idDelta: 0, wantErr: nil, wantMatched: true},
+		{name: "mismatched ID", idDelta: 1, wantErr: ErrDNSIdMismatch, wantMatched: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			mockConn, _ := newDNSDatagramServerConn(cancel, []dnsScriptedDatagram{
+				{addr: "130.192.91.211", idDelta: tt.idDelta},
+			})
+			logger, records := newCapturingLogger()
+			conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(ctx, mockConn)
+			require.NoError(t, err)
+
+			_, err = conn.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+			} else {
+				require.NoError(t, err)
+			}
+
+			done, found := findRecord(*records, "dnsExchangeDone")
+			require.True(t, found)
+			matched, found := findAttr(done, "dnsIdMatched")
+			require.True(t, found)
+			assert.Equal(t, tt.wantMatched, matched.Bool())
+		})
+	}
+}
+
+// newDNSLateResponseServerConn returns a [*netstub.FuncConn] emulating a DNS
+// server whose response arrives after the exchange timed out. The first read
+// fails with a deadline error, the second read advances the clock returned by
+// the timeNow function by lateBy and delivers the response, and the following
+// reads fail with a deadline error. The returned slice pointer collects the
+// read deadlines set on the conn.
+func newDNSLateResponseServerConn(lateBy time.Duration) (*netstub.FuncConn, func() time.Time, *[]time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var (
+		deadlines []time.Time
+		query     *dns.Msg
+		reads     int
+	)
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	conn.ReadFunc = func(b []byte) (int, error) {
+		reads++
+		if reads != 2 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		now = now.Add(lateBy)
+		return copy(b, runtimex.PanicOnError1(newDNSResponse(query, "10.10.34.35").Pack())), nil
+	}
+	conn.SetReadDeadFunc = func(t time.Time) error {
+		deadlines = append(deadlines, t)
+		return nil
+	}
+	return conn, func() time.Time { return now }, &deadlines
+}
+
+// Exchange logs the responses arriving after the deadline when
+// LateResponseGrace is set, but still returns the deadline error.
+func TestDNSOverUDPConnExchangeLateResponse(t *testing.T) {
+	mockConn, timeNow, deadlines := newDNSLateResponseServerConn(40 * time.Millisecond)
+	logger, records := newCapturingLogger()
+	cfg := NewConfig()
+	cfg.TimeNow = timeNow
+	fn := NewDNSOverUDPConnFunc(cfg, logger)
+	fn.LateResponseGrace = 100 * time.Millisecond
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	resp, err := conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Nil(t, resp)
+	var messages []string
+	for _, record := range *records {
+		messages = append(messages, record.Message)
+	}
+	assert.Equal(t, []string{"dnsExchangeStart", "dnsQuery", "dnsExchangeDone", "dnsLateResponse"}, messages)
+
+	late := (*records)[3]
+	value, found := findAttr(late, "dnsLateByMs")
+	require.True(t, found)
+	assert.Equal(t, int64(40), value.Int64())
+	value, found = findAttr(late, "dnsRawResponse")
+	require.True(t, found)
+	msg := new(dns.Msg)
+	require.NoError(t, msg.Unpack(value.Any().([]byte)))
+	require.Len(t, msg.Answer, 1)
+	assert.Equal(t, "10.10.34.35", msg.Answer[0].(*dns.A).A.String())
+
+	require.Len(t, *deadlines, 2)
+	assert.False(t, (*deadlines)[0].IsZero())
+	assert.True(t, (*deadlines)[1].IsZero(), "should clear the read deadline")
+}
+
+// Exchange does not log late responses when a CancelWatchFunc bound to the
+// same context closes the connection once the deadline expires.
+func TestDNSOverUDPConnExchangeLateResponseCancelWatch(t *testing.T) {
+	closed := make(chan struct{})
+	var reads int
+	mockConn := newMinimalConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return len(b), nil
+	}
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		reads++
+		<-closed
+		if reads == 1 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		return 0, net.ErrClosed
+	}
+	mockConn.CloseFunc = func() error {
+		close(closed)
+		return nil
+	}
+	mockConn.SetDeadlineFunc = func(t time.Time) error {
+		return nil
+	}
+	mockConn.SetReadDeadFunc = func(t time.Time) error {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	watched, err := NewCancelWatchFunc().Call(ctx, mockConn)
+	require.NoError(t, err)
+	logger, records := newCapturingLogger()
+	fn := NewDNSOverUDPConnFunc(NewConfig(), logger)
+	fn.LateResponseGrace = time.Hour
+	conn, err := fn.Call(ctx, watched)
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(ctx, dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, 2, reads, "should attempt reading late responses once")
+	_, found := findRecord(*records, "dnsLateResponse")
+	assert.False(t, found)
+}
+
+// Exchange does not read late responses when LateResponseGrace is zero.
+func TestDNSOverUDPConnExchangeLateResponseDisabled(t *testing.T) {
+	mockConn, timeNow, deadlines := newDNSLateResponseServerConn(40 * time.Millisecond)
+	logger, records := newCapturingLogger()
+	cfg := NewConfig()
+	cfg.TimeNow = timeNow
+	fn := NewDNSOverUDPConnFunc(cfg, logger)
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	assert.Equal(t, "dnsExchangeDone", (*records)[len(*records)-1].Message)
+	assert.Empty(t, *deadlines)
+}
+
+// Exchange logs dnsQueryFlagRD=true for queries built by dnscodec, which
+// always sets the Recursion Desired flag.
+func TestDNSOverUDPConnExchangeLogsQueryFlagRD(t *testing.T) {
+	logger, records := newCapturingLogger()
+	conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), newDNSServerUDPConn(54321))
+	require.NoError(t, err)
+
+	_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+	require.NoError(t, err)
+	query, found := findRecord(*records, "dnsQuery")
+	require.True(t, found)
+	value, found := findAttr(query, "dnsQueryFlagRD")
+	require.True(t, found)
+	assert.True(t, value.Bool())
+}
+
+// newDNSSizedResponseUDPConn returns a mock UDP conn replying to each query
+// with a response padded to exactly size bytes using EDNS(0) padding.
+func newDNSSizedResponseUDPConn(size int) *netstub.FuncConn {
+	conn := newDNSServerUDPConn(40000)
+	var query *dns.Msg
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query = new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b))
+		return len(b), nil
+	}
+	conn.ReadFunc = func(b []byte) (int, error) {
+		resp := newDNSResponse(query, "130.192.91.211")
+		resp.SetEdns0(dns.DefaultMsgSize, false)
+		unpadded := runtimex.PanicOnError1(resp.Pack())
+		padding := &dns.EDNS0_PADDING{Padding: make([]byte, size-len(unpadded)-4)}
+		resp.IsEdns0().Option = append(resp.IsEdns0().Option, padding)
+		return copy(b, runtimex.PanicOnError1(resp.Pack())), nil
+	}
+	return conn
+}
+
+// Exchange logs the response size relative to the advertised buffer size.
+func TestDNSOverUDPConnExchangeLogsNearTruncation(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// size is the size of the response.
+		size int
+
+		// wantNear is the expected dnsNearTruncation.
+		wantNear bool
+	}{
+		{
+			name:     "far from the buffer size",
+			size:     300,
+			wantNear: false,
+		},
+
+		{
+			name:     "within the margin",
+			size:     1200,
+			wantNear: true,
+		},
+
+		{
+			name:     "filling the buffer",
+			size:     1232,
+			wantNear: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			fn := NewDNSOverUDPConnFunc(NewConfig(), logger)
+			fn.NearTruncationMargin = 100
+			conn, err := fn.Call(context.Background(), newDNSSizedResponseUDPConn(tt.size))
+			require.NoError(t, err)
+			query := dnscodec.NewQuery("example.com", dns.TypeA)
+			query.MaxSize = dnscodec.QueryMaxResponseSizeUDP
+
+			_, err = conn.Exchange(context.Background(), query)
+
+			require.NoError(t, err)
+			done, found := findRecord(*records, "dnsExchangeDone")
+			require.True(t, found)
+			value, found := findAttr(done, "dnsResponseSize")
+			require.True(t, found)
+			assert.Equal(t, int64(tt.size), value.Int64())
+			value, found = findAttr(done, "dnsEdnsBufferSize")
+			require.True(t, found)
+			assert.Equal(t, int64(dnscodec.QueryMaxResponseSizeUDP), value.Int64())
+			value, found = findAttr(done, "dnsNearTruncation")
+			require.True(t, found)
+			assert.Equal(t, tt.wantNear, value.Bool())
+		})
+	}
+
+	t.Run("no response", func(t *testing.T) {
+		mockConn := newDNSServerUDPConn(40000)
+		mockConn.WriteFunc = func(b []byte) (int, error) {
+			return 0, errors.New("mocked write error")
+		}
+		logger, records := newCapturingLogger()
+		conn, err := NewDNSOverUDPConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+		require.NoError(t, err)
+
+		_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+
+		require.Error(t, err)
+		done, found := findRecord(*records, "dnsExchangeDone")
+		require.True(t, found)
+		_, found = findAttr(done, "dnsResponseSize")
+		assert.False(t, found)
+		_, found = findAttr(done, "dnsNearTruncation")
+		assert.False(t, found)
+	})
+}
+
+// dnsResponseSizeAttrs uses the 512 bytes limit when the query lacks an OPT record.
+func TestDNSResponseSizeAttrsWithoutOPT(t *testing.T) {
+	rawQuery := runtimex.PanicOnError1(new(dns.Msg).SetQuestion("example.com.", dns.TypeA).Pack())
+
+	attrs := dnsResponseSizeAttrs(rawQuery, make([]byte, 500), 16)
+
+	assert.Equal(t, []any{
+		slog.Int("dnsEdnsBufferSize", 512),
+		slog.Bool("dnsNearTruncation", true),
+		slog.Int("dnsResponseSize", 500),
+	}, attrs)
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"log/slog"
+	"net"
+	"slices"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// dnsPartialResponseMaxSize is the maximum number of bytes recorded by
+// [dnsPartialResponseConn], that is, a length prefix followed by the largest
+// response accepted by the DNS-over-TCP and DNS-over-TLS transports.
+const dnsPartialResponseMaxSize = 2 + dnscodec.QueryMaxResponseSizeTCP
+
+// dnsPartialResponseConn wraps a [net.Conn] used by a single DNS-over-TCP
+// or DNS-over-TLS exchange to record the raw bytes it reads, including the
+// 2-byte length prefix, so that we can log what arrived before an error.
+type dnsPartialResponseConn struct {
+	net.Conn
+
+	// read contains the bytes read so far.
+	read []byte
+}
+
+// Read implements [net.Conn].
+func (c *dnsPartialResponseConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	if room := dnsPartialResponseMaxSize - len(c.read); room > 0 {
+		c.read = append(c.read, b[:min(max(count, 0), room)]...)
+	}
+	return count, err
+}
+
+// attrs returns the dnsExchangeDone attributes describing the partial
+// response, or nil when the exchange succeeded or did not read any byte.
+//
+// We log the raw bytes read before the error as dnsPartialResponse. Since
+// the conn is used by a single exchange, we hand over the recorded bytes
+// rather than copying them, and we release them when the exchange succeeds.
+func (c *dnsPartialResponseConn) attrs(err error) []any {
+	read := c.read
+	c.read = nil
+	if err == nil || len(read) <= 0 {
+		return nil
+	}
+	return []any{slog.Any("dnsPartialResponse", slices.Clip(read))}
+}
@@ -0,0 +1,164 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/tlsstub"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errDNSPartialResponse is the error returned by [newDNSPartialResponseConn]
+// after returning the response prefix.
+var errDNSPartialResponse = errors.New("connection reset by peer")
+
+// newDNSPartialResponseConn returns a [*netstub.FuncConn] emulating a DNS
+// stream server that replies with the first size bytes of the framed response
+// and then fails all the subsequent reads with [errDNSPartialResponse].
+//
+// The wantRead argument receives the bytes that the conn returns.
+func newDNSPartialResponseConn(size int, wantRead *[]byte) *netstub.FuncConn {
+	var pending bytes.Buffer
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query := new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b[2:]))
+		rawResp := runtimex.PanicOnError1(newDNSResponse(query, "130.192.91.211").Pack())
+		framed := append([]byte{byte(len(rawResp) >> 8), byte(len(rawResp))}, rawResp...)
+		*wantRead = framed[:size]
+		pending.Write(*wantRead)
+		return len(b), nil
+	}
+	conn.ReadFunc = func(b []byte) (int, error) {
+		if pending.Len() <= 0 {
+			return 0, errDNSPartialResponse
+		}
+		return pending.Read(b)
+	}
+	conn.CloseFunc = func() error { return nil }
+	return conn
+}
+
+// dnsPartialResponseExchange exchanges a query using the given stream conn
+// and returns the dnsPartialResponse field, whether the dnsExchangeDone event
+// includes it, and the exchange error.
+type dnsPartialResponseExchange func(t *testing.T, conn *netstub.FuncConn) ([]byte, bool, error)
+
+// DNSOverTCPConn and DNSOverTLSConn log the bytes read before the error
+// as dnsPartialResponse on dnsExchangeDone.
+func TestDNSStreamConnExchangeLogsPartialResponse(t *testing.T) {
+	exchangeTCP := func(t *testing.T, serverConn *netstub.FuncConn) ([]byte, bool, error) {
+		logger, records := newCapturingLogger()
+		conn, err := NewDNSOverTCPConnFunc(NewConfig(), logger).Call(context.Background(), serverConn)
+		require.NoError(t, err)
+		_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		done, found := findRecord(*records, "dnsExchangeDone")
+		require.True(t, found)
+		value, found := findAttr(done, "dnsPartialResponse")
+		if !found {
+			return nil, false, err
+		}
+		return value.Any().([]byte), true, err
+	}
+
+	exchangeTLS := func(t *testing.T, serverConn *netstub.FuncConn) ([]byte, bool, error) {
+		logger, records := newCapturingLogger()
+		mockTLSConn := &tlsstub.FuncTLSConn{
+			FuncConn: serverConn,
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{}
+			},
+		}
+		conn, err := NewDNSOverTLSConnFunc(NewConfig(), logger).Call(context.Background(), mockTLSConn)
+		require.NoError(t, err)
+		_, err = conn.Exchange(context.Background(), dnscodec.NewQuery("example.com", dns.TypeA))
+		done, found := findRecord(*records, "dnsExchangeDone")
+		require.True(t, found)
+		value, found := findAttr(done, "dnsPartialResponse")
+		if !found {
+			return nil, false, err
+		}
+		return value.Any().([]byte), true, err
+	}
+
+	for name, exchange := range map[string]dnsPartialResponseExchange{"tcp": exchangeTCP, "tls": exchangeTLS} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("prefix then error", func(t *testing.T) {
+				var wantRead []byte
+				partial, found, err := exchange(t, newDNSPartialResponseConn(10, &wantRead))
+
+				require.ErrorIs(t, err, errDNSPartialResponse)
+				require.True(t, found)
+				assert.Equal(t, wantRead, partial)
+				assert.Len(t, partial, 10)
+			})
+
+			t.Run("error before any byte", func(t *testing.T) {
+				var wantRead []byte
+				_, found, err := exchange(t, newDNSPartialResponseConn(0, &wantRead))
+
+				require.ErrorIs(t, err, errDNSPartialResponse)
+				assert.False(t, found)
+			})
+
+			t.Run("success", func(t *testing.T) {
+				serverConn := newDNSStreamServerConn(func(query *dns.Msg) *dns.Msg {
+					return newDNSResponse(query, "130.192.91.211")
+				})
+				_, found, err := exchange(t, serverConn)
+
+				require.NoError(t, err)
+				assert.False(t, found)
+			})
+		})
+	}
+}
+
+// dnsPartialResponseConn stops recording after dnsPartialResponseMaxSize bytes.
+func TestDNSPartialResponseConnMaxSize(t *testing.T) {
+	conn := newMinimalConn()
+	conn.ReadFunc = func(b []byte) (int, error) {
+		return len(b), nil
+	}
+	prc := &dnsPartialResponseConn{Conn: conn}
+	buffer := make([]byte, 4096)
+	for range 20 {
+		count, err := prc.Read(buffer)
+		require.NoError(t, err)
+		require.Equal(t, len(buffer), count)
+	}
+
+	assert.Len(t, prc.read, dnsPartialResponseMaxSize)
+	assert.Nil(t, prc.attrs(nil))
+	assert.Nil(t, prc.read, "should release the bytes on success")
+}
+
+// dnsPartialResponseConn logs exactly the bytes read on failure.
+func TestDNSPartialResponseConnAttrs(t *testing.T) {
+	conn := newMinimalConn()
+	conn.ReadFunc = func(b []byte) (int, error) {
+		return copy(b, []byte{0x00, 0x20, 0xab}), nil
+	}
+	prc := &dnsPartialResponseConn{Conn: conn}
+	_, err := prc.Read(make([]byte, 4096))
+	require.NoError(t, err)
+
+	attrs := prc.attrs(errDNSPartialResponse)
+
+	require.Len(t, attrs, 1)
+	partial := attrs[0].(slog.Attr).Value.Any().([]byte)
+	assert.Equal(t, []byte{0x00, 0x20, 0xab}, partial)
+	assert.Equal(t, len(partial), cap(partial))
+	assert.Nil(t, prc.read)
+}
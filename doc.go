@@ -19,29 +19,63 @@
 //
 // Connection establishment:
 //   - [ConnectFunc]: dials TCP or UDP endpoints
+//   - [HappyEyeballsConnectFunc]: races connect attempts to dual-stack endpoints (RFC 8305)
+//   - [ResolveConnectFunc]: resolves a "host:port" address using a [Resolver] and connects to it
+//   - [SOCKS4aDialer]: a [Dialer] tunneling TCP connections through a SOCKS4a proxy
+//   - [SOCKS5Dialer]: a [Dialer] tunneling TCP connections through a SOCKS5 proxy
 //   - [TLSHandshakeFunc]: performs TLS handshake over an existing connection
+//   - [QUICHandshakeFunc]: establishes a QUIC connection using a pluggable [QUICDialer]
 //   - [ObserveConnFunc]: observes connections for logging I/O operations
 //   - [CancelWatchFunc]: closes connection on context cancellation (for responsive ^C handling)
+//   - [SemaphoreFunc]: limits concurrent connections and logs the queueing delay
+//   - [JitterFunc]: delays connections by a random duration to stress-test timeouts
+//
+// Connection wrappers (debugging and auditing aids):
+//   - [SyscallCounterFunc]: counts Read, Write, and deadline calls on a connection
+//   - [IOTimelineFunc]: records the time and size of each Read and Write without logging
+//   - [ChunkedReadFunc]: caps the size of each Read to stress-test protocol parsers
+//   - [FirstByteFunc]: logs the time to the first byte received on a connection
+//   - [ReentrancyGuardFunc]: logs concurrent Read or concurrent Write calls
+//   - [WriteBatchFunc]: coalesces small writes into larger ones and logs each flush
+//   - [TLSCertPEMFunc]: logs the peer certificates as PEM for archival
+//   - [TLSHostnameCheckFunc]: logs whether the peer certificate is valid for a hostname
+//   - [TLSCipherPreferenceProbe]: infers whether the server enforces its cipher suite preference
+//   - [TCPMSSFunc]: logs the TCP maximum segment size (Linux only)
+//   - [PMTUFunc]: logs the path MTU discovered by the kernel (Linux only)
+//   - [SynRetryFunc]: logs the TCP SYN retransmissions (Linux only)
+//   - [TCPFastOpenFunc]: logs whether TCP Fast Open saved a round trip (Linux only)
+//   - [CongestionControlFunc]: logs the TCP congestion control algorithm (Linux only)
+//   - [SummaryFunc]: emits a [ConnectionSummary] aggregating the outcome of all phases
+//   - [Summarize]: like [SummaryFunc] but wraps a pipeline and also emits on failure
+//   - [LatencyObserveFunc]: feeds the duration of each call into a [LatencyAccumulator]
+//     computing percentiles across a batch
 //
 // HTTP:
 //   - [HTTPConn]: wraps a connection with an HTTP transport, performs round trips
 //     with structured logging and transparent body observation (created via [NewHTTPConnFunc])
 //
 // DNS resolution:
-//   - [DNSOverUDPConn]: wraps a UDP connection for DNS-over-UDP (owns the connection)
+//   - [DNSOverUDPConn]: wraps a UDP connection for DNS-over-UDP (owns the connection),
+//     optionally collecting duplicate responses with their interarrival times
 //   - [DNSOverTCPConn]: wraps a TCP connection for DNS-over-TCP (owns the connection)
 //   - [DNSOverTLSConn]: wraps a TLS connection for DNS-over-TLS (owns the connection)
 //   - [DNSOverHTTPSConn]: wraps an HTTPConn for DNS-over-HTTPS (owns the connection)
+//   - [DNSOverHTTPSJSONConn]: wraps an HTTPConn for the JSON API for DNS over HTTPS
+//     offered by resolvers such as Google and Cloudflare (owns the connection)
 //   - [DNSExchangeLogContext]: structured logging for DNS exchanges, used internally
 //     by the above types and available for callers implementing custom exchange
 //     loops (e.g., collecting duplicate DNS-over-UDP responses)
+//   - [CompareDNSResponses]: compares the answers obtained using distinct transports
+//   - [DNSBlocklistFunc]: logs whether a response contains known sinkhole or blockpage addresses
 //
 // Composition utilities:
 //   - [Compose2] through [Compose8]: chain Funcs into pipelines
 //   - [FuncAdapter]: wrap a function as a Func for ad-hoc custom behavior
 //   - [Apply]: bind a fixed input to a Func
 //   - [ConstFunc]: lift a pure value into a Func
+//   - [Timeout]: bound each call of a Func with its own timeout
 //   - [NewEndpointFunc]: convenience wrapper for ConstFunc with endpoints
+//   - [BuildPipeline]: build a pipeline from a declarative [PipelineSpec]
 //
 // # Connection Lifecycle
 //
@@ -77,17 +111,30 @@
 //
 // All events share a common set of fields: localAddr, remoteAddr, protocol,
 // and t (timestamp). Completion events (*Done) additionally include t0 (start
-// time), err, and errClass. I/O-level events (read, write, deadline changes)
-// are emitted at [slog.LevelDebug]; all other events use [slog.LevelInfo].
+// time), err, and errClass. IP addresses in localAddr and remoteAddr use the
+// canonical host:port form (e.g., "[fe80::1%eth0]:53"), with IPv4-mapped IPv6
+// addresses unmapped and IPv6 zones preserved. I/O-level events (read, write,
+// deadline changes) are emitted at [slog.LevelDebug]; all other events use
+// [slog.LevelInfo].
 // The structured log format is compatible with the RBMK data format specification
 // (see https://github.com/rbmk-project/rbmk) and may evolve in minor ways as
 // these packages mature.
+// Use [ToRBMKEvent] and [FromRBMKEvent] to convert between [slog.Record]
+// values and the JSON-compatible event envelope used by RBMK tooling.
 //
 // Use [NewSpanID] to generate a unique, time-ordered identifier (UUIDv7) for each
 // operation, then attach it to the logger with [*slog.Logger.With]. All log entries
 // from that operation will share the same spanID, enabling correlation across
 // pipeline stages and simplifying log analysis.
 //
+// Use [NewTraceSLogger] in tests to record the events emitted by a pipeline
+// and assert on their order and fields using the returned [*Trace]. To make
+// the t0 and t fields deterministic, construct the pipeline from a [*Config]
+// sharing a [*FakeClock] (see [*Config.WithClock]).
+//
+// Use [NewBundleSLogger] to archive all the events of a measurement run as
+// a single JSON object grouping the events by spanID.
+//
 // # Timeout and Context Philosophy
 //
 // This package is context-transparent: operations never modify the context they receive.
@@ -104,12 +151,17 @@
 // indefinitely even after the context is done. Always include [CancelWatchFunc]
 // when composing connection pipelines to ensure proper timeout behavior.
 //
+// The only exception is [Timeout], which deliberately derives a child context bounded
+// by the given timeout, to cap individual operations when the caller provides a
+// long-lived context. When the wrapped operation fails after the timeout expired, the
+// error wraps both [context.DeadlineExceeded] and the error of the operation.
+//
 // # Design Boundaries
 //
 // This package intentionally provides only primitives. The following are out of scope
 // and should be implemented by higher-level packages:
 //
-//   - Parallel execution (fan-out, racing)
+//   - Parallel execution (fan-out, racing), except for [HappyEyeballsConnectFunc]
 //   - Retry and backoff logic
 //   - Multi-step orchestration
 //   - Convenience helpers that combine multiple primitives
@@ -2,7 +2,11 @@
 
 package nop
 
-import "github.com/bassosimone/errclass"
+import (
+	"errors"
+
+	"github.com/bassosimone/errclass"
+)
 
 // ErrClassifier classifies errors into categorical strings for analysis.
 //
@@ -30,4 +34,34 @@ func (f ErrClassifierFunc) Classify(err error) string {
 // Unix-like error names (e.g., "ETIMEDOUT", "ECONNRESET", "EDNS_NONAME").
 //
 // See the [errclass] package for the full list of supported error classes.
-var DefaultErrClassifier = ErrClassifierFunc(errclass.New)
+//
+// Additionally, it maps the errors returned by [*SOCKS5Dialer] when the proxy
+// fails the handshake to "ESOCKS5_"-prefixed classes (e.g., "ESOCKS5_AUTH_REJECTED"
+// or "ESOCKS5_HOST_UNREACHABLE") and the error returned by [*SOCKS4aDialer]
+// when the proxy rejects the request to "ESOCKS4_REJECTED", which distinguish
+// them from the failures of the connection to the proxy itself.
+var DefaultErrClassifier = ErrClassifierFunc(defaultErrClassify)
+
+// defaultErrClassifyMap contains the nop errors that we map with [errors.Is].
+var defaultErrClassifyMap = []struct {
+	err   error
+	class string
+}{
+	{ErrSOCKS5AuthRejected, "ESOCKS5_AUTH_REJECTED"},
+	{ErrSOCKS5NoAcceptableAuth, "ESOCKS5_NO_ACCEPTABLE_AUTH"},
+	{ErrSOCKS5HostUnreachable, "ESOCKS5_HOST_UNREACHABLE"},
+	{ErrSOCKS5NetworkUnreachable, "ESOCKS5_NETWORK_UNREACHABLE"},
+	{ErrSOCKS5ConnectionRefused, "ESOCKS5_CONNECTION_REFUSED"},
+	{ErrSOCKS5Rejected, "ESOCKS5_REJECTED"},
+	{ErrSOCKS4Rejected, "ESOCKS4_REJECTED"},
+}
+
+// defaultErrClassify implements [DefaultErrClassifier].
+func defaultErrClassify(err error) string {
+	for _, entry := range defaultErrClassifyMap {
+		if errors.Is(err, entry.err) {
+			return entry.class
+		}
+	}
+	return errclass.New(err)
+}
@@ -5,6 +5,7 @@ package nop
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/bassosimone/errclass"
@@ -24,3 +25,38 @@ func TestDefaultErrClassifier(t *testing.T) {
 	result = DefaultErrClassifier.Classify(errors.New("unknown error"))
 	assert.Equal(t, errclass.EGENERIC, result)
 }
+
+// DefaultErrClassifier maps the SOCKS5 handshake failures to distinct classes.
+func TestDefaultErrClassifierSOCKS5(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: status 1", ErrSOCKS5AuthRejected), "ESOCKS5_AUTH_REJECTED"},
+		{ErrSOCKS5NoAcceptableAuth, "ESOCKS5_NO_ACCEPTABLE_AUTH"},
+		{ErrSOCKS5HostUnreachable, "ESOCKS5_HOST_UNREACHABLE"},
+		{ErrSOCKS5NetworkUnreachable, "ESOCKS5_NETWORK_UNREACHABLE"},
+		{ErrSOCKS5ConnectionRefused, "ESOCKS5_CONNECTION_REFUSED"},
+		{fmt.Errorf("%w: reply code 2", ErrSOCKS5Rejected), "ESOCKS5_REJECTED"},
+		{ErrSOCKS5InvalidReply, errclass.EGENERIC},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, DefaultErrClassifier.Classify(tt.err), tt.err.Error())
+	}
+}
+
+// DefaultErrClassifier maps the SOCKS4 request rejection to a distinct class.
+func TestDefaultErrClassifierSOCKS4(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: reply code 91", ErrSOCKS4Rejected), "ESOCKS4_REJECTED"},
+		{ErrSOCKS4InvalidReply, errclass.EGENERIC},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, DefaultErrClassifier.Classify(tt.err), tt.err.Error())
+	}
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// NewFirstByteFunc returns a new [*FirstByteFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewFirstByteFunc(cfg *Config, logger SLogger) *FirstByteFunc {
+	return &FirstByteFunc{
+		Logger:  logger,
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// FirstByteFunc wraps a [net.Conn] to log when the first byte is received.
+//
+// The first Read returning data emits a firstByte event whose firstByteAtMs
+// field contains the time elapsed since Call wrapped the connection, in
+// milliseconds. Subsequent reads do not emit events. Since it operates at the
+// [net.Conn] level, this is a protocol-agnostic measure of the latency between
+// the connection becoming usable and the first byte from the peer.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type FirstByteFunc struct {
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewFirstByteFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewFirstByteFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &FirstByteFunc{}
+
+// Call wraps the given [net.Conn] to log when the first byte is received.
+func (op *FirstByteFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &firstByteConn{Conn: conn, op: op, t0: op.TimeNow()}, nil
+}
+
+// firstByteConn logs when the first byte is received on a [net.Conn].
+type firstByteConn struct {
+	net.Conn
+	once sync.Once
+	op   *FirstByteFunc
+	t0   time.Time
+}
+
+// Read implements [net.Conn].
+func (c *firstByteConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	if count > 0 {
+		c.once.Do(c.logFirstByte)
+	}
+	return count, err
+}
+
+func (c *firstByteConn) logFirstByte() {
+	t := c.op.TimeNow()
+	c.op.Logger.Info(
+		"firstByte",
+		slog.Int64("firstByteAtMs", t.Sub(c.t0).Milliseconds()),
+		slog.String("localAddr", connLocalAddr(c.Conn)),
+		slog.String("protocol", safeconn.Network(c.Conn)),
+		slog.String("remoteAddr", connRemoteAddr(c.Conn)),
+		slog.Time("t0", c.t0),
+		slog.Time("t", t),
+	)
+}
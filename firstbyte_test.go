@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewFirstByteFunc populates all fields from Config and the provided logger.
+func TestNewFirstByteFunc(t *testing.T) {
+	fn := NewFirstByteFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// The first Read returning data logs firstByteAtMs once, relative to the wrap time.
+func TestFirstByteFunc(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := NewConfig()
+	cfg.TimeNow = func() time.Time { return now }
+
+	reads := []struct {
+		delay time.Duration
+		count int
+		err   error
+	}{
+		{delay: 10 * time.Millisecond, count: 0, err: errors.New("temporary error")},
+		{delay: 25 * time.Millisecond, count: 4, err: nil},
+		{delay: 50 * time.Millisecond, count: 8, err: nil},
+	}
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		read := reads[0]
+		reads = reads[1:]
+		now = now.Add(read.delay)
+		return read.count, read.err
+	}
+
+	logger, records := newCapturingLogger()
+	conn, err := NewFirstByteFunc(cfg, logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	buffer := make([]byte, 16)
+	_, err = conn.Read(buffer)
+	require.Error(t, err)
+	assert.Empty(t, *records)
+
+	count, err := conn.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+	count, err = conn.Read(buffer)
+	require.NoError(t, err)
+	assert.Equal(t, 8, count)
+
+	require.Len(t, *records, 1)
+	assert.Equal(t, "firstByte", (*records)[0].Message)
+	value, found := findAttr((*records)[0], "firstByteAtMs")
+	require.True(t, found)
+	assert.Equal(t, int64(35), value.Int64())
+}
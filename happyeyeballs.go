@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// ErrNoCandidates indicates that [*HappyEyeballsConnectFunc] received
+// an empty list of candidate endpoints.
+var ErrNoCandidates = errors.New("nop: no candidate endpoints")
+
+// happyEyeballsDefaultFallbackDelay is the default delay between connect
+// attempts, following the recommendation of RFC 8305, Section 5.
+const happyEyeballsDefaultFallbackDelay = 250 * time.Millisecond
+
+// NewHappyEyeballsConnectFunc returns a new [*HappyEyeballsConnectFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The network argument must be either "tcp" or "udp".
+//
+// The logger argument is the [SLogger] to use for structured logging.
+//
+// This function panics if cfg.DSCP is not between 0 and 63.
+func NewHappyEyeballsConnectFunc(cfg *Config, network string, logger SLogger) *HappyEyeballsConnectFunc {
+	return &HappyEyeballsConnectFunc{
+		Connect:       NewConnectFunc(cfg, network, logger),
+		ErrClassifier: cfg.ErrClassifier,
+		FallbackDelay: happyEyeballsDefaultFallbackDelay,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// HappyEyeballsConnectFunc races connect attempts to dual-stack candidate
+// endpoints in the style of RFC 8305 and returns the first connection.
+//
+// Call sorts the candidates by alternating the address families, starting
+// with the family of the first candidate and otherwise preserving their order.
+// It then starts a connect attempt every FallbackDelay, or as soon as the
+// previous attempt fails, until an attempt succeeds. Each attempt uses
+// Connect, thus emitting connectStart and connectDone events. When an
+// attempt succeeds, Call cancels the other attempts and closes the losing
+// connections before returning. When several attempts have succeeded by the
+// time Call notices, the one that started first wins, so ties prefer the
+// family of the first candidate.
+//
+// Call emits a final happyEyeballsDone event containing the number of
+// attempts started as connectCandidatesTried and, on success, the address
+// that won as happyEyeballsWinner, which is also the remoteAddr, and its
+// address family ("inet" or "inet6") as connectWinningFamily. The
+// connectCandidatesTried and connectWinningFamily fields have the same
+// meaning as in the connectDone event of [*ResolveConnectFunc]. On failure,
+// the error is the one returned by the last failed attempt or
+// [ErrNoCandidates] when there are no candidates.
+//
+// Call respects the caller's context: when the context is done, no new
+// attempts are started and the pending ones fail.
+//
+// While racing violates the one-attempt-per-primitive rule that
+// characterizes this package, this Func has a single success and failure
+// mode, so it composes like [*ConnectFunc].
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type HappyEyeballsConnectFunc struct {
+	// Connect is the [*ConnectFunc] performing each attempt.
+	//
+	// Set by [NewHappyEyeballsConnectFunc] to a [*ConnectFunc] constructed
+	// using the same arguments.
+	Connect *ConnectFunc
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewHappyEyeballsConnectFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// FallbackDelay is the delay between starting connect attempts.
+	//
+	// Set by [NewHappyEyeballsConnectFunc] to 250 ms (see RFC 8305, Section 5).
+	FallbackDelay time.Duration
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewHappyEyeballsConnectFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewHappyEyeballsConnectFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[[]netip.AddrPort, net.Conn] = &HappyEyeballsConnectFunc{}
+
+// happyEyeballsResult is the result of a connect attempt.
+type happyEyeballsResult struct {
+	conn  net.Conn
+	err   error
+	index int
+}
+
+// Call races connect attempts to the given candidates.
+func (op *HappyEyeballsConnectFunc) Call(ctx context.Context, candidates []netip.AddrPort) (net.Conn, error) {
+	t0 := op.TimeNow()
+	deadline, _ := ctx.Deadline()
+	ordered := happyEyeballsOrder(candidates)
+
+	// 1. Hide the summary from the attempts, since we only record the winner,
+	// and use a child context to cancel the losing attempts
+	attemptCtx, cancel := context.WithCancel(ContextWithConnectionSummary(ctx, nil))
+	results := make(chan happyEyeballsResult, len(ordered))
+	var started, pending int
+	startNext := func() {
+		index := started
+		started++
+		pending++
+		go func() {
+			conn, err := op.Connect.Call(attemptCtx, ordered[index])
+			results <- happyEyeballsResult{conn: conn, err: err, index: index}
+		}()
+	}
+
+	// 2. Start an attempt every FallbackDelay or when the previous one fails
+	var (
+		err    error = ErrNoCandidates
+		winner *happyEyeballsResult
+	)
+	canStartNext := func() bool {
+		return started < len(ordered) && ctx.Err() == nil
+	}
+	timer := time.NewTimer(op.FallbackDelay)
+	defer timer.Stop()
+	if len(ordered) > 0 {
+		startNext()
+	}
+	for winner == nil && pending > 0 {
+		var timerC <-chan time.Time
+		if canStartNext() {
+			timerC = timer.C
+		}
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil {
+				winner = &result
+				continue
+			}
+			err = result.err
+			if canStartNext() {
+				startNext()
+				timer.Reset(op.FallbackDelay)
+			}
+		case <-timerC:
+			startNext()
+			timer.Reset(op.FallbackDelay)
+		}
+	}
+
+	// 3. Prefer the earliest attempt among those that already succeeded
+	if winner != nil {
+		var drained int
+		winner, drained = happyEyeballsPreferEarliest(winner, results)
+		pending -= drained
+	}
+
+	// 4. Cancel the losing attempts and close any late success
+	cancel()
+	for ; pending > 0; pending-- {
+		if result := <-results; result.err == nil {
+			result.conn.Close()
+		}
+	}
+
+	// 5. Record the winner into the caller's summary and log the outcome
+	var conn net.Conn
+	remoteAddr := ""
+	if winner != nil {
+		conn, err = winner.conn, nil
+		remoteAddr = ordered[winner.index].String()
+	}
+	t := op.TimeNow()
+	if summary := ConnectionSummaryFromContext(ctx); summary != nil {
+		summary.recordConnect(connLocalAddr(conn), op.Connect.Network,
+			canonicalAddr(remoteAddr), t.Sub(t0), op.ErrClassifier.Classify(err))
+	}
+	attrs := []any{
+		slog.Int("connectCandidatesTried", started),
+	}
+	if winner != nil {
+		attrs = append(attrs, slog.String("connectWinningFamily", connectFamily(ordered[winner.index])))
+	}
+	attrs = append(attrs,
+		slog.Time("deadline", deadline),
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+	)
+	if winner != nil {
+		attrs = append(attrs, slog.String("happyEyeballsWinner", canonicalAddr(remoteAddr)))
+	}
+	attrs = append(attrs,
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", op.Connect.Network),
+		slog.String("remoteAddr", canonicalAddr(remoteAddr)),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+	)
+	op.Logger.Info("happyEyeballsDone", attrs...)
+	return conn, err
+}
+
+// happyEyeballsPreferEarliest consumes the results that are already available
+// and returns the successful result with the lowest index, closing the other
+// connections, along with the number of results it consumed.
+func happyEyeballsPreferEarliest(
+	winner *happyEyeballsResult, results <-chan happyEyeballsResult) (*happyEyeballsResult, int) {
+	var drained int
+	for {
+		select {
+		case result := <-results:
+			drained++
+			if result.err != nil {
+				continue
+			}
+			loser := result
+			if result.index < winner.index {
+				loser, winner = *winner, &result
+			}
+			loser.conn.Close()
+		default:
+			return winner, drained
+		}
+	}
+}
+
+// happyEyeballsOrder returns a copy of the candidates where the address
+// families alternate, starting with the family of the first candidate.
+func happyEyeballsOrder(candidates []netip.AddrPort) []netip.AddrPort {
+	if len(candidates) <= 0 {
+		return nil
+	}
+	var first, second []netip.AddrPort
+	firstIs4 := candidates[0].Addr().Unmap().Is4()
+	for _, candidate := range candidates {
+		if candidate.Addr().Unmap().Is4() == firstIs4 {
+			first = append(first, candidate)
+			continue
+		}
+		second = append(second, candidate)
+	}
+	ordered := make([]netip.AddrPort, 0, len(candidates))
+	for idx := 0; idx < len(first) || idx < len(second); idx++ {
+		if idx < len(first) {
+			ordered = append(ordered, first[idx])
+		}
+		if idx < len(second) {
+			ordered = append(ordered, second[idx])
+		}
+	}
+	return ordered
+}
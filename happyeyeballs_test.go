@@ -0,0 +1,331 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/slogstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newHappyEyeballsTestFunc returns a [*HappyEyeballsConnectFunc] whose dialer
+// waits for the given per-address delay and then fails when the address is in
+// failures, otherwise returns a connection incrementing closed when closed.
+func newHappyEyeballsTestFunc(
+	delays map[string]time.Duration, failures map[string]error, closed *atomic.Int64) *HappyEyeballsConnectFunc {
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			select {
+			case <-time.After(delays[address]):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if err := failures[address]; err != nil {
+				return nil, err
+			}
+			conn := newMinimalConn()
+			conn.CloseFunc = func() error {
+				closed.Add(1)
+				return nil
+			}
+			conn.RemoteAddrFunc = func() net.Addr {
+				return net.TCPAddrFromAddrPort(netip.MustParseAddrPort(address))
+			}
+			return conn, nil
+		},
+	}
+	return NewHappyEyeballsConnectFunc(cfg, "tcp", slog.New(slog.DiscardHandler))
+}
+
+// newLockedCapturingLogger is like newCapturingLogger but safe for concurrent use.
+func newLockedCapturingLogger() (*slog.Logger, func() []slog.Record) {
+	var (
+		mu      sync.Mutex
+		records []slog.Record
+	)
+	handler := &slogstub.FuncHandler{
+		EnabledFunc: func(ctx context.Context, level slog.Level) bool {
+			return true
+		},
+		HandleFunc: func(ctx context.Context, record slog.Record) error {
+			mu.Lock()
+			defer mu.Unlock()
+			records = append(records, record)
+			return nil
+		},
+	}
+	return slog.New(handler), func() []slog.Record {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]slog.Record{}, records...)
+	}
+}
+
+// NewHappyEyeballsConnectFunc populates all fields from Config and the provided logger.
+func TestNewHappyEyeballsConnectFunc(t *testing.T) {
+	cfg := NewConfig()
+	logger := DefaultSLogger()
+
+	fn := NewHappyEyeballsConnectFunc(cfg, "tcp", logger)
+
+	require.NotNil(t, fn)
+	require.NotNil(t, fn.Connect)
+	assert.Equal(t, "tcp", fn.Connect.Network)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.Equal(t, 250*time.Millisecond, fn.FallbackDelay)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// happyEyeballsOrder alternates families starting with the first candidate's family.
+func TestHappyEyeballsOrder(t *testing.T) {
+	v4a := netip.MustParseAddrPort("10.0.0.1:443")
+	v4b := netip.MustParseAddrPort("10.0.0.2:443")
+	v6a := netip.MustParseAddrPort("[2001:db8::1]:443")
+	v6b := netip.MustParseAddrPort("[2001:db8::2]:443")
+
+	assert.Nil(t, happyEyeballsOrder(nil))
+	assert.Equal(t, []netip.AddrPort{v6a, v4a, v6b, v4b},
+		happyEyeballsOrder([]netip.AddrPort{v6a, v6b, v4a, v4b}))
+	assert.Equal(t, []netip.AddrPort{v4a, v6a, v4b},
+		happyEyeballsOrder([]netip.AddrPort{v4a, v4b, v6a}))
+	assert.Equal(t, []netip.AddrPort{v4a, v4b},
+		happyEyeballsOrder([]netip.AddrPort{v4a, v4b}))
+}
+
+// Call fails with ErrNoCandidates without candidates.
+func TestHappyEyeballsConnectFuncNoCandidates(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(nil, nil, &closed)
+	logger, records := newCapturingLogger()
+	fn.Logger = logger
+
+	conn, err := fn.Call(context.Background(), nil)
+
+	require.ErrorIs(t, err, ErrNoCandidates)
+	assert.Nil(t, conn)
+	record, found := findRecord(*records, "happyEyeballsDone")
+	require.True(t, found)
+	attempts, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(0), attempts.Int64())
+	_, found = findAttr(record, "happyEyeballsWinner")
+	assert.False(t, found)
+}
+
+// Call returns the first attempt when it succeeds before FallbackDelay.
+func TestHappyEyeballsConnectFuncFirstWins(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(nil, nil, &closed)
+	fn.FallbackDelay = time.Hour
+	logger, records := newLockedCapturingLogger()
+	fn.Logger = logger
+	fn.Connect.Logger = logger
+
+	conn, err := fn.Call(context.Background(), []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.Equal(t, "[2001:db8::1]:443", conn.RemoteAddr().String())
+	assert.Equal(t, int64(0), closed.Load())
+
+	var starts int
+	for _, record := range records() {
+		if record.Message == "connectStart" {
+			starts++
+		}
+	}
+	assert.Equal(t, 1, starts)
+	record, found := findRecord(records(), "happyEyeballsDone")
+	require.True(t, found)
+	attempts, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(1), attempts.Int64())
+	winner, _ := findAttr(record, "happyEyeballsWinner")
+	assert.Equal(t, "[2001:db8::1]:443", winner.String())
+	remoteAddr, _ := findAttr(record, "remoteAddr")
+	assert.Equal(t, "[2001:db8::1]:443", remoteAddr.String())
+	errClass, _ := findAttr(record, "errClass")
+	assert.Equal(t, "", errClass.String())
+}
+
+// Call starts the next attempt after FallbackDelay and closes the loser.
+func TestHappyEyeballsConnectFuncFallbackWins(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(map[string]time.Duration{
+		"[2001:db8::1]:443": 200 * time.Millisecond,
+	}, nil, &closed)
+	fn.FallbackDelay = 10 * time.Millisecond
+	logger, records := newLockedCapturingLogger()
+	fn.Logger = logger
+	fn.Connect.Logger = logger
+
+	conn, err := fn.Call(context.Background(), []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.Equal(t, "10.0.0.1:443", conn.RemoteAddr().String())
+
+	var starts, dones int
+	for _, record := range records() {
+		switch record.Message {
+		case "connectStart":
+			starts++
+		case "connectDone":
+			dones++
+		}
+	}
+	assert.Equal(t, 2, starts)
+	assert.Equal(t, 2, dones, "the losing attempt must have terminated")
+	record, found := findRecord(records(), "happyEyeballsDone")
+	require.True(t, found)
+	attempts, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(2), attempts.Int64())
+	winner, _ := findAttr(record, "happyEyeballsWinner")
+	assert.Equal(t, "10.0.0.1:443", winner.String())
+}
+
+// Call starts the next attempt immediately when an attempt fails.
+func TestHappyEyeballsConnectFuncFailureStartsNext(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(nil, map[string]error{
+		"[2001:db8::1]:443": errors.New("connection refused"),
+	}, &closed)
+	fn.FallbackDelay = time.Hour
+	logger, records := newLockedCapturingLogger()
+	fn.Logger = logger
+
+	conn, err := fn.Call(context.Background(), []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.Equal(t, "10.0.0.1:443", conn.RemoteAddr().String())
+	record, found := findRecord(records(), "happyEyeballsDone")
+	require.True(t, found)
+	tried, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(2), tried.Int64())
+	family, _ := findAttr(record, "connectWinningFamily")
+	assert.Equal(t, "inet", family.String())
+	_, found = findAttr(record, "happyEyeballsAttempts")
+	assert.False(t, found)
+}
+
+// Call returns the last error when all attempts fail.
+func TestHappyEyeballsConnectFuncAllFail(t *testing.T) {
+	var closed atomic.Int64
+	errLast := errors.New("network unreachable")
+	fn := newHappyEyeballsTestFunc(map[string]time.Duration{
+		"10.0.0.1:443": 20 * time.Millisecond,
+	}, map[string]error{
+		"[2001:db8::1]:443": errors.New("connection refused"),
+		"10.0.0.1:443":      errLast,
+	}, &closed)
+	logger, records := newLockedCapturingLogger()
+	fn.Logger = logger
+
+	conn, err := fn.Call(context.Background(), []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.ErrorIs(t, err, errLast)
+	assert.Nil(t, conn)
+	record, found := findRecord(records(), "happyEyeballsDone")
+	require.True(t, found)
+	attempts, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(2), attempts.Int64())
+	_, found = findAttr(record, "happyEyeballsWinner")
+	assert.False(t, found)
+	_, found = findAttr(record, "connectWinningFamily")
+	assert.False(t, found)
+}
+
+// happyEyeballsPreferEarliest picks the earliest among the available successes.
+func TestHappyEyeballsPreferEarliest(t *testing.T) {
+	var closed atomic.Int64
+	newConn := func() net.Conn {
+		conn := newMinimalConn()
+		conn.CloseFunc = func() error {
+			closed.Add(1)
+			return nil
+		}
+		return conn
+	}
+	results := make(chan happyEyeballsResult, 3)
+	results <- happyEyeballsResult{err: errors.New("connection refused"), index: 2}
+	results <- happyEyeballsResult{conn: newConn(), index: 0}
+	results <- happyEyeballsResult{conn: newConn(), index: 3}
+	winner := &happyEyeballsResult{conn: newConn(), index: 1}
+
+	got, drained := happyEyeballsPreferEarliest(winner, results)
+
+	assert.Equal(t, 0, got.index)
+	assert.Equal(t, 3, drained)
+	assert.Equal(t, int64(2), closed.Load())
+}
+
+// Call stops starting attempts and fails when the context is done.
+func TestHappyEyeballsConnectFuncContextCanceled(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(map[string]time.Duration{
+		"[2001:db8::1]:443": time.Hour,
+		"10.0.0.1:443":      time.Hour,
+	}, nil, &closed)
+	fn.FallbackDelay = time.Hour
+	logger, records := newLockedCapturingLogger()
+	fn.Logger = logger
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	conn, err := fn.Call(ctx, []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, conn)
+	record, found := findRecord(records(), "happyEyeballsDone")
+	require.True(t, found)
+	attempts, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(1), attempts.Int64())
+}
+
+// Call records only the winner into the caller's summary.
+func TestHappyEyeballsConnectFuncSummary(t *testing.T) {
+	var closed atomic.Int64
+	fn := newHappyEyeballsTestFunc(nil, map[string]error{
+		"[2001:db8::1]:443": errors.New("connection refused"),
+	}, &closed)
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+
+	conn, err := fn.Call(ctx, []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:443"),
+		netip.MustParseAddrPort("10.0.0.1:443"),
+	})
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.Equal(t, "10.0.0.1:443", summary.remoteAddr)
+	assert.Equal(t, "", summary.errClass)
+	assert.Equal(t, "tcp", summary.protocol)
+}
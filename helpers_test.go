@@ -3,14 +3,17 @@
 package nop
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"log/slog"
 	"net"
 
 	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/slogstub"
 	"github.com/bassosimone/tlsstub"
+	"github.com/miekg/dns"
 )
 
 // newCapturingLogger returns a logger that captures all log records into the
@@ -57,3 +60,150 @@ func newMinimalConn() *netstub.FuncConn {
 		RemoteAddrFunc: func() net.Addr { return &net.TCPAddr{} },
 	}
 }
+
+// newDNSStreamServerConn returns a [*netstub.FuncConn] emulating a DNS
+// server speaking the two-byte length-prefixed framing used by DNS-over-TCP
+// and DNS-over-TLS. Each query written to the conn is decoded and passed to
+// reply, whose framed response is returned by the subsequent reads.
+func newDNSStreamServerConn(reply func(query *dns.Msg) *dns.Msg) *netstub.FuncConn {
+	var pending bytes.Buffer
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		query := new(dns.Msg)
+		runtimex.PanicOnError0(query.Unpack(b[2:]))
+		rawResp := runtimex.PanicOnError1(reply(query).Pack())
+		pending.Write([]byte{byte(len(rawResp) >> 8), byte(len(rawResp))})
+		pending.Write(rawResp)
+		return len(b), nil
+	}
+	conn.ReadFunc = pending.Read
+	conn.CloseFunc = func() error { return nil }
+	return conn
+}
+
+// newDNSResponse returns a response to query containing one A record
+// for each of the given addresses.
+func newDNSResponse(query *dns.Msg, addrs ...string) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	resp.RecursionAvailable = true
+	for _, addr := range addrs {
+		resp.Answer = append(resp.Answer, &dns.A{
+			Hdr: dns.RR_Header{
+				Name:   query.Question[0].Name,
+				Rrtype: dns.TypeA,
+				Class:  dns.ClassINET,
+				Ttl:    300,
+			},
+			A: net.ParseIP(addr),
+		})
+	}
+	return resp
+}
+
+// findRecord returns the first record with the given message.
+func findRecord(records []slog.Record, msg string) (slog.Record, bool) {
+	for _, record := range records {
+		if record.Message == msg {
+			return record, true
+		}
+	}
+	return slog.Record{}, false
+}
+
+// findAttr returns the value of the attribute with the given key
+// in the record and whether such an attribute exists.
+func findAttr(record slog.Record, key string) (value slog.Value, found bool) {
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == key {
+			value, found = attr.Value, true
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// instrumentedTLSConn is a [TLSConn] mock that additionally implements
+// the optional interfaces supported by instrumented [TLSEngine] types.
+type instrumentedTLSConn struct {
+	*tlsstub.FuncTLSConn
+	ALPSNegotiatedFunc      func() bool
+	BytesReceivedFunc       func() int64
+	ClientHelloFunc         func() []byte
+	CompressionMethodFunc   func() uint8
+	EarlyDataAcceptedFunc   func() bool
+	EarlyDataAttemptedFunc  func() bool
+	FirstReceivedRecordFunc func() []byte
+	LastAlertFunc           func() []byte
+	OfferedExtensionsFunc   func() []uint16
+	RecordLayerVersionFunc  func() uint16
+	RecordSizesFunc         func() []int
+	SecureRenegotiationFunc func() bool
+	SignatureSchemeFunc     func() tls.SignatureScheme
+}
+
+// ALPSNegotiated implements [TLSALPSReporter].
+func (c *instrumentedTLSConn) ALPSNegotiated() bool {
+	return c.ALPSNegotiatedFunc()
+}
+
+// BytesReceived implements [TLSBytesReceivedReporter].
+func (c *instrumentedTLSConn) BytesReceived() int64 {
+	return c.BytesReceivedFunc()
+}
+
+// ClientHello implements [TLSClientHelloReporter].
+func (c *instrumentedTLSConn) ClientHello() []byte {
+	return c.ClientHelloFunc()
+}
+
+// CompressionMethod implements [TLSCompressionMethodReporter].
+func (c *instrumentedTLSConn) CompressionMethod() uint8 {
+	return c.CompressionMethodFunc()
+}
+
+// EarlyDataAccepted implements [TLSEarlyDataReporter].
+func (c *instrumentedTLSConn) EarlyDataAccepted() bool {
+	return c.EarlyDataAcceptedFunc()
+}
+
+// EarlyDataAttempted implements [TLSEarlyDataReporter].
+func (c *instrumentedTLSConn) EarlyDataAttempted() bool {
+	return c.EarlyDataAttemptedFunc()
+}
+
+// FirstReceivedRecord implements [TLSFirstRecordReporter].
+func (c *instrumentedTLSConn) FirstReceivedRecord() []byte {
+	return c.FirstReceivedRecordFunc()
+}
+
+// LastAlert implements [TLSAlertReporter].
+func (c *instrumentedTLSConn) LastAlert() []byte {
+	return c.LastAlertFunc()
+}
+
+// OfferedExtensions implements [TLSOfferedExtensionsReporter].
+func (c *instrumentedTLSConn) OfferedExtensions() []uint16 {
+	return c.OfferedExtensionsFunc()
+}
+
+// RecordLayerVersion implements [TLSRecordLayerVersionReporter].
+func (c *instrumentedTLSConn) RecordLayerVersion() uint16 {
+	return c.RecordLayerVersionFunc()
+}
+
+// RecordSizes implements [TLSRecordSizesReporter].
+func (c *instrumentedTLSConn) RecordSizes() []int {
+	return c.RecordSizesFunc()
+}
+
+// SecureRenegotiation implements [TLSSecureRenegotiationReporter].
+func (c *instrumentedTLSConn) SecureRenegotiation() bool {
+	return c.SecureRenegotiationFunc()
+}
+
+// SignatureScheme implements [TLSSignatureSchemeReporter].
+func (c *instrumentedTLSConn) SignatureScheme() tls.SignatureScheme {
+	return c.SignatureSchemeFunc()
+}
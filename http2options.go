@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/bassosimone/runtimex"
+	"golang.org/x/net/http2"
+)
+
+// http2DefaultConnWindowSize and http2DefaultStreamWindowSize are the
+// flow-control windows used by [*http2.Transport] by default.
+const (
+	http2DefaultConnWindowSize   = 1 << 30
+	http2DefaultStreamWindowSize = 4 << 20
+)
+
+// http2MinConnWindowSize is the minimum connection window accepted
+// by [*http2.Transport], which is the initial window size of RFC 9113.
+const http2MinConnWindowSize = 65535
+
+// HTTP2Options contains options for HTTP/2 connections created by [*HTTPConnFunc].
+//
+// When these options are set, [*HTTPConn] logs the flow-control windows they
+// configure, which are the ones advertised to the server. The
+// http2InitialWindowSize field contains the stream window and
+// http2InitialConnWindowSize the connection window. A zero or out-of-range
+// value means using the transport default (4 MiB and 1 GiB respectively),
+// which is what gets logged in such a case.
+//
+// The SETTINGS advertised by the server are instead observed from the client
+// connection state regardless of these options (see [*HTTPConn.RoundTrip]).
+type HTTP2Options struct {
+	// InitialConnWindowSize is the connection-level flow-control window.
+	InitialConnWindowSize int
+
+	// InitialWindowSize is the initial stream-level flow-control window.
+	InitialWindowSize int
+}
+
+// newTransport returns a new [*http2.Transport] configured using the options.
+//
+// This method returns a default transport when the options are nil.
+func (opts *HTTP2Options) newTransport() *http2.Transport {
+	if opts == nil {
+		return &http2.Transport{}
+	}
+	t1 := &http.Transport{
+		HTTP2: &http.HTTP2Config{
+			MaxReceiveBufferPerConnection: opts.InitialConnWindowSize,
+			MaxReceiveBufferPerStream:     opts.InitialWindowSize,
+		},
+	}
+	return runtimex.PanicOnError1(http2.ConfigureTransports(t1))
+}
+
+// connWindowSize returns the effective connection-level window.
+func (opts *HTTP2Options) connWindowSize() int {
+	if opts.InitialConnWindowSize < http2MinConnWindowSize || opts.InitialConnWindowSize > math.MaxInt32 {
+		return http2DefaultConnWindowSize
+	}
+	return opts.InitialConnWindowSize
+}
+
+// streamWindowSize returns the effective stream-level window.
+func (opts *HTTP2Options) streamWindowSize() int {
+	if opts.InitialWindowSize < 1 || opts.InitialWindowSize > math.MaxInt32 {
+		return http2DefaultStreamWindowSize
+	}
+	return opts.InitialWindowSize
+}
+
+// http2ClientConn is an [http.RoundTripper] using a single
+// [*http2.ClientConn] created over conn on the first round trip.
+//
+// We use the client connection directly, rather than through the transport
+// connection pool, to observe its state (see [*http2ClientConn.state]).
+type http2ClientConn struct {
+	// conn is the connection to use.
+	conn net.Conn
+
+	// txp is the transport creating the client connection.
+	txp *http2.Transport
+
+	// mu protects cc and err.
+	mu sync.Mutex
+
+	// cc is the client connection, created lazily.
+	cc *http2.ClientConn
+
+	// err is the error that occurred creating the client connection.
+	err error
+}
+
+// clientConn returns the client connection, creating it if needed.
+func (c *http2ClientConn) clientConn() (*http2.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc == nil && c.err == nil {
+		c.cc, c.err = c.txp.NewClientConn(c.conn)
+	}
+	return c.cc, c.err
+}
+
+// RoundTrip implements [http.RoundTripper].
+func (c *http2ClientConn) RoundTrip(req *http.Request) (*http.Response, error) {
+	cc, err := c.clientConn()
+	if err != nil {
+		return nil, err
+	}
+	return cc.RoundTrip(req)
+}
+
+// state returns the client connection state, if the client connection exists.
+func (c *http2ClientConn) state() (http2.ClientConnState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc == nil {
+		return http2.ClientConnState{}, false
+	}
+	return c.cc.State(), true
+}
+
+// close closes the client connection, if it exists.
+func (c *http2ClientConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cc != nil {
+		c.cc.Close()
+	}
+}
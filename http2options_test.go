@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// newHTTP2PipeConn returns a [TLSConn] negotiating h2 backed by the given conn.
+func newHTTP2PipeConn(conn net.Conn) *tlsstub.FuncTLSConn {
+	return &tlsstub.FuncTLSConn{
+		FuncConn: &netstub.FuncConn{
+			ReadFunc:        conn.Read,
+			WriteFunc:       conn.Write,
+			CloseFunc:       conn.Close,
+			LocalAddrFunc:   conn.LocalAddr,
+			RemoteAddrFunc:  conn.RemoteAddr,
+			SetDeadlineFunc: conn.SetDeadline,
+			SetReadDeadFunc: conn.SetReadDeadline,
+			SetWriteDeaFunc: conn.SetWriteDeadline,
+		},
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{NegotiatedProtocol: "h2", HandshakeComplete: true}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+}
+
+// The HTTP/2 transport advertises the configured windows and logs the options
+// along with the limit on concurrent streams advertised by the server.
+func TestHTTPConnFuncHTTP2Options(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// opts contains the options to use.
+		opts *HTTP2Options
+
+		// wantStream is the expected stream window.
+		wantStream int
+
+		// wantConn is the expected connection window.
+		wantConn int
+
+		// wantLogged indicates whether we expect the windows to be logged.
+		wantLogged bool
+	}{
+		{
+			name:       "without options",
+			opts:       nil,
+			wantStream: http2DefaultStreamWindowSize,
+			wantConn:   http2DefaultConnWindowSize,
+			wantLogged: false,
+		},
+
+		{
+			name:       "with zero options",
+			opts:       &HTTP2Options{},
+			wantStream: http2DefaultStreamWindowSize,
+			wantConn:   http2DefaultConnWindowSize,
+			wantLogged: true,
+		},
+
+		{
+			name: "with custom options",
+			opts: &HTTP2Options{
+				InitialWindowSize:     1 << 16,
+				InitialConnWindowSize: 1 << 20,
+			},
+			wantStream: 1 << 16,
+			wantConn:   1 << 20,
+			wantLogged: true,
+		},
+	}
+
+	// serverStreams is the limit on concurrent streams advertised by the server.
+	const serverStreams = 64
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			// Read the client preface, SETTINGS, and WINDOW_UPDATE frames and send
+			// our SETTINGS. Once the client has acknowledged them, respond to the
+			// request, so the limit is observed on a live connection.
+			type settings struct {
+				stream uint32
+				conn   uint32
+			}
+			done := make(chan settings, 1)
+			go func() {
+				var got settings
+				defer func() { done <- got }()
+				preface := make([]byte, len(http2.ClientPreface))
+				if _, err := io.ReadFull(server, preface); err != nil {
+					return
+				}
+				var (
+					acked    bool
+					requests bool
+					wrote    = make(chan struct{})
+				)
+				framer := http2.NewFramer(io.Discard, server)
+				for !acked || !requests {
+					frame, err := framer.ReadFrame()
+					if err != nil {
+						return
+					}
+					switch frame := frame.(type) {
+					case *http2.SettingsFrame:
+						if frame.IsAck() {
+							acked = true
+							continue
+						}
+						got.stream, _ = frame.Value(http2.SettingInitialWindowSize)
+						go func() {
+							defer close(wrote)
+							http2.NewFramer(server, nil).WriteSettings(http2.Setting{
+								ID:  http2.SettingMaxConcurrentStreams,
+								Val: serverStreams,
+							})
+						}()
+					case *http2.WindowUpdateFrame:
+						if frame.StreamID == 0 {
+							got.conn = frame.Increment
+						}
+					case *http2.HeadersFrame:
+						requests = true
+					}
+				}
+				<-wrote
+				var block bytes.Buffer
+				hpack.NewEncoder(&block).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				go http2.NewFramer(server, nil).WriteHeaders(http2.HeadersFrameParam{
+					StreamID:      1,
+					BlockFragment: block.Bytes(),
+					EndStream:     true,
+					EndHeaders:    true,
+				})
+				_, _ = io.Copy(io.Discard, server)
+			}()
+
+			logger, records := newCapturingLogger()
+			fn := NewHTTPConnFuncTLS(NewConfig(), logger)
+			fn.HTTP2Options = tt.opts
+			hc, err := fn.Call(context.Background(), newHTTP2PipeConn(client))
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, "GET", "https://example.com/", nil)
+			require.NoError(t, err)
+			resp, err := hc.RoundTrip(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			doneRecord, found := findRecord(*records, "httpRoundTripDone")
+			require.True(t, found)
+			hc.Close()
+
+			got := <-done
+			assert.Equal(t, uint32(tt.wantStream), got.stream)
+			assert.Equal(t, uint32(tt.wantConn), got.conn)
+
+			stream, found := findAttr(doneRecord, "http2InitialWindowSize")
+			require.Equal(t, tt.wantLogged, found)
+			connWindow, found := findAttr(doneRecord, "http2InitialConnWindowSize")
+			require.Equal(t, tt.wantLogged, found)
+			if tt.wantLogged {
+				assert.Equal(t, int64(tt.wantStream), stream.Int64())
+				assert.Equal(t, int64(tt.wantConn), connWindow.Int64())
+			}
+			streams, found := findAttr(doneRecord, "http2MaxConcurrentStreams")
+			require.True(t, found)
+			assert.Equal(t, int64(serverStreams), streams.Int64())
+		})
+	}
+}
@@ -11,6 +11,12 @@ import (
 // httpBodyWrap wraps an HTTP body so that we emit structured log events
 // lazily: httpBodyStreamStart on the first Read, and httpBodyStreamDone
 // on Close (only if at least one Read happened).
+//
+// The httpBodyStreamDone event includes httpBodyDownloadMs, the duration
+// between the first Read and Close, which, combined with the number of
+// bytes read, allows computing the download throughput. Because the first
+// Read happens after the headers have been received, this duration excludes
+// the time to first byte.
 func httpBodyWrap(
 	body io.ReadCloser,
 	errClass ErrClassifier,
@@ -77,15 +83,17 @@ func (b *httpBodyWrapper) Close() (err error) {
 	b.closeOnce.Do(func() {
 		err = b.body.Close()
 		if b.didRead.Load() { // acquire: t0 is visible if this returns true
+			t := b.timeNow()
 			b.logger.Info(
 				"httpBodyStreamDone",
 				slog.Any("err", err),
 				slog.String("errClass", b.errClass.Classify(err)),
+				slog.Int64("httpBodyDownloadMs", t.Sub(b.t0).Milliseconds()),
 				slog.String("localAddr", b.laddr),
 				slog.String("protocol", b.protocol),
 				slog.String("remoteAddr", b.raddr),
 				slog.Time("t0", b.t0),
-				slog.Time("t", b.timeNow()),
+				slog.Time("t", t),
 			)
 		}
 	})
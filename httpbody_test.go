@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// httpBodyStreamDone includes the duration between the first Read and Close.
+func TestHTTPBodyWrapLogsDownloadDuration(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+	logger, records := newCapturingLogger()
+	body := httpBodyWrap(io.NopCloser(strings.NewReader("hello, world")), DefaultErrClassifier,
+		"127.0.0.1:54321", logger, "tcp", "93.184.216.34:443", clock.Now)
+
+	clock.Advance(time.Second) // time to first byte, which must be excluded
+	buffer := make([]byte, 5)
+	_, err := body.Read(buffer)
+	require.NoError(t, err)
+	clock.Advance(150 * time.Millisecond)
+	_, err = io.ReadAll(body)
+	require.NoError(t, err)
+	clock.Advance(100 * time.Millisecond)
+	require.NoError(t, body.Close())
+
+	record, found := findRecord(*records, "httpBodyStreamDone")
+	require.True(t, found)
+	downloadMs, found := findAttr(record, "httpBodyDownloadMs")
+	require.True(t, found)
+	assert.Equal(t, int64(250), downloadMs.Int64())
+	recordT0, _ := findAttr(record, "t0")
+	assert.Equal(t, t0.Add(time.Second), recordT0.Time())
+	recordT, _ := findAttr(record, "t")
+	assert.Equal(t, t0.Add(1250*time.Millisecond), recordT.Time())
+}
+
+// Close without any Read does not emit httpBodyStreamDone.
+func TestHTTPBodyWrapCloseWithoutRead(t *testing.T) {
+	logger, records := newCapturingLogger()
+	body := httpBodyWrap(io.NopCloser(strings.NewReader("")), DefaultErrClassifier,
+		"", logger, "tcp", "", time.Now)
+
+	require.NoError(t, body.Close())
+	require.NoError(t, body.Close()) // idempotent
+
+	assert.Empty(t, *records)
+}
@@ -9,14 +9,20 @@ package nop
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bassosimone/safeconn"
 	"github.com/bassosimone/sud"
-	"golang.org/x/net/http2"
 )
 
 // HTTPConn represents an HTTP "connection" (a configured transport over a connection).
@@ -26,7 +32,8 @@ import (
 // HTTPConn performs round trips with structured logging and transparent body
 // observation: httpRoundTripStart/httpRoundTripDone span events are emitted
 // around each round trip, and the response body is lazily wrapped to emit
-// httpBodyStreamStart/httpBodyStreamDone events.
+// httpBodyStreamStart/httpBodyStreamDone events. The httpBodyStreamDone event
+// includes httpBodyDownloadMs, the time spent downloading the body.
 //
 // Construct using [NewHTTPConnFunc], [NewHTTPConnFuncPlain], [NewHTTPConnFuncTLS].
 type HTTPConn struct {
@@ -39,34 +46,72 @@ type HTTPConn struct {
 	// closeIdleFunc closes idle connections in the transport.
 	closeIdleFunc func()
 
+	// http2Options contains the HTTP/2 options in use, if any.
+	http2Options *HTTP2Options
+
+	// http2ActiveStreams counts the round trips in progress over
+	// an HTTP/2 connection (see [*HTTPConn.RoundTrip]).
+	http2ActiveStreams atomic.Int64
+
 	// ErrClassifier classifies errors for structured logging.
 	ErrClassifier ErrClassifier
 
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	Logger SLogger
 
+	// Observe1xxResponses enables logging informational (1xx) responses
+	// received before the final response as http1xxReceived events.
+	Observe1xxResponses bool
+
 	// TimeNow is the function to get the current time (configurable for testing).
 	TimeNow func() time.Time
 }
 
 // RoundTrip implements [http.RoundTripper].
+//
+// When the connection negotiated "h2" using ALPN, the httpRoundTripStart event
+// includes the http2ActiveStreams field containing the number of streams open
+// on the connection, including the one used by this round trip. Since neither
+// the standard library nor [golang.org/x/net/http2] expose this number for the
+// transport we use, the value is a best-effort count of the round trips in
+// progress, where a round trip ends when it fails or when its response body
+// is closed or fully read. Server-side stream resets and request bodies still
+// being uploaded are not accounted for.
 func (hc *HTTPConn) RoundTrip(req *http.Request) (*http.Response, error) {
 	// 1. Get the underlying connection for logging metadata
 	conn := hc.conn
 
-	// 2. Log before the round trip
+	// 2. Log before the round trip, counting the active streams
 	t0 := hc.TimeNow()
 	deadline, _ := req.Context().Deadline()
-	httpLogRoundTripStart(hc, conn, req, t0, deadline)
+	var streamAttrs []any
+	h2 := httpNegotiatedProtocol(conn) == "h2"
+	if h2 {
+		streamAttrs = append(streamAttrs, slog.Int64("http2ActiveStreams", hc.http2ActiveStreams.Add(1)))
+	}
+	httpLogRoundTripStart(hc, conn, req, t0, deadline, streamAttrs...)
 
 	// 3. Perform the round trip
+	if hc.Observe1xxResponses {
+		req = httpTrace1xxResponses(hc, conn, req)
+	}
 	resp, err := hc.txp.RoundTrip(req)
 
 	// 4. Log after the round trip
 	httpLogRoundTripDone(hc, conn, req, t0, deadline, resp, err)
+	if summary := ConnectionSummaryFromContext(req.Context()); summary != nil {
+		var statusCode int
+		if resp != nil {
+			statusCode = resp.StatusCode
+		}
+		summary.recordHTTPRoundTrip(statusCode, hc.ErrClassifier.Classify(err))
+	}
 
 	// 5. On error, return immediately
 	if err != nil {
+		if h2 {
+			hc.http2ActiveStreams.Add(-1)
+		}
 		return nil, err
 	}
 
@@ -74,15 +119,41 @@ func (hc *HTTPConn) RoundTrip(req *http.Request) (*http.Response, error) {
 	resp.Body = httpBodyWrap(
 		resp.Body,
 		hc.ErrClassifier,
-		safeconn.LocalAddr(conn),
+		connLocalAddr(conn),
 		hc.Logger,
 		safeconn.Network(conn),
-		safeconn.RemoteAddr(conn),
+		connRemoteAddr(conn),
 		hc.TimeNow,
 	)
+	if h2 {
+		resp.Body = &httpStreamBody{ReadCloser: resp.Body, done: func() { hc.http2ActiveStreams.Add(-1) }}
+	}
 	return resp, nil
 }
 
+// httpStreamBody wraps a response body to invoke done once, when the
+// body is closed or a Read fails, including when it returns [io.EOF].
+type httpStreamBody struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
+}
+
+// Read implements [io.Reader].
+func (b *httpStreamBody) Read(data []byte) (int, error) {
+	count, err := b.ReadCloser.Read(data)
+	if err != nil {
+		b.once.Do(b.done)
+	}
+	return count, err
+}
+
+// Close implements [io.Closer].
+func (b *httpStreamBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
 // Close cleans up the transport and closes the underlying connection.
 func (hc *HTTPConn) Close() error {
 	hc.closeIdleFunc()
@@ -97,46 +168,355 @@ func (hc *HTTPConn) Conn() net.Conn {
 	return hc.conn
 }
 
-func httpLogRoundTripStart(hc *HTTPConn, conn net.Conn, req *http.Request, t0 time.Time, deadline time.Time) {
-	hc.Logger.Info(
-		"httpRoundTripStart",
+// httpLogRoundTripStart logs the httpRoundTripStart event.
+//
+// The event includes the httpRequestCookieNames field containing the names,
+// but not the values, of the cookies sent with the request, which is useful
+// to study session behavior without having to parse the Cookie header. The
+// values of the Cookie and Set-Cookie headers are redacted in the logged
+// headers (see [httpRedactCookies]).
+//
+// The extra argument contains additional attributes to log.
+func httpLogRoundTripStart(hc *HTTPConn, conn net.Conn,
+	req *http.Request, t0 time.Time, deadline time.Time, extra ...any) {
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.String("httpMethod", req.Method),
 		slog.String("httpUrl", req.URL.String()),
-		slog.Any("httpRequestHeaders", req.Header),
-		slog.String("localAddr", safeconn.LocalAddr(conn)),
+		slog.Any("httpRequestCookieNames", httpCookieNames(req.Cookies())),
+		slog.Any("httpRequestHeaders", httpRedactCookies(req.Header)),
+		slog.String("localAddr", connLocalAddr(conn)),
 		slog.String("protocol", safeconn.Network(conn)),
-		slog.String("remoteAddr", safeconn.RemoteAddr(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
 		slog.Time("t", t0),
-	)
+	}
+	hc.Logger.Info("httpRoundTripStart", append(attrs, extra...)...)
 }
 
+// httpLogRoundTripDone logs the httpRoundTripDone event.
+//
+// When the connection uses HTTP/2 with [HTTP2Options], the event also includes
+// the http2InitialWindowSize and http2InitialConnWindowSize fields.
+//
+// When the connection negotiated "h2" using ALPN and the HTTP/2 client
+// connection exists, the event includes the http2MaxConcurrentStreams field
+// containing the limit on concurrent streams advertised by the server in
+// its SETTINGS, which is zero when no SETTINGS frame has been received yet.
+//
+// When the connection negotiated "h2" using ALPN and the round trip succeeded,
+// the event includes the http2FallbackToH1 field, which is true when the
+// response nonetheless reports HTTP/1.x, thus revealing a fallback.
+//
+// When the round trip succeeded, the event also includes the
+// httpProtocolConsistent field, which is true when the major version of
+// the response protocol matches the transport selected using ALPN, that
+// is, 2 for "h2" and 1 otherwise (see [httpProtocolConsistent]).
+//
+// Besides the whole response headers, the event includes the httpServerHeader
+// and httpVia fields containing the Server and Via response headers, which
+// are useful to fingerprint the server software. Multiple Via headers are
+// joined using ", " as allowed by RFC 9110. Both fields are empty when the
+// headers are missing or the round trip failed.
+//
+// The event also includes the httpKeepAlive field indicating whether the
+// server allows reusing the connection (see [httpKeepAlive]) and the
+// httpResponseHeaderBytes field approximating the size of the response
+// headers (see [httpResponseHeaderBytes]).
+//
+// Like httpRoundTripStart, the event includes httpRequestCookieNames. It also
+// includes httpResponseSetCookieNames, containing the names, but not the
+// values, of the cookies set by the response using Set-Cookie.
+//
+// Additionally, the httpAutoDecompressed field indicates whether the transport
+// transparently decompressed the body, which happens when the transport added
+// "Accept-Encoding: gzip" to the request on its own and the response carried
+// "Content-Encoding: gzip". In such a case, the transport removes the
+// Content-Encoding and Content-Length headers from the logged response headers.
+//
+// For cache-age analysis, the event includes the httpDate, httpAge, and
+// httpXCache fields containing the Date, Age, and X-Cache response headers,
+// respectively, each one only when the corresponding header is present.
+//
+// To make URL rewriting (e.g., by proxies or by normalization) visible, the
+// event includes the httpRequestedUrl field containing the URL of the request
+// we sent and, when the response carries its request, the httpEffectiveUrl
+// field containing the URL of the request that produced the response.
+//
+// When the connection exposes a TLS connection state (e.g., a [TLSConn]), the
+// event includes the httpTlsVersion and httpTlsCipherSuite fields, which
+// associate the response with the handshake that protected it.
+//
+// For HTTPS-redirect studies, when the response carries a valid
+// Strict-Transport-Security header, the event includes the parsed policy
+// as the httpHstsMaxAge (in seconds), httpHstsIncludeSubDomains, and
+// httpHstsPreload fields (see [httpParseHSTS]).
 func httpLogRoundTripDone(hc *HTTPConn, conn net.Conn, req *http.Request,
 	t0 time.Time, deadline time.Time, resp *http.Response, err error) {
 	var (
-		statusCode int
-		headers    http.Header
+		autoDecompressed bool
+		setCookieNames   = httpCookieNames(nil)
+		statusCode       int
+		headers          http.Header
 	)
 	if resp != nil {
+		autoDecompressed = resp.Uncompressed
+		setCookieNames = httpCookieNames(resp.Cookies())
 		statusCode = resp.StatusCode
 		headers = resp.Header
 	}
-	hc.Logger.Info(
-		"httpRoundTripDone",
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.Any("err", err),
 		slog.String("errClass", hc.ErrClassifier.Classify(err)),
+		slog.Bool("httpAutoDecompressed", autoDecompressed),
 		slog.String("httpMethod", req.Method),
 		slog.String("httpUrl", req.URL.String()),
-		slog.Any("httpRequestHeaders", req.Header),
-		slog.Any("httpResponseHeaders", headers),
+		slog.Any("httpRequestCookieNames", httpCookieNames(req.Cookies())),
+		slog.Any("httpRequestHeaders", httpRedactCookies(req.Header)),
+		slog.String("httpRequestedUrl", req.URL.String()),
+		slog.Bool("httpKeepAlive", httpKeepAlive(resp)),
+		slog.Int("httpResponseHeaderBytes", httpResponseHeaderBytes(resp)),
+		slog.Any("httpResponseHeaders", httpRedactCookies(headers)),
+		slog.Any("httpResponseSetCookieNames", setCookieNames),
 		slog.Int("httpResponseStatusCode", statusCode),
-		slog.String("localAddr", safeconn.LocalAddr(conn)),
+		slog.String("httpServerHeader", headers.Get("Server")),
+		slog.String("httpVia", strings.Join(headers.Values("Via"), ", ")),
+		slog.String("localAddr", connLocalAddr(conn)),
 		slog.String("protocol", safeconn.Network(conn)),
-		slog.String("remoteAddr", safeconn.RemoteAddr(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
 		slog.Time("t0", t0),
 		slog.Time("t", hc.TimeNow()),
-	)
+	}
+	if resp != nil && httpNegotiatedProtocol(conn) == "h2" {
+		attrs = append(attrs, slog.Bool("http2FallbackToH1", resp.ProtoMajor == 1))
+	}
+	if resp != nil {
+		attrs = append(attrs, slog.Bool("httpProtocolConsistent", httpProtocolConsistent(conn, resp)))
+	}
+	if hsts, ok := httpParseHSTS(headers.Get("Strict-Transport-Security")); ok {
+		attrs = append(attrs,
+			slog.Int64("httpHstsMaxAge", hsts.maxAge),
+			slog.Bool("httpHstsIncludeSubDomains", hsts.includeSubDomains),
+			slog.Bool("httpHstsPreload", hsts.preload),
+		)
+	}
+	if state, ok := httpTLSConnectionState(conn); ok {
+		attrs = append(attrs,
+			slog.String("httpTlsCipherSuite", tls.CipherSuiteName(state.CipherSuite)),
+			slog.String("httpTlsVersion", tls.VersionName(state.Version)),
+		)
+	}
+	if opts := hc.http2Options; opts != nil {
+		attrs = append(attrs,
+			slog.Int("http2InitialConnWindowSize", opts.connWindowSize()),
+			slog.Int("http2InitialWindowSize", opts.streamWindowSize()),
+		)
+	}
+	if h2conn, ok := hc.txp.(*http2ClientConn); ok {
+		if state, ok := h2conn.state(); ok {
+			attrs = append(attrs, slog.Int64("http2MaxConcurrentStreams", int64(state.MaxConcurrentStreams)))
+		}
+	}
+	if resp != nil && resp.Request != nil && resp.Request.URL != nil {
+		attrs = append(attrs, slog.String("httpEffectiveUrl", resp.Request.URL.String()))
+	}
+	for _, entry := range []struct{ key, header string }{
+		{"httpAge", "Age"},
+		{"httpDate", "Date"},
+		{"httpXCache", "X-Cache"},
+	} {
+		if value := headers.Get(entry.header); value != "" {
+			attrs = append(attrs, slog.String(entry.key, value))
+		}
+	}
+	hc.Logger.Info("httpRoundTripDone", attrs...)
+}
+
+// httpProtocolConsistent returns whether the major version of the response
+// protocol matches the transport that [HTTPConnFunc] selects for conn using
+// ALPN, which is HTTP/2 for "h2" and HTTP/1.1 otherwise.
+func httpProtocolConsistent(conn any, resp *http.Response) bool {
+	expectMajor := 1
+	if httpNegotiatedProtocol(conn) == "h2" {
+		expectMajor = 2
+	}
+	return resp.ProtoMajor == expectMajor
+}
+
+// httpNegotiatedProtocol returns the ALPN protocol negotiated by conn, or
+// the empty string when conn does not expose a TLS connection state.
+func httpNegotiatedProtocol(conn any) string {
+	state, _ := httpTLSConnectionState(conn)
+	return state.NegotiatedProtocol
+}
+
+// httpTLSConnectionState returns the TLS connection state of conn and true,
+// or the zero value and false when conn does not expose a TLS connection state.
+func httpTLSConnectionState(conn any) (tls.ConnectionState, bool) {
+	type connectionStater interface {
+		ConnectionState() tls.ConnectionState
+	}
+	if csp, ok := conn.(connectionStater); ok {
+		return csp.ConnectionState(), true
+	}
+	return tls.ConnectionState{}, false
+}
+
+// httpCookieNames returns the names of the given cookies, in order.
+func httpCookieNames(cookies []*http.Cookie) []string {
+	names := []string{}
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return names
+}
+
+// httpRedactedValue replaces the redacted header values.
+const httpRedactedValue = "[redacted]"
+
+// httpRedactCookies returns the given headers with the values of the Cookie
+// and Set-Cookie headers replaced by a placeholder, so that we never log
+// session tokens. The original headers are not modified: when there is
+// something to redact, this function returns a modified clone.
+func httpRedactCookies(header http.Header) http.Header {
+	if len(header.Values("Cookie")) <= 0 && len(header.Values("Set-Cookie")) <= 0 {
+		return header
+	}
+	header = header.Clone()
+	for _, key := range []string{"Cookie", "Set-Cookie"} {
+		for idx := range header[key] {
+			header[key][idx] = httpRedactedValue
+		}
+	}
+	return header
+}
+
+// httpResponseHeaderBytes approximates the number of bytes of the status line
+// and headers of the given response, or returns zero when the response is nil.
+//
+// The [net/http] transport does not expose the bytes read from the wire, so
+// we compute the size of the HTTP/1.1 serialization of the status line and of
+// the headers, each line terminated by CRLF, followed by the final CRLF. The
+// result differs from the wire size when the server uses a different
+// whitespace or letter case, when the transport removes headers (e.g.,
+// Content-Encoding after transparent decompression), and for HTTP/2, where
+// HPACK compresses the headers.
+func httpResponseHeaderBytes(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	count := len(resp.Proto) + len(" ") + len(resp.Status) + len("\r\n")
+	for key, values := range resp.Header {
+		for _, value := range values {
+			count += len(key) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	return count + len("\r\n")
+}
+
+// httpKeepAlive returns whether the given response allows reusing the
+// connection for subsequent requests, or false when the response is nil.
+//
+// HTTP/2 and later connections are always persistent. For HTTP/1.x, the
+// connection is not persistent when the transport marks the response with
+// Close or the Connection header contains "close". Otherwise, HTTP/1.1
+// connections are persistent by default, while HTTP/1.0 connections are
+// persistent only when the Connection header contains "keep-alive".
+func httpKeepAlive(resp *http.Response) bool {
+	switch {
+	case resp == nil:
+		return false
+	case resp.ProtoMajor >= 2:
+		return true
+	case resp.Close || httpHeaderHasToken(resp.Header, "Connection", "close"):
+		return false
+	case resp.ProtoAtLeast(1, 1):
+		return true
+	default:
+		return httpHeaderHasToken(resp.Header, "Connection", "keep-alive")
+	}
+}
+
+// httpHSTSPolicy is the policy parsed by [httpParseHSTS].
+type httpHSTSPolicy struct {
+	includeSubDomains bool
+	maxAge            int64
+	preload           bool
+}
+
+// httpParseHSTS parses the value of the Strict-Transport-Security header
+// (see RFC 6797, Section 6.1) and returns the policy and true, or false
+// when the value is invalid, e.g., because it is empty, lacks max-age, or
+// repeats a directive.
+//
+// Directive names are case-insensitive and their values may be quoted. We
+// ignore unknown directives and, besides the standard ones, we parse the
+// preload directive used to opt into the browsers' preload lists.
+func httpParseHSTS(value string) (policy httpHSTSPolicy, ok bool) {
+	seen := make(map[string]bool)
+	for directive := range strings.SplitSeq(value, ";") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return httpHSTSPolicy{}, false
+		}
+		seen[name] = true
+		switch name {
+		case "max-age":
+			arg = strings.Trim(strings.TrimSpace(arg), `"`)
+			maxAge, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil || maxAge < 0 || strings.HasPrefix(arg, "+") {
+				return httpHSTSPolicy{}, false
+			}
+			policy.maxAge = maxAge
+		case "includesubdomains":
+			policy.includeSubDomains = true
+		case "preload":
+			policy.preload = true
+		}
+	}
+	if !seen["max-age"] {
+		return httpHSTSPolicy{}, false
+	}
+	return policy, true
+}
+
+// httpHeaderHasToken returns whether the comma-separated values of the
+// given header contain the given token, using case-insensitive matching.
+func httpHeaderHasToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for elem := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(elem), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// httpTrace1xxResponses returns a copy of req whose context carries an
+// [*httptrace.ClientTrace] logging each informational (1xx) response.
+func httpTrace1xxResponses(hc *HTTPConn, conn net.Conn, req *http.Request) *http.Request {
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			hc.Logger.Info(
+				"http1xxReceived",
+				slog.String("httpMethod", req.Method),
+				slog.String("httpUrl", req.URL.String()),
+				slog.Any("httpResponseHeaders", httpRedactCookies(http.Header(header))),
+				slog.Int("httpResponseStatusCode", code),
+				slog.String("localAddr", connLocalAddr(conn)),
+				slog.String("protocol", safeconn.Network(conn)),
+				slog.String("remoteAddr", connRemoteAddr(conn)),
+				slog.Time("t", hc.TimeNow()),
+			)
+			return nil
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
 }
 
 // HTTPConnFunc wraps a connection into an [*HTTPConn].
@@ -149,6 +529,12 @@ func httpLogRoundTripDone(hc *HTTPConn, conn net.Conn, req *http.Request,
 //
 // The caller is responsible for closing the returned [*HTTPConn].
 //
+// To make the transport selection auditable, Call emits an httpConnCreated
+// event containing the ALPN protocol negotiated by the connection, if any, as
+// tlsNegotiatedProtocol and the selected transport ("h2" or "http/1.1") as
+// httpConnTransport. For example, a [*TLSHandshakeFunc] whose configuration
+// does not offer "h2" forces HTTP/1.1 even when the server supports HTTP/2.
+//
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type HTTPConnFunc[T net.Conn] struct {
@@ -157,11 +543,24 @@ type HTTPConnFunc[T net.Conn] struct {
 	// Set by [NewHTTPConnFunc] from [Config.ErrClassifier].
 	ErrClassifier ErrClassifier
 
+	// HTTP2Options optionally configures the HTTP/2 transport. When not nil
+	// and the connection negotiates HTTP/2, the configured flow-control windows
+	// are also logged on httpRoundTripDone (see [HTTP2Options]).
+	//
+	// Set by [NewHTTPConnFunc] to nil.
+	HTTP2Options *HTTP2Options
+
 	// Logger is the [SLogger] to use (configurable for testing or custom logging).
 	//
 	// Set by [NewHTTPConnFunc] to the user-provided logger.
 	Logger SLogger
 
+	// Observe1xxResponses enables logging informational (1xx) responses
+	// as http1xxReceived events (see [HTTPConn.Observe1xxResponses]).
+	//
+	// Set by [NewHTTPConnFunc] to false.
+	Observe1xxResponses bool
+
 	// TimeNow is the function to get the current time (configurable for testing).
 	//
 	// Set by [NewHTTPConnFunc] from [Config.TimeNow].
@@ -187,30 +586,26 @@ var _ Func[TLSConn, *HTTPConn] = &HTTPConnFunc[TLSConn]{}
 // Call implements [Func].
 func (op *HTTPConnFunc[T]) Call(ctx context.Context, conn T) (*HTTPConn, error) {
 	// Obtain the protocol that was negotiated
-	type connectionStater interface {
-		ConnectionState() tls.ConnectionState
-	}
-	var alpn string
-	if csp, ok := any(conn).(connectionStater); ok {
-		alpn = csp.ConnectionState().NegotiatedProtocol
-	}
-
-	// Create a special dialer that works just once
-	dialer := sud.NewSingleUseDialer(conn)
+	alpn := httpNegotiatedProtocol(conn)
 
 	// Create proper transport depending on ALPN
 	var txp http.RoundTripper
 	var closeIdleFunc func()
+	var http2Options *HTTP2Options
+	transport := "http/1.1"
 	switch alpn {
 	case "h2":
-		h2txp := &http2.Transport{
-			DialTLSContext:     dialer.DialTLSContext,
-			DisableCompression: false,
-		}
-		txp = h2txp
-		closeIdleFunc = h2txp.CloseIdleConnections
+		transport = "h2"
+		h2txp := op.HTTP2Options.newTransport()
+		h2txp.DisableCompression = false
+		h2conn := &http2ClientConn{conn: conn, txp: h2txp}
+		txp = h2conn
+		closeIdleFunc = h2conn.close
+		http2Options = op.HTTP2Options
 
 	default:
+		// Create a special dialer that works just once
+		dialer := sud.NewSingleUseDialer(conn)
 		h1txp := &http.Transport{
 			DialContext:        dialer.DialContext,
 			DialTLSContext:     dialer.DialContext,
@@ -222,13 +617,24 @@ func (op *HTTPConnFunc[T]) Call(ctx context.Context, conn T) (*HTTPConn, error)
 	}
 
 	hc := &HTTPConn{
-		conn:          conn,
-		txp:           txp,
-		closeIdleFunc: closeIdleFunc,
-		ErrClassifier: op.ErrClassifier,
-		Logger:        op.Logger,
-		TimeNow:       op.TimeNow,
+		conn:                conn,
+		txp:                 txp,
+		closeIdleFunc:       closeIdleFunc,
+		http2Options:        http2Options,
+		ErrClassifier:       op.ErrClassifier,
+		Logger:              op.Logger,
+		Observe1xxResponses: op.Observe1xxResponses,
+		TimeNow:             op.TimeNow,
 	}
+	op.Logger.Info(
+		"httpConnCreated",
+		slog.String("httpConnTransport", transport),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t", op.TimeNow()),
+		slog.String("tlsNegotiatedProtocol", alpn),
+	)
 	return hc, nil
 }
 
@@ -131,3 +131,74 @@ func TestNewHTTPConnFuncTLS(t *testing.T) {
 	// Verify it satisfies Func interface
 	var _ Func[TLSConn, *HTTPConn] = fn
 }
+
+// Call logs the negotiated ALPN protocol and the selected transport on httpConnCreated.
+func TestHTTPConnFuncLogsTransport(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// alpn is the protocol negotiated by the TLS connection.
+		alpn string
+
+		// wantTransport is the expected httpConnTransport.
+		wantTransport string
+	}{
+		{
+			name:          "h2 negotiated",
+			alpn:          "h2",
+			wantTransport: "h2",
+		},
+
+		{
+			name:          "http/1.1 negotiated",
+			alpn:          "http/1.1",
+			wantTransport: "http/1.1",
+		},
+
+		{
+			name:          "no ALPN",
+			alpn:          "",
+			wantTransport: "http/1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{NegotiatedProtocol: tt.alpn}
+				},
+			}
+			logger, records := newCapturingLogger()
+
+			_, err := NewHTTPConnFuncTLS(NewConfig(), logger).Call(context.Background(), mockTLSConn)
+
+			require.NoError(t, err)
+			require.Len(t, *records, 1)
+			assert.Equal(t, "httpConnCreated", (*records)[0].Message)
+			value, found := findAttr((*records)[0], "tlsNegotiatedProtocol")
+			require.True(t, found)
+			assert.Equal(t, tt.alpn, value.String())
+			value, found = findAttr((*records)[0], "httpConnTransport")
+			require.True(t, found)
+			assert.Equal(t, tt.wantTransport, value.String())
+		})
+	}
+
+	t.Run("plain connection", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+
+		_, err := NewHTTPConnFuncPlain(NewConfig(), logger).Call(context.Background(), newMinimalConn())
+
+		require.NoError(t, err)
+		require.Len(t, *records, 1)
+		value, found := findAttr((*records)[0], "tlsNegotiatedProtocol")
+		require.True(t, found)
+		assert.Empty(t, value.String())
+		value, found = findAttr((*records)[0], "httpConnTransport")
+		require.True(t, found)
+		assert.Equal(t, "http/1.1", value.String())
+	})
+}
@@ -3,16 +3,24 @@
 package nop
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/bassosimone/tlsstub"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -207,3 +215,1096 @@ func TestHTTPConnRoundTripLogsConnectionMetadata(t *testing.T) {
 	assert.Equal(t, wantRemoteAddr, gotRemoteAddr)
 	assert.Equal(t, wantProtocol, gotProtocol)
 }
+
+// RoundTrip logs informational responses when Observe1xxResponses is set.
+func TestHTTPConnRoundTripObserve1xxResponses(t *testing.T) {
+	// newHTTPConn returns an HTTPConn whose transport delivers a 100 and
+	// a 103 informational response before the final response.
+	newHTTPConn := func(logger SLogger, observe bool) *HTTPConn {
+		return &HTTPConn{
+			conn: newMinimalConn(),
+			txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+				if trace := httptrace.ContextClientTrace(req.Context()); trace != nil {
+					require.NoError(t, trace.Got1xxResponse(100, textproto.MIMEHeader{}))
+					require.NoError(t, trace.Got1xxResponse(103, textproto.MIMEHeader{
+						"Link": []string{"</style.css>; rel=preload"},
+					}))
+				}
+				return &http.Response{
+					StatusCode: 200,
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil
+			}),
+			closeIdleFunc:       func() {},
+			ErrClassifier:       NewConfig().ErrClassifier,
+			Logger:              logger,
+			Observe1xxResponses: observe,
+			TimeNow:             time.Now,
+		}
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		require.NoError(t, err)
+
+		_, err = newHTTPConn(logger, true).RoundTrip(req)
+		require.NoError(t, err)
+
+		require.Len(t, *records, 4)
+		assert.Equal(t, "httpRoundTripStart", (*records)[0].Message)
+		assert.Equal(t, "http1xxReceived", (*records)[1].Message)
+		assert.Equal(t, "http1xxReceived", (*records)[2].Message)
+		assert.Equal(t, "httpRoundTripDone", (*records)[3].Message)
+
+		code, found := findAttr((*records)[1], "httpResponseStatusCode")
+		require.True(t, found)
+		assert.Equal(t, int64(100), code.Int64())
+		code, found = findAttr((*records)[2], "httpResponseStatusCode")
+		require.True(t, found)
+		assert.Equal(t, int64(103), code.Int64())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		require.NoError(t, err)
+
+		_, err = newHTTPConn(logger, false).RoundTrip(req)
+		require.NoError(t, err)
+
+		require.Len(t, *records, 2)
+	})
+}
+
+// RoundTrip logs the Server and Via response headers in the done event.
+func TestHTTPConnRoundTripLogsServerSoftware(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// header contains the response headers.
+		header http.Header
+
+		// wantServer is the expected httpServerHeader value.
+		wantServer string
+
+		// wantVia is the expected httpVia value.
+		wantVia string
+	}{
+		{
+			name: "server and via headers",
+			header: http.Header{
+				"Server": []string{"nginx/1.25.3"},
+				"Via":    []string{"1.1 varnish", "1.1 squid"},
+			},
+			wantServer: "nginx/1.25.3",
+			wantVia:    "1.1 varnish, 1.1 squid",
+		},
+
+		{
+			name:       "missing headers",
+			header:     http.Header{},
+			wantServer: "",
+			wantVia:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Header:     tt.header,
+						Body:       io.NopCloser(strings.NewReader("")),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        logger,
+				TimeNow:       time.Now,
+			}
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			server, found := findAttr((*records)[1], "httpServerHeader")
+			require.True(t, found)
+			assert.Equal(t, tt.wantServer, server.String())
+			via, found := findAttr((*records)[1], "httpVia")
+			require.True(t, found)
+			assert.Equal(t, tt.wantVia, via.String())
+		})
+	}
+}
+
+// RoundTrip logs the Date, Age, and X-Cache response headers only when present.
+func TestHTTPConnRoundTripLogsCacheAge(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// header contains the response headers.
+		header http.Header
+
+		// want maps each field to its expected value, or to the empty
+		// string when we expect the field to be missing.
+		want map[string]string
+	}{
+		{
+			name: "cache headers",
+			header: http.Header{
+				"Age":     []string{"3600"},
+				"Date":    []string{"Mon, 06 Jan 2025 12:00:00 GMT"},
+				"X-Cache": []string{"HIT"},
+			},
+			want: map[string]string{
+				"httpAge":    "3600",
+				"httpDate":   "Mon, 06 Jan 2025 12:00:00 GMT",
+				"httpXCache": "HIT",
+			},
+		},
+
+		{
+			name: "date only",
+			header: http.Header{
+				"Date": []string{"Mon, 06 Jan 2025 12:00:00 GMT"},
+			},
+			want: map[string]string{
+				"httpAge":    "",
+				"httpDate":   "Mon, 06 Jan 2025 12:00:00 GMT",
+				"httpXCache": "",
+			},
+		},
+
+		{
+			name:   "missing headers",
+			header: http.Header{},
+			want: map[string]string{
+				"httpAge":    "",
+				"httpDate":   "",
+				"httpXCache": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Header:     tt.header,
+						Body:       io.NopCloser(strings.NewReader("")),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        logger,
+				TimeNow:       time.Now,
+			}
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			for key, want := range tt.want {
+				value, found := findAttr((*records)[1], key)
+				assert.Equal(t, want != "", found, key)
+				if found {
+					assert.Equal(t, want, value.String(), key)
+				}
+			}
+		})
+	}
+}
+
+// RoundTrip logs whether the server allows reusing the connection.
+func TestHTTPConnRoundTripLogsKeepAlive(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// protoMajor and protoMinor are the response protocol version.
+		protoMajor, protoMinor int
+
+		// header contains the response headers.
+		header http.Header
+
+		// wantKeepAlive is the expected httpKeepAlive value.
+		wantKeepAlive bool
+	}{
+		{
+			name:          "HTTP/1.0",
+			protoMajor:    1,
+			protoMinor:    0,
+			header:        http.Header{},
+			wantKeepAlive: false,
+		},
+
+		{
+			name:          "HTTP/1.0 with Connection: keep-alive",
+			protoMajor:    1,
+			protoMinor:    0,
+			header:        http.Header{"Connection": []string{"Keep-Alive"}},
+			wantKeepAlive: true,
+		},
+
+		{
+			name:          "HTTP/1.1",
+			protoMajor:    1,
+			protoMinor:    1,
+			header:        http.Header{},
+			wantKeepAlive: true,
+		},
+
+		{
+			name:          "HTTP/1.1 with Connection: close",
+			protoMajor:    1,
+			protoMinor:    1,
+			header:        http.Header{"Connection": []string{"upgrade, close"}},
+			wantKeepAlive: false,
+		},
+
+		{
+			name:          "HTTP/2",
+			protoMajor:    2,
+			protoMinor:    0,
+			header:        http.Header{},
+			wantKeepAlive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						ProtoMajor: tt.protoMajor,
+						ProtoMinor: tt.protoMinor,
+						Header:     tt.header,
+						Body:       io.NopCloser(strings.NewReader("")),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        logger,
+				TimeNow:       time.Now,
+			}
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			keepAlive, found := findAttr((*records)[1], "httpKeepAlive")
+			require.True(t, found)
+			assert.Equal(t, tt.wantKeepAlive, keepAlive.Bool())
+		})
+	}
+}
+
+// RoundTrip logs the approximate size of the response status line and headers.
+func TestHTTPConnRoundTripLogsResponseHeaderBytes(t *testing.T) {
+	logger, records := newCapturingLogger()
+	httpConn := &HTTPConn{
+		conn: newMinimalConn(),
+		txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Proto:      "HTTP/1.1",
+				ProtoMajor: 1,
+				ProtoMinor: 1,
+				Header: http.Header{
+					"Content-Type": []string{"text/html"},
+					"Set-Cookie":   []string{"a=1", "b=2"},
+				},
+				Body: io.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        logger,
+		TimeNow:       time.Now,
+	}
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	require.NoError(t, err)
+
+	_, err = httpConn.RoundTrip(req)
+	require.NoError(t, err)
+
+	// HTTP/1.1 200 OK\r\n                 17 bytes
+	// Content-Type: text/html\r\n         25 bytes
+	// Set-Cookie: a=1\r\n                 17 bytes
+	// Set-Cookie: b=2\r\n                 17 bytes
+	// \r\n                                 2 bytes
+	require.Len(t, *records, 2)
+	value, found := findAttr((*records)[1], "httpResponseHeaderBytes")
+	require.True(t, found)
+	assert.Equal(t, int64(78), value.Int64())
+}
+
+// RoundTrip logs whether the transport transparently decompressed the body.
+func TestHTTPConnRoundTripLogsAutoDecompressed(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// gzip indicates whether the server compresses the body.
+		gzip bool
+
+		// want is the expected httpAutoDecompressed value.
+		want bool
+	}{
+		{name: "gzip response", gzip: true, want: true},
+		{name: "identity response", gzip: false, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const body = "Hello, World!\n"
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				defer server.Close()
+				req, err := http.ReadRequest(bufio.NewReader(server))
+				if err != nil {
+					return
+				}
+				resp := &http.Response{
+					StatusCode: http.StatusOK,
+					ProtoMajor: 1,
+					ProtoMinor: 1,
+					Header:     http.Header{},
+					Request:    req,
+				}
+				var buffer bytes.Buffer
+				if tt.gzip && strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+					zw := gzip.NewWriter(&buffer)
+					_, _ = zw.Write([]byte(body))
+					_ = zw.Close()
+					resp.Header.Set("Content-Encoding", "gzip")
+				} else {
+					buffer.WriteString(body)
+				}
+				resp.ContentLength = int64(buffer.Len())
+				resp.Body = io.NopCloser(&buffer)
+				_ = resp.Write(server)
+			}()
+
+			logger, records := newCapturingLogger()
+			httpConn, err := NewHTTPConnFuncPlain(NewConfig(), logger).Call(context.Background(), client)
+			require.NoError(t, err)
+			defer httpConn.Close()
+			req, err := http.NewRequest("GET", "http://example.com/", nil)
+			require.NoError(t, err)
+
+			resp, err := httpConn.RoundTrip(req)
+			require.NoError(t, err)
+			data, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, body, string(data))
+
+			done, found := findRecord(*records, "httpRoundTripDone")
+			require.True(t, found)
+			value, found := findAttr(done, "httpAutoDecompressed")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.Bool())
+		})
+	}
+}
+
+// RoundTrip logs the names, but not the values, of the cookies sent and received.
+func TestHTTPConnRoundTripLogsCookieNames(t *testing.T) {
+	logger, records := newCapturingLogger()
+	httpConn := &HTTPConn{
+		conn: newMinimalConn(),
+		txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Header: http.Header{
+					"Set-Cookie": []string{
+						"session=s3cr3t; Path=/; HttpOnly",
+						"theme=dark",
+					},
+				},
+				Body: io.NopCloser(strings.NewReader("")),
+			}, nil
+		}),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        logger,
+		TimeNow:       time.Now,
+	}
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	require.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: "id", Value: "t0k3n"})
+	req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+
+	_, err = httpConn.RoundTrip(req)
+	require.NoError(t, err)
+
+	require.Len(t, *records, 2)
+	for _, record := range *records {
+		value, found := findAttr(record, "httpRequestCookieNames")
+		require.True(t, found, record.Message)
+		assert.Equal(t, []string{"id", "lang"}, value.Any())
+	}
+	value, found := findAttr((*records)[1], "httpResponseSetCookieNames")
+	require.True(t, found)
+	assert.Equal(t, []string{"session", "theme"}, value.Any())
+	_, found = findAttr((*records)[0], "httpResponseSetCookieNames")
+	assert.False(t, found)
+
+	// Make sure the cookie values never appear in any event
+	for _, record := range *records {
+		record.Attrs(func(attr slog.Attr) bool {
+			text := fmt.Sprint(attr.Value.Any())
+			for _, secret := range []string{"s3cr3t", "t0k3n", "dark", "lang=en"} {
+				assert.NotContains(t, text, secret, attr.Key)
+			}
+			return true
+		})
+	}
+	value, found = findAttr((*records)[1], "httpRequestHeaders")
+	require.True(t, found)
+	assert.Equal(t, []string{httpRedactedValue}, value.Any().(http.Header).Values("Cookie"))
+	value, found = findAttr((*records)[1], "httpResponseHeaders")
+	require.True(t, found)
+	assert.Equal(t, []string{httpRedactedValue, httpRedactedValue},
+		value.Any().(http.Header).Values("Set-Cookie"))
+
+	// Make sure we did not modify the original request headers
+	assert.Equal(t, "id=t0k3n; lang=en", req.Header.Get("Cookie"))
+}
+
+// httpRedactCookies returns the same headers when there is nothing to redact.
+func TestHTTPRedactCookies(t *testing.T) {
+	assert.Nil(t, httpRedactCookies(nil))
+	header := http.Header{"Accept": []string{"*/*"}}
+	assert.Equal(t, header, httpRedactCookies(header))
+	header.Set("Cookie", "id=t0k3n")
+	assert.Equal(t, http.Header{
+		"Accept": []string{"*/*"},
+		"Cookie": []string{httpRedactedValue},
+	}, httpRedactCookies(header))
+	assert.Equal(t, "id=t0k3n", header.Get("Cookie"))
+}
+
+// RoundTrip logs empty cookie names when there are no cookies or the round trip fails.
+func TestHTTPConnRoundTripLogsCookieNamesEmpty(t *testing.T) {
+	logger, records := newCapturingLogger()
+	httpConn := &HTTPConn{
+		conn: newMinimalConn(),
+		txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("mocked error")
+		}),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        logger,
+		TimeNow:       time.Now,
+	}
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	require.NoError(t, err)
+
+	_, err = httpConn.RoundTrip(req)
+	require.Error(t, err)
+
+	require.Len(t, *records, 2)
+	value, found := findAttr((*records)[1], "httpRequestCookieNames")
+	require.True(t, found)
+	assert.Empty(t, value.Any())
+	value, found = findAttr((*records)[1], "httpResponseSetCookieNames")
+	require.True(t, found)
+	assert.Empty(t, value.Any())
+}
+
+// RoundTrip logs the requested URL and, when the response carries its
+// request, the effective URL, so that rewrites are visible.
+func TestHTTPConnRoundTripLogsEffectiveURL(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// rewrite returns the request the response carries.
+		rewrite func(req *http.Request) *http.Request
+
+		// wantEffective is the expected httpEffectiveUrl, or the empty
+		// string when we expect the field to be missing.
+		wantEffective string
+	}{
+		{
+			name: "rewritten URL",
+			rewrite: func(req *http.Request) *http.Request {
+				rewritten := req.Clone(req.Context())
+				rewritten.URL.Host = "www.example.com"
+				rewritten.URL.Path = "/index.html"
+				return rewritten
+			},
+			wantEffective: "https://www.example.com/index.html",
+		},
+
+		{
+			name: "same URL",
+			rewrite: func(req *http.Request) *http.Request {
+				return req
+			},
+			wantEffective: "https://example.com/",
+		},
+
+		{
+			name: "missing request",
+			rewrite: func(req *http.Request) *http.Request {
+				return nil
+			},
+			wantEffective: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := &HTTPConn{
+				conn: newMinimalConn(),
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						Header:     http.Header{},
+						Body:       io.NopCloser(strings.NewReader("")),
+						Request:    tt.rewrite(req),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        logger,
+				TimeNow:       time.Now,
+			}
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "httpRequestedUrl")
+			require.True(t, found)
+			assert.Equal(t, "https://example.com/", value.String())
+			value, found = findAttr((*records)[1], "httpEffectiveUrl")
+			require.Equal(t, tt.wantEffective != "", found)
+			if found {
+				assert.Equal(t, tt.wantEffective, value.String())
+			}
+		})
+	}
+}
+
+// RoundTrip logs whether the response falls back to HTTP/1.x when the
+// connection negotiated h2 and omits the field otherwise.
+func TestHTTPConnRoundTripLogsHTTP2FallbackToH1(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// alpn is the protocol negotiated by the connection.
+		alpn string
+
+		// protoMajor is the response protocol major version.
+		protoMajor int
+
+		// wantFound indicates whether we expect http2FallbackToH1.
+		wantFound bool
+
+		// wantFallback is the expected http2FallbackToH1.
+		wantFallback bool
+	}{
+		{
+			name:         "h2 negotiated and HTTP/1.1 response",
+			alpn:         "h2",
+			protoMajor:   1,
+			wantFound:    true,
+			wantFallback: true,
+		},
+
+		{
+			name:         "h2 negotiated and HTTP/2 response",
+			alpn:         "h2",
+			protoMajor:   2,
+			wantFound:    true,
+			wantFallback: false,
+		},
+
+		{
+			name:       "http/1.1 negotiated",
+			alpn:       "http/1.1",
+			protoMajor: 1,
+			wantFound:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := &HTTPConn{
+				conn: &tlsstub.FuncTLSConn{
+					FuncConn: newMinimalConn(),
+					ConnectionStateFunc: func() tls.ConnectionState {
+						return tls.ConnectionState{NegotiatedProtocol: tt.alpn}
+					},
+				},
+				txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: 200,
+						ProtoMajor: tt.protoMajor,
+						Header:     http.Header{},
+						Body:       io.NopCloser(strings.NewReader("")),
+					}, nil
+				}),
+				closeIdleFunc: func() {},
+				ErrClassifier: NewConfig().ErrClassifier,
+				Logger:        logger,
+				TimeNow:       time.Now,
+			}
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "http2FallbackToH1")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.wantFallback, value.Bool())
+			}
+		})
+	}
+}
+
+// RoundTrip omits http2FallbackToH1 when the round trip fails.
+func TestHTTPConnRoundTripLogsHTTP2FallbackToH1Error(t *testing.T) {
+	logger, records := newCapturingLogger()
+	httpConn := &HTTPConn{
+		conn: &tlsstub.FuncTLSConn{
+			FuncConn: newMinimalConn(),
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{NegotiatedProtocol: "h2"}
+			},
+		},
+		txp: funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("mocked error")
+		}),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        logger,
+		TimeNow:       time.Now,
+	}
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	require.NoError(t, err)
+
+	_, err = httpConn.RoundTrip(req)
+	require.Error(t, err)
+
+	require.Len(t, *records, 2)
+	_, found := findAttr((*records)[1], "http2FallbackToH1")
+	assert.False(t, found)
+}
+
+// RoundTrip logs whether the response protocol matches the transport
+// selected using ALPN and omits the field when the round trip fails.
+func TestHTTPConnRoundTripLogsProtocolConsistent(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// alpn is the protocol negotiated by the connection.
+		alpn string
+
+		// protoMajor is the response protocol major version.
+		protoMajor int
+
+		// err is the error returned by the transport.
+		err error
+
+		// wantFound indicates whether we expect httpProtocolConsistent.
+		wantFound bool
+
+		// wantConsistent is the expected httpProtocolConsistent.
+		wantConsistent bool
+	}{
+		{
+			name:           "h2 negotiated and HTTP/2 response",
+			alpn:           "h2",
+			protoMajor:     2,
+			wantFound:      true,
+			wantConsistent: true,
+		},
+
+		{
+			name:           "h2 negotiated and HTTP/1.1 response",
+			alpn:           "h2",
+			protoMajor:     1,
+			wantFound:      true,
+			wantConsistent: false,
+		},
+
+		{
+			name:           "http/1.1 negotiated and HTTP/1.1 response",
+			alpn:           "http/1.1",
+			protoMajor:     1,
+			wantFound:      true,
+			wantConsistent: true,
+		},
+
+		{
+			name:           "nothing negotiated and HTTP/2 response",
+			alpn:           "",
+			protoMajor:     2,
+			wantFound:      true,
+			wantConsistent: false,
+		},
+
+		{
+			name:      "round trip error",
+			alpn:      "h2",
+			err:       errors.New("mocked error"),
+			wantFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			httpConn := newHTTP2TestConn(logger, tt.alpn, func(req *http.Request) (*http.Response, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &http.Response{
+					StatusCode: 200,
+					ProtoMajor: tt.protoMajor,
+					Header:     http.Header{},
+					Body:       io.NopCloser(strings.NewReader("")),
+				}, nil
+			})
+			req, err := http.NewRequest("GET", "https://example.com/", nil)
+			require.NoError(t, err)
+
+			_, err = httpConn.RoundTrip(req)
+			require.ErrorIs(t, err, tt.err)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "httpProtocolConsistent")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.wantConsistent, value.Bool())
+			}
+		})
+	}
+}
+
+// newHTTP2TestConn returns an [*HTTPConn] over a connection that negotiated
+// the given ALPN protocol, whose transport uses the given function.
+func newHTTP2TestConn(logger SLogger, alpn string, fx func(req *http.Request) (*http.Response, error)) *HTTPConn {
+	return &HTTPConn{
+		conn: &tlsstub.FuncTLSConn{
+			FuncConn: newMinimalConn(),
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{NegotiatedProtocol: alpn}
+			},
+		},
+		txp:           funcRoundTripper(fx),
+		closeIdleFunc: func() {},
+		ErrClassifier: NewConfig().ErrClassifier,
+		Logger:        logger,
+		TimeNow:       time.Now,
+	}
+}
+
+// RoundTrip logs http2ActiveStreams on httpRoundTripStart, counting the
+// round trips in progress, including the current one.
+func TestHTTPConnRoundTripLogsHTTP2ActiveStreams(t *testing.T) {
+	// roundTrip performs a round trip and returns the response along
+	// with the http2ActiveStreams field of the last httpRoundTripStart.
+	roundTrip := func(t *testing.T, hc *HTTPConn, records *[]slog.Record) (*http.Response, int64, error) {
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		require.NoError(t, err)
+		resp, err := hc.RoundTrip(req)
+		var start slog.Record
+		for _, record := range *records {
+			if record.Message == "httpRoundTripStart" {
+				start = record
+			}
+		}
+		value, found := findAttr(start, "http2ActiveStreams")
+		require.True(t, found)
+		return resp, value.Int64(), err
+	}
+
+	newResponse := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			ProtoMajor: 2,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("abc")),
+		}, nil
+	}
+
+	t.Run("sequential round trips", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "h2", newResponse)
+
+		for range 3 {
+			resp, active, err := roundTrip(t, hc, records)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), active)
+			_, err = io.ReadAll(resp.Body) // reading until EOF ends the stream
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("overlapping round trips", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "h2", newResponse)
+
+		resp1, active, err := roundTrip(t, hc, records)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), active)
+
+		resp2, active, err := roundTrip(t, hc, records)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), active)
+
+		require.NoError(t, resp1.Body.Close())
+		require.NoError(t, resp1.Body.Close()) // idempotent
+		resp3, active, err := roundTrip(t, hc, records)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), active)
+
+		require.NoError(t, resp2.Body.Close())
+		require.NoError(t, resp3.Body.Close())
+		resp4, active, err := roundTrip(t, hc, records)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), active)
+		require.NoError(t, resp4.Body.Close())
+	})
+
+	t.Run("failed round trips", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "h2", func(req *http.Request) (*http.Response, error) {
+			return nil, errors.New("mocked error")
+		})
+
+		for range 2 {
+			_, active, err := roundTrip(t, hc, records)
+			require.Error(t, err)
+			assert.Equal(t, int64(1), active)
+		}
+	})
+}
+
+// RoundTrip omits http2ActiveStreams when the connection did not negotiate h2.
+func TestHTTPConnRoundTripLogsHTTP2ActiveStreamsNotH2(t *testing.T) {
+	logger, records := newCapturingLogger()
+	hc := newHTTP2TestConn(logger, "http/1.1", func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			ProtoMajor: 1,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	req, err := http.NewRequest("GET", "https://example.com/", nil)
+	require.NoError(t, err)
+
+	resp, err := hc.RoundTrip(req)
+
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Len(t, *records, 2)
+	_, found := findAttr((*records)[0], "http2ActiveStreams")
+	assert.False(t, found)
+}
+
+// RoundTrip logs the TLS version and cipher suite on httpRoundTripDone when
+// the connection is a TLSConn and omits them otherwise.
+func TestHTTPConnRoundTripLogsTLSState(t *testing.T) {
+	newResponse := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			ProtoMajor: 1,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	}
+
+	// roundTrip performs a round trip and returns the httpRoundTripDone event.
+	roundTrip := func(t *testing.T, hc *HTTPConn, records *[]slog.Record) slog.Record {
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		require.NoError(t, err)
+		resp, err := hc.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		record, found := findRecord(*records, "httpRoundTripDone")
+		require.True(t, found)
+		return record
+	}
+
+	t.Run("TLS connection", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "http/1.1", newResponse)
+		hc.conn = &tlsstub.FuncTLSConn{
+			FuncConn: newMinimalConn(),
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{
+					CipherSuite: tls.TLS_AES_128_GCM_SHA256,
+					Version:     tls.VersionTLS13,
+				}
+			},
+		}
+
+		record := roundTrip(t, hc, records)
+
+		value, found := findAttr(record, "httpTlsVersion")
+		require.True(t, found)
+		assert.Equal(t, "TLS 1.3", value.String())
+		value, found = findAttr(record, "httpTlsCipherSuite")
+		require.True(t, found)
+		assert.Equal(t, "TLS_AES_128_GCM_SHA256", value.String())
+	})
+
+	t.Run("plaintext connection", func(t *testing.T) {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "", newResponse)
+		hc.conn = newMinimalConn()
+
+		record := roundTrip(t, hc, records)
+
+		_, found := findAttr(record, "httpTlsVersion")
+		assert.False(t, found)
+		_, found = findAttr(record, "httpTlsCipherSuite")
+		assert.False(t, found)
+	})
+}
+
+// httpParseHSTS parses realistic and malformed Strict-Transport-Security values.
+func TestHTTPParseHSTS(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// value is the header value.
+		value string
+
+		// want is the expected policy.
+		want httpHSTSPolicy
+
+		// wantOK indicates whether we expect the value to be valid.
+		wantOK bool
+	}{
+		{
+			name:   "preload list submission",
+			value:  "max-age=63072000; includeSubDomains; preload",
+			want:   httpHSTSPolicy{maxAge: 63072000, includeSubDomains: true, preload: true},
+			wantOK: true,
+		},
+
+		{
+			name:   "max-age only",
+			value:  "max-age=31536000",
+			want:   httpHSTSPolicy{maxAge: 31536000},
+			wantOK: true,
+		},
+
+		{
+			name:   "quoted value, mixed case, and unknown directive",
+			value:  `INCLUDESUBDOMAINS ; Max-Age="0"; report-uri="https://example.com/r";`,
+			want:   httpHSTSPolicy{maxAge: 0, includeSubDomains: true},
+			wantOK: true,
+		},
+
+		{name: "empty", value: ""},
+		{name: "missing max-age", value: "includeSubDomains; preload"},
+		{name: "invalid max-age", value: "max-age=forever"},
+		{name: "negative max-age", value: "max-age=-1"},
+		{name: "signed max-age", value: "max-age=+1"},
+		{name: "repeated directive", value: "max-age=1; max-age=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := httpParseHSTS(tt.value)
+
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// RoundTrip logs the parsed HSTS policy when the response carries a valid header.
+func TestHTTPConnRoundTripLogsHSTS(t *testing.T) {
+	// roundTrip performs a round trip whose response carries the given
+	// headers and returns the httpRoundTripDone event.
+	roundTrip := func(t *testing.T, header http.Header) slog.Record {
+		logger, records := newCapturingLogger()
+		hc := newHTTP2TestConn(logger, "http/1.1", func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				ProtoMajor: 1,
+				Header:     header,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		})
+		req, err := http.NewRequest("GET", "https://example.com/", nil)
+		require.NoError(t, err)
+		resp, err := hc.RoundTrip(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		record, found := findRecord(*records, "httpRoundTripDone")
+		require.True(t, found)
+		return record
+	}
+
+	t.Run("valid header", func(t *testing.T) {
+		record := roundTrip(t, http.Header{
+			"Strict-Transport-Security": {"max-age=63072000; includeSubDomains; preload"},
+		})
+
+		value, found := findAttr(record, "httpHstsMaxAge")
+		require.True(t, found)
+		assert.Equal(t, int64(63072000), value.Int64())
+		value, found = findAttr(record, "httpHstsIncludeSubDomains")
+		require.True(t, found)
+		assert.True(t, value.Bool())
+		value, found = findAttr(record, "httpHstsPreload")
+		require.True(t, found)
+		assert.True(t, value.Bool())
+	})
+
+	for name, header := range map[string]http.Header{
+		"missing header": {},
+		"invalid header": {"Strict-Transport-Security": {"includeSubDomains"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			record := roundTrip(t, header)
+
+			_, found := findAttr(record, "httpHstsMaxAge")
+			assert.False(t, found)
+			_, found = findAttr(record, "httpHstsIncludeSubDomains")
+			assert.False(t, found)
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// NewIOTimelineFunc returns a new [*IOTimelineFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+func NewIOTimelineFunc(cfg *Config) *IOTimelineFunc {
+	return &IOTimelineFunc{
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// IOTimelineFunc wraps a [net.Conn] to record the timeline of its I/O.
+//
+// The returned [net.Conn] is an [*IOTimelineConn] recording an entry for each
+// Read and Write call. Use [*IOTimelineConn.Timeline] to obtain the entries.
+// Unlike [*ObserveConnFunc], this Func does not emit any event, to avoid
+// the overhead of the log handler, which is useful for offline analysis
+// of detailed latency traces (e.g., microbenchmarks).
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type IOTimelineFunc struct {
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewIOTimelineFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &IOTimelineFunc{}
+
+// Call wraps the given [net.Conn] into an [*IOTimelineConn].
+func (op *IOTimelineFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &IOTimelineConn{Conn: conn, timeNow: op.TimeNow}, nil
+}
+
+// IOTimelineEntry is an entry of the timeline recorded by [*IOTimelineConn].
+type IOTimelineEntry struct {
+	// Op is the operation, either "read" or "write".
+	Op string
+
+	// T is the time when the operation returned.
+	T time.Time
+
+	// Bytes is the number of bytes read or written.
+	Bytes int
+}
+
+// IOTimelineConn is the [net.Conn] returned by [*IOTimelineFunc].
+//
+// It is safe to use concurrently, like any [net.Conn].
+type IOTimelineConn struct {
+	net.Conn
+	entries []IOTimelineEntry
+	mu      sync.Mutex
+	timeNow func() time.Time
+}
+
+// Timeline returns a copy of the entries recorded so far, in order.
+func (c *IOTimelineConn) Timeline() []IOTimelineEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.entries)
+}
+
+// Read implements [net.Conn].
+func (c *IOTimelineConn) Read(buf []byte) (int, error) {
+	count, err := c.Conn.Read(buf)
+	c.record("read", count)
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (c *IOTimelineConn) Write(data []byte) (int, error) {
+	count, err := c.Conn.Write(data)
+	c.record("write", count)
+	return count, err
+}
+
+// record appends an entry to the timeline.
+func (c *IOTimelineConn) record(op string, count int) {
+	t := c.timeNow()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, IOTimelineEntry{Op: op, T: t, Bytes: count})
+}
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewIOTimelineFunc populates all fields from Config.
+func TestNewIOTimelineFunc(t *testing.T) {
+	fn := NewIOTimelineFunc(NewConfig())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// The wrapped conn records a timeline entry for each Read and Write.
+func TestIOTimelineFunc(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		clock.Advance(3 * time.Millisecond)
+		return 7, nil
+	}
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		clock.Advance(time.Millisecond)
+		return len(b), nil
+	}
+
+	fn := NewIOTimelineFunc(NewConfig().WithClock(clock))
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	timeline, ok := conn.(*IOTimelineConn)
+	require.True(t, ok)
+	assert.Empty(t, timeline.Timeline())
+
+	// Scripted sequence: a request, two reads, and a failing write
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	buf := make([]byte, 16)
+	_, _ = conn.Read(buf)
+	_, _ = conn.Read(buf)
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		clock.Advance(time.Millisecond)
+		return 0, errors.New("mocked write error")
+	}
+	_, err = conn.Write([]byte("x"))
+	require.Error(t, err)
+
+	assert.Equal(t, []IOTimelineEntry{
+		{Op: "write", T: t0.Add(1 * time.Millisecond), Bytes: 18},
+		{Op: "read", T: t0.Add(4 * time.Millisecond), Bytes: 7},
+		{Op: "read", T: t0.Add(7 * time.Millisecond), Bytes: 7},
+		{Op: "write", T: t0.Add(8 * time.Millisecond), Bytes: 0},
+	}, timeline.Timeline())
+}
+
+// Timeline returns a copy that is not affected by subsequent I/O.
+func TestIOTimelineConnTimelineCopy(t *testing.T) {
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) { return 1, nil }
+	conn, err := NewIOTimelineFunc(NewConfig()).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	timeline := conn.(*IOTimelineConn)
+
+	_, _ = conn.Read(make([]byte, 1))
+	snapshot := timeline.Timeline()
+	_, _ = conn.Read(make([]byte, 1))
+
+	assert.Len(t, snapshot, 1)
+	assert.Len(t, timeline.Timeline(), 2)
+}
@@ -0,0 +1,310 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidClientHello indicates that [ComputeJA4] cannot parse the ClientHello.
+var ErrInvalidClientHello = errors.New("nop: invalid ClientHello")
+
+// ComputeJA4 computes the JA4 fingerprint of the given ClientHello (see
+// https://github.com/FoxIO-LLC/ja4), e.g., "t13d1516h2_8daaf6152771_e5627efa2ab1".
+//
+// The clientHello argument contains the ClientHello handshake message, which
+// may be preceded by the TLS record header. Since this package speaks TLS over
+// TCP, the fingerprint always starts with "t".
+//
+// As mandated by the specification, we ignore GREASE values (RFC 8701), and
+// we exclude the SNI and ALPN extensions from the hashed extensions.
+//
+// This function returns [ErrInvalidClientHello] when parsing fails.
+func ComputeJA4(clientHello []byte) (string, error) {
+	hello, err := ja4ParseClientHello(clientHello)
+	if err != nil {
+		return "", err
+	}
+	return hello.fingerprint(), nil
+}
+
+// ja4ClientHello contains the ClientHello fields used by JA4.
+type ja4ClientHello struct {
+	// alpn is the first ALPN value or nil.
+	alpn []byte
+
+	// ciphers contains the cipher suites excluding GREASE values.
+	ciphers []uint16
+
+	// extensions contains the extension types excluding GREASE values.
+	extensions []uint16
+
+	// sigAlgs contains the signature algorithms in the original order.
+	sigAlgs []uint16
+
+	// sni indicates whether the SNI extension is present.
+	sni bool
+
+	// version is the highest supported version.
+	version uint16
+}
+
+// fingerprint returns the JA4 fingerprint.
+func (h *ja4ClientHello) fingerprint() string {
+	var extensions []uint16
+	for _, extension := range h.extensions {
+		if extension != ja4ExtensionSNI && extension != ja4ExtensionALPN {
+			extensions = append(extensions, extension)
+		}
+	}
+	slices.Sort(extensions)
+	ciphers := slices.Sorted(slices.Values(h.ciphers))
+
+	sni := "i"
+	if h.sni {
+		sni = "d"
+	}
+	extensionsInput := ja4HexList(extensions)
+	if len(h.sigAlgs) > 0 {
+		extensionsInput += "_" + ja4HexList(h.sigAlgs)
+	}
+	return fmt.Sprintf("t%s%s%02d%02d%s_%s_%s",
+		ja4VersionString(h.version), sni, min(len(h.ciphers), 99), min(len(h.extensions), 99),
+		ja4ALPNString(h.alpn), ja4Hash(len(ciphers), ja4HexList(ciphers)),
+		ja4Hash(len(extensions), extensionsInput))
+}
+
+// ja4HexList formats the values as comma-separated 4-digit lowercase hex.
+func ja4HexList(values []uint16) string {
+	parts := make([]string, 0, len(values))
+	for _, value := range values {
+		parts = append(parts, fmt.Sprintf("%04x", value))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ja4Hash returns the first 12 hex digits of the SHA-256 of input, or
+// zeros when the list from which we built input is empty.
+func ja4Hash(count int, input string) string {
+	if count <= 0 {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// ja4VersionString returns the JA4 representation of the TLS version.
+func ja4VersionString(version uint16) string {
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	default:
+		return "00"
+	}
+}
+
+// ja4ALPNString returns the first and last characters of the first ALPN
+// value, using the hex representation when they are not alphanumeric, or
+// "00" when there is no ALPN value.
+func ja4ALPNString(alpn []byte) string {
+	if len(alpn) <= 0 {
+		return "00"
+	}
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if !ja4IsAlnum(first) || !ja4IsAlnum(last) {
+		encoded := hex.EncodeToString(alpn)
+		return encoded[:1] + encoded[len(encoded)-1:]
+	}
+	return string([]byte{first, last})
+}
+
+// ja4IsAlnum returns whether the byte is an ASCII letter or digit.
+func ja4IsAlnum(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
+}
+
+// ja4IsGREASE returns whether the value is a GREASE value (RFC 8701).
+func ja4IsGREASE(value uint16) bool {
+	return value&0x0f0f == 0x0a0a && value>>8 == value&0xff
+}
+
+const (
+	// ja4ExtensionSNI is the server_name extension type.
+	ja4ExtensionSNI = 0x0000
+
+	// ja4ExtensionSigAlgs is the signature_algorithms extension type.
+	ja4ExtensionSigAlgs = 0x000d
+
+	// ja4ExtensionALPN is the application_layer_protocol_negotiation extension type.
+	ja4ExtensionALPN = 0x0010
+
+	// ja4ExtensionSupportedVersions is the supported_versions extension type.
+	ja4ExtensionSupportedVersions = 0x002b
+)
+
+// ja4ParseClientHello parses the ClientHello, optionally preceded by
+// the TLS record header, and returns the fields used by JA4.
+func ja4ParseClientHello(data []byte) (*ja4ClientHello, error) {
+	// 1. Skip the record header, if any, and the handshake header
+	r := &ja4Reader{data: data}
+	if len(data) > 0 && data[0] == 0x16 {
+		r.skip(5)
+	}
+	if r.u8() != 0x01 {
+		return nil, ErrInvalidClientHello
+	}
+	body := r.sub(r.u24())
+
+	// 2. Parse the fixed fields
+	hello := &ja4ClientHello{version: body.u16()}
+	body.skip(32)
+	body.sub(int(body.u8()))
+	ciphers := body.sub(int(body.u16()))
+	for !ciphers.empty() {
+		if cipher := ciphers.u16(); !ja4IsGREASE(cipher) {
+			hello.ciphers = append(hello.ciphers, cipher)
+		}
+	}
+	body.sub(int(body.u8()))
+
+	// 3. Parse the extensions, which may be missing
+	if !body.empty() {
+		extensions := body.sub(int(body.u16()))
+		for !extensions.empty() {
+			extension, content := extensions.u16(), extensions.sub(int(extensions.u16()))
+			if ja4IsGREASE(extension) {
+				continue
+			}
+			hello.extensions = append(hello.extensions, extension)
+			hello.parseExtension(extension, content)
+		}
+	}
+	if r.err != nil {
+		return nil, ErrInvalidClientHello
+	}
+	return hello, nil
+}
+
+// parseExtension parses the content of the given extension.
+//
+// Note: parsing errors are sticky and propagate to the reader from which
+// we obtained content, so the caller eventually notices them.
+func (h *ja4ClientHello) parseExtension(extension uint16, content *ja4Reader) {
+	switch extension {
+	case ja4ExtensionSNI:
+		h.sni = true
+
+	case ja4ExtensionALPN:
+		protocols := content.sub(int(content.u16()))
+		if !protocols.empty() {
+			h.alpn = protocols.bytes(int(protocols.u8()))
+		}
+
+	case ja4ExtensionSigAlgs:
+		algs := content.sub(int(content.u16()))
+		for !algs.empty() {
+			h.sigAlgs = append(h.sigAlgs, algs.u16())
+		}
+
+	case ja4ExtensionSupportedVersions:
+		versions := content.sub(int(content.u8()))
+		var highest uint16
+		for !versions.empty() {
+			if version := versions.u16(); !ja4IsGREASE(version) {
+				highest = max(highest, version)
+			}
+		}
+		if highest != 0 {
+			h.version = highest
+		}
+	}
+}
+
+// ja4Reader reads big-endian values from a byte slice.
+//
+// Errors are sticky: after the first error, the reader returns zero
+// values and sets the err field of its parent readers, if any.
+type ja4Reader struct {
+	data   []byte
+	err    error
+	parent *ja4Reader
+}
+
+// empty returns whether there is nothing left to read or reading failed.
+func (r *ja4Reader) empty() bool {
+	return r.err != nil || len(r.data) <= 0
+}
+
+// bytes reads count bytes.
+func (r *ja4Reader) bytes(count int) []byte {
+	if r.err != nil || count > len(r.data) {
+		r.fail()
+		return nil
+	}
+	out := r.data[:count]
+	r.data = r.data[count:]
+	return out
+}
+
+// fail records the parsing error in this reader and in its parents.
+func (r *ja4Reader) fail() {
+	for cur := r; cur != nil; cur = cur.parent {
+		cur.err = ErrInvalidClientHello
+	}
+}
+
+// skip skips count bytes.
+func (r *ja4Reader) skip(count int) {
+	r.bytes(count)
+}
+
+// sub reads count bytes and returns a reader for them.
+func (r *ja4Reader) sub(count int) *ja4Reader {
+	return &ja4Reader{data: r.bytes(count), err: r.err, parent: r}
+}
+
+// u8 reads an 8-bit value.
+func (r *ja4Reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// u16 reads a 16-bit value.
+func (r *ja4Reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// u24 reads a 24-bit value.
+func (r *ja4Reader) u24() int {
+	if b := r.bytes(3); b != nil {
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	}
+	return 0
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ja4TestExtension is an extension of a [ja4TestHello].
+type ja4TestExtension struct {
+	// kind is the extension type.
+	kind uint16
+
+	// data is the extension content.
+	data []byte
+}
+
+// ja4TestHello describes a ClientHello to serialize.
+type ja4TestHello struct {
+	// version is the legacy_version field.
+	version uint16
+
+	// ciphers contains the cipher suites.
+	ciphers []uint16
+
+	// extensions contains the extensions or nil to omit them.
+	extensions []ja4TestExtension
+}
+
+// ja4AppendU16 appends a big-endian 16-bit value.
+func ja4AppendU16(out []byte, value uint16) []byte {
+	return append(out, byte(value>>8), byte(value))
+}
+
+// ja4AppendU16List appends a list of 16-bit values preceded by its
+// length in bytes, using a lengthSize-byte length field.
+func ja4AppendU16List(out []byte, lengthSize int, values ...uint16) []byte {
+	if lengthSize == 1 {
+		out = append(out, byte(2*len(values)))
+	} else {
+		out = ja4AppendU16(out, uint16(2*len(values)))
+	}
+	for _, value := range values {
+		out = ja4AppendU16(out, value)
+	}
+	return out
+}
+
+// handshake returns the serialized ClientHello handshake message.
+func (h *ja4TestHello) handshake() []byte {
+	body := ja4AppendU16(nil, h.version)
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // empty session ID
+	body = ja4AppendU16List(body, 2, h.ciphers...)
+	body = append(body, 1, 0) // null compression
+	if h.extensions != nil {
+		var extensions []byte
+		for _, extension := range h.extensions {
+			extensions = ja4AppendU16(extensions, extension.kind)
+			extensions = ja4AppendU16(extensions, uint16(len(extension.data)))
+			extensions = append(extensions, extension.data...)
+		}
+		body = ja4AppendU16(body, uint16(len(extensions)))
+		body = append(body, extensions...)
+	}
+	return append([]byte{0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// record returns the ClientHello preceded by the TLS record header.
+func (h *ja4TestHello) record() []byte {
+	handshake := h.handshake()
+	return append([]byte{0x16, 0x03, 0x01, byte(len(handshake) >> 8), byte(len(handshake))}, handshake...)
+}
+
+// ja4SNIExtension returns the server_name extension for the given name.
+func ja4SNIExtension(name string) ja4TestExtension {
+	entry := append([]byte{0x00}, ja4AppendU16(nil, uint16(len(name)))...)
+	entry = append(entry, name...)
+	return ja4TestExtension{kind: 0x0000, data: append(ja4AppendU16(nil, uint16(len(entry))), entry...)}
+}
+
+// ja4ALPNExtension returns the ALPN extension for the given protocols.
+func ja4ALPNExtension(protocols ...string) ja4TestExtension {
+	var list []byte
+	for _, protocol := range protocols {
+		list = append(list, byte(len(protocol)))
+		list = append(list, protocol...)
+	}
+	return ja4TestExtension{kind: 0x0010, data: append(ja4AppendU16(nil, uint16(len(list))), list...)}
+}
+
+// newJA4ChromeHello returns a Chrome-like ClientHello including GREASE values
+// matching the example in the JA4 specification, whose fingerprint is
+// "t13d1516h2_8daaf6152771_e5627efa2ab1".
+func newJA4ChromeHello() *ja4TestHello {
+	return &ja4TestHello{
+		version: 0x0303,
+		ciphers: []uint16{
+			0x4a4a, // GREASE
+			0x1301, 0x1302, 0x1303, 0xc02b, 0xc02f, 0xc02c, 0xc030, 0xcca9,
+			0xcca8, 0xc013, 0xc014, 0x009c, 0x009d, 0x002f, 0x0035,
+		},
+		extensions: []ja4TestExtension{
+			{kind: 0x1a1a}, // GREASE
+			{kind: 0x0033, data: []byte{0x00, 0x00}},
+			{kind: 0x0023},
+			ja4ALPNExtension("h2", "http/1.1"),
+			{kind: 0x4469, data: []byte{0x00, 0x03, 0x02, 'h', '2'}},
+			{kind: 0x000d, data: ja4AppendU16List(nil, 2,
+				0x0403, 0x0804, 0x0401, 0x0503, 0x0805, 0x0501, 0x0806, 0x0601)},
+			{kind: 0x0017},
+			{kind: 0x0012},
+			{kind: 0x002b, data: ja4AppendU16List(nil, 1, 0x3a3a, 0x0304, 0x0303)},
+			ja4SNIExtension("example.com"),
+			{kind: 0x000b, data: []byte{0x01, 0x00}},
+			{kind: 0x0005, data: []byte{0x01, 0x00, 0x00, 0x00, 0x00}},
+			{kind: 0x001b, data: []byte{0x02, 0x00, 0x02}},
+			{kind: 0x000a, data: ja4AppendU16List(nil, 2, 0x2a2a, 0x001d, 0x0017)},
+			{kind: 0xff01, data: []byte{0x00}},
+			{kind: 0x002d, data: []byte{0x01, 0x01}},
+			{kind: 0x0015, data: make([]byte, 16)},
+			{kind: 0x2a2a, data: []byte{0x00}}, // GREASE
+		},
+	}
+}
+
+// ComputeJA4 computes the expected fingerprint of known ClientHellos.
+func TestComputeJA4(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// clientHello is the serialized ClientHello.
+		clientHello []byte
+
+		// want is the expected fingerprint.
+		want string
+	}{
+		{
+			name:        "specification example",
+			clientHello: newJA4ChromeHello().handshake(),
+			want:        "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+
+		{
+			name:        "specification example with record header",
+			clientHello: newJA4ChromeHello().record(),
+			want:        "t13d1516h2_8daaf6152771_e5627efa2ab1",
+		},
+
+		{
+			// Without supported_versions, SNI, and ALPN. The ciphers hash covers
+			// "009c,c02f" and the extensions hash covers "000a,000d_0401".
+			name: "TLS 1.2 without SNI and ALPN",
+			clientHello: (&ja4TestHello{
+				version: 0x0303,
+				ciphers: []uint16{0xc02f, 0x009c},
+				extensions: []ja4TestExtension{
+					{kind: 0x000d, data: ja4AppendU16List(nil, 2, 0x0401)},
+					{kind: 0x000a, data: ja4AppendU16List(nil, 2, 0x0017)},
+				},
+			}).handshake(),
+			want: "t12i020200_08dfa304a768_4f3e98f48336",
+		},
+
+		{
+			// The ciphers hash covers "002f".
+			name: "without extensions",
+			clientHello: (&ja4TestHello{
+				version: 0x0301,
+				ciphers: []uint16{0x002f},
+			}).handshake(),
+			want: "t10i010000_ba72b8082249_000000000000",
+		},
+
+		{
+			name: "non-alphanumeric ALPN",
+			clientHello: (&ja4TestHello{
+				version:    0x0303,
+				extensions: []ja4TestExtension{ja4ALPNExtension("\xab\xcd")},
+			}).handshake(),
+			want: "t12i0001ad_000000000000_000000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeJA4(tt.clientHello)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// ComputeJA4 returns ErrInvalidClientHello for malformed input.
+func TestComputeJA4Invalid(t *testing.T) {
+	valid := newJA4ChromeHello().handshake()
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// clientHello is the malformed ClientHello.
+		clientHello []byte
+	}{
+		{name: "empty", clientHello: nil},
+		{name: "not a ClientHello", clientHello: append([]byte{0x02}, valid[1:]...)},
+		{name: "truncated handshake", clientHello: valid[:len(valid)-1]},
+		{name: "truncated record header", clientHello: []byte{0x16, 0x03}},
+		{name: "truncated fixed fields", clientHello: []byte{0x01, 0x00, 0x00, 0x02, 0x03, 0x03}},
+		{
+			name: "truncated extension content",
+			clientHello: (&ja4TestHello{
+				version: 0x0303,
+				extensions: []ja4TestExtension{
+					{kind: 0x000d, data: []byte{0x00, 0x04, 0x04, 0x01}},
+				},
+			}).handshake(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeJA4(tt.clientHello)
+
+			require.ErrorIs(t, err, ErrInvalidClientHello)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+// ComputeJA4 parses the ClientHello sent by the standard library.
+func TestComputeJA4Stdlib(t *testing.T) {
+	var clientHello []byte
+	conn := newMinimalConn()
+	conn.WriteFunc = func(b []byte) (int, error) {
+		if clientHello == nil {
+			clientHello = append([]byte{}, b...)
+		}
+		return 0, errors.New("mocked write error")
+	}
+	conn.CloseFunc = func() error { return nil }
+	tconn := tls.Client(conn, &tls.Config{ServerName: "example.com", NextProtos: []string{"h2"}})
+	require.Error(t, tconn.HandshakeContext(context.Background()))
+
+	got, err := ComputeJA4(clientHello)
+
+	require.NoError(t, err)
+	assert.Regexp(t, `^t13d\d{4}h2_[0-9a-f]{12}_[0-9a-f]{12}$`, got)
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/safeconn"
+)
+
+// NewJitterFunc returns a new [*JitterFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The min and max arguments are the bounds of the random delay.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+//
+// This function panics if min is negative or max is less than min.
+func NewJitterFunc(cfg *Config, min, max time.Duration, logger SLogger) *JitterFunc {
+	runtimex.Assert(min >= 0 && max >= min)
+	return &JitterFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		Max:           max,
+		Min:           min,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// JitterFunc delays a [net.Conn] by a random duration before passing it through.
+//
+// Call waits for a duration drawn uniformly from the [Min, Max] range and
+// emits a jitter event whose jitterMs field contains the drawn duration in
+// milliseconds. Placing this Func between the stages of a pipeline (e.g., after
+// [ConnectFunc] and after [TLSHandshakeFunc]) injects artificial latency,
+// which, combined with short timeouts, stress-tests timeout handling in CI.
+//
+// When the context is done before the delay elapses, Call closes the
+// connection and returns the context error.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type JitterFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewJitterFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewJitterFunc] to the user-provided logger.
+	Logger SLogger
+
+	// Max is the maximum delay.
+	//
+	// Set by [NewJitterFunc] to the user-provided value.
+	Max time.Duration
+
+	// Min is the minimum delay.
+	//
+	// Set by [NewJitterFunc] to the user-provided value.
+	Min time.Duration
+
+	// Rand is the optional source of randomness. Set it to a seeded [*rand.Rand]
+	// (e.g., using [rand.NewPCG]) to make the sequence of delays deterministic.
+	// When nil, we use the global source provided by [math/rand/v2].
+	//
+	// Set by [NewJitterFunc] to nil.
+	Rand *rand.Rand
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewJitterFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+
+	// mu serializes access to Rand, which is not safe for concurrent use.
+	mu sync.Mutex
+}
+
+var _ Func[net.Conn, net.Conn] = &JitterFunc{}
+
+// Call waits for a random delay and returns the [net.Conn] unchanged.
+func (op *JitterFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	t0 := op.TimeNow()
+	delay := op.delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	op.Logger.Info(
+		"jitter",
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.Int64("jitterMs", delay.Milliseconds()),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t0", t0),
+		slog.Time("t", op.TimeNow()),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// delay draws a random delay in the [Min, Max] range.
+func (op *JitterFunc) delay() time.Duration {
+	span := int64(op.Max-op.Min) + 1
+	if op.Rand == nil {
+		return op.Min + time.Duration(rand.Int64N(span))
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return op.Min + time.Duration(op.Rand.Int64N(span))
+}
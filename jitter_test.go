@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewJitterFunc populates all fields from Config, the provided values, and logger.
+func TestNewJitterFunc(t *testing.T) {
+	fn := NewJitterFunc(NewConfig(), time.Millisecond, 5*time.Millisecond, DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.Equal(t, 5*time.Millisecond, fn.Max)
+	assert.Equal(t, time.Millisecond, fn.Min)
+	assert.Nil(t, fn.Rand)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// NewJitterFunc panics when the range is invalid.
+func TestNewJitterFuncInvalidRange(t *testing.T) {
+	assert.Panics(t, func() { NewJitterFunc(NewConfig(), -time.Millisecond, 0, DefaultSLogger()) })
+	assert.Panics(t, func() { NewJitterFunc(NewConfig(), 2*time.Millisecond, time.Millisecond, DefaultSLogger()) })
+}
+
+// Call waits for a deterministic delay within the range when using a seeded source.
+func TestJitterFuncSeeded(t *testing.T) {
+	const (
+		min = 1 * time.Millisecond
+		max = 8 * time.Millisecond
+	)
+
+	// runJitter calls a JitterFunc using the given seed a few times and
+	// returns the logged jitterMs values.
+	runJitter := func(seed uint64) []int64 {
+		logger, records := newCapturingLogger()
+		fn := NewJitterFunc(NewConfig(), min, max, logger)
+		fn.Rand = rand.New(rand.NewPCG(seed, seed))
+		mockConn := newMinimalConn()
+		for range 8 {
+			t0 := time.Now()
+			conn, err := fn.Call(context.Background(), mockConn)
+			require.NoError(t, err)
+			assert.Same(t, mockConn, conn)
+			assert.True(t, time.Since(t0) >= min)
+		}
+		var values []int64
+		for _, record := range *records {
+			require.Equal(t, "jitter", record.Message)
+			value, found := findAttr(record, "jitterMs")
+			require.True(t, found)
+			assert.True(t, value.Int64() >= min.Milliseconds() && value.Int64() <= max.Milliseconds())
+			values = append(values, value.Int64())
+		}
+		return values
+	}
+
+	first, second := runJitter(4), runJitter(4)
+	require.Len(t, first, 8)
+	assert.Equal(t, first, second)
+
+	// compute the expected values using the same seed
+	expect := rand.New(rand.NewPCG(4, 4))
+	var want []int64
+	for range 8 {
+		want = append(want, (min + time.Duration(expect.Int64N(int64(max-min)+1))).Milliseconds())
+	}
+	assert.Equal(t, want, first)
+}
+
+// Call closes the connection and returns the error when the context is done.
+func TestJitterFuncContextDone(t *testing.T) {
+	var closed bool
+	mockConn := newMinimalConn()
+	mockConn.CloseFunc = func() error {
+		closed = true
+		return nil
+	}
+	logger, records := newCapturingLogger()
+	fn := NewJitterFunc(NewConfig(), time.Hour, time.Hour, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn, err := fn.Call(ctx, mockConn)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, conn)
+	assert.True(t, closed)
+	require.Len(t, *records, 1)
+	value, found := findAttr((*records)[0], "jitterMs")
+	require.True(t, found)
+	assert.Equal(t, time.Hour.Milliseconds(), value.Int64())
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// LatencyAccumulator collects durations (e.g., of the connect phase) across
+// a batch of measurements and computes their percentiles on demand, which is
+// useful to build batch summaries without an external aggregator.
+//
+// Feed durations using [*LatencyObserveFunc] or [*LatencyAccumulator.Add].
+//
+// An accumulator is safe for concurrent use.
+//
+// Construct using [NewLatencyAccumulator].
+type LatencyAccumulator struct {
+	durations []time.Duration
+	mu        sync.Mutex
+}
+
+// NewLatencyAccumulator returns a new empty [*LatencyAccumulator].
+func NewLatencyAccumulator() *LatencyAccumulator {
+	return &LatencyAccumulator{}
+}
+
+// Add adds the given duration to the accumulator.
+func (a *LatencyAccumulator) Add(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.durations = append(a.durations, d)
+}
+
+// Count returns the number of durations added so far.
+func (a *LatencyAccumulator) Count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.durations)
+}
+
+// Percentile returns the p-th percentile of the durations added so far using
+// the nearest-rank method, such that the result is always one of the added
+// durations, or zero when no duration has been added.
+//
+// This method panics if p is not in the (0, 100] interval.
+func (a *LatencyAccumulator) Percentile(p float64) time.Duration {
+	runtimex.Assert(p > 0 && p <= 100)
+	a.mu.Lock()
+	sorted := slices.Sorted(slices.Values(a.durations))
+	a.mu.Unlock()
+	if len(sorted) <= 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[rank-1]
+}
+
+// Log emits a latencyPercentiles event containing the number of durations
+// (latencyCount) and their 50th, 90th, and 99th percentiles in milliseconds
+// (latencyP50Ms, latencyP90Ms, and latencyP99Ms).
+//
+// The t argument is the time to log, typically obtained from [Config.TimeNow].
+func (a *LatencyAccumulator) Log(logger SLogger, t time.Time) {
+	logger.Info(
+		"latencyPercentiles",
+		slog.Int("latencyCount", a.Count()),
+		slog.Int64("latencyP50Ms", a.Percentile(50).Milliseconds()),
+		slog.Int64("latencyP90Ms", a.Percentile(90).Milliseconds()),
+		slog.Int64("latencyP99Ms", a.Percentile(99).Milliseconds()),
+		slog.Time("t", t),
+	)
+}
+
+// NewLatencyObserveFunc returns a new [*LatencyObserveFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The acc argument is the accumulator to feed. Share the same accumulator
+// among all the pipelines of the batch.
+//
+// The fn argument is the [Func] to observe (e.g., a [*ConnectFunc]).
+//
+// This function panics if acc or fn is nil.
+func NewLatencyObserveFunc[A, B any](cfg *Config,
+	acc *LatencyAccumulator, fn Func[A, B]) *LatencyObserveFunc[A, B] {
+	runtimex.Assert(acc != nil && fn != nil)
+	return &LatencyObserveFunc[A, B]{
+		Accumulator: acc,
+		TimeNow:     cfg.TimeNow,
+		Wrapped:     fn,
+	}
+}
+
+// LatencyObserveFunc wraps a [Func] and feeds the duration of each successful
+// call into a [*LatencyAccumulator].
+//
+// Wrap a [*ConnectFunc] to accumulate the connect durations, which match
+// the difference between the t and t0 fields of the connectDone events, and
+// use [*LatencyAccumulator.Log] to log their percentiles after the batch.
+// Failed calls are not accumulated, since their duration depends on the
+// failure (e.g., a timeout) rather than on the path latency.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type LatencyObserveFunc[A, B any] struct {
+	// Accumulator is the accumulator to feed.
+	//
+	// Set by [NewLatencyObserveFunc] to the user-provided accumulator.
+	Accumulator *LatencyAccumulator
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewLatencyObserveFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+
+	// Wrapped is the observed [Func].
+	//
+	// Set by [NewLatencyObserveFunc] to the user-provided Func.
+	Wrapped Func[A, B]
+}
+
+// Call invokes the wrapped [Func] and accumulates its duration on success.
+func (op *LatencyObserveFunc[A, B]) Call(ctx context.Context, input A) (B, error) {
+	t0 := op.TimeNow()
+	output, err := op.Wrapped.Call(ctx, input)
+	if err == nil {
+		op.Accumulator.Add(op.TimeNow().Sub(t0))
+	}
+	return output, err
+}
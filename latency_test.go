@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// LatencyAccumulator computes percentiles using the nearest-rank method.
+func TestLatencyAccumulatorPercentile(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		acc := NewLatencyAccumulator()
+
+		assert.Equal(t, 0, acc.Count())
+		assert.Equal(t, time.Duration(0), acc.Percentile(50))
+	})
+
+	t.Run("one hundred durations added out of order", func(t *testing.T) {
+		acc := NewLatencyAccumulator()
+		for ms := 100; ms >= 1; ms-- {
+			acc.Add(time.Duration(ms) * time.Millisecond)
+		}
+
+		assert.Equal(t, 100, acc.Count())
+		assert.Equal(t, 50*time.Millisecond, acc.Percentile(50))
+		assert.Equal(t, 90*time.Millisecond, acc.Percentile(90))
+		assert.Equal(t, 99*time.Millisecond, acc.Percentile(99))
+		assert.Equal(t, 100*time.Millisecond, acc.Percentile(100))
+	})
+
+	t.Run("few durations", func(t *testing.T) {
+		acc := NewLatencyAccumulator()
+		for _, d := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond} {
+			acc.Add(d)
+		}
+
+		assert.Equal(t, 20*time.Millisecond, acc.Percentile(50))
+		assert.Equal(t, 30*time.Millisecond, acc.Percentile(90))
+		assert.Equal(t, 30*time.Millisecond, acc.Percentile(99))
+	})
+
+	t.Run("invalid percentile", func(t *testing.T) {
+		acc := NewLatencyAccumulator()
+
+		assert.Panics(t, func() { acc.Percentile(0) })
+		assert.Panics(t, func() { acc.Percentile(101) })
+	})
+}
+
+// LatencyAccumulator is safe for concurrent use.
+func TestLatencyAccumulatorConcurrentAdd(t *testing.T) {
+	acc := NewLatencyAccumulator()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			for range 100 {
+				acc.Add(time.Millisecond)
+			}
+		})
+	}
+	wg.Wait()
+
+	assert.Equal(t, 800, acc.Count())
+}
+
+// Log emits the count and the percentiles.
+func TestLatencyAccumulatorLog(t *testing.T) {
+	acc := NewLatencyAccumulator()
+	for ms := 1; ms <= 100; ms++ {
+		acc.Add(time.Duration(ms) * time.Millisecond)
+	}
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger, records := newCapturingLogger()
+
+	acc.Log(logger, t0)
+
+	require.Len(t, *records, 1)
+	assert.Equal(t, "latencyPercentiles", (*records)[0].Message)
+	for key, want := range map[string]int64{
+		"latencyP50Ms": 50,
+		"latencyP90Ms": 90,
+		"latencyP99Ms": 99,
+	} {
+		value, found := findAttr((*records)[0], key)
+		require.True(t, found, key)
+		assert.Equal(t, slog.KindInt64, value.Kind(), key)
+		assert.Equal(t, want, value.Int64(), key)
+	}
+	value, found := findAttr((*records)[0], "latencyCount")
+	require.True(t, found)
+	assert.Equal(t, int64(100), value.Int64())
+	value, found = findAttr((*records)[0], "t")
+	require.True(t, found)
+	assert.Equal(t, t0, value.Time())
+}
+
+// NewLatencyObserveFunc populates all fields and rejects nil arguments.
+func TestNewLatencyObserveFunc(t *testing.T) {
+	acc := NewLatencyAccumulator()
+	wrapped := ConstFunc(1)
+
+	fn := NewLatencyObserveFunc(NewConfig(), acc, wrapped)
+
+	require.NotNil(t, fn)
+	assert.Same(t, acc, fn.Accumulator)
+	assert.NotNil(t, fn.TimeNow)
+	assert.Equal(t, wrapped, fn.Wrapped)
+	assert.Panics(t, func() { NewLatencyObserveFunc(NewConfig(), nil, wrapped) })
+	assert.Panics(t, func() { NewLatencyObserveFunc[Unit, int](NewConfig(), acc, nil) })
+}
+
+// LatencyObserveFunc accumulates the duration of successful calls only.
+func TestLatencyObserveFunc(t *testing.T) {
+	clock := NewFakeClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	cfg := NewConfig().WithClock(clock)
+	acc := NewLatencyAccumulator()
+	wantErr := errors.New("mocked error")
+	fn := NewLatencyObserveFunc(cfg, acc, FuncAdapter[time.Duration, int](
+		func(ctx context.Context, d time.Duration) (int, error) {
+			clock.Advance(d)
+			if d > time.Second {
+				return 0, wantErr
+			}
+			return 42, nil
+		}))
+
+	for _, d := range []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond} {
+		output, err := fn.Call(context.Background(), d)
+		require.NoError(t, err)
+		assert.Equal(t, 42, output)
+	}
+	_, err := fn.Call(context.Background(), 5*time.Second)
+	require.ErrorIs(t, err, wantErr)
+
+	assert.Equal(t, 3, acc.Count())
+	assert.Equal(t, 20*time.Millisecond, acc.Percentile(50))
+	assert.Equal(t, 30*time.Millisecond, acc.Percentile(99))
+}
@@ -12,6 +12,7 @@ import (
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bassosimone/safeconn"
@@ -37,6 +38,15 @@ func NewObserveConnFunc(cfg *Config, logger SLogger) *ObserveConnFunc {
 // enforcement, use [CancelWatchFunc] to close the connection when the context
 // is done, which causes any in-progress I/O to fail immediately.
 //
+// As a soft warning about teardown correctness, the closeDone event includes
+// closeAfterWriteNoRead=true when the connection is closed after a successful
+// Write without any subsequent Read returning data. Closing a TCP connection
+// with unread or unacknowledged data may cause the kernel to send a RST instead
+// of a FIN. The field is omitted otherwise. An empty Read does not count as a
+// Read, while a Read failing with an error is not evidence either way (e.g.,
+// when the peer aborts a TLS handshake), so the field is also omitted when the
+// last Read after the last Write failed.
+//
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type ObserveConnFunc struct {
@@ -63,10 +73,10 @@ func (op *ObserveConnFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, e
 	observed := &observedConn{
 		closeonce: sync.Once{},
 		conn:      conn,
-		laddr:     safeconn.LocalAddr(conn),
+		laddr:     connLocalAddr(conn),
 		op:        op,
 		protocol:  safeconn.Network(conn),
-		raddr:     safeconn.RemoteAddr(conn),
+		raddr:     connRemoteAddr(conn),
 	}
 	return observed, nil
 }
@@ -79,6 +89,10 @@ type observedConn struct {
 	op        *ObserveConnFunc
 	protocol  string
 	raddr     string
+
+	// writeNoRead is true after a successful Write not followed by a Read
+	// returning data or failing with an error.
+	writeNoRead atomic.Bool
 }
 
 // Close implements [net.Conn].
@@ -99,8 +113,7 @@ func (c *observedConn) Close() (err error) {
 
 		err = c.conn.Close()
 
-		c.op.Logger.Info(
-			"closeDone",
+		attrs := []any{
 			slog.Any("err", err),
 			slog.String("errClass", c.op.ErrClassifier.Classify(err)),
 			slog.String("localAddr", c.laddr),
@@ -108,7 +121,11 @@ func (c *observedConn) Close() (err error) {
 			slog.String("remoteAddr", c.raddr),
 			slog.Time("t0", t0),
 			slog.Time("t", c.op.TimeNow()),
-		)
+		}
+		if c.writeNoRead.Load() {
+			attrs = append(attrs, slog.Bool("closeAfterWriteNoRead", true))
+		}
+		c.op.Logger.Info("closeDone", attrs...)
 	})
 	return
 }
@@ -131,6 +148,9 @@ func (c *observedConn) Read(buf []byte) (int, error) {
 	)
 
 	count, err := c.conn.Read(buf)
+	if count > 0 || err != nil {
+		c.writeNoRead.Store(false)
+	}
 
 	c.op.Logger.Debug(
 		"readDone",
@@ -204,6 +224,9 @@ func (c *observedConn) Write(data []byte) (n int, err error) {
 	)
 
 	count, err := c.conn.Write(data)
+	if count > 0 {
+		c.writeNoRead.Store(true)
+	}
 
 	c.op.Logger.Debug(
 		"writeDone",
@@ -259,6 +259,64 @@ func TestObservedConnCloseLogging(t *testing.T) {
 	assert.Equal(t, "closeDone", (*records)[1].Message)
 }
 
+// Close flags closing after a Write without an intervening Read.
+func TestObservedConnCloseAfterWriteNoRead(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// ops contains the I/O operations to perform before closing.
+		ops []string
+
+		// want indicates whether we expect closeAfterWriteNoRead.
+		want bool
+	}{
+		{name: "write then close", ops: []string{"write"}, want: true},
+		{name: "read then write then close", ops: []string{"read", "write"}, want: true},
+		{name: "write then read then close", ops: []string{"write", "read"}, want: false},
+		{name: "read then close", ops: []string{"read"}, want: false},
+		{name: "close without I/O", ops: nil, want: false},
+		{name: "write then empty read then close", ops: []string{"write", "emptyRead"}, want: true},
+		{name: "write then failed read then close", ops: []string{"write", "failedRead"}, want: false},
+		{name: "failed read then write then close", ops: []string{"failedRead", "write"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			mockConn := newMinimalConn()
+			mockConn.CloseFunc = func() error { return nil }
+			mockConn.ReadFunc = func(b []byte) (int, error) { return len(b), nil }
+			mockConn.WriteFunc = func(b []byte) (int, error) { return len(b), nil }
+
+			observed, _ := NewObserveConnFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+			for _, op := range tt.ops {
+				switch op {
+				case "read":
+					_, _ = observed.Read(make([]byte, 4))
+				case "emptyRead":
+					mockConn.ReadFunc = func(b []byte) (int, error) { return 0, nil }
+					_, _ = observed.Read(make([]byte, 4))
+				case "failedRead":
+					mockConn.ReadFunc = func(b []byte) (int, error) { return 0, errors.New("connection reset by peer") }
+					_, _ = observed.Read(make([]byte, 4))
+				case "write":
+					_, _ = observed.Write([]byte("abcd"))
+				}
+			}
+			require.NoError(t, observed.Close())
+
+			done := (*records)[len(*records)-1]
+			require.Equal(t, "closeDone", done.Message)
+			value, found := findAttr(done, "closeAfterWriteNoRead")
+			require.Equal(t, tt.want, found)
+			if found {
+				assert.True(t, value.Bool())
+			}
+		})
+	}
+}
+
 // Read emits readStart/readDone log events.
 func TestObservedConnReadLogging(t *testing.T) {
 	cfg := NewConfig()
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// ErrInvalidPipelineSpec indicates that [BuildPipeline] cannot build
+// a pipeline from the given [PipelineSpec].
+var ErrInvalidPipelineSpec = errors.New("nop: invalid pipeline spec")
+
+// PipelineSpec declaratively describes a pipeline for [BuildPipeline].
+//
+// The pipeline starts from [PipelineSpec.Endpoint] and then runs each
+// stage in order, feeding the output of a stage to the next one.
+type PipelineSpec struct {
+	// Endpoint is the endpoint given as input to the first stage.
+	Endpoint netip.AddrPort
+
+	// Stages contains the stages to run in order.
+	Stages []PipelineStage
+}
+
+// PipelineStage describes a single stage of a [PipelineSpec].
+//
+// The supported stages and their parameters are:
+//
+//   - "connect": [ConnectFunc]; requires "network" ("tcp" or "udp").
+//   - "observe": [ObserveConnFunc]; no parameters.
+//   - "cancelWatch": [CancelWatchFunc]; no parameters.
+//   - "tlsHandshake": [TLSHandshakeFunc]; requires "serverName" and accepts
+//     "alpn" as a comma-separated list of protocols (e.g., "h2,http/1.1").
+//   - "httpConn": [HTTPConnFunc] for either a [net.Conn] or a [TLSConn].
+//   - "dohWrap": [DNSOverHTTPSConnFunc]; requires "url".
+type PipelineStage struct {
+	// Name is the name of the stage (e.g., "connect").
+	Name string
+
+	// Params contains the stage parameters.
+	Params map[string]string
+}
+
+// pipelineStageBuilder builds an erased [Func] for a stage given its input type.
+type pipelineStageBuilder func(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error)
+
+// pipelineStageInfo describes how to build a stage.
+type pipelineStageInfo struct {
+	params []string
+	build  pipelineStageBuilder
+}
+
+var (
+	pipelineAddrPortType  = reflect.TypeFor[netip.AddrPort]()
+	pipelineNetConnType   = reflect.TypeFor[net.Conn]()
+	pipelineTLSConnType   = reflect.TypeFor[TLSConn]()
+	pipelineHTTPConnType  = reflect.TypeFor[*HTTPConn]()
+	pipelineDoHConnType   = reflect.TypeFor[*DNSOverHTTPSConn]()
+	pipelineStageRegistry = map[string]pipelineStageInfo{
+		"connect":      {[]string{"network"}, pipelineBuildConnect},
+		"observe":      {nil, pipelineBuildObserve},
+		"cancelWatch":  {nil, pipelineBuildCancelWatch},
+		"tlsHandshake": {[]string{"alpn", "serverName"}, pipelineBuildTLSHandshake},
+		"httpConn":     {nil, pipelineBuildHTTPConn},
+		"dohWrap":      {[]string{"url"}, pipelineBuildDoHWrap},
+	}
+)
+
+// BuildPipeline builds a [Func] from the given [PipelineSpec].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+//
+// This function validates the spec before building the pipeline and returns
+// an error wrapping [ErrInvalidPipelineSpec] describing the first problem, such
+// as an unknown stage, an unknown or missing parameter, or a stage whose input
+// type does not match the output type of the previous stage.
+//
+// The returned [Func] yields the output of the last stage (e.g., a [net.Conn]
+// or a [*DNSOverHTTPSConn]), which the caller should type-assert. Prefer
+// [Compose2] and friends when the pipeline is known at compile time, since
+// the compiler then verifies the type compatibility of the stages.
+func BuildPipeline(spec PipelineSpec, cfg *Config, logger SLogger) (Func[Unit, any], error) {
+	if len(spec.Stages) <= 0 {
+		return nil, fmt.Errorf("%w: no stages", ErrInvalidPipelineSpec)
+	}
+	var pipeline Func[Unit, any] = pipelineErase(NewEndpointFunc(spec.Endpoint))
+	input := pipelineAddrPortType
+	for idx, stage := range spec.Stages {
+		info, found := pipelineStageRegistry[stage.Name]
+		if !found {
+			return nil, fmt.Errorf("%w: stage %d: unknown stage %q", ErrInvalidPipelineSpec, idx, stage.Name)
+		}
+		for name := range stage.Params {
+			if !slices.Contains(info.params, name) {
+				return nil, fmt.Errorf("%w: stage %d (%s): unknown parameter %q",
+					ErrInvalidPipelineSpec, idx, stage.Name, name)
+			}
+		}
+		fn, output, err := info.build(stage, input, cfg, logger)
+		if err != nil {
+			return nil, fmt.Errorf("%w: stage %d (%s): %s", ErrInvalidPipelineSpec, idx, stage.Name, err.Error())
+		}
+		pipeline = Compose2(pipeline, fn)
+		input = output
+	}
+	return pipeline, nil
+}
+
+// pipelineErase converts a [Func] into a [Func] operating on any values.
+//
+// The caller must ensure that the input is of type A.
+func pipelineErase[A, B any](fn Func[A, B]) Func[A, any] {
+	return FuncAdapter[A, any](func(ctx context.Context, input A) (any, error) {
+		return fn.Call(ctx, input)
+	})
+}
+
+// pipelineEraseInput is like [pipelineErase] but also erases the input type.
+func pipelineEraseInput[A, B any](fn Func[A, B]) Func[any, any] {
+	return FuncAdapter[any, any](func(ctx context.Context, input any) (any, error) {
+		return fn.Call(ctx, input.(A))
+	})
+}
+
+// pipelineExpect returns an error if the input type is not one of the expected types.
+func pipelineExpect(input reflect.Type, expected ...reflect.Type) error {
+	if slices.Contains(expected, input) {
+		return nil
+	}
+	var names []string
+	for _, t := range expected {
+		names = append(names, t.String())
+	}
+	return fmt.Errorf("expected input of type %s but the previous stage returns %s",
+		strings.Join(names, " or "), input.String())
+}
+
+// pipelineRequireParam returns the value of a required parameter.
+func pipelineRequireParam(stage PipelineStage, name string) (string, error) {
+	value := stage.Params[name]
+	if value == "" {
+		return "", fmt.Errorf("missing required parameter %q", name)
+	}
+	return value, nil
+}
+
+func pipelineBuildConnect(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineAddrPortType); err != nil {
+		return nil, nil, err
+	}
+	network, err := pipelineRequireParam(stage, "network")
+	if err != nil {
+		return nil, nil, err
+	}
+	if network != "tcp" && network != "udp" {
+		return nil, nil, fmt.Errorf("unsupported network %q", network)
+	}
+	return pipelineEraseInput(NewConnectFunc(cfg, network, logger)), pipelineNetConnType, nil
+}
+
+func pipelineBuildObserve(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineNetConnType); err != nil {
+		return nil, nil, err
+	}
+	return pipelineEraseInput(NewObserveConnFunc(cfg, logger)), pipelineNetConnType, nil
+}
+
+func pipelineBuildCancelWatch(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineNetConnType); err != nil {
+		return nil, nil, err
+	}
+	return pipelineEraseInput(NewCancelWatchFunc()), pipelineNetConnType, nil
+}
+
+func pipelineBuildTLSHandshake(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineNetConnType); err != nil {
+		return nil, nil, err
+	}
+	serverName, err := pipelineRequireParam(stage, "serverName")
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: serverName}
+	if alpn := stage.Params["alpn"]; alpn != "" {
+		tlsConfig.NextProtos = strings.Split(alpn, ",")
+	}
+	return pipelineEraseInput(NewTLSHandshakeFunc(cfg, tlsConfig, logger)), pipelineTLSConnType, nil
+}
+
+func pipelineBuildHTTPConn(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineNetConnType, pipelineTLSConnType); err != nil {
+		return nil, nil, err
+	}
+	if input == pipelineTLSConnType {
+		return pipelineEraseInput(NewHTTPConnFuncTLS(cfg, logger)), pipelineHTTPConnType, nil
+	}
+	return pipelineEraseInput(NewHTTPConnFuncPlain(cfg, logger)), pipelineHTTPConnType, nil
+}
+
+func pipelineBuildDoHWrap(
+	stage PipelineStage, input reflect.Type, cfg *Config, logger SLogger) (Func[any, any], reflect.Type, error) {
+	if err := pipelineExpect(input, pipelineHTTPConnType); err != nil {
+		return nil, nil, err
+	}
+	url, err := pipelineRequireParam(stage, "url")
+	if err != nil {
+		return nil, nil, err
+	}
+	return pipelineEraseInput(NewDNSOverHTTPSConnFunc(cfg, url, logger)), pipelineDoHConnType, nil
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// BuildPipeline composes a valid DoH spec into a working pipeline.
+func TestBuildPipelineDoH(t *testing.T) {
+	t.Run("DoH over TLS builds", func(t *testing.T) {
+		spec := PipelineSpec{
+			Endpoint: netip.MustParseAddrPort("8.8.8.8:443"),
+			Stages: []PipelineStage{
+				{Name: "connect", Params: map[string]string{"network": "tcp"}},
+				{Name: "observe"},
+				{Name: "cancelWatch"},
+				{Name: "tlsHandshake", Params: map[string]string{"serverName": "dns.google", "alpn": "h2,http/1.1"}},
+				{Name: "httpConn"},
+				{Name: "dohWrap", Params: map[string]string{"url": "https://dns.google/dns-query"}},
+			},
+		}
+
+		pipeline, err := BuildPipeline(spec, NewConfig(), DefaultSLogger())
+
+		require.NoError(t, err)
+		assert.NotNil(t, pipeline)
+	})
+
+	t.Run("DoH over plain HTTP runs", func(t *testing.T) {
+		var dialed string
+		cfg := NewConfig()
+		cfg.Dialer = &netstub.FuncDialer{
+			DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+				dialed = network + "/" + address
+				conn := newMinimalConn()
+				conn.CloseFunc = func() error { return nil }
+				return conn, nil
+			},
+		}
+		spec := PipelineSpec{
+			Endpoint: netip.MustParseAddrPort("8.8.8.8:80"),
+			Stages: []PipelineStage{
+				{Name: "connect", Params: map[string]string{"network": "tcp"}},
+				{Name: "cancelWatch"},
+				{Name: "httpConn"},
+				{Name: "dohWrap", Params: map[string]string{"url": "http://dns.google/dns-query"}},
+			},
+		}
+
+		pipeline, err := BuildPipeline(spec, cfg, DefaultSLogger())
+		require.NoError(t, err)
+
+		result, err := pipeline.Call(context.Background(), Unit{})
+
+		require.NoError(t, err)
+		assert.Equal(t, "tcp/8.8.8.8:80", dialed)
+		dnsConn, ok := result.(*DNSOverHTTPSConn)
+		require.True(t, ok)
+		assert.Equal(t, "http://dns.google/dns-query", dnsConn.url)
+		require.NoError(t, dnsConn.Close())
+	})
+}
+
+// BuildPipeline rejects invalid specs with a descriptive error.
+func TestBuildPipelineInvalidSpec(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// stages contains the stages of the spec.
+		stages []PipelineStage
+
+		// wantErr is the expected error string.
+		wantErr string
+	}{
+		{
+			name:    "no stages",
+			stages:  nil,
+			wantErr: "nop: invalid pipeline spec: no stages",
+		},
+
+		{
+			name: "type-incompatible stages",
+			stages: []PipelineStage{
+				{Name: "connect", Params: map[string]string{"network": "tcp"}},
+				{Name: "tlsHandshake", Params: map[string]string{"serverName": "dns.google"}},
+				{Name: "dohWrap", Params: map[string]string{"url": "https://dns.google/dns-query"}},
+			},
+			wantErr: "nop: invalid pipeline spec: stage 2 (dohWrap): expected input of type " +
+				"*nop.HTTPConn but the previous stage returns nop.TLSConn",
+		},
+
+		{
+			name: "stage before connect",
+			stages: []PipelineStage{
+				{Name: "observe"},
+			},
+			wantErr: "nop: invalid pipeline spec: stage 0 (observe): expected input of type " +
+				"net.Conn but the previous stage returns netip.AddrPort",
+		},
+
+		{
+			name: "unknown stage",
+			stages: []PipelineStage{
+				{Name: "quicHandshake"},
+			},
+			wantErr: `nop: invalid pipeline spec: stage 0: unknown stage "quicHandshake"`,
+		},
+
+		{
+			name: "unknown parameter",
+			stages: []PipelineStage{
+				{Name: "connect", Params: map[string]string{"network": "tcp", "port": "443"}},
+			},
+			wantErr: `nop: invalid pipeline spec: stage 0 (connect): unknown parameter "port"`,
+		},
+
+		{
+			name: "missing parameter",
+			stages: []PipelineStage{
+				{Name: "connect"},
+			},
+			wantErr: `nop: invalid pipeline spec: stage 0 (connect): missing required parameter "network"`,
+		},
+
+		{
+			name: "unsupported network",
+			stages: []PipelineStage{
+				{Name: "connect", Params: map[string]string{"network": "sctp"}},
+			},
+			wantErr: `nop: invalid pipeline spec: stage 0 (connect): unsupported network "sctp"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := PipelineSpec{
+				Endpoint: netip.MustParseAddrPort("8.8.8.8:443"),
+				Stages:   tt.stages,
+			}
+
+			pipeline, err := BuildPipeline(spec, NewConfig(), DefaultSLogger())
+
+			require.ErrorIs(t, err, ErrInvalidPipelineSpec)
+			assert.EqualError(t, err, tt.wantErr)
+			assert.Nil(t, pipeline)
+		})
+	}
+}
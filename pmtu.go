@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// errPathMTUUnavailable indicates that we cannot read the path MTU.
+var errPathMTUUnavailable = errors.New("path mtu unavailable")
+
+// NewPMTUFunc returns a new [*PMTUFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewPMTUFunc(cfg *Config, logger SLogger) *PMTUFunc {
+	return &PMTUFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// PMTUFunc logs the path MTU that the kernel discovered for a connection.
+//
+// Place this Func after [ConnectFunc] to emit a pathMtu event. On Linux, the
+// pathMtu field contains the path MTU read using the IP_MTU (or IPV6_MTU)
+// socket option, which is useful for path MTU discovery and black-hole
+// studies. When the path MTU cannot be read (e.g., on other systems or for
+// connections not implementing [syscall.Conn]), the event includes
+// pathMtuUnavailable instead, along with the error that occurred. The
+// connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type PMTUFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewPMTUFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewPMTUFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewPMTUFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &PMTUFunc{}
+
+// Call logs the path MTU of the given [net.Conn] and returns it.
+func (op *PMTUFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	mtu, err := pmtuRead(conn)
+	sockoptLog(op.Logger, op.ErrClassifier, op.TimeNow(), "pathMtu", conn, mtu, err)
+	return conn, nil
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+	"syscall"
+)
+
+// pmtuRead reads IP_MTU, or IPV6_MTU for IPv6 sockets, from the given connection.
+//
+// Returns [errPathMTUUnavailable] when the connection does not implement [syscall.Conn].
+func pmtuRead(conn net.Conn) (int, error) {
+	return sockoptRead(conn, errPathMTUUnavailable, func(fd int) (int, error) {
+		domain, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+		if err != nil {
+			return 0, err
+		}
+		level, option := syscall.IPPROTO_IP, syscall.IP_MTU
+		if domain == syscall.AF_INET6 {
+			level, option = syscall.IPPROTO_IPV6, syscall.IPV6_MTU
+		}
+		return syscall.GetsockoptInt(fd, level, option)
+	})
+}
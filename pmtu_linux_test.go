@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Call logs the path MTU of a connected UDP socket.
+func TestPMTUFuncSocket(t *testing.T) {
+	udpConn, err := net.Dial("udp", "127.0.0.1:53")
+	require.NoError(t, err)
+	defer udpConn.Close()
+
+	logger, records := newCapturingLogger()
+	conn, err := NewPMTUFunc(NewConfig(), logger).Call(context.Background(), udpConn)
+
+	require.NoError(t, err)
+	assert.Same(t, udpConn, conn)
+	require.Len(t, *records, 1)
+	mtu, found := findAttr((*records)[0], "pathMtu")
+	require.True(t, found)
+	assert.Greater(t, mtu.Int64(), int64(0))
+	_, found = findAttr((*records)[0], "pathMtuUnavailable")
+	assert.False(t, found)
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package nop
+
+import "net"
+
+// pmtuRead always returns [errPathMTUUnavailable] on this platform.
+func pmtuRead(conn net.Conn) (int, error) {
+	return 0, errPathMTUUnavailable
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// QUICConn abstracts over a QUIC connection (e.g., *quic.Conn).
+//
+// By using an abstraction we allow for alternative QUIC implementations
+// without depending on a specific one.
+type QUICConn interface {
+	// CloseWithError closes the connection with an application error code.
+	CloseWithError(code uint64, reason string) error
+
+	// ConnectionState returns the connection state.
+	ConnectionState() QUICConnectionState
+
+	// LocalAddr returns the local address.
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the remote address.
+	RemoteAddr() net.Addr
+}
+
+// QUICConnectionState contains the state of a [QUICConn].
+type QUICConnectionState struct {
+	// TLS contains the state of the TLS handshake.
+	TLS tls.ConnectionState
+
+	// Version is the negotiated QUIC version (e.g., 1 for RFC 9000).
+	Version uint32
+}
+
+// QUICDialer abstracts over a QUIC implementation dialing and handshaking.
+//
+// The DialContext method must return after the QUIC handshake completes. It
+// may return both a [QUICConn] and an error, in which case [*QUICHandshakeFunc]
+// closes the connection per the cleanup contract.
+type QUICDialer interface {
+	DialContext(ctx context.Context, address string, config *tls.Config) (QUICConn, error)
+}
+
+// NewQUICHandshakeFunc returns a new [*QUICHandshakeFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The dialer argument is the [QUICDialer] to use. This package does not
+// provide a default QUIC implementation, so the caller must provide one.
+//
+// The tlsConfig argument is the TLS configuration to use.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewQUICHandshakeFunc(cfg *Config, dialer QUICDialer, tlsConfig *tls.Config, logger SLogger) *QUICHandshakeFunc {
+	runtimex.Assert(dialer != nil)
+	runtimex.Assert(tlsConfig != nil)
+	return &QUICHandshakeFunc{
+		Config:        tlsConfig,
+		Dialer:        dialer,
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// QUICHandshakeFunc establishes a QUIC connection with a [netip.AddrPort].
+//
+// This is the QUIC counterpart of [ConnectFunc] and [TLSHandshakeFunc]
+// combined, since QUIC performs the transport and TLS handshakes together.
+// It emits quicHandshakeStart and quicHandshakeDone events.
+//
+// Returns either a valid [QUICConn] or an error, never both.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type QUICHandshakeFunc struct {
+	// Config contains the [*tls.Config] configuration to use.
+	//
+	// Set by [NewQUICHandshakeFunc] to the user-provided [*tls.Config] pointer.
+	Config *tls.Config
+
+	// Dialer is the [QUICDialer] to use.
+	//
+	// Set by [NewQUICHandshakeFunc] to the user-provided dialer.
+	Dialer QUICDialer
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewQUICHandshakeFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewQUICHandshakeFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewQUICHandshakeFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[netip.AddrPort, QUICConn] = &QUICHandshakeFunc{}
+
+// Call invokes the [*QUICHandshakeFunc] to establish a QUIC connection.
+func (op *QUICHandshakeFunc) Call(ctx context.Context, address netip.AddrPort) (QUICConn, error) {
+	config := op.tlsConfig()
+	t0 := op.TimeNow()
+	deadline, _ := ctx.Deadline()
+	op.logHandshakeStart(address.String(), t0, deadline, config)
+	qconn, err := op.Dialer.DialContext(ctx, address.String(), config)
+	op.logHandshakeDone(address.String(), t0, deadline, config, qconn, err)
+	if err != nil {
+		if qconn != nil {
+			qconn.CloseWithError(0, "")
+		}
+		return nil, err
+	}
+	return qconn, nil
+}
+
+func (op *QUICHandshakeFunc) tlsConfig() *tls.Config {
+	runtimex.Assert(op.Config != nil)
+	config := op.Config.Clone()
+	config.Time = op.TimeNow
+	return config
+}
+
+func (op *QUICHandshakeFunc) logHandshakeStart(
+	address string, t0 time.Time, deadline time.Time, config *tls.Config) {
+	op.Logger.Info(
+		"quicHandshakeStart",
+		slog.Time("deadline", deadline),
+		slog.String("protocol", "udp"),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.Time("t", t0),
+		slog.Any("tlsOfferedProtocols", config.NextProtos),
+		slog.String("tlsServerName", config.ServerName),
+		slog.Bool("tlsSkipVerify", config.InsecureSkipVerify),
+	)
+}
+
+func (op *QUICHandshakeFunc) logHandshakeDone(address string,
+	t0 time.Time, deadline time.Time, config *tls.Config, qconn QUICConn, err error) {
+	var (
+		laddr string
+		state QUICConnectionState
+	)
+	if qconn != nil {
+		if addr := qconn.LocalAddr(); addr != nil {
+			laddr = canonicalAddr(addr.String())
+		}
+		state = qconn.ConnectionState()
+	}
+	op.Logger.Info(
+		"quicHandshakeDone",
+		slog.Time("deadline", deadline),
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", laddr),
+		slog.String("protocol", "udp"),
+		slog.Uint64("quicVersion", uint64(state.Version)),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.Time("t0", t0),
+		slog.Time("t", op.TimeNow()),
+		slog.String("tlsCipherSuite", tls.CipherSuiteName(state.TLS.CipherSuite)),
+		slog.String("tlsNegotiatedProtocol", state.TLS.NegotiatedProtocol),
+		slog.Any("tlsOfferedProtocols", config.NextProtos),
+		slog.String("tlsServerName", config.ServerName),
+		slog.Bool("tlsSkipVerify", config.InsecureSkipVerify),
+		slog.String("tlsVersion", tls.VersionName(state.TLS.Version)),
+	)
+}
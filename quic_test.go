@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockQUICConn implements [QUICConn] for testing.
+type mockQUICConn struct {
+	closed bool
+	state  QUICConnectionState
+}
+
+func (c *mockQUICConn) CloseWithError(code uint64, reason string) error {
+	c.closed = true
+	return nil
+}
+
+func (c *mockQUICConn) ConnectionState() QUICConnectionState {
+	return c.state
+}
+
+func (c *mockQUICConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 54321}
+}
+
+func (c *mockQUICConn) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 443}
+}
+
+// mockQUICDialer implements [QUICDialer] for testing.
+type mockQUICDialer func(ctx context.Context, address string, config *tls.Config) (QUICConn, error)
+
+func (f mockQUICDialer) DialContext(ctx context.Context, address string, config *tls.Config) (QUICConn, error) {
+	return f(ctx, address, config)
+}
+
+// NewQUICHandshakeFunc populates all fields from Config and the provided arguments.
+func TestNewQUICHandshakeFunc(t *testing.T) {
+	dialer := mockQUICDialer(func(ctx context.Context, address string, config *tls.Config) (QUICConn, error) {
+		return nil, errors.New("not implemented")
+	})
+	tlsConfig := &tls.Config{ServerName: "dns.google"}
+
+	fn := NewQUICHandshakeFunc(NewConfig(), dialer, tlsConfig, DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.Same(t, tlsConfig, fn.Config)
+	assert.NotNil(t, fn.Dialer)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call returns the connection and logs the negotiated parameters.
+func TestQUICHandshakeFuncSuccess(t *testing.T) {
+	qconn := &mockQUICConn{state: QUICConnectionState{
+		TLS: tls.ConnectionState{
+			NegotiatedProtocol: "h3",
+			Version:            tls.VersionTLS13,
+		},
+		Version: 1,
+	}}
+	var gotAddress, gotServerName string
+	dialer := mockQUICDialer(func(ctx context.Context, address string, config *tls.Config) (QUICConn, error) {
+		gotAddress, gotServerName = address, config.ServerName
+		return qconn, nil
+	})
+	logger, records := newCapturingLogger()
+	fn := NewQUICHandshakeFunc(NewConfig(), dialer, &tls.Config{
+		NextProtos: []string{"h3"},
+		ServerName: "dns.google",
+	}, logger)
+
+	conn, err := fn.Call(context.Background(), netip.MustParseAddrPort("8.8.8.8:443"))
+
+	require.NoError(t, err)
+	assert.Same(t, qconn, conn)
+	assert.False(t, qconn.closed)
+	assert.Equal(t, "8.8.8.8:443", gotAddress)
+	assert.Equal(t, "dns.google", gotServerName)
+
+	require.Len(t, *records, 2)
+	assert.Equal(t, "quicHandshakeStart", (*records)[0].Message)
+	assert.Equal(t, "quicHandshakeDone", (*records)[1].Message)
+	wantAttrs := map[string]any{
+		"errClass":              "",
+		"localAddr":             "127.0.0.1:54321",
+		"quicVersion":           uint64(1),
+		"tlsNegotiatedProtocol": "h3",
+		"tlsVersion":            "TLS 1.3",
+	}
+	for key, want := range wantAttrs {
+		value, found := findAttr((*records)[1], key)
+		require.True(t, found, key)
+		assert.Equal(t, want, value.Any(), key)
+	}
+}
+
+// Call closes the connection and returns the error when the handshake fails.
+func TestQUICHandshakeFuncFailure(t *testing.T) {
+	wantErr := errors.New("handshake timeout")
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// qconn is the connection returned along with the error, if any.
+		qconn *mockQUICConn
+	}{
+		{name: "without connection", qconn: nil},
+		{name: "with connection", qconn: &mockQUICConn{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dialer := mockQUICDialer(func(ctx context.Context, address string, config *tls.Config) (QUICConn, error) {
+				if tt.qconn == nil {
+					return nil, wantErr
+				}
+				return tt.qconn, wantErr
+			})
+			logger, records := newCapturingLogger()
+			cfg := NewConfig()
+			cfg.ErrClassifier = ErrClassifierFunc(func(err error) string {
+				if err == nil {
+					return ""
+				}
+				return "ETIMEDOUT"
+			})
+			fn := NewQUICHandshakeFunc(cfg, dialer, &tls.Config{ServerName: "dns.google"}, logger)
+
+			conn, err := fn.Call(context.Background(), netip.MustParseAddrPort("8.8.8.8:443"))
+
+			require.ErrorIs(t, err, wantErr)
+			assert.Nil(t, conn)
+			if tt.qconn != nil {
+				assert.True(t, tt.qconn.closed)
+			}
+			require.Len(t, *records, 2)
+			errClass, found := findAttr((*records)[1], "errClass")
+			require.True(t, found)
+			assert.Equal(t, "ETIMEDOUT", errClass.String())
+		})
+	}
+}
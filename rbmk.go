@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// ErrInvalidRBMKEvent indicates that an RBMK event cannot be converted
+// back to a [slog.Record] by [FromRBMKEvent].
+var ErrInvalidRBMKEvent = errors.New("nop: invalid RBMK event")
+
+// rbmkTimeKeys contains the attributes holding a [time.Time].
+var rbmkTimeKeys = []string{"deadline", "t", "t0"}
+
+// rbmkBytesKeys contains the attributes holding raw bytes.
+//
+// Since JSON encodes raw bytes as base64 strings, which are indistinguishable
+// from other strings, we cannot infer these attributes from the values, so
+// any new attribute holding raw bytes must be added here.
+var rbmkBytesKeys = []string{
+	"dnsPartialResponse",
+	"dnsRawQuery",
+	"dnsRawResponse",
+	"tlsAlertBytes",
+	"tlsFirstRecord",
+}
+
+// rbmkBytesSliceKeys contains the attributes holding lists of raw bytes.
+var rbmkBytesSliceKeys = []string{"tlsPeerCerts"}
+
+// ToRBMKEvent converts a [slog.Record] emitted by this package into the
+// JSON-compatible envelope used by RBMK tooling.
+//
+// The envelope is the JSON object that [slog.JSONHandler] would emit for
+// the record: the "time", "level", and "msg" keys followed by one key for
+// each attribute. Times are encoded as RFC 3339 strings with nanoseconds,
+// byte slices as base64 strings, errors as their string representation,
+// and numbers as [json.Number] to avoid losing precision.
+//
+// Use [FromRBMKEvent] to convert the envelope back into a [slog.Record].
+func ToRBMKEvent(record slog.Record) (map[string]any, error) {
+	var buf bytes.Buffer
+	handler := slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	if err := handler.Handle(context.Background(), record); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(&buf)
+	decoder.UseNumber()
+	var event map[string]any
+	if err := decoder.Decode(&event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// FromRBMKEvent converts an RBMK event envelope, such as the one returned
+// by [ToRBMKEvent], back into a [slog.Record].
+//
+// The attributes known to carry times or raw bytes are decoded back to
+// [time.Time] and []byte values, numbers become int64 or float64 values,
+// and all the other values are preserved as-is. Because the envelope is a
+// map, the attributes are added to the record sorted by key. Errors cannot
+// be recovered and are thus represented by their string representation.
+//
+// This function returns [ErrInvalidRBMKEvent] (possibly wrapped) when the
+// envelope lacks the "msg" key or contains malformed values.
+func FromRBMKEvent(event map[string]any) (slog.Record, error) {
+	msg, ok := event[slog.MessageKey].(string)
+	if !ok {
+		return slog.Record{}, fmt.Errorf("%w: missing %q", ErrInvalidRBMKEvent, slog.MessageKey)
+	}
+
+	var t time.Time
+	if value, found := event[slog.TimeKey]; found {
+		var err error
+		if t, err = rbmkParseTime(value); err != nil {
+			return slog.Record{}, fmt.Errorf("%w: %q: %w", ErrInvalidRBMKEvent, slog.TimeKey, err)
+		}
+	}
+
+	var level slog.Level
+	if value, found := event[slog.LevelKey]; found {
+		text, ok := value.(string)
+		if !ok {
+			return slog.Record{}, fmt.Errorf("%w: %q is not a string", ErrInvalidRBMKEvent, slog.LevelKey)
+		}
+		if err := level.UnmarshalText([]byte(text)); err != nil {
+			return slog.Record{}, fmt.Errorf("%w: %q: %w", ErrInvalidRBMKEvent, slog.LevelKey, err)
+		}
+	}
+
+	record := slog.NewRecord(t, level, msg, 0)
+	keys := make([]string, 0, len(event))
+	for key := range event {
+		switch key {
+		case slog.MessageKey, slog.TimeKey, slog.LevelKey:
+			// already handled
+		default:
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		attr, err := rbmkDecodeAttr(key, event[key])
+		if err != nil {
+			return slog.Record{}, fmt.Errorf("%w: %q: %w", ErrInvalidRBMKEvent, key, err)
+		}
+		record.AddAttrs(attr)
+	}
+	return record, nil
+}
+
+// rbmkDecodeAttr converts a JSON-compatible value back into a [slog.Attr].
+func rbmkDecodeAttr(key string, value any) (slog.Attr, error) {
+	switch {
+	case slices.Contains(rbmkTimeKeys, key):
+		t, err := rbmkParseTime(value)
+		if err != nil {
+			return slog.Attr{}, err
+		}
+		return slog.Time(key, t), nil
+
+	case slices.Contains(rbmkBytesKeys, key) && value != nil:
+		data, err := rbmkDecodeBytes(value)
+		if err != nil {
+			return slog.Attr{}, err
+		}
+		return slog.Any(key, data), nil
+
+	case slices.Contains(rbmkBytesSliceKeys, key) && value != nil:
+		values, ok := value.([]any)
+		if !ok {
+			return slog.Attr{}, errors.New("expected a list of base64 strings")
+		}
+		list := make([][]byte, 0, len(values))
+		for _, entry := range values {
+			data, err := rbmkDecodeBytes(entry)
+			if err != nil {
+				return slog.Attr{}, err
+			}
+			list = append(list, data)
+		}
+		return slog.Any(key, list), nil
+	}
+
+	if number, ok := value.(json.Number); ok {
+		if v, err := number.Int64(); err == nil {
+			return slog.Int64(key, v), nil
+		}
+		v, err := number.Float64()
+		if err != nil {
+			return slog.Attr{}, err
+		}
+		return slog.Float64(key, v), nil
+	}
+	return slog.Any(key, value), nil
+}
+
+// rbmkDecodeBytes decodes raw bytes encoded by [ToRBMKEvent].
+func rbmkDecodeBytes(value any) ([]byte, error) {
+	text, ok := value.(string)
+	if !ok {
+		return nil, errors.New("expected a base64 string")
+	}
+	return base64.StdEncoding.DecodeString(text)
+}
+
+// rbmkParseTime parses a time encoded by [ToRBMKEvent].
+func rbmkParseTime(value any) (time.Time, error) {
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("expected an RFC 3339 string")
+	}
+	return time.Parse(time.RFC3339Nano, text)
+}
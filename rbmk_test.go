@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ToRBMKEvent and FromRBMKEvent round trip a connectDone record.
+func TestRBMKEventRoundTripConnectDone(t *testing.T) {
+	cfg := NewConfig()
+	fixedTime := time.Date(2025, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	cfg.TimeNow = func() time.Time { return fixedTime }
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn := newMinimalConn()
+			conn.LocalAddrFunc = func() net.Addr {
+				return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 54321}
+			}
+			return conn, nil
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	_, err := NewConnectFunc(cfg, "tcp", logger).Call(context.Background(), netip.MustParseAddrPort("8.8.8.8:443"))
+	require.NoError(t, err)
+	require.Len(t, *records, 2)
+	original := (*records)[1]
+	require.Equal(t, "connectDone", original.Message)
+
+	event, err := ToRBMKEvent(original)
+	require.NoError(t, err)
+	assert.Equal(t, "connectDone", event["msg"])
+	assert.Equal(t, "INFO", event["level"])
+	assert.Equal(t, "127.0.0.1:54321", event["localAddr"])
+	assert.Equal(t, "2025-01-01T12:00:00.123456789Z", event["t"])
+	assert.Nil(t, event["err"])
+
+	decoded, err := FromRBMKEvent(event)
+	require.NoError(t, err)
+	assert.Equal(t, original.Message, decoded.Message)
+	assert.Equal(t, original.Level, decoded.Level)
+	assert.True(t, original.Time.Equal(decoded.Time))
+	assert.Equal(t, original.NumAttrs(), decoded.NumAttrs())
+
+	for _, key := range []string{"localAddr", "protocol", "remoteAddr", "errClass"} {
+		want, found := findAttr(original, key)
+		require.True(t, found, key)
+		got, found := findAttr(decoded, key)
+		require.True(t, found, key)
+		assert.Equal(t, want.String(), got.String(), key)
+	}
+	for _, key := range []string{"t", "t0", "deadline"} {
+		want, found := findAttr(original, key)
+		require.True(t, found, key)
+		got, found := findAttr(decoded, key)
+		require.True(t, found, key)
+		assert.True(t, want.Time().Equal(got.Time()), key)
+	}
+}
+
+// ToRBMKEvent and FromRBMKEvent round trip a dnsResponse record.
+func TestRBMKEventRoundTripDNSResponse(t *testing.T) {
+	logger, records := newCapturingLogger()
+	lc := newTestLogContext(logger)
+
+	rqr := []byte{0x00, 0x01, 0x02}
+	rawResp := []byte{0x03, 0x04, 0x05}
+	lc.MakeResponseObserver(time.Now(), &rqr)(rawResp)
+	require.Len(t, *records, 1)
+	original := (*records)[0]
+
+	event, err := ToRBMKEvent(original)
+	require.NoError(t, err)
+	assert.Equal(t, "AAEC", event["dnsRawQuery"])
+	assert.Equal(t, "AwQF", event["dnsRawResponse"])
+
+	decoded, err := FromRBMKEvent(event)
+	require.NoError(t, err)
+	assert.Equal(t, "dnsResponse", decoded.Message)
+
+	got, found := findAttr(decoded, "dnsRawQuery")
+	require.True(t, found)
+	assert.Equal(t, rqr, got.Any())
+	got, found = findAttr(decoded, "dnsRawResponse")
+	require.True(t, found)
+	assert.Equal(t, rawResp, got.Any())
+	got, found = findAttr(decoded, "serverProtocol")
+	require.True(t, found)
+	assert.Equal(t, "udp", got.String())
+}
+
+// ToRBMKEvent and FromRBMKEvent round trip each attribute holding raw bytes.
+func TestRBMKEventRoundTripBytes(t *testing.T) {
+	tests := []struct {
+		// key is the attribute key.
+		key string
+
+		// value is the attribute value.
+		value any
+	}{
+		{key: "dnsPartialResponse", value: []byte{0x00, 0x2a, 0x81}},
+		{key: "dnsRawQuery", value: []byte{0x00, 0x01, 0x02}},
+		{key: "dnsRawResponse", value: []byte{0x03, 0x04, 0x05}},
+		{key: "tlsAlertBytes", value: []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}},
+		{key: "tlsFirstRecord", value: []byte{0x16, 0x03, 0x03, 0x00, 0x04}},
+		{key: "tlsPeerCerts", value: [][]byte{{0x30, 0x82}, {0x30, 0x81}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			original := slog.NewRecord(time.Now(), slog.LevelInfo, "event", 0)
+			original.AddAttrs(slog.Any(tt.key, tt.value))
+
+			event, err := ToRBMKEvent(original)
+			require.NoError(t, err)
+			decoded, err := FromRBMKEvent(event)
+			require.NoError(t, err)
+
+			got, found := findAttr(decoded, tt.key)
+			require.True(t, found)
+			assert.Equal(t, tt.value, got.Any())
+		})
+	}
+
+	t.Run("malformed list", func(t *testing.T) {
+		_, err := FromRBMKEvent(map[string]any{"msg": "event", "tlsPeerCerts": []any{"!"}})
+		require.ErrorIs(t, err, ErrInvalidRBMKEvent)
+		_, err = FromRBMKEvent(map[string]any{"msg": "event", "tlsPeerCerts": "AAEC"})
+		require.ErrorIs(t, err, ErrInvalidRBMKEvent)
+	})
+}
+
+// FromRBMKEvent decodes numbers and rejects malformed envelopes.
+func TestFromRBMKEvent(t *testing.T) {
+	t.Run("numbers", func(t *testing.T) {
+		record, err := FromRBMKEvent(map[string]any{
+			"msg":          "readDone",
+			"ioBytesCount": json.Number("42"),
+			"ratio":        json.Number("0.5"),
+		})
+		require.NoError(t, err)
+
+		count, found := findAttr(record, "ioBytesCount")
+		require.True(t, found)
+		assert.Equal(t, slog.KindInt64, count.Kind())
+		assert.Equal(t, int64(42), count.Int64())
+
+		ratio, found := findAttr(record, "ratio")
+		require.True(t, found)
+		assert.Equal(t, 0.5, ratio.Float64())
+	})
+
+	invalid := []struct {
+		// name describes the scenario.
+		name string
+
+		// event is the malformed envelope.
+		event map[string]any
+	}{
+		{name: "missing msg", event: map[string]any{"t": "2025-01-01T00:00:00Z"}},
+		{name: "invalid time", event: map[string]any{"msg": "x", "time": "yesterday"}},
+		{name: "invalid level", event: map[string]any{"msg": "x", "level": "LOUD"}},
+		{name: "invalid t", event: map[string]any{"msg": "x", "t": 42}},
+		{name: "invalid bytes", event: map[string]any{"msg": "x", "dnsRawQuery": "!!"}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FromRBMKEvent(tt.event)
+			require.True(t, errors.Is(err, ErrInvalidRBMKEvent))
+			assert.Contains(t, err.Error(), "nop: invalid RBMK event: ")
+		})
+	}
+}
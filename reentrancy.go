@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// NewReentrancyGuardFunc returns a new [*ReentrancyGuardFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewReentrancyGuardFunc(cfg *Config, logger SLogger) *ReentrancyGuardFunc {
+	return &ReentrancyGuardFunc{
+		Logger:  logger,
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// ReentrancyGuardFunc wraps a [net.Conn] to detect concurrent Read calls
+// or concurrent Write calls, which usually indicate misuse of the connection
+// by code that reads or writes from multiple goroutines.
+//
+// When a Read starts while another Read is in progress, or a Write starts
+// while another Write is in progress, the wrapper emits a reentrancyDetected
+// event whose reentrancyOp field is either "read" or "write". The wrapper
+// never blocks the calls. Concurrent Read and Write calls are legitimate
+// and do not emit events.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type ReentrancyGuardFunc struct {
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewReentrancyGuardFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewReentrancyGuardFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &ReentrancyGuardFunc{}
+
+// Call wraps the given [net.Conn] to detect concurrent Read or Write calls.
+func (op *ReentrancyGuardFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &reentrancyGuardConn{Conn: conn, op: op}, nil
+}
+
+// reentrancyGuardConn detects concurrent Read or Write calls on a [net.Conn].
+type reentrancyGuardConn struct {
+	net.Conn
+	op      *ReentrancyGuardFunc
+	readers atomic.Int64
+	writers atomic.Int64
+}
+
+// Read implements [net.Conn].
+func (c *reentrancyGuardConn) Read(b []byte) (int, error) {
+	if c.readers.Add(1) > 1 {
+		c.logReentrancy("read")
+	}
+	defer c.readers.Add(-1)
+	return c.Conn.Read(b)
+}
+
+// Write implements [net.Conn].
+func (c *reentrancyGuardConn) Write(b []byte) (int, error) {
+	if c.writers.Add(1) > 1 {
+		c.logReentrancy("write")
+	}
+	defer c.writers.Add(-1)
+	return c.Conn.Write(b)
+}
+
+func (c *reentrancyGuardConn) logReentrancy(operation string) {
+	c.op.Logger.Info(
+		"reentrancyDetected",
+		slog.String("localAddr", connLocalAddr(c.Conn)),
+		slog.String("protocol", safeconn.Network(c.Conn)),
+		slog.String("reentrancyOp", operation),
+		slog.String("remoteAddr", connRemoteAddr(c.Conn)),
+		slog.Time("t", c.op.TimeNow()),
+	)
+}
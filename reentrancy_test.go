@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewReentrancyGuardFunc populates all fields from Config and the provided logger.
+func TestNewReentrancyGuardFunc(t *testing.T) {
+	fn := NewReentrancyGuardFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Concurrent Read calls emit reentrancyDetected.
+func TestReentrancyGuardFuncConcurrentReads(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		entered <- struct{}{}
+		<-release
+		return len(b), nil
+	}
+	logger, records := newCapturingLogger()
+	conn, err := NewReentrancyGuardFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	// Start the first Read and wait for it to block inside the mock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.Read(make([]byte, 4))
+	}()
+	<-entered
+
+	// Start the second Read, which must be detected before reaching the mock
+	go func() {
+		<-entered
+		close(release)
+	}()
+	_, err = conn.Read(make([]byte, 4))
+	require.NoError(t, err)
+	<-done
+
+	require.Len(t, *records, 1)
+	assert.Equal(t, "reentrancyDetected", (*records)[0].Message)
+	value, found := findAttr((*records)[0], "reentrancyOp")
+	require.True(t, found)
+	assert.Equal(t, "read", value.String())
+}
+
+// Sequential Read and Write calls do not emit events.
+func TestReentrancyGuardFuncSequentialCalls(t *testing.T) {
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		return len(b), nil
+	}
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return len(b), nil
+	}
+	logger, records := newCapturingLogger()
+	conn, err := NewReentrancyGuardFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err = conn.Read(make([]byte, 4))
+		require.NoError(t, err)
+		_, err = conn.Write(make([]byte, 4))
+		require.NoError(t, err)
+	}
+
+	assert.Empty(t, *records)
+}
@@ -0,0 +1,198 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// Resolver abstracts over [*net.Resolver] for [*ResolveConnectFunc] to allow
+// for unit testing and for using alternative resolvers.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+var _ Resolver = &net.Resolver{}
+
+// NewResolveConnectFunc returns a new [*ResolveConnectFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The network argument must be either "tcp" or "udp".
+//
+// The logger argument is the [SLogger] to use for structured logging.
+//
+// This function panics if cfg.DSCP is not between 0 and 63.
+func NewResolveConnectFunc(cfg *Config, network string, logger SLogger) *ResolveConnectFunc {
+	return &ResolveConnectFunc{
+		Connect:       NewConnectFunc(cfg, network, logger),
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		Resolver:      cfg.Resolver,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// ResolveConnectFunc resolves a "host:port" address and connects to it.
+//
+// Call resolves the host using Resolver, emitting a dnsLookupStart and
+// dnsLookupDone pair of events around the resolution. These events are
+// distinct from the dnsExchangeStart and dnsExchangeDone events, since the
+// Resolver hides the DNS messages, and dnsLookupDone contains the full
+// list of candidate addresses as dnsLookupAddrs.
+//
+// Call then dials each candidate in order using Connect, thus emitting
+// connectStart and connectDone events, until one succeeds. When all the
+// candidates fail, Call returns the last dial error wrapped with the
+// address and the candidates it resolved to.
+//
+// Call emits a final resolveConnectDone event containing the number of
+// candidates dialed as connectCandidatesTried and, on success, the address
+// family of the winning candidate ("inet" or "inet6") as connectWinningFamily.
+//
+// Prefer [*ConnectFunc] along with the DNS primitives (e.g., [*DNSOverUDPConn])
+// when you need to observe the DNS messages or to choose the resolver precisely.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type ResolveConnectFunc struct {
+	// Connect is the [*ConnectFunc] dialing each candidate.
+	//
+	// Set by [NewResolveConnectFunc] to a [*ConnectFunc] constructed
+	// using the same arguments.
+	Connect *ConnectFunc
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewResolveConnectFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewResolveConnectFunc] to the user-provided logger.
+	Logger SLogger
+
+	// Resolver is the [Resolver] to use.
+	//
+	// Set by [NewResolveConnectFunc] from [Config.Resolver].
+	Resolver Resolver
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewResolveConnectFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[string, net.Conn] = &ResolveConnectFunc{}
+
+// Call resolves the given "host:port" address and connects to it.
+func (op *ResolveConnectFunc) Call(ctx context.Context, address string) (net.Conn, error) {
+	// 1. Split the address into host and port
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("nop: invalid port in %q: %w", address, err)
+	}
+
+	// 2. Resolve the host into candidate endpoints
+	t0 := op.TimeNow()
+	deadline, _ := ctx.Deadline()
+	candidates, err := op.lookup(ctx, host, uint16(port))
+
+	// 3. Dial each candidate until one succeeds
+	var (
+		conn   net.Conn
+		tried  int
+		winner netip.AddrPort
+	)
+	for _, candidate := range candidates {
+		tried++
+		if conn, err = op.Connect.Call(ctx, candidate); err == nil {
+			winner = candidate
+			break
+		}
+	}
+	if err != nil && len(candidates) > 0 {
+		err = fmt.Errorf("nop: connect to %s (resolved to %v): %w", address, candidates, err)
+	}
+
+	// 4. Log the outcome
+	attrs := []any{
+		slog.Int("connectCandidatesTried", tried),
+	}
+	remoteAddr := ""
+	if conn != nil {
+		attrs = append(attrs, slog.String("connectWinningFamily", connectFamily(winner)))
+		remoteAddr = winner.String()
+	}
+	attrs = append(attrs,
+		slog.Time("deadline", deadline),
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", op.Connect.Network),
+		slog.String("remoteAddr", canonicalAddr(remoteAddr)),
+		slog.Time("t0", t0),
+		slog.Time("t", op.TimeNow()),
+	)
+	op.Logger.Info("resolveConnectDone", attrs...)
+	return conn, err
+}
+
+// connectFamily returns the address family of the endpoint as "inet" or "inet6".
+func connectFamily(addr netip.AddrPort) string {
+	if addr.Addr().Unmap().Is4() {
+		return "inet"
+	}
+	return "inet6"
+}
+
+// lookup resolves the host and returns the candidate endpoints.
+func (op *ResolveConnectFunc) lookup(ctx context.Context, host string, port uint16) ([]netip.AddrPort, error) {
+	t0 := op.TimeNow()
+	deadline, _ := ctx.Deadline()
+	op.Logger.Info(
+		"dnsLookupStart",
+		slog.Time("deadline", deadline),
+		slog.String("dnsLookupHost", host),
+		slog.Time("t", t0),
+	)
+
+	addrs, err := op.Resolver.LookupNetIP(ctx, "ip", host)
+	if err == nil && len(addrs) <= 0 {
+		err = ErrNoCandidates
+	}
+	var (
+		candidates []netip.AddrPort
+		logAddrs   []string
+	)
+	for _, addr := range addrs {
+		candidate := netip.AddrPortFrom(addr.Unmap(), port)
+		candidates = append(candidates, candidate)
+		logAddrs = append(logAddrs, candidate.String())
+	}
+
+	op.Logger.Info(
+		"dnsLookupDone",
+		slog.Time("deadline", deadline),
+		slog.Any("dnsLookupAddrs", logAddrs),
+		slog.String("dnsLookupHost", host),
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.Time("t0", t0),
+		slog.Time("t", op.TimeNow()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return candidates, nil
+}
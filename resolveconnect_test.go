@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcResolver is a [Resolver] using a function.
+type funcResolver func(ctx context.Context, network, host string) ([]netip.Addr, error)
+
+func (fx funcResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	return fx(ctx, network, host)
+}
+
+// newResolveConnectTestFunc returns a [*ResolveConnectFunc] using the given
+// resolver and a dialer failing with the error mapped to the address, if any.
+func newResolveConnectTestFunc(
+	resolver Resolver, failures map[string]error, logger SLogger) (*ResolveConnectFunc, *[]string) {
+	var dialed []string
+	cfg := NewConfig()
+	cfg.Resolver = resolver
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			if err := failures[address]; err != nil {
+				return nil, err
+			}
+			conn := newMinimalConn()
+			conn.RemoteAddrFunc = func() net.Addr {
+				return net.TCPAddrFromAddrPort(netip.MustParseAddrPort(address))
+			}
+			return conn, nil
+		},
+	}
+	return NewResolveConnectFunc(cfg, "tcp", logger), &dialed
+}
+
+// NewResolveConnectFunc populates all fields from Config and the provided logger.
+func TestNewResolveConnectFunc(t *testing.T) {
+	cfg := NewConfig()
+	logger := DefaultSLogger()
+
+	fn := NewResolveConnectFunc(cfg, "tcp", logger)
+
+	require.NotNil(t, fn)
+	require.NotNil(t, fn.Connect)
+	assert.Equal(t, "tcp", fn.Connect.Network)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.Same(t, net.DefaultResolver, fn.Resolver)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call resolves the host, logs the candidates, and dials until one succeeds.
+func TestResolveConnectFuncSuccess(t *testing.T) {
+	resolver := funcResolver(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		assert.Equal(t, "ip", network)
+		assert.Equal(t, "www.example.com", host)
+		return []netip.Addr{
+			netip.MustParseAddr("2001:db8::1"),
+			netip.MustParseAddr("::ffff:10.0.0.1"),
+		}, nil
+	})
+	logger, records := newCapturingLogger()
+	fn, dialed := newResolveConnectTestFunc(resolver, map[string]error{
+		"[2001:db8::1]:443": errors.New("network unreachable"),
+	}, logger)
+
+	conn, err := fn.Call(context.Background(), "www.example.com:443")
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	assert.Equal(t, "10.0.0.1:443", conn.RemoteAddr().String())
+	assert.Equal(t, []string{"[2001:db8::1]:443", "10.0.0.1:443"}, *dialed)
+
+	var messages []string
+	for _, record := range *records {
+		messages = append(messages, record.Message)
+	}
+	assert.Equal(t, []string{
+		"dnsLookupStart", "dnsLookupDone",
+		"connectStart", "connectDone",
+		"connectStart", "connectDone",
+		"resolveConnectDone",
+	}, messages)
+
+	record, found := findRecord(*records, "dnsLookupDone")
+	require.True(t, found)
+	host, _ := findAttr(record, "dnsLookupHost")
+	assert.Equal(t, "www.example.com", host.String())
+	addrs, _ := findAttr(record, "dnsLookupAddrs")
+	assert.Equal(t, []string{"[2001:db8::1]:443", "10.0.0.1:443"}, addrs.Any())
+	errClass, _ := findAttr(record, "errClass")
+	assert.Equal(t, "", errClass.String())
+
+	record, found = findRecord(*records, "resolveConnectDone")
+	require.True(t, found)
+	tried, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(2), tried.Int64())
+	family, _ := findAttr(record, "connectWinningFamily")
+	assert.Equal(t, "inet", family.String())
+	remoteAddr, _ := findAttr(record, "remoteAddr")
+	assert.Equal(t, "10.0.0.1:443", remoteAddr.String())
+}
+
+// Call logs the IPv6 family when the IPv6 candidate wins.
+func TestResolveConnectFuncWinningFamilyIPv6(t *testing.T) {
+	resolver := funcResolver(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		return []netip.Addr{
+			netip.MustParseAddr("10.0.0.1"),
+			netip.MustParseAddr("2001:db8::1"),
+		}, nil
+	})
+	logger, records := newCapturingLogger()
+	fn, _ := newResolveConnectTestFunc(resolver, map[string]error{
+		"10.0.0.1:443": errors.New("network unreachable"),
+	}, logger)
+
+	conn, err := fn.Call(context.Background(), "www.example.com:443")
+
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	record, found := findRecord(*records, "resolveConnectDone")
+	require.True(t, found)
+	tried, _ := findAttr(record, "connectCandidatesTried")
+	assert.Equal(t, int64(2), tried.Int64())
+	family, _ := findAttr(record, "connectWinningFamily")
+	assert.Equal(t, "inet6", family.String())
+}
+
+// Call wraps the last dial error with the resolution context when all candidates fail.
+func TestResolveConnectFuncAllFail(t *testing.T) {
+	resolver := funcResolver(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		return []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}, nil
+	})
+	errLast := errors.New("connection refused")
+	fn, dialed := newResolveConnectTestFunc(resolver, map[string]error{
+		"10.0.0.1:443": errors.New("network unreachable"),
+		"10.0.0.2:443": errLast,
+	}, DefaultSLogger())
+
+	conn, err := fn.Call(context.Background(), "www.example.com:443")
+
+	require.ErrorIs(t, err, errLast)
+	assert.Nil(t, conn)
+	assert.Contains(t, err.Error(), "www.example.com:443")
+	assert.Contains(t, err.Error(), "10.0.0.2:443")
+	assert.Len(t, *dialed, 2)
+}
+
+// Call returns the resolution error without dialing.
+func TestResolveConnectFuncLookupError(t *testing.T) {
+	errLookup := errors.New("no such host")
+	tests := []struct {
+		// name describes what this test case verifies.
+		name string
+
+		// addrs is the list of addresses returned by the resolver.
+		addrs []netip.Addr
+
+		// err is the error returned by the resolver.
+		err error
+
+		// wantErr is the expected error.
+		wantErr error
+	}{
+		{
+			name:    "resolver error",
+			err:     errLookup,
+			wantErr: errLookup,
+		},
+
+		{
+			name:    "no addresses",
+			wantErr: ErrNoCandidates,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := funcResolver(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+				return tt.addrs, tt.err
+			})
+			logger, records := newCapturingLogger()
+			fn, dialed := newResolveConnectTestFunc(resolver, nil, logger)
+
+			conn, err := fn.Call(context.Background(), "www.example.com:443")
+
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, conn)
+			assert.Empty(t, *dialed)
+			require.Len(t, *records, 3)
+			record, found := findRecord(*records, "dnsLookupDone")
+			require.True(t, found)
+			errValue, _ := findAttr(record, "err")
+			assert.ErrorIs(t, errValue.Any().(error), tt.wantErr)
+			record, found = findRecord(*records, "resolveConnectDone")
+			require.True(t, found)
+			tried, _ := findAttr(record, "connectCandidatesTried")
+			assert.Equal(t, int64(0), tried.Int64())
+		})
+	}
+}
+
+// Call fails without resolving when the address is invalid.
+func TestResolveConnectFuncInvalidAddress(t *testing.T) {
+	for _, address := range []string{"www.example.com", "www.example.com:https", "www.example.com:65536"} {
+		t.Run(address, func(t *testing.T) {
+			resolver := funcResolver(func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+				t.Fatal("should not resolve")
+				return nil, nil
+			})
+			logger, records := newCapturingLogger()
+			fn, _ := newResolveConnectTestFunc(resolver, nil, logger)
+
+			conn, err := fn.Call(context.Background(), address)
+
+			require.Error(t, err)
+			assert.Nil(t, conn)
+			assert.Empty(t, *records)
+		})
+	}
+}
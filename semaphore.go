@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/safeconn"
+)
+
+// NewSemaphoreFunc returns a new [*SemaphoreFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The sem argument is the semaphore, whose capacity is the maximum number of
+// connections allowed to proceed concurrently. Share the same channel among all
+// the pipelines that should be limited together.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSemaphoreFunc(cfg *Config, sem chan struct{}, logger SLogger) *SemaphoreFunc {
+	runtimex.Assert(cap(sem) > 0)
+	return &SemaphoreFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		Semaphore:     sem,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// SemaphoreFunc limits the number of connections proceeding concurrently.
+//
+// Call acquires a slot by sending to the semaphore channel, waiting until a
+// slot is available or the context is done, and then returns a [net.Conn]
+// wrapping the input that releases the slot when closed. Call emits a
+// semaphoreWait event whose semaphoreWaitMs field contains the time spent
+// waiting in milliseconds, which is useful to distinguish queueing delay from
+// network delay when many pipelines share a rate-limited resource.
+//
+// When the context is done before a slot is available, Call closes the
+// connection and returns the context error.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type SemaphoreFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewSemaphoreFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSemaphoreFunc] to the user-provided logger.
+	Logger SLogger
+
+	// Semaphore is the channel used as a semaphore.
+	//
+	// Set by [NewSemaphoreFunc] to the user-provided channel.
+	Semaphore chan struct{}
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSemaphoreFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &SemaphoreFunc{}
+
+// Call acquires a slot and wraps the [net.Conn] to release it on Close.
+func (op *SemaphoreFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	t0 := op.TimeNow()
+	var err error
+	select {
+	case op.Semaphore <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	t := op.TimeNow()
+	op.Logger.Info(
+		"semaphoreWait",
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Int64("semaphoreWaitMs", t.Sub(t0).Milliseconds()),
+		slog.Time("t0", t0),
+		slog.Time("t", t),
+	)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &semaphoreConn{Conn: conn, sem: op.Semaphore}, nil
+}
+
+// semaphoreConn releases a semaphore slot when closed.
+type semaphoreConn struct {
+	net.Conn
+	once sync.Once
+	sem  chan struct{}
+}
+
+// Close closes the underlying connection and releases the slot.
+func (c *semaphoreConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		<-c.sem
+	})
+	return err
+}
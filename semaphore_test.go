@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewSemaphoreFunc populates all fields from Config and the provided arguments.
+func TestNewSemaphoreFunc(t *testing.T) {
+	sem := make(chan struct{}, 1)
+
+	fn := NewSemaphoreFunc(NewConfig(), sem, DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.Equal(t, sem, fn.Semaphore)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// NewSemaphoreFunc panics with an unbuffered channel.
+func TestNewSemaphoreFuncUnbuffered(t *testing.T) {
+	assert.Panics(t, func() { NewSemaphoreFunc(NewConfig(), make(chan struct{}), DefaultSLogger()) })
+}
+
+// Call waits for a slot, records the wait, and releases the slot on Close.
+func TestSemaphoreFunc(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	logger, records := newCapturingLogger()
+	cfg := NewConfig()
+	var elapsed, calls atomic.Int64
+	cfg.TimeNow = func() time.Time {
+		calls.Add(1)
+		return time.Unix(0, elapsed.Load())
+	}
+	fn := NewSemaphoreFunc(cfg, sem, logger)
+
+	newConn := func() net.Conn {
+		conn := newMinimalConn()
+		conn.CloseFunc = func() error { return nil }
+		return conn
+	}
+
+	// The first conn acquires the only slot without waiting
+	first, err := fn.Call(context.Background(), newConn())
+	require.NoError(t, err)
+	assert.Len(t, sem, 1)
+
+	// The second conn waits for the first one to be closed. We know that
+	// the second Call has started waiting once it has read the clock.
+	result := make(chan error, 1)
+	go func() {
+		_, err := fn.Call(context.Background(), newConn())
+		result <- err
+	}()
+	require.Eventually(t, func() bool { return calls.Load() >= 3 }, time.Second, time.Millisecond)
+	select {
+	case <-result:
+		t.Fatal("expected the second Call to wait")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Advance the clock and release the slot. Closing twice releases once.
+	elapsed.Add(int64(250 * time.Millisecond))
+	require.NoError(t, first.Close())
+	require.NoError(t, first.Close())
+	require.NoError(t, <-result)
+	assert.Len(t, sem, 1)
+
+	require.Len(t, *records, 2)
+	for idx, want := range []int64{0, 250} {
+		assert.Equal(t, "semaphoreWait", (*records)[idx].Message)
+		value, found := findAttr((*records)[idx], "semaphoreWaitMs")
+		require.True(t, found)
+		assert.Equal(t, want, value.Int64())
+	}
+}
+
+// Call closes the conn and fails when the context is done while waiting.
+func TestSemaphoreFuncContextDone(t *testing.T) {
+	sem := make(chan struct{}, 1)
+	sem <- struct{}{}
+	logger, records := newCapturingLogger()
+	fn := NewSemaphoreFunc(NewConfig(), sem, logger)
+	var closed int
+	conn := newMinimalConn()
+	conn.CloseFunc = func() error {
+		closed++
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	got, err := fn.Call(ctx, conn)
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Nil(t, got)
+	assert.Equal(t, 1, closed)
+	require.Len(t, *records, 1)
+	errClass, found := findAttr((*records)[0], "errClass")
+	require.True(t, found)
+	assert.Equal(t, "ETIMEDOUT", errClass.String())
+}
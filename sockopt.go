@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// sockoptLog emits the event of a Func that logs a socket option of conn.
+//
+// The event contains the value under the event key when err is nil and
+// `<event>Unavailable` otherwise, along with the error that occurred.
+func sockoptLog(logger SLogger, classifier ErrClassifier, t time.Time,
+	event string, conn net.Conn, value any, err error) {
+	attrs := []any{
+		slog.Any("err", err),
+		slog.String("errClass", classifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t", t),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Bool(event+"Unavailable", true))
+	} else {
+		attrs = append(attrs, slog.Any(event, value))
+	}
+	logger.Info(event, attrs...)
+}
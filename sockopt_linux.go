@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+	"syscall"
+)
+
+// sockoptRead invokes read with the file descriptor of the given connection.
+//
+// Returns unavailable when the connection does not implement [syscall.Conn].
+func sockoptRead[T any](conn net.Conn, unavailable error, read func(fd int) (T, error)) (T, error) {
+	var zero T
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return zero, unavailable
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return zero, err
+	}
+	var (
+		value T
+		serr  error
+	)
+	err = rc.Control(func(fd uintptr) {
+		value, serr = read(int(fd))
+	})
+	if err != nil {
+		return zero, err
+	}
+	if serr != nil {
+		return zero, serr
+	}
+	return value, nil
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sockoptRead returns the read value or the appropriate error.
+func TestSockoptRead(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tcpConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+
+	errUnavailable := errors.New("unavailable")
+	errRead := errors.New("read failed")
+
+	cases := []struct {
+		name    string
+		conn    net.Conn
+		read    func(fd int) (int, error)
+		want    int
+		wantErr error
+	}{
+		{
+			name:    "not a syscall.Conn",
+			conn:    newMinimalConn(),
+			read:    func(fd int) (int, error) { return 1, nil },
+			wantErr: errUnavailable,
+		},
+		{
+			name:    "read error",
+			conn:    tcpConn,
+			read:    func(fd int) (int, error) { return 1, errRead },
+			wantErr: errRead,
+		},
+		{
+			name: "success",
+			conn: tcpConn,
+			read: func(fd int) (int, error) {
+				return syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TYPE)
+			},
+			want: syscall.SOCK_STREAM,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := sockoptRead(tc.conn, errUnavailable, tc.read)
+
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				assert.Zero(t, value)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sockoptLog emits either the value or the unavailable flag along with the common attributes.
+func TestSockoptLog(t *testing.T) {
+	errRead := errors.New("mocked error")
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		value any
+		err   error
+		want  any
+	}{
+		{name: "int value", value: 1460, want: int64(1460)},
+		{name: "string value", value: "cubic", want: "cubic"},
+		{name: "unavailable", value: 0, err: errRead},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+
+			sockoptLog(logger, DefaultErrClassifier, now, "sockopt", newMinimalConn(), tc.value, tc.err)
+
+			require.Len(t, *records, 1)
+			record := (*records)[0]
+			assert.Equal(t, "sockopt", record.Message)
+			for _, key := range []string{"errClass", "localAddr", "protocol", "remoteAddr"} {
+				_, found := findAttr(record, key)
+				assert.True(t, found, key)
+			}
+			tv, found := findAttr(record, "t")
+			require.True(t, found)
+			assert.Equal(t, now, tv.Time())
+			errValue, found := findAttr(record, "err")
+			require.True(t, found)
+			value, hasValue := findAttr(record, "sockopt")
+			unavailable, hasUnavailable := findAttr(record, "sockoptUnavailable")
+			if tc.err != nil {
+				assert.ErrorIs(t, errValue.Any().(error), tc.err)
+				assert.False(t, hasValue)
+				require.True(t, hasUnavailable)
+				assert.True(t, unavailable.Bool())
+				return
+			}
+			assert.Nil(t, errValue.Any())
+			assert.False(t, hasUnavailable)
+			require.True(t, hasValue)
+			assert.Equal(t, tc.want, value.Any())
+		})
+	}
+}
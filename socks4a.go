@@ -0,0 +1,244 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// SOCKS4 reply codes (see https://www.openssh.com/txt/socks4.protocol).
+const (
+	// SOCKS4ReplyGranted indicates that the request was granted.
+	SOCKS4ReplyGranted = 90
+
+	// SOCKS4ReplyRejected indicates that the request was rejected or failed.
+	SOCKS4ReplyRejected = 91
+
+	// SOCKS4ReplyIdentdUnreachable indicates that the request was rejected
+	// because the proxy cannot connect to the identd on the client.
+	SOCKS4ReplyIdentdUnreachable = 92
+
+	// SOCKS4ReplyIdentdMismatch indicates that the request was rejected
+	// because identd reported a different user ID.
+	SOCKS4ReplyIdentdMismatch = 93
+)
+
+var (
+	// ErrSOCKS4Rejected indicates that the SOCKS4 proxy did not grant the request.
+	ErrSOCKS4Rejected = errors.New("nop: SOCKS4 request rejected")
+
+	// ErrSOCKS4InvalidReply indicates that the SOCKS4 proxy sent an invalid reply.
+	ErrSOCKS4InvalidReply = errors.New("nop: invalid SOCKS4 reply")
+
+	// ErrSOCKS4UnsupportedAddress indicates that SOCKS4a cannot tunnel the address.
+	ErrSOCKS4UnsupportedAddress = errors.New("nop: unsupported SOCKS4 address")
+)
+
+// NewSOCKS4aDialer returns a new [*SOCKS4aDialer].
+//
+// The cfg argument contains the common configuration for nop operations. The
+// returned dialer uses [Config.Dialer] to connect to the proxy, so you must
+// construct it before assigning it to [Config.Dialer].
+//
+// The proxyAddr argument is the address of the proxy (e.g., "127.0.0.1:1080").
+//
+// The userID argument is the user ID to send to the proxy (possibly empty).
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSOCKS4aDialer(cfg *Config, proxyAddr, userID string, logger SLogger) *SOCKS4aDialer {
+	return &SOCKS4aDialer{
+		Dialer:        cfg.Dialer,
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		ProxyAddr:     proxyAddr,
+		TimeNow:       cfg.TimeNow,
+		UserID:        userID,
+	}
+}
+
+// SOCKS4aDialer is a [Dialer] tunneling TCP connections through a SOCKS4a proxy.
+//
+// DialContext connects to the proxy and performs the SOCKS4a CONNECT flow
+// emitting socks4ConnectStart and socks4ConnectDone events. The done event
+// includes the socks4ReplyCode field containing the proxy reply code (e.g.,
+// [SOCKS4ReplyGranted]) or -1 when the proxy did not send a valid reply.
+// When the address host is a hostname rather than an IPv4 address, the
+// dialer passes it to the proxy using the 0.0.0.x sentinel defined by
+// SOCKS4a, so that the proxy resolves it. IPv6 addresses are not supported
+// by SOCKS4.
+//
+// When the proxy rejects the request, the error wraps [ErrSOCKS4Rejected],
+// which [DefaultErrClassifier] maps to the "ESOCKS4_REJECTED" error class.
+//
+// Assign this dialer to [Config.Dialer] to have [*ConnectFunc] tunnel
+// connections through the proxy.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [DialContext].
+type SOCKS4aDialer struct {
+	// Dialer is the [Dialer] used to connect to the proxy.
+	//
+	// Set by [NewSOCKS4aDialer] from [Config.Dialer].
+	Dialer Dialer
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewSOCKS4aDialer] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSOCKS4aDialer] to the user-provided logger.
+	Logger SLogger
+
+	// ProxyAddr is the address of the proxy.
+	//
+	// Set by [NewSOCKS4aDialer] to the user-provided value.
+	ProxyAddr string
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSOCKS4aDialer] from [Config.TimeNow].
+	TimeNow func() time.Time
+
+	// UserID is the user ID sent to the proxy.
+	//
+	// Set by [NewSOCKS4aDialer] to the user-provided value.
+	UserID string
+}
+
+var _ Dialer = &SOCKS4aDialer{}
+
+// DialContext implements [Dialer].
+//
+// The network must be "tcp" or "tcp4". The context deadline, if any, limits
+// the duration of both connecting to the proxy and the CONNECT flow.
+func (d *SOCKS4aDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	t0 := d.TimeNow()
+	deadline, _ := ctx.Deadline()
+	d.logConnectStart(address, t0, deadline)
+	conn, code, err := d.connect(ctx, network, address)
+	d.logConnectDone(address, t0, deadline, conn, code, err)
+	return conn, err
+}
+
+// connect connects to the proxy and performs the CONNECT flow, returning
+// either a valid [net.Conn] or an error, never both, and the reply code.
+func (d *SOCKS4aDialer) connect(ctx context.Context, network, address string) (net.Conn, int, error) {
+	// 1. Serialize the request before connecting to fail early
+	if network != "tcp" && network != "tcp4" {
+		return nil, -1, fmt.Errorf("%w: network %s", ErrSOCKS4UnsupportedAddress, network)
+	}
+	request, err := socks4NewConnectRequest(address, d.UserID)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// 2. Connect to the proxy
+	conn, err := d.Dialer.DialContext(ctx, "tcp", d.ProxyAddr)
+	if err != nil {
+		return nil, -1, err
+	}
+
+	// 3. Use the context deadline to limit the CONNECT flow
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// 4. Send the request and read the reply
+	code, err := socks4Connect(conn, request)
+	if err != nil {
+		conn.Close()
+		return nil, code, err
+	}
+	return conn, code, nil
+}
+
+// socks4NewConnectRequest returns the SOCKS4a CONNECT request for address.
+func socks4NewConnectRequest(address, userID string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: port %s", ErrSOCKS4UnsupportedAddress, portString)
+	}
+	request := []byte{4, 1}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	addr, err := netip.ParseAddr(host)
+	isHostname := err != nil
+	switch {
+	case isHostname:
+		request = append(request, 0, 0, 0, 1) // SOCKS4a sentinel
+	case addr.Unmap().Is4():
+		request = append(request, addr.Unmap().AsSlice()...)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrSOCKS4UnsupportedAddress, host)
+	}
+	request = append(request, userID...)
+	request = append(request, 0)
+	if isHostname {
+		request = append(request, host...)
+		request = append(request, 0)
+	}
+	return request, nil
+}
+
+// socks4Connect sends the request and reads the reply, returning the reply
+// code or -1 when the proxy did not send a valid reply.
+func socks4Connect(conn net.Conn, request []byte) (int, error) {
+	if _, err := conn.Write(request); err != nil {
+		return -1, err
+	}
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return -1, err
+	}
+	if reply[0] != 0 {
+		return -1, ErrSOCKS4InvalidReply
+	}
+	code := int(reply[1])
+	if code != SOCKS4ReplyGranted {
+		return code, fmt.Errorf("%w: reply code %d", ErrSOCKS4Rejected, code)
+	}
+	return code, nil
+}
+
+func (d *SOCKS4aDialer) logConnectStart(address string, t0 time.Time, deadline time.Time) {
+	d.Logger.Info(
+		"socks4ConnectStart",
+		slog.Time("deadline", deadline),
+		slog.String("protocol", "tcp"),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.String("socks4ProxyAddr", d.ProxyAddr),
+		slog.Time("t", t0),
+	)
+}
+
+func (d *SOCKS4aDialer) logConnectDone(address string,
+	t0 time.Time, deadline time.Time, conn net.Conn, code int, err error) {
+	d.Logger.Info(
+		"socks4ConnectDone",
+		slog.Time("deadline", deadline),
+		slog.Any("err", err),
+		slog.String("errClass", d.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", "tcp"),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.String("socks4ProxyAddr", d.ProxyAddr),
+		slog.Int("socks4ReplyCode", code),
+		slog.Time("t0", t0),
+		slog.Time("t", d.TimeNow()),
+	)
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSOCKS4MockProxyDialer returns a [*netstub.FuncDialer] connecting to a
+// mock SOCKS4 proxy that reads a request of the given size, saves it into
+// request, and then sends the given reply.
+func newSOCKS4MockProxyDialer(size int, request chan<- []byte, reply []byte) *netstub.FuncDialer {
+	return &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				buffer := make([]byte, size)
+				if _, err := io.ReadFull(server, buffer); err != nil {
+					return
+				}
+				request <- buffer
+				server.Write(reply)
+			}()
+			return client, nil
+		},
+	}
+}
+
+// NewSOCKS4aDialer populates all fields from Config and the provided arguments.
+func TestNewSOCKS4aDialer(t *testing.T) {
+	d := NewSOCKS4aDialer(NewConfig(), "127.0.0.1:1080", "nop", DefaultSLogger())
+
+	require.NotNil(t, d)
+	assert.NotNil(t, d.Dialer)
+	assert.NotNil(t, d.ErrClassifier)
+	assert.NotNil(t, d.Logger)
+	assert.Equal(t, "127.0.0.1:1080", d.ProxyAddr)
+	assert.NotNil(t, d.TimeNow)
+	assert.Equal(t, "nop", d.UserID)
+}
+
+// DialContext performs the SOCKS4a CONNECT flow and logs the reply code.
+func TestSOCKS4aDialerDialContext(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// address is the address to dial.
+		address string
+
+		// wantRequest is the expected CONNECT request.
+		wantRequest []byte
+
+		// reply is the reply sent by the proxy.
+		reply []byte
+
+		// wantErr is the expected error, if any.
+		wantErr error
+	}{
+		{
+			name:    "granted with IPv4 address",
+			address: "93.184.216.34:443",
+			wantRequest: []byte{
+				4, 1, 0x01, 0xbb, 93, 184, 216, 34,
+				'n', 'o', 'p', 0,
+			},
+			reply:   []byte{0, SOCKS4ReplyGranted, 0, 0, 0, 0, 0, 0},
+			wantErr: nil,
+		},
+
+		{
+			name:    "granted with hostname",
+			address: "example.com:80",
+			wantRequest: []byte{
+				4, 1, 0x00, 0x50, 0, 0, 0, 1,
+				'n', 'o', 'p', 0,
+				'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', 0,
+			},
+			reply:   []byte{0, SOCKS4ReplyGranted, 0, 0, 0, 0, 0, 0},
+			wantErr: nil,
+		},
+
+		{
+			name:    "rejected",
+			address: "93.184.216.34:443",
+			wantRequest: []byte{
+				4, 1, 0x01, 0xbb, 93, 184, 216, 34,
+				'n', 'o', 'p', 0,
+			},
+			reply:   []byte{0, SOCKS4ReplyRejected, 0, 0, 0, 0, 0, 0},
+			wantErr: ErrSOCKS4Rejected,
+		},
+
+		{
+			name:    "invalid reply version",
+			address: "93.184.216.34:443",
+			wantRequest: []byte{
+				4, 1, 0x01, 0xbb, 93, 184, 216, 34,
+				'n', 'o', 'p', 0,
+			},
+			reply:   []byte{4, SOCKS4ReplyGranted, 0, 0, 0, 0, 0, 0},
+			wantErr: ErrSOCKS4InvalidReply,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan []byte, 1)
+			cfg := NewConfig()
+			cfg.Dialer = newSOCKS4MockProxyDialer(len(tt.wantRequest), requests, tt.reply)
+			logger, records := newCapturingLogger()
+			d := NewSOCKS4aDialer(cfg, "127.0.0.1:1080", "nop", logger)
+
+			conn, err := d.DialContext(context.Background(), "tcp", tt.address)
+
+			assert.Equal(t, tt.wantRequest, <-requests)
+			require.Len(t, *records, 2)
+			assert.Equal(t, "socks4ConnectStart", (*records)[0].Message)
+			assert.Equal(t, "socks4ConnectDone", (*records)[1].Message)
+			code, found := findAttr((*records)[1], "socks4ReplyCode")
+			require.True(t, found)
+			if errors.Is(tt.wantErr, ErrSOCKS4InvalidReply) {
+				assert.Equal(t, int64(-1), code.Int64())
+			} else {
+				assert.Equal(t, int64(tt.reply[1]), code.Int64())
+			}
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, conn)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, conn)
+			conn.Close()
+		})
+	}
+}
+
+// DialContext fails without connecting to the proxy when SOCKS4a cannot tunnel the address.
+func TestSOCKS4aDialerDialContextUnsupportedAddress(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// network is the network to dial.
+		network string
+
+		// address is the address to dial.
+		address string
+	}{
+		{name: "IPv6 address", network: "tcp", address: "[2001:db8::1]:443"},
+		{name: "UDP network", network: "udp", address: "93.184.216.34:53"},
+		{name: "invalid port", network: "tcp", address: "93.184.216.34:https"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Dialer = &netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					panic("should not be called")
+				},
+			}
+			d := NewSOCKS4aDialer(cfg, "127.0.0.1:1080", "", DefaultSLogger())
+
+			conn, err := d.DialContext(context.Background(), tt.network, tt.address)
+
+			require.ErrorIs(t, err, ErrSOCKS4UnsupportedAddress)
+			assert.Nil(t, conn)
+		})
+	}
+}
+
+// DialContext propagates errors connecting to the proxy.
+func TestSOCKS4aDialerDialContextProxyError(t *testing.T) {
+	wantErr := errors.New("connection refused")
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, wantErr
+		},
+	}
+	logger, records := newCapturingLogger()
+	d := NewSOCKS4aDialer(cfg, "127.0.0.1:1080", "", logger)
+
+	conn, err := d.DialContext(context.Background(), "tcp", "93.184.216.34:443")
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	code, found := findAttr((*records)[1], "socks4ReplyCode")
+	require.True(t, found)
+	assert.Equal(t, int64(-1), code.Int64())
+}
@@ -0,0 +1,415 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 reply codes (see RFC 1928 Section 6).
+const (
+	// SOCKS5ReplySucceeded indicates that the request succeeded.
+	SOCKS5ReplySucceeded = 0x00
+
+	// SOCKS5ReplyGeneralFailure indicates a general SOCKS server failure.
+	SOCKS5ReplyGeneralFailure = 0x01
+
+	// SOCKS5ReplyNotAllowed indicates that the ruleset does not allow the connection.
+	SOCKS5ReplyNotAllowed = 0x02
+
+	// SOCKS5ReplyNetworkUnreachable indicates that the network is unreachable.
+	SOCKS5ReplyNetworkUnreachable = 0x03
+
+	// SOCKS5ReplyHostUnreachable indicates that the host is unreachable.
+	SOCKS5ReplyHostUnreachable = 0x04
+
+	// SOCKS5ReplyConnectionRefused indicates that the host refused the connection.
+	SOCKS5ReplyConnectionRefused = 0x05
+
+	// SOCKS5ReplyTTLExpired indicates that the TTL expired.
+	SOCKS5ReplyTTLExpired = 0x06
+
+	// SOCKS5ReplyCommandNotSupported indicates that the command is not supported.
+	SOCKS5ReplyCommandNotSupported = 0x07
+
+	// SOCKS5ReplyAddressTypeNotSupported indicates that the address type is not supported.
+	SOCKS5ReplyAddressTypeNotSupported = 0x08
+)
+
+var (
+	// ErrSOCKS5AuthRejected indicates that the SOCKS5 proxy rejected the credentials.
+	ErrSOCKS5AuthRejected = errors.New("nop: SOCKS5 authentication rejected")
+
+	// ErrSOCKS5NoAcceptableAuth indicates that the SOCKS5 proxy accepts
+	// none of the authentication methods that we offered.
+	ErrSOCKS5NoAcceptableAuth = errors.New("nop: no acceptable SOCKS5 authentication method")
+
+	// ErrSOCKS5HostUnreachable indicates that the SOCKS5 proxy cannot reach the host.
+	ErrSOCKS5HostUnreachable = errors.New("nop: SOCKS5 host unreachable")
+
+	// ErrSOCKS5NetworkUnreachable indicates that the SOCKS5 proxy cannot reach the network.
+	ErrSOCKS5NetworkUnreachable = errors.New("nop: SOCKS5 network unreachable")
+
+	// ErrSOCKS5ConnectionRefused indicates that the host refused the connection from the SOCKS5 proxy.
+	ErrSOCKS5ConnectionRefused = errors.New("nop: SOCKS5 connection refused")
+
+	// ErrSOCKS5Rejected indicates that the SOCKS5 proxy did not grant the request
+	// for reasons other than the ones covered by more specific errors.
+	ErrSOCKS5Rejected = errors.New("nop: SOCKS5 request rejected")
+
+	// ErrSOCKS5InvalidReply indicates that the SOCKS5 proxy sent an invalid reply.
+	ErrSOCKS5InvalidReply = errors.New("nop: invalid SOCKS5 reply")
+
+	// ErrSOCKS5InvalidAuth indicates that the credentials cannot be encoded
+	// because the username or the password is empty or too long.
+	ErrSOCKS5InvalidAuth = errors.New("nop: invalid SOCKS5 credentials")
+
+	// ErrSOCKS5UnsupportedAddress indicates that SOCKS5 cannot tunnel the address.
+	ErrSOCKS5UnsupportedAddress = errors.New("nop: unsupported SOCKS5 address")
+)
+
+// SOCKS5 authentication methods (see RFC 1928 Section 3).
+const (
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPass     = 0x02
+	socks5MethodNoAcceptable = 0xff
+)
+
+// SOCKS5Auth contains the credentials for the username/password
+// authentication method (see RFC 1929).
+type SOCKS5Auth struct {
+	// Username is the username, which must be between 1 and 255 bytes.
+	Username string
+
+	// Password is the password, which must be between 1 and 255 bytes.
+	Password string
+}
+
+// NewSOCKS5Dialer returns a new [*SOCKS5Dialer].
+//
+// The cfg argument contains the common configuration for nop operations. The
+// returned dialer uses [Config.Dialer] to connect to the proxy, so you must
+// construct it before assigning it to [Config.Dialer].
+//
+// The proxyAddr argument is the address of the proxy (e.g., "127.0.0.1:1080").
+//
+// The auth argument contains the credentials or is nil to only offer the
+// "no authentication required" method.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSOCKS5Dialer(cfg *Config, proxyAddr string, auth *SOCKS5Auth, logger SLogger) *SOCKS5Dialer {
+	return &SOCKS5Dialer{
+		Auth:          auth,
+		Dialer:        cfg.Dialer,
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		ProxyAddr:     proxyAddr,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// SOCKS5Dialer is a [Dialer] tunneling TCP connections through a SOCKS5 proxy.
+//
+// DialContext connects to the proxy and performs the SOCKS5 handshake, which
+// consists of negotiating the authentication method, authenticating, and
+// sending the CONNECT request, emitting socksHandshakeStart and
+// socksHandshakeDone events. The done event includes socksAuthMethod, the
+// method selected by the proxy, and socksReplyCode, the proxy reply code
+// (e.g., [SOCKS5ReplySucceeded]), each of which is -1 when the handshake
+// did not reach the corresponding stage. Hostnames are passed to the proxy,
+// which resolves them.
+//
+// Failures wrap distinct errors (e.g., [ErrSOCKS5AuthRejected] and
+// [ErrSOCKS5HostUnreachable]), which [DefaultErrClassifier] maps to
+// distinct error classes (e.g., "ESOCKS5_AUTH_REJECTED").
+//
+// Assign this dialer to [Config.Dialer] to have [*ConnectFunc] tunnel
+// connections through the proxy.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [DialContext].
+type SOCKS5Dialer struct {
+	// Auth contains the optional credentials.
+	//
+	// Set by [NewSOCKS5Dialer] to the user-provided value.
+	Auth *SOCKS5Auth
+
+	// Dialer is the [Dialer] used to connect to the proxy.
+	//
+	// Set by [NewSOCKS5Dialer] from [Config.Dialer].
+	Dialer Dialer
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewSOCKS5Dialer] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSOCKS5Dialer] to the user-provided logger.
+	Logger SLogger
+
+	// ProxyAddr is the address of the proxy.
+	//
+	// Set by [NewSOCKS5Dialer] to the user-provided value.
+	ProxyAddr string
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSOCKS5Dialer] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Dialer = &SOCKS5Dialer{}
+
+// socks5Result contains the outcome of the SOCKS5 handshake for logging.
+type socks5Result struct {
+	// authMethod is the method selected by the proxy or -1.
+	authMethod int
+
+	// replyCode is the reply code or -1.
+	replyCode int
+}
+
+// DialContext implements [Dialer].
+//
+// The network must be "tcp", "tcp4", or "tcp6". The context deadline, if any,
+// limits the duration of both connecting to the proxy and the handshake.
+func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	t0 := d.TimeNow()
+	deadline, _ := ctx.Deadline()
+	d.logHandshakeStart(address, t0, deadline)
+	result := &socks5Result{authMethod: -1, replyCode: -1}
+	conn, err := d.connect(ctx, network, address, result)
+	d.logHandshakeDone(address, t0, deadline, conn, result, err)
+	return conn, err
+}
+
+// connect connects to the proxy and performs the handshake, returning
+// either a valid [net.Conn] or an error, never both.
+func (d *SOCKS5Dialer) connect(
+	ctx context.Context, network, address string, result *socks5Result) (net.Conn, error) {
+	// 1. Serialize the requests before connecting to fail early
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("%w: network %s", ErrSOCKS5UnsupportedAddress, network)
+	}
+	request, err := socks5NewConnectRequest(address)
+	if err != nil {
+		return nil, err
+	}
+	var authRequest []byte
+	if d.Auth != nil {
+		if authRequest, err = socks5NewAuthRequest(d.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Connect to the proxy
+	conn, err := d.Dialer.DialContext(ctx, "tcp", d.ProxyAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Use the context deadline to limit the handshake
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	// 4. Negotiate the method, authenticate, and send the CONNECT request
+	if err := socks5Handshake(conn, authRequest, request, result); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// socks5NewConnectRequest returns the SOCKS5 CONNECT request for address.
+func socks5NewConnectRequest(address string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: port %s", ErrSOCKS5UnsupportedAddress, portString)
+	}
+	request := []byte{5, 1, 0}
+	addr, err := netip.ParseAddr(host)
+	switch {
+	case err == nil && addr.Unmap().Is4():
+		request = append(request, 1)
+		request = append(request, addr.Unmap().AsSlice()...)
+	case err == nil && addr.Zone() == "":
+		request = append(request, 4)
+		request = append(request, addr.AsSlice()...)
+	case err == nil:
+		return nil, fmt.Errorf("%w: %s", ErrSOCKS5UnsupportedAddress, host)
+	case len(host) <= 0 || len(host) > 255:
+		return nil, fmt.Errorf("%w: %s", ErrSOCKS5UnsupportedAddress, host)
+	default:
+		request = append(request, 3, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	return request, nil
+}
+
+// socks5NewAuthRequest returns the username/password authentication request.
+func socks5NewAuthRequest(auth *SOCKS5Auth) ([]byte, error) {
+	if len(auth.Username) <= 0 || len(auth.Username) > 255 ||
+		len(auth.Password) <= 0 || len(auth.Password) > 255 {
+		return nil, ErrSOCKS5InvalidAuth
+	}
+	request := []byte{1, byte(len(auth.Username))}
+	request = append(request, auth.Username...)
+	request = append(request, byte(len(auth.Password)))
+	request = append(request, auth.Password...)
+	return request, nil
+}
+
+// socks5Handshake performs the SOCKS5 handshake, saving its outcome into result.
+func socks5Handshake(conn net.Conn, authRequest, request []byte, result *socks5Result) error {
+	// 1. Negotiate the authentication method
+	greeting := []byte{5, 1, socks5MethodNoAuth}
+	if authRequest != nil {
+		greeting = []byte{5, 2, socks5MethodNoAuth, socks5MethodUserPass}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	choice := make([]byte, 2)
+	if _, err := io.ReadFull(conn, choice); err != nil {
+		return err
+	}
+	if choice[0] != 5 {
+		return ErrSOCKS5InvalidReply
+	}
+	result.authMethod = int(choice[1])
+
+	// 2. Authenticate, if needed
+	switch {
+	case choice[1] == socks5MethodNoAcceptable:
+		return ErrSOCKS5NoAcceptableAuth
+	case choice[1] == socks5MethodUserPass && authRequest != nil:
+		if err := socks5Authenticate(conn, authRequest); err != nil {
+			return err
+		}
+	case choice[1] != socks5MethodNoAuth:
+		return fmt.Errorf("%w: unexpected method %d", ErrSOCKS5InvalidReply, choice[1])
+	}
+
+	// 3. Send the CONNECT request and read the reply
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != 5 {
+		return ErrSOCKS5InvalidReply
+	}
+	result.replyCode = int(header[1])
+	if err := socks5DiscardBoundAddr(conn, header[3]); err != nil {
+		return err
+	}
+	return socks5ReplyError(header[1])
+}
+
+// socks5Authenticate performs the username/password authentication.
+func socks5Authenticate(conn net.Conn, authRequest []byte) error {
+	if _, err := conn.Write(authRequest); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 1 {
+		return ErrSOCKS5InvalidReply
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("%w: status %d", ErrSOCKS5AuthRejected, reply[1])
+	}
+	return nil
+}
+
+// socks5DiscardBoundAddr reads and discards the bound address and port
+// that follow the reply header, whose type is atyp.
+func socks5DiscardBoundAddr(conn net.Conn, atyp byte) error {
+	var size int
+	switch atyp {
+	case 1:
+		size = net.IPv4len
+	case 4:
+		size = net.IPv6len
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		size = int(length[0])
+	default:
+		return fmt.Errorf("%w: address type %d", ErrSOCKS5InvalidReply, atyp)
+	}
+	_, err := io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+// socks5ReplyError maps the reply code to an error.
+func socks5ReplyError(code byte) error {
+	switch code {
+	case SOCKS5ReplySucceeded:
+		return nil
+	case SOCKS5ReplyNetworkUnreachable:
+		return ErrSOCKS5NetworkUnreachable
+	case SOCKS5ReplyHostUnreachable:
+		return ErrSOCKS5HostUnreachable
+	case SOCKS5ReplyConnectionRefused:
+		return ErrSOCKS5ConnectionRefused
+	default:
+		return fmt.Errorf("%w: reply code %d", ErrSOCKS5Rejected, code)
+	}
+}
+
+func (d *SOCKS5Dialer) logHandshakeStart(address string, t0 time.Time, deadline time.Time) {
+	d.Logger.Info(
+		"socksHandshakeStart",
+		slog.Time("deadline", deadline),
+		slog.String("protocol", "tcp"),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.Bool("socksAuth", d.Auth != nil),
+		slog.String("socksProxyAddr", d.ProxyAddr),
+		slog.Int("socksVersion", 5),
+		slog.Time("t", t0),
+	)
+}
+
+func (d *SOCKS5Dialer) logHandshakeDone(address string,
+	t0 time.Time, deadline time.Time, conn net.Conn, result *socks5Result, err error) {
+	d.Logger.Info(
+		"socksHandshakeDone",
+		slog.Time("deadline", deadline),
+		slog.Any("err", err),
+		slog.String("errClass", d.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", "tcp"),
+		slog.String("remoteAddr", canonicalAddr(address)),
+		slog.Int("socksAuthMethod", result.authMethod),
+		slog.String("socksProxyAddr", d.ProxyAddr),
+		slog.Int("socksReplyCode", result.replyCode),
+		slog.Int("socksVersion", 5),
+		slog.Time("t0", t0),
+		slog.Time("t", d.TimeNow()),
+	)
+}
@@ -0,0 +1,426 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socks5MockStep is a step performed by the mock SOCKS5 proxy, which reads
+// size bytes from the client and then writes reply, if not nil.
+type socks5MockStep struct {
+	size  int
+	reply []byte
+}
+
+// newSOCKS5MockProxyDialer returns a [*netstub.FuncDialer] connecting to a
+// mock SOCKS5 proxy that performs the given steps and sends the bytes read
+// at each step to requests. The proxy keeps the connection open until the
+// client closes it, so that the client can use the tunneled connection.
+func newSOCKS5MockProxyDialer(steps []socks5MockStep, requests chan<- []byte) *netstub.FuncDialer {
+	return &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				for _, step := range steps {
+					buffer := make([]byte, step.size)
+					if _, err := io.ReadFull(server, buffer); err != nil {
+						return
+					}
+					requests <- buffer
+					if step.reply != nil {
+						server.Write(step.reply)
+					}
+				}
+				io.Copy(server, server) // echo until the client closes
+			}()
+			return client, nil
+		},
+	}
+}
+
+// NewSOCKS5Dialer populates all fields from Config and the provided arguments.
+func TestNewSOCKS5Dialer(t *testing.T) {
+	auth := &SOCKS5Auth{Username: "user", Password: "pass"}
+	d := NewSOCKS5Dialer(NewConfig(), "127.0.0.1:1080", auth, DefaultSLogger())
+
+	require.NotNil(t, d)
+	assert.Same(t, auth, d.Auth)
+	assert.NotNil(t, d.Dialer)
+	assert.NotNil(t, d.ErrClassifier)
+	assert.NotNil(t, d.Logger)
+	assert.Equal(t, "127.0.0.1:1080", d.ProxyAddr)
+	assert.NotNil(t, d.TimeNow)
+}
+
+// DialContext performs the SOCKS5 handshake and logs its outcome.
+func TestSOCKS5DialerDialContext(t *testing.T) {
+	var (
+		greetingNoAuth   = []byte{5, 1, 0}
+		greetingUserPass = []byte{5, 2, 0, 2}
+		authRequest      = []byte{1, 4, 'u', 's', 'e', 'r', 4, 'p', 'a', 's', 's'}
+		connectIPv4      = []byte{5, 1, 0, 1, 93, 184, 216, 34, 0x01, 0xbb}
+		replySucceeded   = []byte{5, SOCKS5ReplySucceeded, 0, 1, 127, 0, 0, 1, 0x04, 0x38}
+	)
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// address is the address to dial.
+		address string
+
+		// auth contains the optional credentials.
+		auth *SOCKS5Auth
+
+		// steps are the steps performed by the proxy.
+		steps []socks5MockStep
+
+		// wantAuthMethod is the expected socksAuthMethod value.
+		wantAuthMethod int64
+
+		// wantReplyCode is the expected socksReplyCode value.
+		wantReplyCode int64
+
+		// wantErr is the expected error, if any.
+		wantErr error
+
+		// wantErrClass is the expected errClass value.
+		wantErrClass string
+	}{
+		{
+			name:    "succeeded with IPv4 address",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{len(connectIPv4), replySucceeded},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplySucceeded,
+		},
+
+		{
+			name:    "succeeded with IPv6 address and IPv6 bound address",
+			address: "[2001:db8::1]:80",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{4 + 16 + 2, append([]byte{5, 0, 0, 4}, make([]byte, 16+2)...)},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplySucceeded,
+		},
+
+		{
+			name:    "succeeded with hostname and domain bound address",
+			address: "example.com:80",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{5 + len("example.com") + 2, []byte{5, 0, 0, 3, 3, 'f', 'o', 'o', 0, 80}},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplySucceeded,
+		},
+
+		{
+			name:    "succeeded with username and password",
+			address: "93.184.216.34:443",
+			auth:    &SOCKS5Auth{Username: "user", Password: "pass"},
+			steps: []socks5MockStep{
+				{len(greetingUserPass), []byte{5, 2}},
+				{len(authRequest), []byte{1, 0}},
+				{len(connectIPv4), replySucceeded},
+			},
+			wantAuthMethod: 2,
+			wantReplyCode:  SOCKS5ReplySucceeded,
+		},
+
+		{
+			name:    "authentication rejected",
+			address: "93.184.216.34:443",
+			auth:    &SOCKS5Auth{Username: "user", Password: "pass"},
+			steps: []socks5MockStep{
+				{len(greetingUserPass), []byte{5, 2}},
+				{len(authRequest), []byte{1, 1}},
+			},
+			wantAuthMethod: 2,
+			wantReplyCode:  -1,
+			wantErr:        ErrSOCKS5AuthRejected,
+			wantErrClass:   "ESOCKS5_AUTH_REJECTED",
+		},
+
+		{
+			name:    "no acceptable authentication method",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0xff}},
+			},
+			wantAuthMethod: 0xff,
+			wantReplyCode:  -1,
+			wantErr:        ErrSOCKS5NoAcceptableAuth,
+			wantErrClass:   "ESOCKS5_NO_ACCEPTABLE_AUTH",
+		},
+
+		{
+			name:    "username and password required without credentials",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 2}},
+			},
+			wantAuthMethod: 2,
+			wantReplyCode:  -1,
+			wantErr:        ErrSOCKS5InvalidReply,
+			wantErrClass:   "EGENERIC",
+		},
+
+		{
+			name:    "host unreachable",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{len(connectIPv4), []byte{5, SOCKS5ReplyHostUnreachable, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplyHostUnreachable,
+			wantErr:        ErrSOCKS5HostUnreachable,
+			wantErrClass:   "ESOCKS5_HOST_UNREACHABLE",
+		},
+
+		{
+			name:    "connection refused",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{len(connectIPv4), []byte{5, SOCKS5ReplyConnectionRefused, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplyConnectionRefused,
+			wantErr:        ErrSOCKS5ConnectionRefused,
+			wantErrClass:   "ESOCKS5_CONNECTION_REFUSED",
+		},
+
+		{
+			name:    "not allowed",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{len(connectIPv4), []byte{5, SOCKS5ReplyNotAllowed, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplyNotAllowed,
+			wantErr:        ErrSOCKS5Rejected,
+			wantErrClass:   "ESOCKS5_REJECTED",
+		},
+
+		{
+			name:    "invalid reply version",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{4, 0}},
+			},
+			wantAuthMethod: -1,
+			wantReplyCode:  -1,
+			wantErr:        ErrSOCKS5InvalidReply,
+			wantErrClass:   "EGENERIC",
+		},
+
+		{
+			name:    "invalid bound address type",
+			address: "93.184.216.34:443",
+			steps: []socks5MockStep{
+				{len(greetingNoAuth), []byte{5, 0}},
+				{len(connectIPv4), []byte{5, SOCKS5ReplySucceeded, 0, 9}},
+			},
+			wantAuthMethod: 0,
+			wantReplyCode:  SOCKS5ReplySucceeded,
+			wantErr:        ErrSOCKS5InvalidReply,
+			wantErrClass:   "EGENERIC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := make(chan []byte, len(tt.steps))
+			cfg := NewConfig()
+			cfg.Dialer = newSOCKS5MockProxyDialer(tt.steps, requests)
+			logger, records := newCapturingLogger()
+			d := NewSOCKS5Dialer(cfg, "127.0.0.1:1080", tt.auth, logger)
+
+			conn, err := d.DialContext(context.Background(), "tcp", tt.address)
+
+			require.Len(t, *records, 2)
+			assert.Equal(t, "socksHandshakeStart", (*records)[0].Message)
+			assert.Equal(t, "socksHandshakeDone", (*records)[1].Message)
+			method, found := findAttr((*records)[1], "socksAuthMethod")
+			require.True(t, found)
+			assert.Equal(t, tt.wantAuthMethod, method.Int64())
+			code, found := findAttr((*records)[1], "socksReplyCode")
+			require.True(t, found)
+			assert.Equal(t, tt.wantReplyCode, code.Int64())
+			errClass, found := findAttr((*records)[1], "errClass")
+			require.True(t, found)
+			assert.Equal(t, tt.wantErrClass, errClass.String())
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, conn)
+				return
+			}
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// Make sure the client sent the expected requests
+			if tt.auth == nil {
+				assert.Equal(t, greetingNoAuth, <-requests)
+			} else {
+				assert.Equal(t, greetingUserPass, <-requests)
+				assert.Equal(t, authRequest, <-requests)
+			}
+			connectRequest := <-requests
+			assert.Equal(t, []byte{5, 1, 0}, connectRequest[:3])
+
+			// Make sure the tunneled connection works
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			buffer := make([]byte, 4)
+			_, err = io.ReadFull(conn, buffer)
+			require.NoError(t, err)
+			assert.Equal(t, "ping", string(buffer))
+		})
+	}
+}
+
+// socks5NewConnectRequest encodes IPv4, IPv6, and hostname addresses.
+func TestSOCKS5NewConnectRequest(t *testing.T) {
+	request, err := socks5NewConnectRequest("[::ffff:10.0.0.1]:53")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{5, 1, 0, 1, 10, 0, 0, 1, 0, 53}, request)
+
+	request, err = socks5NewConnectRequest("[2001:db8::1]:53")
+	require.NoError(t, err)
+	want := append([]byte{5, 1, 0, 4}, netip.MustParseAddr("2001:db8::1").AsSlice()...)
+	assert.Equal(t, append(want, 0, 53), request)
+
+	request, err = socks5NewConnectRequest("foo.example:53")
+	require.NoError(t, err)
+	want = append([]byte{5, 1, 0, 3, 11}, "foo.example"...)
+	assert.Equal(t, append(want, 0, 53), request)
+}
+
+// DialContext fails before connecting to the proxy when it cannot encode the requests.
+func TestSOCKS5DialerDialContextUnsupportedAddress(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// network is the network to dial.
+		network string
+
+		// address is the address to dial.
+		address string
+
+		// auth contains the optional credentials.
+		auth *SOCKS5Auth
+
+		// wantErr is the expected error.
+		wantErr error
+	}{
+		{name: "UDP network", network: "udp", address: "93.184.216.34:53", wantErr: ErrSOCKS5UnsupportedAddress},
+		{name: "IPv6 zone", network: "tcp", address: "[fe80::1%eth0]:443", wantErr: ErrSOCKS5UnsupportedAddress},
+		{name: "invalid port", network: "tcp", address: "example.com:https", wantErr: ErrSOCKS5UnsupportedAddress},
+		{name: "empty password", network: "tcp", address: "example.com:443",
+			auth: &SOCKS5Auth{Username: "user"}, wantErr: ErrSOCKS5InvalidAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig()
+			cfg.Dialer = &netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					panic("should not be called")
+				},
+			}
+			d := NewSOCKS5Dialer(cfg, "127.0.0.1:1080", tt.auth, DefaultSLogger())
+
+			conn, err := d.DialContext(context.Background(), tt.network, tt.address)
+
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, conn)
+		})
+	}
+}
+
+// DialContext returns the error occurred when connecting to the proxy.
+func TestSOCKS5DialerDialContextProxyError(t *testing.T) {
+	wantErr := errors.New("connection refused")
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			assert.Equal(t, "tcp", network)
+			assert.Equal(t, "127.0.0.1:1080", address)
+			return nil, wantErr
+		},
+	}
+	logger, records := newCapturingLogger()
+	d := NewSOCKS5Dialer(cfg, "127.0.0.1:1080", nil, logger)
+
+	conn, err := d.DialContext(context.Background(), "tcp", "93.184.216.34:443")
+
+	require.ErrorIs(t, err, wantErr)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	method, _ := findAttr((*records)[1], "socksAuthMethod")
+	assert.Equal(t, int64(-1), method.Int64())
+}
+
+// DialContext honors the context deadline during the handshake.
+func TestSOCKS5DialerDialContextDeadline(t *testing.T) {
+	requests := make(chan []byte, 1)
+	cfg := NewConfig()
+	cfg.Dialer = newSOCKS5MockProxyDialer([]socks5MockStep{{size: 3}}, requests) // never replies
+	logger, records := newCapturingLogger()
+	d := NewSOCKS5Dialer(cfg, "127.0.0.1:1080", nil, logger)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", "93.184.216.34:443")
+
+	require.Error(t, err)
+	assert.Nil(t, conn)
+	require.Len(t, *records, 2)
+	errClass, _ := findAttr((*records)[1], "errClass")
+	assert.Equal(t, "ETIMEDOUT", errClass.String())
+}
+
+// ConnectFunc tunnels connections through the SOCKS5 proxy when
+// the SOCKS5Dialer is assigned to Config.Dialer.
+func TestSOCKS5DialerWithConnectFunc(t *testing.T) {
+	requests := make(chan []byte, 2)
+	cfg := NewConfig()
+	cfg.Dialer = newSOCKS5MockProxyDialer([]socks5MockStep{
+		{3, []byte{5, 0}},
+		{10, []byte{5, SOCKS5ReplySucceeded, 0, 1, 0, 0, 0, 0, 0, 0}},
+	}, requests)
+	logger, records := newCapturingLogger()
+	cfg.Dialer = NewSOCKS5Dialer(cfg, "127.0.0.1:1080", nil, logger)
+
+	conn, err := NewConnectFunc(cfg, "tcp", logger).Call(
+		context.Background(), netip.MustParseAddrPort("93.184.216.34:443"))
+
+	require.NoError(t, err)
+	defer conn.Close()
+	var messages []string
+	for _, record := range *records {
+		messages = append(messages, record.Message)
+	}
+	assert.Equal(t, []string{"connectStart", "socksHandshakeStart", "socksHandshakeDone", "connectDone"}, messages)
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ConnectionSummary accumulates the outcome of the phases of a connection.
+//
+// Attach a summary to the context using [ContextWithConnectionSummary]. Then,
+// [*ConnectFunc], [*TLSHandshakeFunc], and [*HTTPConn] record the outcome of
+// the connect, TLS handshake, and HTTP round trip phases into it. Use a
+// [*SummaryFunc] as the last stage of the pipeline to emit the summary.
+//
+// A summary is safe for concurrent use. Use a distinct summary for each
+// connection, otherwise the phases of distinct connections would be mixed.
+//
+// Construct using [NewConnectionSummary].
+type ConnectionSummary struct {
+	connectDuration time.Duration
+	errClass        string
+	httpStatusCode  int
+	localAddr       string
+	mu              sync.Mutex
+	protocol        string
+	remoteAddr      string
+	tlsCipherSuite  string
+	tlsVersion      string
+}
+
+// NewConnectionSummary returns a new empty [*ConnectionSummary].
+func NewConnectionSummary() *ConnectionSummary {
+	return &ConnectionSummary{}
+}
+
+type connectionSummaryKey struct{}
+
+// ContextWithConnectionSummary returns a copy of ctx carrying the given summary.
+func ContextWithConnectionSummary(ctx context.Context, summary *ConnectionSummary) context.Context {
+	return context.WithValue(ctx, connectionSummaryKey{}, summary)
+}
+
+// ConnectionSummaryFromContext returns the summary attached to ctx by
+// [ContextWithConnectionSummary] or nil when there is no summary.
+func ConnectionSummaryFromContext(ctx context.Context) *ConnectionSummary {
+	summary, _ := ctx.Value(connectionSummaryKey{}).(*ConnectionSummary)
+	return summary
+}
+
+// recordConnect records the outcome of the connect phase.
+func (s *ConnectionSummary) recordConnect(
+	laddr, protocol, raddr string, duration time.Duration, errClass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectDuration = duration
+	s.errClass = errClass
+	s.localAddr = laddr
+	s.protocol = protocol
+	s.remoteAddr = raddr
+}
+
+// recordTLSHandshake records the outcome of the TLS handshake phase.
+func (s *ConnectionSummary) recordTLSHandshake(version, cipherSuite, errClass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errClass = errClass
+	s.tlsCipherSuite = cipherSuite
+	s.tlsVersion = version
+}
+
+// recordHTTPRoundTrip records the outcome of the HTTP round trip phase.
+func (s *ConnectionSummary) recordHTTPRoundTrip(statusCode int, errClass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errClass = errClass
+	s.httpStatusCode = statusCode
+}
+
+// attrs returns the attributes of the connectionSummary event.
+func (s *ConnectionSummary) attrs() []any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return []any{
+		slog.Int64("connectDurationMs", s.connectDuration.Milliseconds()),
+		slog.String("errClass", s.errClass),
+		slog.Int("httpResponseStatusCode", s.httpStatusCode),
+		slog.String("localAddr", s.localAddr),
+		slog.String("protocol", s.protocol),
+		slog.String("remoteAddr", s.remoteAddr),
+		slog.String("tlsCipherSuite", s.tlsCipherSuite),
+		slog.String("tlsVersion", s.tlsVersion),
+	}
+}
+
+// NewSummaryFunc returns a new [*SummaryFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSummaryFunc[T any](cfg *Config, logger SLogger) *SummaryFunc[T] {
+	return &SummaryFunc[T]{
+		Logger:  logger,
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// SummaryFunc emits the [*ConnectionSummary] attached to the context as a
+// single connectionSummary event and returns its input unchanged.
+//
+// The event contains the connect duration in milliseconds, the negotiated
+// TLS version and cipher suite, the HTTP status code, and the errClass of
+// the last recorded phase. Phases that did not run are reported using zero
+// values. When the context does not carry a summary, this Func does not
+// emit any event.
+//
+// Place this Func last in the pipeline. Because a composed pipeline stops
+// at the first error, the summary is only emitted when all the previous
+// stages succeed. Use [Summarize] to wrap the pipeline instead when you
+// also need the summary on failure. To summarize the HTTP round trip, perform
+// the round trip inside the pipeline (e.g., using a [FuncAdapter]).
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type SummaryFunc[T any] struct {
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSummaryFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSummaryFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+// Call implements [Func].
+func (op *SummaryFunc[T]) Call(ctx context.Context, input T) (T, error) {
+	op.emit(ctx)
+	return input, nil
+}
+
+// emit emits the connectionSummary event, if the context carries a summary.
+func (op *SummaryFunc[T]) emit(ctx context.Context) {
+	if summary := ConnectionSummaryFromContext(ctx); summary != nil {
+		attrs := append(summary.attrs(), slog.Time("t", op.TimeNow()))
+		op.Logger.Info("connectionSummary", attrs...)
+	}
+}
+
+// Summarize wraps a [Func] such that each call emits the [*ConnectionSummary]
+// attached to the context as a connectionSummary event after fn returns,
+// regardless of whether fn succeeded or failed.
+//
+// Unlike placing a [*SummaryFunc] last in a pipeline, this also emits the
+// summary when a stage fails, in which case the errClass field contains the
+// class of the error of the failed phase. Like [*SummaryFunc], the wrapper
+// does not emit any event when the context does not carry a summary.
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func Summarize[A, B any](fn Func[A, B], cfg *Config, logger SLogger) Func[A, B] {
+	return &summarizeFunc[A, B]{fn, NewSummaryFunc[B](cfg, logger)}
+}
+
+type summarizeFunc[A, B any] struct {
+	fn      Func[A, B]
+	summary *SummaryFunc[B]
+}
+
+func (s *summarizeFunc[A, B]) Call(ctx context.Context, input A) (B, error) {
+	res, err := s.fn.Call(ctx, input)
+	s.summary.emit(ctx)
+	return res, err
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// ConnectionSummaryFromContext returns nil without a summary.
+func TestConnectionSummaryFromContext(t *testing.T) {
+	assert.Nil(t, ConnectionSummaryFromContext(context.Background()))
+
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+	assert.Same(t, summary, ConnectionSummaryFromContext(ctx))
+}
+
+// SummaryFunc emits a connectionSummary event aggregating all the phases.
+func TestSummaryFunc(t *testing.T) {
+	// Use a clock advancing one second on each call
+	var now time.Time
+	cfg := NewConfig()
+	cfg.TimeNow = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn := newMinimalConn()
+			conn.CloseFunc = func() error { return nil }
+			return conn, nil
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	tlsFunc := NewTLSHandshakeFunc(cfg, &tls.Config{ServerName: "example.com"}, logger)
+	tlsFunc.Engine = newMockTLSEngine(&tlsstub.FuncTLSConn{
+		FuncConn: newMinimalConn(),
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{
+				CipherSuite: tls.TLS_AES_128_GCM_SHA256,
+				Version:     tls.VersionTLS13,
+			}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	})
+
+	roundTrip := FuncAdapter[*HTTPConn, *http.Response](func(ctx context.Context, hc *HTTPConn) (*http.Response, error) {
+		hc.txp = funcRoundTripper(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 204,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		})
+		req, err := http.NewRequestWithContext(ctx, "GET", "https://example.com/", nil)
+		if err != nil {
+			return nil, err
+		}
+		return hc.RoundTrip(req)
+	})
+
+	pipeline := Compose5(
+		NewConnectFunc(cfg, "tcp", logger),
+		tlsFunc,
+		NewHTTPConnFuncTLS(cfg, logger),
+		roundTrip,
+		NewSummaryFunc[*http.Response](cfg, logger),
+	)
+
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+	resp, err := pipeline.Call(ctx, netip.MustParseAddrPort("93.184.216.34:443"))
+
+	require.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+
+	record := (*records)[len(*records)-1]
+	assert.Equal(t, "connectionSummary", record.Message)
+	wantAttrs := map[string]any{
+		"connectDurationMs":      int64(1000),
+		"errClass":               "",
+		"httpResponseStatusCode": int64(204),
+		"protocol":               "tcp",
+		"remoteAddr":             "93.184.216.34:443",
+		"tlsCipherSuite":         "TLS_AES_128_GCM_SHA256",
+		"tlsVersion":             "TLS 1.3",
+	}
+	for key, want := range wantAttrs {
+		value, found := findAttr(record, key)
+		require.True(t, found, key)
+		assert.Equal(t, want, value.Any(), key)
+	}
+}
+
+// ConnectFunc records the errClass of a failed connect.
+func TestConnectionSummaryRecordsConnectError(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ErrClassifier = ErrClassifierFunc(func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return "ECONNREFUSED"
+	})
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+	_, err := NewConnectFunc(cfg, "tcp", DefaultSLogger()).Call(ctx, netip.MustParseAddrPort("127.0.0.1:443"))
+	require.Error(t, err)
+
+	record := slog.NewRecord(time.Now(), slog.LevelInfo, "connectionSummary", 0)
+	record.Add(summary.attrs()...)
+	errClass, found := findAttr(record, "errClass")
+	require.True(t, found)
+	assert.Equal(t, "ECONNREFUSED", errClass.String())
+}
+
+// SummaryFunc does not emit any event without a summary in the context.
+func TestSummaryFuncWithoutSummary(t *testing.T) {
+	logger, records := newCapturingLogger()
+
+	got, err := NewSummaryFunc[int](NewConfig(), logger).Call(context.Background(), 42)
+
+	require.NoError(t, err)
+	assert.Equal(t, 42, got)
+	assert.Empty(t, *records)
+}
+
+// Summarize emits the summary even when a stage fails.
+func TestSummarizeOnFailure(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ErrClassifier = ErrClassifierFunc(func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return "EHANDSHAKE"
+	})
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			conn := newMinimalConn()
+			conn.CloseFunc = func() error { return nil }
+			return conn, nil
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	errHandshake := errors.New("handshake failed")
+	tconn := newMinimalConn()
+	tconn.CloseFunc = func() error { return nil }
+	tlsFunc := NewTLSHandshakeFunc(cfg, &tls.Config{ServerName: "example.com"}, logger)
+	tlsFunc.Engine = newMockTLSEngine(&tlsstub.FuncTLSConn{
+		FuncConn: tconn,
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return errHandshake
+		},
+	})
+
+	pipeline := Summarize(Compose2(NewConnectFunc(cfg, "tcp", logger), tlsFunc), cfg, logger)
+
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+	conn, err := pipeline.Call(ctx, netip.MustParseAddrPort("93.184.216.34:443"))
+
+	require.ErrorIs(t, err, errHandshake)
+	assert.Nil(t, conn)
+	record := (*records)[len(*records)-1]
+	assert.Equal(t, "connectionSummary", record.Message)
+	errClass, found := findAttr(record, "errClass")
+	require.True(t, found)
+	assert.Equal(t, "EHANDSHAKE", errClass.String())
+	remoteAddr, _ := findAttr(record, "remoteAddr")
+	assert.Equal(t, "93.184.216.34:443", remoteAddr.String())
+}
+
+// Summarize emits the summary and returns the result on success.
+func TestSummarizeOnSuccess(t *testing.T) {
+	logger, records := newCapturingLogger()
+	fn := Summarize[Unit, int](ConstFunc(42), NewConfig(), logger)
+
+	summary := NewConnectionSummary()
+	ctx := ContextWithConnectionSummary(context.Background(), summary)
+	got, err := fn.Call(ctx, Unit{})
+
+	require.NoError(t, err)
+	assert.Equal(t, 42, got)
+	require.Len(t, *records, 1)
+	assert.Equal(t, "connectionSummary", (*records)[0].Message)
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// NewSyscallCounterFunc returns a new [*SyscallCounterFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSyscallCounterFunc(cfg *Config, logger SLogger) *SyscallCounterFunc {
+	return &SyscallCounterFunc{
+		Logger:  logger,
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// SyscallCounterFunc wraps a [net.Conn] to count the I/O calls made on it.
+//
+// The returned [net.Conn] is a [*SyscallCounterConn] counting the Read, Write,
+// and deadline-setting calls. Use [*SyscallCounterConn.Counts] to read the
+// counters. When the connection is closed, the counters are also logged as
+// a syscallCounts event. This is useful to audit downstream code for
+// pathological I/O patterns (e.g., many tiny reads or writes).
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type SyscallCounterFunc struct {
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSyscallCounterFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSyscallCounterFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &SyscallCounterFunc{}
+
+// Call wraps the given [net.Conn] into a [*SyscallCounterConn].
+func (op *SyscallCounterFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &SyscallCounterConn{Conn: conn, op: op}, nil
+}
+
+// SyscallCounts contains the counters collected by [*SyscallCounterConn].
+type SyscallCounts struct {
+	// ReadCalls is the number of Read calls.
+	ReadCalls int64
+
+	// WriteCalls is the number of Write calls.
+	WriteCalls int64
+
+	// DeadlineCalls is the number of SetDeadline, SetReadDeadline,
+	// and SetWriteDeadline calls.
+	DeadlineCalls int64
+}
+
+// SyscallCounterConn is the [net.Conn] returned by [*SyscallCounterFunc].
+//
+// It is safe to use concurrently, like any [net.Conn].
+type SyscallCounterConn struct {
+	net.Conn
+	closeonce     sync.Once
+	deadlineCalls atomic.Int64
+	op            *SyscallCounterFunc
+	readCalls     atomic.Int64
+	writeCalls    atomic.Int64
+}
+
+// Counts returns a snapshot of the counters.
+func (c *SyscallCounterConn) Counts() SyscallCounts {
+	return SyscallCounts{
+		ReadCalls:     c.readCalls.Load(),
+		WriteCalls:    c.writeCalls.Load(),
+		DeadlineCalls: c.deadlineCalls.Load(),
+	}
+}
+
+// Close implements [net.Conn].
+//
+// The first call logs the counters as a syscallCounts event.
+func (c *SyscallCounterConn) Close() error {
+	c.closeonce.Do(func() {
+		counts := c.Counts()
+		c.op.Logger.Info(
+			"syscallCounts",
+			slog.Int64("deadlineCalls", counts.DeadlineCalls),
+			slog.String("localAddr", connLocalAddr(c.Conn)),
+			slog.String("protocol", safeconn.Network(c.Conn)),
+			slog.Int64("readCalls", counts.ReadCalls),
+			slog.String("remoteAddr", connRemoteAddr(c.Conn)),
+			slog.Time("t", c.op.TimeNow()),
+			slog.Int64("writeCalls", counts.WriteCalls),
+		)
+	})
+	return c.Conn.Close()
+}
+
+// Read implements [net.Conn].
+func (c *SyscallCounterConn) Read(buf []byte) (int, error) {
+	c.readCalls.Add(1)
+	return c.Conn.Read(buf)
+}
+
+// SetDeadline implements [net.Conn].
+func (c *SyscallCounterConn) SetDeadline(t time.Time) error {
+	c.deadlineCalls.Add(1)
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline implements [net.Conn].
+func (c *SyscallCounterConn) SetReadDeadline(t time.Time) error {
+	c.deadlineCalls.Add(1)
+	return c.Conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline implements [net.Conn].
+func (c *SyscallCounterConn) SetWriteDeadline(t time.Time) error {
+	c.deadlineCalls.Add(1)
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// Write implements [net.Conn].
+func (c *SyscallCounterConn) Write(data []byte) (int, error) {
+	c.writeCalls.Add(1)
+	return c.Conn.Write(data)
+}
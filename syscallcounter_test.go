@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewSyscallCounterFunc populates all fields from Config and the provided logger.
+func TestNewSyscallCounterFunc(t *testing.T) {
+	fn := NewSyscallCounterFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// The wrapped conn counts I/O calls and logs the counters on Close.
+func TestSyscallCounterFunc(t *testing.T) {
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) { return 1, nil }
+	mockConn.WriteFunc = func(b []byte) (int, error) { return len(b), nil }
+	mockConn.SetDeadlineFunc = func(t time.Time) error { return nil }
+	mockConn.SetReadDeadFunc = func(t time.Time) error { return nil }
+	mockConn.SetWriteDeaFunc = func(t time.Time) error { return nil }
+	mockConn.CloseFunc = func() error { return nil }
+
+	logger, records := newCapturingLogger()
+	fn := NewSyscallCounterFunc(NewConfig(), logger)
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	counter, ok := conn.(*SyscallCounterConn)
+	require.True(t, ok)
+
+	// Scripted sequence: many tiny reads, a couple of writes, and deadlines
+	buf := make([]byte, 16)
+	for range 5 {
+		_, _ = conn.Read(buf)
+	}
+	_, _ = conn.Write([]byte("a"))
+	_, _ = conn.Write([]byte("b"))
+	_ = conn.SetDeadline(time.Now())
+	_ = conn.SetReadDeadline(time.Now())
+	_ = conn.SetWriteDeadline(time.Now())
+
+	assert.Equal(t, SyscallCounts{ReadCalls: 5, WriteCalls: 2, DeadlineCalls: 3}, counter.Counts())
+	require.Empty(t, *records)
+
+	// Close logs the counters exactly once
+	require.NoError(t, conn.Close())
+	require.NoError(t, conn.Close())
+	require.Len(t, *records, 1)
+	assert.Equal(t, "syscallCounts", (*records)[0].Message)
+	for key, want := range map[string]int64{"readCalls": 5, "writeCalls": 2, "deadlineCalls": 3} {
+		value, found := findAttr((*records)[0], key)
+		require.True(t, found, key)
+		assert.Equal(t, want, value.Int64(), key)
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// errTCPCongestionControlUnavailable indicates that we cannot read the congestion control algorithm.
+var errTCPCongestionControlUnavailable = errors.New("tcp congestion control unavailable")
+
+// NewCongestionControlFunc returns a new [*CongestionControlFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewCongestionControlFunc(cfg *Config, logger SLogger) *CongestionControlFunc {
+	return &CongestionControlFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// CongestionControlFunc logs the congestion control algorithm of a TCP connection.
+//
+// Place this Func after [ConnectFunc] to emit a tcpCongestionControl event. On
+// Linux, the tcpCongestionControl field contains the name of the algorithm (e.g.,
+// "cubic" or "bbr") read using the TCP_CONGESTION socket option, which helps to
+// explain throughput differences between vantage points. When the algorithm
+// cannot be read (e.g., on other systems or for connections not implementing
+// [syscall.Conn]), the event includes tcpCongestionControlUnavailable instead,
+// along with the error that occurred. The connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type CongestionControlFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewCongestionControlFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewCongestionControlFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewCongestionControlFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &CongestionControlFunc{}
+
+// Call logs the congestion control algorithm of the given [net.Conn] and returns it.
+func (op *CongestionControlFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	algorithm, err := tcpReadCongestionControl(conn)
+	sockoptLog(op.Logger, op.ErrClassifier, op.TimeNow(), "tcpCongestionControl", conn, algorithm, err)
+	return conn, nil
+}
@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpReadCongestionControl reads TCP_CONGESTION from the given connection.
+//
+// Returns [errTCPCongestionControlUnavailable] when the connection does
+// not implement [syscall.Conn].
+func tcpReadCongestionControl(conn net.Conn) (string, error) {
+	return sockoptRead(conn, errTCPCongestionControlUnavailable, func(fd int) (string, error) {
+		return unix.GetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+	})
+}
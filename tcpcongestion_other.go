@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package nop
+
+import "net"
+
+// tcpReadCongestionControl always returns [errTCPCongestionControlUnavailable] on this platform.
+func tcpReadCongestionControl(conn net.Conn) (string, error) {
+	return "", errTCPCongestionControlUnavailable
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// errTCPFastOpenUnavailable indicates that we cannot read whether TCP Fast Open was used.
+var errTCPFastOpenUnavailable = errors.New("tcp fast open info unavailable")
+
+// NewTCPFastOpenFunc returns a new [*TCPFastOpenFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewTCPFastOpenFunc(cfg *Config, logger SLogger) *TCPFastOpenFunc {
+	return &TCPFastOpenFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// TCPFastOpenFunc wraps a TCP [net.Conn] to log whether TCP Fast Open saved
+// a round trip, i.e., whether the peer acknowledged data sent in the SYN.
+//
+// With TCP Fast Open enabled on the socket (e.g., using TCP_FASTOPEN_CONNECT
+// via [net.Dialer.Control]), the kernel defers the SYN until the first write,
+// such that connecting completes before the handshake. Therefore, the wrapper
+// inspects the socket when the first Read returns data, at which point the
+// handshake has completed, and emits a tcpFastOpen event. On Linux, the
+// tcpFastOpenUsed field is read from the TCP_INFO socket option. When the
+// information cannot be read (e.g., on other systems or for connections not
+// implementing [syscall.Conn]), the event includes tcpFastOpenUnavailable
+// instead, along with the error that occurred. Subsequent reads do not emit
+// events. Place this Func immediately after [ConnectFunc].
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type TCPFastOpenFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewTCPFastOpenFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewTCPFastOpenFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewTCPFastOpenFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &TCPFastOpenFunc{}
+
+// Call wraps the given [net.Conn] to log whether TCP Fast Open was used.
+func (op *TCPFastOpenFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &tcpFastOpenConn{Conn: conn, op: op}, nil
+}
+
+// tcpFastOpenConn logs whether TCP Fast Open was used on the first Read.
+type tcpFastOpenConn struct {
+	net.Conn
+	once sync.Once
+	op   *TCPFastOpenFunc
+}
+
+// Read implements [net.Conn].
+func (c *tcpFastOpenConn) Read(b []byte) (int, error) {
+	count, err := c.Conn.Read(b)
+	if count > 0 {
+		c.once.Do(c.logFastOpen)
+	}
+	return count, err
+}
+
+func (c *tcpFastOpenConn) logFastOpen() {
+	used, err := tcpReadFastOpenUsed(c.Conn)
+	attrs := []any{
+		slog.Any("err", err),
+		slog.String("errClass", c.op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(c.Conn)),
+		slog.String("protocol", safeconn.Network(c.Conn)),
+		slog.String("remoteAddr", connRemoteAddr(c.Conn)),
+		slog.Time("t", c.op.TimeNow()),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Bool("tcpFastOpenUnavailable", true))
+	} else {
+		attrs = append(attrs, slog.Bool("tcpFastOpenUsed", used))
+	}
+	c.op.Logger.Info("tcpFastOpen", attrs...)
+}
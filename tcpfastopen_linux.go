@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpiOptSynData is the TCPI_OPT_SYN_DATA flag of the tcpi_options field
+// of TCP_INFO, set when the peer acknowledged the data sent in the SYN.
+const tcpiOptSynData = 0x20
+
+// tcpReadFastOpenUsed reads whether data sent in the SYN was acknowledged from TCP_INFO.
+//
+// Returns [errTCPFastOpenUnavailable] when the connection does
+// not implement [syscall.Conn].
+func tcpReadFastOpenUsed(conn net.Conn) (bool, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false, errTCPFastOpenUnavailable
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+	var (
+		info *unix.TCPInfo
+		serr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		info, serr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return false, err
+	}
+	if serr != nil {
+		return false, serr
+	}
+	return info.Options&tcpiOptSynData != 0, nil
+}
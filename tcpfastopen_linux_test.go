@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The first Read returning data logs tcpFastOpenUsed=false for a loopback
+// TCP connection not using TCP Fast Open.
+func TestTCPFastOpenFuncSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte("hello"))
+	}()
+
+	tcpConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+
+	logger, records := newCapturingLogger()
+	conn, err := NewTCPFastOpenFunc(NewConfig(), logger).Call(context.Background(), tcpConn)
+	require.NoError(t, err)
+	buffer := make([]byte, 16)
+	_, err = conn.Read(buffer)
+	require.NoError(t, err)
+
+	require.Len(t, *records, 1)
+	used, found := findAttr((*records)[0], "tcpFastOpenUsed")
+	require.True(t, found)
+	assert.False(t, used.Bool())
+	_, found = findAttr((*records)[0], "tcpFastOpenUnavailable")
+	assert.False(t, found)
+}
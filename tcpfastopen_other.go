@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package nop
+
+import "net"
+
+// tcpReadFastOpenUsed always returns [errTCPFastOpenUnavailable] on this platform.
+func tcpReadFastOpenUsed(conn net.Conn) (bool, error) {
+	return false, errTCPFastOpenUnavailable
+}
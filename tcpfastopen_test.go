@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewTCPFastOpenFunc populates all fields from Config and the provided logger.
+func TestNewTCPFastOpenFunc(t *testing.T) {
+	fn := NewTCPFastOpenFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// The first Read returning data logs tcpFastOpenUnavailable once when the information cannot be read.
+func TestTCPFastOpenFuncUnavailable(t *testing.T) {
+	reads := []int{0, 4, 8}
+	mockConn := newMinimalConn()
+	mockConn.ReadFunc = func(b []byte) (int, error) {
+		count := reads[0]
+		reads = reads[1:]
+		if count <= 0 {
+			return 0, errors.New("temporary error")
+		}
+		return count, nil
+	}
+	logger, records := newCapturingLogger()
+
+	conn, err := NewTCPFastOpenFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+	require.NoError(t, err)
+
+	buffer := make([]byte, 16)
+	_, err = conn.Read(buffer)
+	require.Error(t, err)
+	assert.Empty(t, *records)
+	for range 2 {
+		_, err = conn.Read(buffer)
+		require.NoError(t, err)
+	}
+
+	require.Len(t, *records, 1)
+	assert.Equal(t, "tcpFastOpen", (*records)[0].Message)
+	unavailable, found := findAttr((*records)[0], "tcpFastOpenUnavailable")
+	require.True(t, found)
+	assert.True(t, unavailable.Bool())
+	_, found = findAttr((*records)[0], "tcpFastOpenUsed")
+	assert.False(t, found)
+	errValue, found := findAttr((*records)[0], "err")
+	require.True(t, found)
+	assert.ErrorIs(t, errValue.Any().(error), errTCPFastOpenUnavailable)
+}
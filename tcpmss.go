@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// errTCPMSSUnavailable indicates that we cannot read the TCP MSS.
+var errTCPMSSUnavailable = errors.New("tcp mss unavailable")
+
+// NewTCPMSSFunc returns a new [*TCPMSSFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewTCPMSSFunc(cfg *Config, logger SLogger) *TCPMSSFunc {
+	return &TCPMSSFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// TCPMSSFunc logs the maximum segment size (MSS) of a TCP connection.
+//
+// Place this Func after [ConnectFunc] to emit a tcpMss event. On Linux, the
+// tcpMss field contains the effective MSS read using the TCP_MAXSEG socket
+// option, which is useful for path MTU and middlebox studies. When the MSS
+// cannot be read (e.g., on other systems or for connections not implementing
+// [syscall.Conn]), the event includes tcpMssUnavailable instead, along with
+// the error that occurred. The connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type TCPMSSFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewTCPMSSFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewTCPMSSFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewTCPMSSFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &TCPMSSFunc{}
+
+// Call logs the MSS of the given [net.Conn] and returns it.
+func (op *TCPMSSFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	mss, err := tcpReadMSS(conn)
+	sockoptLog(op.Logger, op.ErrClassifier, op.TimeNow(), "tcpMss", conn, mss, err)
+	return conn, nil
+}
@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+	"syscall"
+)
+
+// tcpReadMSS reads TCP_MAXSEG from the given connection.
+//
+// Returns [errTCPMSSUnavailable] when the connection does not implement [syscall.Conn].
+func tcpReadMSS(conn net.Conn) (int, error) {
+	return sockoptRead(conn, errTCPMSSUnavailable, func(fd int) (int, error) {
+		return syscall.GetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+	})
+}
@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Call logs the MSS of a connected TCP socket.
+func TestTCPMSSFuncSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tcpConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+
+	logger, records := newCapturingLogger()
+	conn, err := NewTCPMSSFunc(NewConfig(), logger).Call(context.Background(), tcpConn)
+
+	require.NoError(t, err)
+	assert.Same(t, tcpConn, conn)
+	require.Len(t, *records, 1)
+	mss, found := findAttr((*records)[0], "tcpMss")
+	require.True(t, found)
+	assert.Greater(t, mss.Int64(), int64(0))
+	_, found = findAttr((*records)[0], "tcpMssUnavailable")
+	assert.False(t, found)
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package nop
+
+import "net"
+
+// tcpReadMSS always returns [errTCPMSSUnavailable] on this platform.
+func tcpReadMSS(conn net.Conn) (int, error) {
+	return 0, errTCPMSSUnavailable
+}
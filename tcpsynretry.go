@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// errTCPSynRetransmitsUnavailable indicates that we cannot read the SYN retransmissions.
+var errTCPSynRetransmitsUnavailable = errors.New("tcp syn retransmits unavailable")
+
+// NewSynRetryFunc returns a new [*SynRetryFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewSynRetryFunc(cfg *Config, logger SLogger) *SynRetryFunc {
+	return &SynRetryFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// SynRetryFunc logs the number of SYN retransmissions of a TCP connection.
+//
+// Place this Func immediately after [ConnectFunc] to emit a tcpSynRetransmits
+// event. On Linux, the tcpSynRetransmits field contains the total number of
+// retransmissions read from the TCP_INFO socket option. Since no data has been
+// sent yet, these are the SYN retransmissions performed while connecting,
+// which indicate packet loss or filtering on the path. When the statistics
+// cannot be read (e.g., on other systems or for connections not implementing
+// [syscall.Conn]), the event includes tcpSynRetransmitsUnavailable instead,
+// along with the error that occurred. The connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type SynRetryFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewSynRetryFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewSynRetryFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewSynRetryFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &SynRetryFunc{}
+
+// Call logs the SYN retransmissions of the given [net.Conn] and returns it.
+func (op *SynRetryFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	retransmits, err := tcpReadSynRetransmits(conn)
+	sockoptLog(op.Logger, op.ErrClassifier, op.TimeNow(), "tcpSynRetransmits", conn, retransmits, err)
+	return conn, nil
+}
@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// tcpReadSynRetransmits reads the total retransmissions from TCP_INFO.
+//
+// Returns [errTCPSynRetransmitsUnavailable] when the connection does
+// not implement [syscall.Conn].
+func tcpReadSynRetransmits(conn net.Conn) (int, error) {
+	return sockoptRead(conn, errTCPSynRetransmitsUnavailable, func(fd int) (int, error) {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return 0, err
+		}
+		return int(info.Total_retrans), nil
+	})
+}
@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build linux
+
+package nop
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Call logs zero SYN retransmissions for a loopback TCP connection.
+func TestSynRetryFuncSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	tcpConn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer tcpConn.Close()
+
+	logger, records := newCapturingLogger()
+	conn, err := NewSynRetryFunc(NewConfig(), logger).Call(context.Background(), tcpConn)
+
+	require.NoError(t, err)
+	assert.Same(t, tcpConn, conn)
+	require.Len(t, *records, 1)
+	retransmits, found := findAttr((*records)[0], "tcpSynRetransmits")
+	require.True(t, found)
+	assert.Equal(t, int64(0), retransmits.Int64())
+}
@@ -0,0 +1,12 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+//go:build !linux
+
+package nop
+
+import "net"
+
+// tcpReadSynRetransmits always returns [errTCPSynRetransmitsUnavailable] on this platform.
+func tcpReadSynRetransmits(conn net.Conn) (int, error) {
+	return 0, errTCPSynRetransmitsUnavailable
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewSynRetryFunc populates all fields from Config and the provided logger.
+func TestNewSynRetryFunc(t *testing.T) {
+	fn := NewSynRetryFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call logs tcpSynRetransmitsUnavailable when the statistics cannot be read and returns the conn unchanged.
+func TestSynRetryFuncUnavailable(t *testing.T) {
+	mockConn := newMinimalConn()
+	logger, records := newCapturingLogger()
+
+	conn, err := NewSynRetryFunc(NewConfig(), logger).Call(context.Background(), mockConn)
+
+	require.NoError(t, err)
+	assert.Same(t, mockConn, conn)
+	require.Len(t, *records, 1)
+	assert.Equal(t, "tcpSynRetransmits", (*records)[0].Message)
+	unavailable, found := findAttr((*records)[0], "tcpSynRetransmitsUnavailable")
+	require.True(t, found)
+	assert.True(t, unavailable.Bool())
+	_, found = findAttr((*records)[0], "tcpSynRetransmits")
+	assert.False(t, found)
+	errValue, found := findAttr((*records)[0], "err")
+	require.True(t, found)
+	assert.ErrorIs(t, errValue.Any().(error), errTCPSynRetransmitsUnavailable)
+}
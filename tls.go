@@ -8,12 +8,18 @@
 package nop
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"log/slog"
 	"net"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bassosimone/runtimex"
@@ -100,6 +106,23 @@ func NewTLSHandshakeFunc(cfg *Config, tlsConfig *tls.Config, logger SLogger) *TL
 //
 // Returns either a valid [TLSConn] or an error, never both.
 //
+// The tlsHandshakeStart event identifies the trust anchors, so that runs
+// using different root CA pools are distinguishable. When [tls.Config.RootCAs]
+// is nil, it includes tlsRootCAs set to "system". Otherwise, it includes
+// tlsRootCAs set to "custom", the number of certificates in the pool
+// (tlsRootCAsCount), and the hex-encoded SHA-256 of their sorted subjects
+// (tlsRootCAsFingerprint), which does not depend on the insertion order.
+//
+// The tlsHandshakeStart event also includes tlsHandshakeDeadlineSource, which
+// is "context" when the context carries a deadline bounding the handshake,
+// and "none" otherwise.
+//
+// Because some servers choose the application protocol based on the order
+// in which the client offers them, the tlsHandshakeStart event also includes
+// tlsAlpnOrder, the comma-separated [tls.Config.NextProtos] in the exact order
+// in which they are offered (e.g., "h2,http/1.1"). This complements the
+// tlsOfferedProtocols list with a scalar that is trivial to compare.
+//
 // All fields are safe to modify after construction but before first use.
 // Fields must not be mutated concurrently with calls to [Call].
 type TLSHandshakeFunc struct {
@@ -123,6 +146,15 @@ type TLSHandshakeFunc struct {
 	// Set by [NewTLSHandshakeFunc] to the user-provided logger.
 	Logger SLogger
 
+	// ObservePostHandshakeIdle enables wrapping the [TLSConn] returned on
+	// success to emit a postHandshakeIdle event on the first Read or Write.
+	// The event includes postHandshakeIdleMs, the time elapsed since the
+	// handshake completed in milliseconds, and postHandshakeIdleOp, either
+	// "read" or "write", which is useful for protocol-idle analysis.
+	//
+	// Set by [NewTLSHandshakeFunc] to false.
+	ObservePostHandshakeIdle bool
+
 	// TimeNow is the function to get the current time (configurable for testing).
 	//
 	// Set by [NewTLSHandshakeFunc] from [Config.TimeNow].
@@ -137,10 +169,14 @@ func (op *TLSHandshakeFunc) Call(ctx context.Context, conn net.Conn) (TLSConn, e
 	tconn := op.Engine.Client(conn, config)
 	t0 := op.TimeNow()
 	deadline, _ := ctx.Deadline()
-	op.logHandshakeStart(op.Engine, conn, t0, deadline, config)
+	op.logHandshakeStart(op.Engine, conn, tconn, t0, deadline, config)
 	err := tconn.HandshakeContext(ctx)
 	state := tconn.ConnectionState()
-	op.logHandshakeDone(op.Engine, conn, t0, deadline, config, err, state)
+	op.logHandshakeDone(op.Engine, conn, tconn, t0, deadline, config, err, state)
+	if summary := ConnectionSummaryFromContext(ctx); summary != nil {
+		summary.recordTLSHandshake(tls.VersionName(state.Version),
+			tls.CipherSuiteName(state.CipherSuite), op.ErrClassifier.Classify(err))
+	}
 	return op.finish(tconn, err)
 }
 
@@ -149,9 +185,47 @@ func (op *TLSHandshakeFunc) finish(conn TLSConn, err error) (TLSConn, error) {
 		conn.Close()
 		return nil, err
 	}
+	if op.ObservePostHandshakeIdle {
+		return &tlsPostHandshakeIdleConn{TLSConn: conn, op: op, t0: op.TimeNow()}, nil
+	}
 	return conn, nil
 }
 
+// tlsPostHandshakeIdleConn logs the idle time between the handshake
+// completion and the first Read or Write on a [TLSConn].
+type tlsPostHandshakeIdleConn struct {
+	TLSConn
+	once sync.Once
+	op   *TLSHandshakeFunc
+	t0   time.Time
+}
+
+// Read implements [net.Conn].
+func (c *tlsPostHandshakeIdleConn) Read(b []byte) (int, error) {
+	c.once.Do(func() { c.logPostHandshakeIdle("read") })
+	return c.TLSConn.Read(b)
+}
+
+// Write implements [net.Conn].
+func (c *tlsPostHandshakeIdleConn) Write(b []byte) (int, error) {
+	c.once.Do(func() { c.logPostHandshakeIdle("write") })
+	return c.TLSConn.Write(b)
+}
+
+func (c *tlsPostHandshakeIdleConn) logPostHandshakeIdle(operation string) {
+	t := c.op.TimeNow()
+	c.op.Logger.Info(
+		"postHandshakeIdle",
+		slog.String("localAddr", connLocalAddr(c.TLSConn)),
+		slog.Int64("postHandshakeIdleMs", t.Sub(c.t0).Milliseconds()),
+		slog.String("postHandshakeIdleOp", operation),
+		slog.String("protocol", safeconn.Network(c.TLSConn)),
+		slog.String("remoteAddr", connRemoteAddr(c.TLSConn)),
+		slog.Time("t0", c.t0),
+		slog.Time("t", t),
+	)
+}
+
 func (op *TLSHandshakeFunc) tlsConfig() *tls.Config {
 	runtimex.Assert(op.Config != nil)
 	config := op.Config.Clone()
@@ -160,44 +234,89 @@ func (op *TLSHandshakeFunc) tlsConfig() *tls.Config {
 }
 
 func (op *TLSHandshakeFunc) logHandshakeStart(engine TLSEngine,
-	conn net.Conn, t0 time.Time, deadline time.Time, config *tls.Config) {
-	op.Logger.Info(
-		"tlsHandshakeStart",
+	conn net.Conn, tconn TLSConn, t0 time.Time, deadline time.Time, config *tls.Config) {
+	attrs := []any{
 		slog.Time("deadline", deadline),
-		slog.String("localAddr", safeconn.LocalAddr(conn)),
+		slog.String("localAddr", connLocalAddr(conn)),
 		slog.String("protocol", safeconn.Network(conn)),
-		slog.String("remoteAddr", safeconn.RemoteAddr(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
 		slog.Time("t", t0),
+		slog.String("tlsAlpnOrder", strings.Join(config.NextProtos, ",")),
 		slog.String("tlsEngineName", engine.Name()),
+		slog.String("tlsHandshakeDeadlineSource", tlsHandshakeDeadlineSource(deadline)),
 		slog.String("tlsParrot", engine.Parrot()),
 		slog.Any("tlsOfferedProtocols", config.NextProtos),
 		slog.String("tlsServerName", config.ServerName),
 		slog.Bool("tlsSkipVerify", config.InsecureSkipVerify),
-	)
+	}
+	attrs = append(attrs, tlsRootCAsAttrs(config.RootCAs)...)
+	attrs = append(attrs, tlsInstrumentedStartAttrs(tconn)...)
+	op.Logger.Info("tlsHandshakeStart", attrs...)
+}
+
+// tlsHandshakeDeadlineSource returns the source of the deadline bounding the
+// handshake, where a zero deadline means that the context has no deadline.
+func tlsHandshakeDeadlineSource(deadline time.Time) string {
+	if deadline.IsZero() {
+		return "none"
+	}
+	return "context"
 }
 
-func (op *TLSHandshakeFunc) logHandshakeDone(engine TLSEngine,
-	conn net.Conn, t0 time.Time, deadline time.Time, config *tls.Config, err error, state tls.ConnectionState) {
-	op.Logger.Info(
-		"tlsHandshakeDone",
+// tlsRootCAsAttrs returns the tlsHandshakeStart attributes identifying the
+// given root CA pool, where a nil pool means using the system roots.
+func tlsRootCAsAttrs(pool *x509.CertPool) []any {
+	if pool == nil {
+		return []any{slog.String("tlsRootCAs", "system")}
+	}
+	// Note: Subjects is deprecated because it does not include the system
+	// roots for pools returned by [x509.SystemCertPool], which is acceptable
+	// here, since we are fingerprinting the explicitly configured pool.
+	subjects := pool.Subjects()
+	slices.SortFunc(subjects, bytes.Compare)
+	hash := sha256.New()
+	for _, subject := range subjects {
+		hash.Write(subject) // DER encoding is self-delimiting
+	}
+	return []any{
+		slog.String("tlsRootCAs", "custom"),
+		slog.Int("tlsRootCAsCount", len(subjects)),
+		slog.String("tlsRootCAsFingerprint", hex.EncodeToString(hash.Sum(nil))),
+	}
+}
+
+func (op *TLSHandshakeFunc) logHandshakeDone(engine TLSEngine, conn net.Conn,
+	tconn TLSConn, t0 time.Time, deadline time.Time, config *tls.Config, err error, state tls.ConnectionState) {
+	attrs := []any{
 		slog.Time("deadline", deadline),
 		slog.Any("err", err),
 		slog.String("errClass", op.ErrClassifier.Classify(err)),
-		slog.String("localAddr", safeconn.LocalAddr(conn)),
+		slog.String("localAddr", connLocalAddr(conn)),
 		slog.String("protocol", safeconn.Network(conn)),
-		slog.String("remoteAddr", safeconn.RemoteAddr(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
 		slog.Time("t0", t0),
 		slog.Time("t", op.TimeNow()),
 		slog.String("tlsCipherSuite", tls.CipherSuiteName(state.CipherSuite)),
 		slog.String("tlsEngineName", engine.Name()),
 		slog.String("tlsParrot", engine.Parrot()),
+		slog.Bool("tlsAlpnOfferedButNotNegotiated", tlsALPNOfferedButNotNegotiated(config, err, state)),
 		slog.String("tlsNegotiatedProtocol", state.NegotiatedProtocol),
 		slog.Any("tlsOfferedProtocols", config.NextProtos),
 		slog.Any("tlsPeerCerts", op.peerCerts(state, err)),
 		slog.String("tlsServerName", config.ServerName),
 		slog.Bool("tlsSkipVerify", config.InsecureSkipVerify),
 		slog.String("tlsVersion", tls.VersionName(state.Version)),
-	)
+	}
+	attrs = append(attrs, tlsSCTAttrs(state)...)
+	attrs = append(attrs, tlsInstrumentedDoneAttrs(tconn, err, state)...)
+	op.Logger.Info("tlsHandshakeDone", attrs...)
+}
+
+// tlsALPNOfferedButNotNegotiated returns true when a successful handshake
+// offered ALPN protocols but the server did not select any of them, which
+// may signal a protocol downgrade (e.g., by a middlebox).
+func tlsALPNOfferedButNotNegotiated(config *tls.Config, err error, state tls.ConnectionState) bool {
+	return err == nil && len(config.NextProtos) > 0 && state.NegotiatedProtocol == ""
 }
 
 func (op *TLSHandshakeFunc) peerCerts(state tls.ConnectionState, err error) (out [][]byte) {
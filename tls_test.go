@@ -6,6 +6,8 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"errors"
 	"log/slog"
 	"net"
@@ -56,6 +58,7 @@ func TestNewTLSHandshakeFunc(t *testing.T) {
 	assert.Equal(t, tlsConfig, fn.Config)
 	assert.NotNil(t, fn.Engine)
 	assert.NotNil(t, fn.Logger)
+	assert.False(t, fn.ObservePostHandshakeIdle)
 	assert.NotNil(t, fn.TimeNow)
 	assert.NotNil(t, fn.ErrClassifier)
 }
@@ -440,3 +443,326 @@ func TestTLSHandshakeFuncSetsTimeOnConfig(t *testing.T) {
 	require.NotNil(t, capturedConfig.Time)
 	assert.Equal(t, fixedTime, capturedConfig.Time())
 }
+
+// Call logs whether ALPN was offered but not negotiated.
+func TestTLSHandshakeFuncLogsALPNOfferedButNotNegotiated(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// nextProtos is the list of offered ALPN protocols.
+		nextProtos []string
+
+		// negotiated is the protocol selected by the server.
+		negotiated string
+
+		// want is the expected tlsAlpnOfferedButNotNegotiated value.
+		want bool
+	}{
+		{name: "offered and negotiated", nextProtos: []string{"h2", "http/1.1"}, negotiated: "h2", want: false},
+		{name: "offered but not negotiated", nextProtos: []string{"h2", "http/1.1"}, negotiated: "", want: true},
+		{name: "none offered", nextProtos: nil, negotiated: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{ServerName: "example.com", NextProtos: tt.nextProtos}
+			logger, records := newCapturingLogger()
+
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{NegotiatedProtocol: tt.negotiated}
+				},
+				HandshakeContextFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}
+
+			fn := NewTLSHandshakeFunc(NewConfig(), tlsConfig, logger)
+			fn.Engine = newMockTLSEngine(mockTLSConn)
+			_, err := fn.Call(context.Background(), newMinimalConn())
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			value, found := findAttr((*records)[1], "tlsAlpnOfferedButNotNegotiated")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.Bool())
+		})
+	}
+}
+
+// Call logs the offered ALPN protocols verbatim, without sorting them,
+// as tlsAlpnOrder on tlsHandshakeStart.
+func TestTLSHandshakeFuncLogsALPNOrder(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// nextProtos is the list of offered ALPN protocols.
+		nextProtos []string
+
+		// want is the expected tlsAlpnOrder value.
+		want string
+	}{
+		{name: "unsorted order", nextProtos: []string{"http/1.1", "h2", "acme-tls/1"}, want: "http/1.1,h2,acme-tls/1"},
+		{name: "preferred h2", nextProtos: []string{"h2", "http/1.1"}, want: "h2,http/1.1"},
+		{name: "none offered", nextProtos: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig := &tls.Config{ServerName: "example.com", NextProtos: tt.nextProtos}
+			logger, records := newCapturingLogger()
+
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{}
+				},
+				HandshakeContextFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}
+
+			fn := NewTLSHandshakeFunc(NewConfig(), tlsConfig, logger)
+			fn.Engine = newMockTLSEngine(mockTLSConn)
+			_, err := fn.Call(context.Background(), newMinimalConn())
+			require.NoError(t, err)
+
+			require.Len(t, *records, 2)
+			assert.Equal(t, "tlsHandshakeStart", (*records)[0].Message)
+			value, found := findAttr((*records)[0], "tlsAlpnOrder")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.String())
+			offered, found := findAttr((*records)[0], "tlsOfferedProtocols")
+			require.True(t, found)
+			assert.Equal(t, tt.nextProtos, offered.Any())
+		})
+	}
+}
+
+// newTestRootCAsPool returns a pool containing fake certificates whose
+// subjects have the given common names.
+func newTestRootCAsPool(commonNames ...string) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, commonName := range commonNames {
+		name := pkix.Name{CommonName: commonName}
+		rawSubject, err := asn1.Marshal(name.ToRDNSequence())
+		if err != nil {
+			panic(err)
+		}
+		pool.AddCert(&x509.Certificate{Raw: rawSubject, RawSubject: rawSubject})
+	}
+	return pool
+}
+
+// Call identifies the root CA pool on tlsHandshakeStart.
+func TestTLSHandshakeFuncLogsRootCAs(t *testing.T) {
+	// handshakeStart performs a handshake using the given pool and returns
+	// the tlsHandshakeStart event.
+	handshakeStart := func(t *testing.T, pool *x509.CertPool) slog.Record {
+		tlsConfig := &tls.Config{ServerName: "example.com", RootCAs: pool}
+		logger, records := newCapturingLogger()
+		mockTLSConn := &tlsstub.FuncTLSConn{
+			FuncConn: newMinimalConn(),
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{}
+			},
+			HandshakeContextFunc: func(ctx context.Context) error {
+				return nil
+			},
+		}
+		fn := NewTLSHandshakeFunc(NewConfig(), tlsConfig, logger)
+		fn.Engine = newMockTLSEngine(mockTLSConn)
+		_, err := fn.Call(context.Background(), newMinimalConn())
+		require.NoError(t, err)
+		require.Len(t, *records, 2)
+		require.Equal(t, "tlsHandshakeStart", (*records)[0].Message)
+		return (*records)[0]
+	}
+
+	// fingerprint returns the tlsRootCAsFingerprint for the given pool.
+	fingerprint := func(t *testing.T, pool *x509.CertPool) string {
+		value, found := findAttr(handshakeStart(t, pool), "tlsRootCAsFingerprint")
+		require.True(t, found)
+		return value.String()
+	}
+
+	t.Run("system roots", func(t *testing.T) {
+		record := handshakeStart(t, nil)
+		value, found := findAttr(record, "tlsRootCAs")
+		require.True(t, found)
+		assert.Equal(t, "system", value.String())
+		_, found = findAttr(record, "tlsRootCAsCount")
+		assert.False(t, found)
+		_, found = findAttr(record, "tlsRootCAsFingerprint")
+		assert.False(t, found)
+	})
+
+	t.Run("custom pool", func(t *testing.T) {
+		record := handshakeStart(t, newTestRootCAsPool("Root A", "Root B"))
+		value, found := findAttr(record, "tlsRootCAs")
+		require.True(t, found)
+		assert.Equal(t, "custom", value.String())
+		value, found = findAttr(record, "tlsRootCAsCount")
+		require.True(t, found)
+		assert.Equal(t, int64(2), value.Int64())
+		value, found = findAttr(record, "tlsRootCAsFingerprint")
+		require.True(t, found)
+		assert.Len(t, value.String(), 64)
+	})
+
+	t.Run("fingerprint ignores the insertion order", func(t *testing.T) {
+		assert.Equal(t,
+			fingerprint(t, newTestRootCAsPool("Root A", "Root B")),
+			fingerprint(t, newTestRootCAsPool("Root B", "Root A")),
+		)
+	})
+
+	t.Run("fingerprint depends on the trust anchors", func(t *testing.T) {
+		assert.NotEqual(t,
+			fingerprint(t, newTestRootCAsPool("Root A", "Root B")),
+			fingerprint(t, newTestRootCAsPool("Root A", "Root C")),
+		)
+	})
+}
+
+// Call logs whether the context deadline bounds the handshake on tlsHandshakeStart.
+func TestTLSHandshakeFuncLogsDeadlineSource(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// withDeadline indicates whether the context carries a deadline.
+		withDeadline bool
+
+		// want is the expected tlsHandshakeDeadlineSource.
+		want string
+	}{
+		{
+			name:         "with context deadline",
+			withDeadline: true,
+			want:         "context",
+		},
+
+		{
+			name:         "without context deadline",
+			withDeadline: false,
+			want:         "none",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{}
+				},
+				HandshakeContextFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}
+			fn := NewTLSHandshakeFunc(NewConfig(), &tls.Config{ServerName: "example.com"}, logger)
+			fn.Engine = newMockTLSEngine(mockTLSConn)
+			ctx := context.Background()
+			if tt.withDeadline {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Minute)
+				defer cancel()
+			}
+
+			_, err := fn.Call(ctx, newMinimalConn())
+
+			require.NoError(t, err)
+			require.Len(t, *records, 2)
+			require.Equal(t, "tlsHandshakeStart", (*records)[0].Message)
+			value, found := findAttr((*records)[0], "tlsHandshakeDeadlineSource")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.String())
+		})
+	}
+}
+
+// newPostHandshakeIdleTLSConn returns a successful mock TLS connection
+// whose Read and Write succeed.
+func newPostHandshakeIdleTLSConn() *tlsstub.FuncTLSConn {
+	tcpConn := newMinimalConn()
+	tcpConn.ReadFunc = func(b []byte) (int, error) { return len(b), nil }
+	tcpConn.WriteFunc = func(b []byte) (int, error) { return len(b), nil }
+	return &tlsstub.FuncTLSConn{
+		FuncConn: tcpConn,
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{Version: tls.VersionTLS13}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return nil
+		},
+	}
+}
+
+// With ObservePostHandshakeIdle, the first Read or Write logs the idle time
+// elapsed since the handshake completed, and subsequent I/O does not.
+func TestTLSHandshakeFuncObservePostHandshakeIdle(t *testing.T) {
+	for _, operation := range []string{"read", "write"} {
+		t.Run(operation, func(t *testing.T) {
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := NewFakeClock(start)
+			logger, records := newCapturingLogger()
+			fn := NewTLSHandshakeFunc(NewConfig().WithClock(clock), &tls.Config{ServerName: "example.com"}, logger)
+			fn.Engine = newMockTLSEngine(newPostHandshakeIdleTLSConn())
+			fn.ObservePostHandshakeIdle = true
+
+			tconn, err := fn.Call(context.Background(), newMinimalConn())
+			require.NoError(t, err)
+			assert.Equal(t, uint16(tls.VersionTLS13), tconn.ConnectionState().Version)
+			require.Len(t, *records, 2)
+
+			clock.Advance(250 * time.Millisecond)
+			buf := make([]byte, 4)
+			if operation == "read" {
+				_, err = tconn.Read(buf)
+			} else {
+				_, err = tconn.Write(buf)
+			}
+			require.NoError(t, err)
+
+			clock.Advance(time.Second)
+			_, err = tconn.Read(buf)
+			require.NoError(t, err)
+			_, err = tconn.Write(buf)
+			require.NoError(t, err)
+
+			require.Len(t, *records, 3)
+			record := (*records)[2]
+			assert.Equal(t, "postHandshakeIdle", record.Message)
+			value, found := findAttr(record, "postHandshakeIdleMs")
+			require.True(t, found)
+			assert.Equal(t, int64(250), value.Int64())
+			value, found = findAttr(record, "postHandshakeIdleOp")
+			require.True(t, found)
+			assert.Equal(t, operation, value.String())
+			value, found = findAttr(record, "t0")
+			require.True(t, found)
+			assert.Equal(t, start, value.Time())
+		})
+	}
+}
+
+// Without ObservePostHandshakeIdle, Call returns the TLSConn unwrapped.
+func TestTLSHandshakeFuncObservePostHandshakeIdleDisabled(t *testing.T) {
+	mockTLSConn := newPostHandshakeIdleTLSConn()
+	logger, records := newCapturingLogger()
+	fn := NewTLSHandshakeFunc(NewConfig(), &tls.Config{ServerName: "example.com"}, logger)
+	fn.Engine = newMockTLSEngine(mockTLSConn)
+
+	tconn, err := fn.Call(context.Background(), newMinimalConn())
+	require.NoError(t, err)
+	assert.Same(t, mockTLSConn, tconn)
+
+	_, err = tconn.Write(make([]byte, 4))
+	require.NoError(t, err)
+	require.Len(t, *records, 2)
+}
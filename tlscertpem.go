@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"encoding/pem"
+	"log/slog"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// NewTLSCertPEMFunc returns a new [*TLSCertPEMFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewTLSCertPEMFunc(cfg *Config, logger SLogger) *TLSCertPEMFunc {
+	return &TLSCertPEMFunc{
+		Logger:  logger,
+		TimeNow: cfg.TimeNow,
+	}
+}
+
+// TLSCertPEMFunc logs the peer certificates of a [TLSConn] as PEM.
+//
+// Place this Func after [TLSHandshakeFunc] to emit a tlsCertsPEM event whose
+// tlsCertsPEM field contains the PEM encoding of each peer certificate in the
+// order sent by the server. This is useful to archive the certificate chain
+// for offline analysis using standard tools. The connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type TLSCertPEMFunc struct {
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewTLSCertPEMFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewTLSCertPEMFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[TLSConn, TLSConn] = &TLSCertPEMFunc{}
+
+// Call logs the peer certificates of the given [TLSConn] and returns it.
+func (op *TLSCertPEMFunc) Call(ctx context.Context, conn TLSConn) (TLSConn, error) {
+	certs := []string{}
+	for _, cert := range conn.ConnectionState().PeerCertificates {
+		block := &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+		certs = append(certs, string(pem.EncodeToMemory(block)))
+	}
+	op.Logger.Info(
+		"tlsCertsPEM",
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t", op.TimeNow()),
+		slog.Any("tlsCertsPEM", certs),
+	)
+	return conn, nil
+}
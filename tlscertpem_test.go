@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewTLSCertPEMFunc populates all fields from Config and the provided logger.
+func TestNewTLSCertPEMFunc(t *testing.T) {
+	fn := NewTLSCertPEMFunc(NewConfig(), DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call logs each peer certificate as a PEM block and returns the conn unchanged.
+func TestTLSCertPEMFunc(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// peerCerts contains the peer certificates.
+		peerCerts []*x509.Certificate
+	}{
+		{
+			name:      "no certificates",
+			peerCerts: nil,
+		},
+
+		{
+			name: "certificate chain",
+			peerCerts: []*x509.Certificate{
+				{Raw: []byte("leaf certificate")},
+				{Raw: []byte("intermediate certificate")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{PeerCertificates: tt.peerCerts}
+				},
+			}
+			logger, records := newCapturingLogger()
+
+			conn, err := NewTLSCertPEMFunc(NewConfig(), logger).Call(context.Background(), mockTLSConn)
+
+			require.NoError(t, err)
+			assert.Same(t, mockTLSConn, conn)
+			require.Len(t, *records, 1)
+			assert.Equal(t, "tlsCertsPEM", (*records)[0].Message)
+			value, found := findAttr((*records)[0], "tlsCertsPEM")
+			require.True(t, found)
+			certs, ok := value.Any().([]string)
+			require.True(t, ok)
+			require.Len(t, certs, len(tt.peerCerts))
+			for idx, cert := range certs {
+				block, rest := pem.Decode([]byte(cert))
+				require.NotNil(t, block)
+				assert.Empty(t, rest)
+				assert.Equal(t, "CERTIFICATE", block.Type)
+				assert.Equal(t, tt.peerCerts[idx].Raw, block.Bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/safeconn"
+)
+
+// NewTLSCipherPreferenceProbe returns a new [*TLSCipherPreferenceProbe].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The tlsConfig argument is the TLS configuration to use, which should be
+// the same used by the [*TLSHandshakeFunc] preceding the probe.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewTLSCipherPreferenceProbe(cfg *Config, tlsConfig *tls.Config, logger SLogger) *TLSCipherPreferenceProbe {
+	runtimex.Assert(tlsConfig != nil)
+	return &TLSCipherPreferenceProbe{
+		Config:        tlsConfig,
+		Connect:       NewConnectFunc(cfg, "tcp", logger),
+		Engine:        TLSEngineStdlib{},
+		ErrClassifier: cfg.ErrClassifier,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// TLSCipherPreferenceProbe infers whether the server enforces its own
+// cipher suite preference rather than honoring the client preference.
+//
+// Place this Func after [TLSHandshakeFunc]. Since a handshake only reveals the
+// negotiated cipher suite, the probe creates a new connection to the same
+// remote address using Connect and performs a second handshake offering the
+// cipher suites in reverse order. The suites offered are Config.CipherSuites or, when empty,
+// the suites returned by [tls.CipherSuites]. When the server picks the same
+// suite in both handshakes, it most likely enforces its own preference.
+//
+// The probe emits a tlsCipherPreference event containing the suite negotiated
+// by the input connection (tlsCipherSuite), the suites offered by the probe
+// (tlsProbeOfferedCipherSuites), the suite negotiated by the probe
+// (tlsProbeCipherSuite), and whether the server preference was detected
+// (tlsServerPreference). The probe never fails the pipeline: probe errors are
+// logged and the input connection is returned unchanged.
+//
+// The [TLSEngineStdlib] engine ignores the order of Config.CipherSuites and
+// does not allow configuring TLS 1.3 suites, so a meaningful probe requires
+// an engine honoring the configured order and handshakes negotiating TLS 1.2
+// or lower. Therefore, the event includes tlsServerPreference only when the
+// probe succeeded, Engine is not [TLSEngineStdlib], and both handshakes
+// negotiated TLS 1.2 or lower, since otherwise the inference is meaningless.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type TLSCipherPreferenceProbe struct {
+	// Config contains the [*tls.Config] configuration to use.
+	//
+	// Set by [NewTLSCipherPreferenceProbe] to the user-provided [*tls.Config] pointer.
+	Config *tls.Config
+
+	// Connect is the [Func] used to create the probe connection, which
+	// may be a pipeline starting with a [*ConnectFunc] (e.g., followed by
+	// an [*ObserveConnFunc]) to observe the probe connection.
+	//
+	// Set by [NewTLSCipherPreferenceProbe] to a [*ConnectFunc] constructed
+	// from cfg and logger using the "tcp" network.
+	Connect Func[netip.AddrPort, net.Conn]
+
+	// Engine is the [TLSEngine] used for the probe handshake.
+	//
+	// Set by [NewTLSCipherPreferenceProbe] to [TLSEngineStdlib].
+	Engine TLSEngine
+
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewTLSCipherPreferenceProbe] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewTLSCipherPreferenceProbe] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewTLSCipherPreferenceProbe] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[TLSConn, TLSConn] = &TLSCipherPreferenceProbe{}
+
+// Call probes the server cipher suite preference and returns the given [TLSConn].
+func (op *TLSCipherPreferenceProbe) Call(ctx context.Context, conn TLSConn) (TLSConn, error) {
+	t0 := op.TimeNow()
+	config := op.probeConfig()
+	probeState, err := op.probe(ctx, conn, config)
+	state := conn.ConnectionState()
+	attrs := []any{
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t0", t0),
+		slog.Time("t", op.TimeNow()),
+		slog.String("tlsCipherSuite", tls.CipherSuiteName(state.CipherSuite)),
+		slog.String("tlsProbeCipherSuite", tls.CipherSuiteName(probeState.CipherSuite)),
+		slog.Any("tlsProbeOfferedCipherSuites", tlsCipherSuiteNames(config.CipherSuites)),
+	}
+	if err == nil && op.meaningful(state, probeState) {
+		serverPreference := len(config.CipherSuites) > 1 && probeState.CipherSuite == state.CipherSuite
+		attrs = append(attrs, slog.Bool("tlsServerPreference", serverPreference))
+	}
+	op.Logger.Info("tlsCipherPreference", attrs...)
+	return conn, nil
+}
+
+// meaningful returns whether comparing the cipher suites negotiated by the
+// given handshakes allows to infer the server preference.
+func (op *TLSCipherPreferenceProbe) meaningful(state, probeState tls.ConnectionState) bool {
+	_, stdlib := op.Engine.(TLSEngineStdlib)
+	return !stdlib && state.Version <= tls.VersionTLS12 && probeState.Version <= tls.VersionTLS12
+}
+
+// probeConfig returns the config offering the cipher suites in reverse order.
+func (op *TLSCipherPreferenceProbe) probeConfig() *tls.Config {
+	runtimex.Assert(op.Config != nil)
+	config := op.Config.Clone()
+	config.Time = op.TimeNow
+	suites := config.CipherSuites
+	if len(suites) <= 0 {
+		for _, suite := range tls.CipherSuites() {
+			suites = append(suites, suite.ID)
+		}
+	}
+	config.CipherSuites = slices.Clone(suites)
+	slices.Reverse(config.CipherSuites)
+	return config
+}
+
+// probe connects to the remote address of the given conn, performs the probe
+// handshake, closes the probe connection, and returns its state.
+func (op *TLSCipherPreferenceProbe) probe(
+	ctx context.Context, conn TLSConn, config *tls.Config) (tls.ConnectionState, error) {
+	address, err := netip.ParseAddrPort(connRemoteAddr(conn))
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	pconn, err := op.Connect.Call(ctx, address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	tconn := op.Engine.Client(pconn, config)
+	defer tconn.Close()
+	if err := tconn.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return tconn.ConnectionState(), nil
+}
+
+// tlsCipherSuiteNames returns the names of the given cipher suites.
+func tlsCipherSuiteNames(suites []uint16) []string {
+	names := make([]string, 0, len(suites))
+	for _, suite := range suites {
+		names = append(names, tls.CipherSuiteName(suite))
+	}
+	return names
+}
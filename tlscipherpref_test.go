@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewTLSCipherPreferenceProbe populates all fields from Config and the provided arguments.
+func TestNewTLSCipherPreferenceProbe(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "example.com"}
+	fn := NewTLSCipherPreferenceProbe(NewConfig(), tlsConfig, DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.Same(t, tlsConfig, fn.Config)
+	require.IsType(t, &ConnectFunc{}, fn.Connect)
+	assert.Equal(t, "tcp", fn.Connect.(*ConnectFunc).Network)
+	assert.Equal(t, TLSEngineStdlib{}, fn.Engine)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call infers the server preference by comparing the suite negotiated by the
+// input conn with the one negotiated by a probe offering the reversed list.
+func TestTLSCipherPreferenceProbe(t *testing.T) {
+	suites := []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	}
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// pick emulates the server selecting a suite among those offered.
+		pick func(offered []uint16) uint16
+
+		// version is the TLS version negotiated by both handshakes.
+		version uint16
+
+		// handshakeErr is the error returned by the probe handshake.
+		handshakeErr error
+
+		// wantProbeSuite is the expected tlsProbeCipherSuite value.
+		wantProbeSuite string
+
+		// wantFound indicates whether we expect tlsServerPreference.
+		wantFound bool
+
+		// wantServerPreference is the expected tlsServerPreference value.
+		wantServerPreference bool
+	}{
+		{
+			name:                 "server preference",
+			pick:                 func(offered []uint16) uint16 { return suites[0] },
+			version:              tls.VersionTLS12,
+			wantProbeSuite:       "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			wantFound:            true,
+			wantServerPreference: true,
+		},
+
+		{
+			name:                 "client preference",
+			pick:                 func(offered []uint16) uint16 { return offered[0] },
+			version:              tls.VersionTLS12,
+			wantProbeSuite:       "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+			wantFound:            true,
+			wantServerPreference: false,
+		},
+
+		{
+			name:           "TLS 1.3",
+			pick:           func(offered []uint16) uint16 { return suites[0] },
+			version:        tls.VersionTLS13,
+			wantProbeSuite: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			wantFound:      false,
+		},
+
+		{
+			name:           "probe handshake failure",
+			pick:           func(offered []uint16) uint16 { return suites[0] },
+			version:        tls.VersionTLS12,
+			handshakeErr:   errors.New("remote error: tls: handshake failure"),
+			wantProbeSuite: tls.CipherSuiteName(0),
+			wantFound:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The input conn negotiated the suite picked from the original list
+			inputConn := &tlsstub.FuncTLSConn{
+				FuncConn: newTLSCipherPreferenceInputConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{CipherSuite: tt.pick(suites), Version: tt.version}
+				},
+			}
+
+			var (
+				addresses   []string
+				probeClosed bool
+			)
+			cfg := NewConfig()
+			cfg.Dialer = &netstub.FuncDialer{
+				DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+					addresses = append(addresses, network+"/"+address)
+					return newMinimalConn(), nil
+				},
+			}
+			logger, records := newCapturingLogger()
+			fn := NewTLSCipherPreferenceProbe(cfg, &tls.Config{CipherSuites: suites}, logger)
+			fn.Engine = &tlsstub.FuncTLSEngine[TLSConn]{
+				ClientFunc: func(c net.Conn, config *tls.Config) TLSConn {
+					conn := &tlsstub.FuncTLSConn{
+						FuncConn: newMinimalConn(),
+						ConnectionStateFunc: func() tls.ConnectionState {
+							return tls.ConnectionState{CipherSuite: tt.pick(config.CipherSuites), Version: tt.version}
+						},
+						HandshakeContextFunc: func(ctx context.Context) error {
+							return tt.handshakeErr
+						},
+					}
+					conn.CloseFunc = func() error {
+						probeClosed = true
+						return nil
+					}
+					return conn
+				},
+			}
+
+			conn, err := fn.Call(context.Background(), inputConn)
+
+			require.NoError(t, err)
+			assert.Same(t, inputConn, conn)
+			assert.True(t, probeClosed)
+			assert.Equal(t, []string{"tcp/93.184.216.34:443"}, addresses)
+			_, found := findRecord(*records, "connectDone")
+			assert.True(t, found, "should connect using the connect pipeline")
+			record, found := findRecord(*records, "tlsCipherPreference")
+			require.True(t, found)
+			offered, found := findAttr(record, "tlsProbeOfferedCipherSuites")
+			require.True(t, found)
+			assert.Equal(t, []string{
+				"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+				"TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+				"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			}, offered.Any())
+			probeSuite, found := findAttr(record, "tlsProbeCipherSuite")
+			require.True(t, found)
+			assert.Equal(t, tt.wantProbeSuite, probeSuite.String())
+			serverPreference, found := findAttr(record, "tlsServerPreference")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.wantServerPreference, serverPreference.Bool())
+			}
+		})
+	}
+}
+
+// The inference is meaningful only with engines honoring the order of the
+// suites and when both handshakes negotiated TLS 1.2 or lower.
+func TestTLSCipherPreferenceProbeMeaningful(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// engine is the engine used by the probe.
+		engine TLSEngine
+
+		// version is the TLS version negotiated by the input conn.
+		version uint16
+
+		// probeVersion is the TLS version negotiated by the probe.
+		probeVersion uint16
+
+		// want is the expected result.
+		want bool
+	}{
+		{name: "custom engine with TLS 1.2", engine: &tlsstub.FuncTLSEngine[TLSConn]{},
+			version: tls.VersionTLS12, probeVersion: tls.VersionTLS12, want: true},
+		{name: "stdlib engine with TLS 1.2", engine: TLSEngineStdlib{},
+			version: tls.VersionTLS12, probeVersion: tls.VersionTLS12, want: false},
+		{name: "custom engine with TLS 1.3", engine: &tlsstub.FuncTLSEngine[TLSConn]{},
+			version: tls.VersionTLS13, probeVersion: tls.VersionTLS13, want: false},
+		{name: "custom engine with TLS 1.3 probe", engine: &tlsstub.FuncTLSEngine[TLSConn]{},
+			version: tls.VersionTLS12, probeVersion: tls.VersionTLS13, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fn := NewTLSCipherPreferenceProbe(NewConfig(), &tls.Config{}, DefaultSLogger())
+			fn.Engine = tt.engine
+
+			got := fn.meaningful(tls.ConnectionState{Version: tt.version}, tls.ConnectionState{Version: tt.probeVersion})
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// newTLSCipherPreferenceInputConn returns a [*netstub.FuncConn] connected to 93.184.216.34:443.
+func newTLSCipherPreferenceInputConn() *netstub.FuncConn {
+	conn := newMinimalConn()
+	conn.RemoteAddrFunc = func() net.Addr {
+		return &net.TCPAddr{IP: net.IPv4(93, 184, 216, 34), Port: 443}
+	}
+	return conn
+}
+
+// Call logs dial errors without failing and offers the default suites when none are configured.
+func TestTLSCipherPreferenceProbeDialError(t *testing.T) {
+	wantErr := errors.New("connection refused")
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, wantErr
+		},
+	}
+	inputConn := &tlsstub.FuncTLSConn{
+		FuncConn: newTLSCipherPreferenceInputConn(),
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+	}
+	logger, records := newCapturingLogger()
+
+	conn, err := NewTLSCipherPreferenceProbe(cfg, &tls.Config{}, logger).Call(context.Background(), inputConn)
+
+	require.NoError(t, err)
+	assert.Same(t, inputConn, conn)
+	record, found := findRecord(*records, "tlsCipherPreference")
+	require.True(t, found)
+	errValue, found := findAttr(record, "err")
+	require.True(t, found)
+	assert.ErrorIs(t, errValue.Any().(error), wantErr)
+	offered, found := findAttr(record, "tlsProbeOfferedCipherSuites")
+	require.True(t, found)
+	assert.Len(t, offered.Any(), len(tls.CipherSuites()))
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bassosimone/safeconn"
+)
+
+// errTLSNoPeerCertificates indicates that the peer did not send certificates.
+var errTLSNoPeerCertificates = errors.New("tls: no peer certificates")
+
+// NewTLSHostnameCheckFunc returns a new [*TLSHostnameCheckFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The host argument is the hostname to check the peer certificate against.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+func NewTLSHostnameCheckFunc(cfg *Config, host string, logger SLogger) *TLSHostnameCheckFunc {
+	return &TLSHostnameCheckFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		Host:          host,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// TLSHostnameCheckFunc checks whether the peer certificate of a [TLSConn]
+// is valid for a given hostname, regardless of the TLS configuration.
+//
+// Place this Func after [TLSHandshakeFunc] to emit a tlsHostnameCheck event
+// whose tlsHostnameValid field reports whether the leaf certificate is valid
+// for the hostname according to [x509.Certificate.VerifyHostname], with the
+// err field containing the reason why it is not. This is useful when using
+// InsecureSkipVerify to always obtain the certificate, while still recording
+// whether it would have been valid for a given name. Note that this Func only
+// checks the hostname and does not verify the certificate chain.
+//
+// The check never fails the pipeline: the connection is returned unchanged.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type TLSHostnameCheckFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewTLSHostnameCheckFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// Host is the hostname to check the peer certificate against.
+	//
+	// Set by [NewTLSHostnameCheckFunc] to the user-provided value.
+	Host string
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewTLSHostnameCheckFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewTLSHostnameCheckFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[TLSConn, TLSConn] = &TLSHostnameCheckFunc{}
+
+// Call checks the peer certificate of the given [TLSConn] and returns it.
+func (op *TLSHostnameCheckFunc) Call(ctx context.Context, conn TLSConn) (TLSConn, error) {
+	err := errTLSNoPeerCertificates
+	if certs := conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		err = certs[0].VerifyHostname(op.Host)
+	}
+	op.Logger.Info(
+		"tlsHostnameCheck",
+		slog.Any("err", err),
+		slog.String("errClass", op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(conn)),
+		slog.String("protocol", safeconn.Network(conn)),
+		slog.String("remoteAddr", connRemoteAddr(conn)),
+		slog.Time("t", op.TimeNow()),
+		slog.String("tlsHostname", op.Host),
+		slog.Bool("tlsHostnameValid", err == nil),
+	)
+	return conn, nil
+}
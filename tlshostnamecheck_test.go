@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewTLSHostnameCheckFunc populates all fields from Config and the provided arguments.
+func TestNewTLSHostnameCheckFunc(t *testing.T) {
+	fn := NewTLSHostnameCheckFunc(NewConfig(), "www.example.com", DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.Equal(t, "www.example.com", fn.Host)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// Call logs whether the leaf certificate is valid for the hostname and returns the conn unchanged.
+func TestTLSHostnameCheckFunc(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// peerCerts contains the peer certificates.
+		peerCerts []*x509.Certificate
+
+		// wantValid is the expected tlsHostnameValid value.
+		wantValid bool
+	}{
+		{
+			name: "matching SAN",
+			peerCerts: []*x509.Certificate{
+				{DNSNames: []string{"example.com", "*.example.com"}},
+			},
+			wantValid: true,
+		},
+
+		{
+			name: "non-matching SAN",
+			peerCerts: []*x509.Certificate{
+				{DNSNames: []string{"example.org"}},
+			},
+			wantValid: false,
+		},
+
+		{
+			name:      "no certificates",
+			peerCerts: nil,
+			wantValid: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tls.ConnectionState{PeerCertificates: tt.peerCerts}
+				},
+			}
+			logger, records := newCapturingLogger()
+
+			fn := NewTLSHostnameCheckFunc(NewConfig(), "www.example.com", logger)
+			conn, err := fn.Call(context.Background(), mockTLSConn)
+
+			require.NoError(t, err)
+			assert.Same(t, mockTLSConn, conn)
+			require.Len(t, *records, 1)
+			assert.Equal(t, "tlsHostnameCheck", (*records)[0].Message)
+			valid, found := findAttr((*records)[0], "tlsHostnameValid")
+			require.True(t, found)
+			assert.Equal(t, tt.wantValid, valid.Bool())
+			errValue, found := findAttr((*records)[0], "err")
+			require.True(t, found)
+			if tt.wantValid {
+				assert.Nil(t, errValue.Any())
+				return
+			}
+			assert.Error(t, errValue.Any().(error))
+		})
+	}
+}
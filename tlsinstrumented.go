@@ -0,0 +1,273 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"strconv"
+	"syscall"
+)
+
+// An instrumented [TLSEngine] returns [TLSConn] instances that additionally
+// implement one or more of the optional interfaces defined in this file.
+//
+// These interfaces expose handshake details that [*tls.Conn] does not make
+// available. When the [TLSConn] implements them, [*TLSHandshakeFunc] includes
+// the corresponding fields in its structured log events. The [TLSEngineStdlib]
+// engine does not implement them, so the fields are omitted or logged with
+// their default value, as documented by each interface.
+
+// TLSAlertReporter is an optional interface for [TLSConn] returning the raw
+// bytes of the last TLS alert record received during the handshake.
+//
+// When the handshake fails, [*TLSHandshakeFunc] logs these bytes as
+// tlsAlertBytes in the tlsHandshakeDone event.
+type TLSAlertReporter interface {
+	LastAlert() []byte
+}
+
+// TLSALPSReporter is an optional interface for [TLSConn] reporting whether
+// the ALPS (Application-Layer Protocol Settings) TLS extension was negotiated,
+// which browsers use to exchange HTTP/2 settings during the handshake.
+//
+// [*TLSHandshakeFunc] logs the value as tlsAlpsNegotiated in the
+// tlsHandshakeDone event. The field is omitted when the [TLSConn] does not
+// implement this interface, since the standard library does not support ALPS.
+type TLSALPSReporter interface {
+	ALPSNegotiated() bool
+}
+
+// TLSBytesReceivedReporter is an optional interface for [TLSConn] returning
+// the number of bytes received from the server during the handshake.
+//
+// When the handshake fails with [syscall.ECONNRESET] after receiving some
+// bytes, the server (or an injector) most likely sent the ServerHello and then
+// reset the connection, which may signal middlebox interference. In such a
+// case, [*TLSHandshakeFunc] logs tlsResetAfterServerHello=true in the
+// tlsHandshakeDone event. The field is logged as false for other failures and is omitted on success or when the
+// [TLSConn] does not implement this interface.
+type TLSBytesReceivedReporter interface {
+	BytesReceived() int64
+}
+
+// TLSClientHelloReporter is an optional interface for [TLSConn] returning
+// the raw ClientHello handshake message sent to the server.
+//
+// [*TLSHandshakeFunc] logs the JA4 fingerprint of the ClientHello (see
+// [ComputeJA4]) as tlsJA4 in the tlsHandshakeDone event. The field is omitted
+// when the [TLSConn] does not implement this interface, returns nil, or returns
+// bytes that do not parse as a ClientHello.
+type TLSClientHelloReporter interface {
+	ClientHello() []byte
+}
+
+// TLSCompressionMethodReporter is an optional interface for [TLSConn]
+// returning the compression method selected by the server in the ServerHello
+// (see RFC 3749), which should be null since CRIME-era attacks made TLS
+// compression unsafe and TLS 1.3 forbids it.
+//
+// [*TLSHandshakeFunc] logs the method name as tlsCompressionMethod in the
+// tlsHandshakeDone event (see [tlsCompressionMethodName]). When the [TLSConn]
+// does not implement this interface, the field is logged as "null", since the
+// standard library client only offers null compression.
+type TLSCompressionMethodReporter interface {
+	CompressionMethod() uint8
+}
+
+// TLSEarlyDataReporter is an optional interface for [TLSConn] reporting
+// whether TLS 1.3 early data (0-RTT) was attempted and accepted.
+//
+// [*TLSHandshakeFunc] logs these values as tls0RTTAttempted and tls0RTTAccepted
+// in the tlsHandshakeDone event. It also logs tls0RTTRejected, which is true
+// when the handshake succeeded but the server rejected the early data that
+// we sent, in which case the client must replay it after the handshake. When
+// the [TLSConn] does not implement this interface, all the fields are logged
+// as false, since the standard library client never sends early data.
+type TLSEarlyDataReporter interface {
+	EarlyDataAttempted() bool
+	EarlyDataAccepted() bool
+}
+
+// TLSFirstRecordReporter is an optional interface for [TLSConn] returning
+// the raw bytes of the first TLS record received from the server, including
+// the record header, which is typically the ServerHello or an alert. This is
+// useful to detect TLS-layer injection regardless of the handshake outcome.
+//
+// [*TLSHandshakeFunc] logs the bytes as tlsFirstRecord and their length as
+// tlsFirstRecordLen in the tlsHandshakeDone event. The fields are omitted when
+// the [TLSConn] does not implement this interface or returns nil (e.g., when
+// no record was received), since the standard library does not expose them.
+type TLSFirstRecordReporter interface {
+	FirstReceivedRecord() []byte
+}
+
+// TLSOfferedExtensionsReporter is an optional interface for [TLSConn]
+// returning the types of the extensions offered by the ClientHello, in
+// order, which is useful to validate JA3/JA4-style fingerprints.
+//
+// Since the engine builds the ClientHello when constructing the [TLSConn],
+// [*TLSHandshakeFunc] logs the types as tlsOfferedExtensions in the
+// tlsHandshakeStart event. The field is omitted when the [TLSConn] does not
+// implement this interface or returns nil, since the standard library does
+// not expose the ClientHello.
+type TLSOfferedExtensionsReporter interface {
+	OfferedExtensions() []uint16
+}
+
+// TLSRecordLayerVersionReporter is an optional interface for [TLSConn]
+// returning the legacy version field of the record layer of the records
+// received from the server, which may differ from the negotiated version
+// (e.g., TLS 1.3 records claim to be TLS 1.2). This is useful to study
+// version intolerance caused by middleboxes inspecting the record layer.
+//
+// [*TLSHandshakeFunc] logs the version name (e.g., "TLS 1.2") as
+// tlsRecordLayerVersion in the tlsHandshakeDone event. The field is omitted
+// when the [TLSConn] does not implement this interface or returns zero,
+// since the standard library does not expose the record-layer version.
+type TLSRecordLayerVersionReporter interface {
+	RecordLayerVersion() uint16
+}
+
+// TLSRecordSizesReporter is an optional interface for [TLSConn] returning
+// the sizes of the TLS records exchanged during the handshake, which is
+// useful for traffic-analysis and padding studies.
+//
+// [*TLSHandshakeFunc] logs the sizes as tlsRecordSizes in the tlsHandshakeDone
+// event. The field is omitted when the [TLSConn] does not implement this
+// interface or returns nil.
+type TLSRecordSizesReporter interface {
+	RecordSizes() []int
+}
+
+// TLSSecureRenegotiationReporter is an optional interface for [TLSConn]
+// reporting whether the server indicated support for secure renegotiation
+// using the renegotiation_info extension (see RFC 5746), which matters
+// for legacy-compatibility audits.
+//
+// [*TLSHandshakeFunc] logs the value as tlsSecureRenegotiation in the
+// tlsHandshakeDone event. When the [TLSConn] does not implement this
+// interface, which is the case of the standard library, the field is true
+// when the handshake succeeded using TLS 1.2 or later and false otherwise,
+// since TLS 1.2 servers lacking the extension are vanishingly rare and TLS
+// 1.3 removes renegotiation altogether.
+type TLSSecureRenegotiationReporter interface {
+	SecureRenegotiation() bool
+}
+
+// TLSSignatureSchemeReporter is an optional interface for [TLSConn] returning
+// the signature scheme used by the server in the CertificateVerify message (or
+// ServerKeyExchange in TLS 1.2), which is useful for crypto-agility studies.
+//
+// [*TLSHandshakeFunc] logs the scheme name (e.g., "ECDSAWithP256AndSHA256") as
+// tlsSignatureScheme in the tlsHandshakeDone event. The field is omitted when
+// the [TLSConn] does not implement this interface or returns zero.
+type TLSSignatureSchemeReporter interface {
+	SignatureScheme() tls.SignatureScheme
+}
+
+// tlsInstrumentedStartAttrs returns the tlsHandshakeStart attributes obtained
+// from the optional interfaces implemented by the given [TLSConn].
+func tlsInstrumentedStartAttrs(tconn TLSConn) (attrs []any) {
+	if oer, ok := tconn.(TLSOfferedExtensionsReporter); ok {
+		if extensions := oer.OfferedExtensions(); extensions != nil {
+			attrs = append(attrs, slog.Any("tlsOfferedExtensions", extensions))
+		}
+	}
+	return
+}
+
+// tlsInstrumentedDoneAttrs returns the tlsHandshakeDone attributes obtained
+// from the optional interfaces implemented by the given [TLSConn], where
+// err is the handshake error and state is the connection state after the
+// handshake.
+func tlsInstrumentedDoneAttrs(tconn TLSConn, err error, state tls.ConnectionState) (attrs []any) {
+	if ar, ok := tconn.(TLSAlertReporter); ok && err != nil {
+		if alert := ar.LastAlert(); alert != nil {
+			attrs = append(attrs, slog.Any("tlsAlertBytes", alert))
+		}
+	}
+
+	if brr, ok := tconn.(TLSBytesReceivedReporter); ok && err != nil {
+		reset := errors.Is(err, syscall.ECONNRESET) && brr.BytesReceived() > 0
+		attrs = append(attrs, slog.Bool("tlsResetAfterServerHello", reset))
+	}
+
+	if chr, ok := tconn.(TLSClientHelloReporter); ok {
+		if clientHello := chr.ClientHello(); clientHello != nil {
+			if ja4, err := ComputeJA4(clientHello); err == nil {
+				attrs = append(attrs, slog.String("tlsJA4", ja4))
+			}
+		}
+	}
+
+	if frr, ok := tconn.(TLSFirstRecordReporter); ok {
+		if record := frr.FirstReceivedRecord(); record != nil {
+			attrs = append(attrs,
+				slog.Any("tlsFirstRecord", record),
+				slog.Int("tlsFirstRecordLen", len(record)),
+			)
+		}
+	}
+
+	if alpsr, ok := tconn.(TLSALPSReporter); ok {
+		attrs = append(attrs, slog.Bool("tlsAlpsNegotiated", alpsr.ALPSNegotiated()))
+	}
+
+	if rlvr, ok := tconn.(TLSRecordLayerVersionReporter); ok {
+		if version := rlvr.RecordLayerVersion(); version != 0 {
+			attrs = append(attrs, slog.String("tlsRecordLayerVersion", tls.VersionName(version)))
+		}
+	}
+
+	if rsr, ok := tconn.(TLSRecordSizesReporter); ok {
+		if sizes := rsr.RecordSizes(); sizes != nil {
+			attrs = append(attrs, slog.Any("tlsRecordSizes", sizes))
+		}
+	}
+
+	if ssr, ok := tconn.(TLSSignatureSchemeReporter); ok {
+		if scheme := ssr.SignatureScheme(); scheme != 0 {
+			attrs = append(attrs, slog.String("tlsSignatureScheme", scheme.String()))
+		}
+	}
+
+	secureRenegotiation := err == nil && state.Version >= tls.VersionTLS12
+	if srr, ok := tconn.(TLSSecureRenegotiationReporter); ok {
+		secureRenegotiation = srr.SecureRenegotiation()
+	}
+	attrs = append(attrs, slog.Bool("tlsSecureRenegotiation", secureRenegotiation))
+
+	var compressionMethod uint8
+	if cmr, ok := tconn.(TLSCompressionMethodReporter); ok {
+		compressionMethod = cmr.CompressionMethod()
+	}
+	attrs = append(attrs, slog.String("tlsCompressionMethod", tlsCompressionMethodName(compressionMethod)))
+
+	var earlyDataAttempted, earlyDataAccepted bool
+	if edr, ok := tconn.(TLSEarlyDataReporter); ok {
+		earlyDataAttempted, earlyDataAccepted = edr.EarlyDataAttempted(), edr.EarlyDataAccepted()
+	}
+	attrs = append(attrs,
+		slog.Bool("tls0RTTAttempted", earlyDataAttempted),
+		slog.Bool("tls0RTTAccepted", earlyDataAccepted),
+		slog.Bool("tls0RTTRejected", err == nil && earlyDataAttempted && !earlyDataAccepted),
+	)
+	return
+}
+
+// tlsCompressionMethodName returns the name of the given TLS compression
+// method: "null", "deflate", "lzs", or the decimal value for other methods.
+func tlsCompressionMethodName(method uint8) string {
+	switch method {
+	case 0:
+		return "null"
+	case 1:
+		return "deflate"
+	case 64:
+		return "lzs"
+	default:
+		return strconv.Itoa(int(method))
+	}
+}
@@ -0,0 +1,554 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newInstrumentedTLSConn returns an [*instrumentedTLSConn] whose
+// handshake returns the given error and whose optional methods
+// return zero values unless overridden by the caller.
+func newInstrumentedTLSConn(handshakeErr error) *instrumentedTLSConn {
+	conn := &instrumentedTLSConn{
+		ALPSNegotiatedFunc:      func() bool { return false },
+		BytesReceivedFunc:       func() int64 { return 0 },
+		ClientHelloFunc:         func() []byte { return nil },
+		CompressionMethodFunc:   func() uint8 { return 0 },
+		EarlyDataAcceptedFunc:   func() bool { return false },
+		EarlyDataAttemptedFunc:  func() bool { return false },
+		FirstReceivedRecordFunc: func() []byte { return nil },
+		LastAlertFunc:           func() []byte { return nil },
+		OfferedExtensionsFunc:   func() []uint16 { return nil },
+		RecordLayerVersionFunc:  func() uint16 { return 0 },
+		RecordSizesFunc:         func() []int { return nil },
+		SecureRenegotiationFunc: func() bool { return false },
+		SignatureSchemeFunc:     func() tls.SignatureScheme { return 0 },
+		FuncTLSConn: &tlsstub.FuncTLSConn{
+			FuncConn: newMinimalConn(),
+			ConnectionStateFunc: func() tls.ConnectionState {
+				return tls.ConnectionState{}
+			},
+			HandshakeContextFunc: func(ctx context.Context) error {
+				return handshakeErr
+			},
+		},
+	}
+	conn.FuncConn.CloseFunc = func() error { return nil }
+	return conn
+}
+
+// runInstrumentedHandshake performs a handshake using an engine returning the
+// given conn and returns the tlsHandshakeDone record.
+func runInstrumentedHandshake(t *testing.T, conn TLSConn) slog.Record {
+	logger, records := newCapturingLogger()
+	fn := NewTLSHandshakeFunc(NewConfig(), &tls.Config{ServerName: "example.com"}, logger)
+	fn.Engine = newMockTLSEngine(conn)
+	_, _ = fn.Call(context.Background(), newMinimalConn())
+	require.Len(t, *records, 2)
+	require.Equal(t, "tlsHandshakeDone", (*records)[1].Message)
+	return (*records)[1]
+}
+
+// The tlsHandshakeDone event includes tlsAlertBytes when the handshake
+// fails and the conn implements TLSAlertReporter.
+func TestTLSHandshakeFuncLogsAlertBytes(t *testing.T) {
+	wantAlert := []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}
+
+	t.Run("handshake failure with alert", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(errors.New("remote error: tls: handshake failure"))
+		conn.LastAlertFunc = func() []byte { return wantAlert }
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsAlertBytes")
+		require.True(t, found)
+		assert.Equal(t, wantAlert, value.Any())
+	})
+
+	t.Run("handshake success", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+		conn.LastAlertFunc = func() []byte { return wantAlert }
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn), "tlsAlertBytes")
+		assert.False(t, found)
+	})
+
+	t.Run("handshake failure without alert", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(errors.New("connection reset by peer"))
+		conn.LastAlertFunc = func() []byte { return nil }
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn), "tlsAlertBytes")
+		assert.False(t, found)
+	})
+
+	t.Run("engine without instrumentation", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(errors.New("remote error: tls: handshake failure"))
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsAlertBytes")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes the 0-RTT outcome reported by
+// instrumented engines and defaults to false otherwise.
+func TestTLSHandshakeFuncLogsEarlyData(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// conn is the conn returned by the engine.
+		conn TLSConn
+
+		// wantAttempted is the expected tls0RTTAttempted value.
+		wantAttempted bool
+
+		// wantAccepted is the expected tls0RTTAccepted value.
+		wantAccepted bool
+	}{
+		{
+			name: "attempted and accepted",
+			conn: func() TLSConn {
+				conn := newInstrumentedTLSConn(nil)
+				conn.EarlyDataAttemptedFunc = func() bool { return true }
+				conn.EarlyDataAcceptedFunc = func() bool { return true }
+				return conn
+			}(),
+			wantAttempted: true,
+			wantAccepted:  true,
+		},
+
+		{
+			name: "attempted but not accepted",
+			conn: func() TLSConn {
+				conn := newInstrumentedTLSConn(nil)
+				conn.EarlyDataAttemptedFunc = func() bool { return true }
+				return conn
+			}(),
+			wantAttempted: true,
+			wantAccepted:  false,
+		},
+
+		{
+			name:          "engine without instrumentation",
+			conn:          newInstrumentedTLSConn(nil).FuncTLSConn,
+			wantAttempted: false,
+			wantAccepted:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := runInstrumentedHandshake(t, tt.conn)
+
+			attempted, found := findAttr(record, "tls0RTTAttempted")
+			require.True(t, found)
+			assert.Equal(t, tt.wantAttempted, attempted.Bool())
+
+			accepted, found := findAttr(record, "tls0RTTAccepted")
+			require.True(t, found)
+			assert.Equal(t, tt.wantAccepted, accepted.Bool())
+		})
+	}
+}
+
+// The tlsHandshakeDone event includes tlsRecordSizes when provided.
+func TestTLSHandshakeFuncLogsRecordSizes(t *testing.T) {
+	t.Run("engine reporting record sizes", func(t *testing.T) {
+		wantSizes := []int{517, 122, 6, 4096, 1500}
+		conn := newInstrumentedTLSConn(nil)
+		conn.RecordSizesFunc = func() []int { return wantSizes }
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsRecordSizes")
+		require.True(t, found)
+		assert.Equal(t, wantSizes, value.Any())
+	})
+
+	t.Run("engine without instrumentation", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsRecordSizes")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsSignatureScheme when the conn
+// implements TLSSignatureSchemeReporter and reports a scheme.
+func TestTLSHandshakeFuncLogsSignatureScheme(t *testing.T) {
+	t.Run("scheme reported", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+		conn.SignatureSchemeFunc = func() tls.SignatureScheme { return tls.ECDSAWithP256AndSHA256 }
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsSignatureScheme")
+		require.True(t, found)
+		assert.Equal(t, "ECDSAWithP256AndSHA256", value.String())
+	})
+
+	t.Run("scheme not reported", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn), "tlsSignatureScheme")
+		assert.False(t, found)
+	})
+
+	t.Run("conn not implementing the interface", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsSignatureScheme")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsAlpsNegotiated when the conn
+// implements TLSALPSReporter.
+func TestTLSHandshakeFuncLogsALPSNegotiated(t *testing.T) {
+	for _, want := range []bool{true, false} {
+		conn := newInstrumentedTLSConn(nil)
+		conn.ALPSNegotiatedFunc = func() bool { return want }
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsAlpsNegotiated")
+		require.True(t, found)
+		assert.Equal(t, want, value.Bool())
+	}
+
+	conn := newInstrumentedTLSConn(nil)
+	_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsAlpsNegotiated")
+	assert.False(t, found)
+}
+
+// The tlsHandshakeDone event includes tlsRecordLayerVersion, which may differ
+// from tlsVersion, when the conn implements TLSRecordLayerVersionReporter.
+func TestTLSHandshakeFuncLogsRecordLayerVersion(t *testing.T) {
+	t.Run("record layer version differs from negotiated version", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+		conn.ConnectionStateFunc = func() tls.ConnectionState {
+			return tls.ConnectionState{Version: tls.VersionTLS13}
+		}
+		conn.RecordLayerVersionFunc = func() uint16 { return tls.VersionTLS12 }
+
+		record := runInstrumentedHandshake(t, conn)
+		value, found := findAttr(record, "tlsRecordLayerVersion")
+		require.True(t, found)
+		assert.Equal(t, "TLS 1.2", value.String())
+		value, found = findAttr(record, "tlsVersion")
+		require.True(t, found)
+		assert.Equal(t, "TLS 1.3", value.String())
+	})
+
+	t.Run("zero version", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn), "tlsRecordLayerVersion")
+		assert.False(t, found)
+	})
+
+	t.Run("not implemented", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsRecordLayerVersion")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsCompressionMethod, which is "null"
+// unless the conn implements TLSCompressionMethodReporter and reports otherwise.
+func TestTLSHandshakeFuncLogsCompressionMethod(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// method is the compression method reported by the conn.
+		method uint8
+
+		// want is the expected tlsCompressionMethod value.
+		want string
+	}{
+		{name: "null", method: 0, want: "null"},
+		{name: "deflate", method: 1, want: "deflate"},
+		{name: "lzs", method: 64, want: "lzs"},
+		{name: "unknown", method: 99, want: "99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newInstrumentedTLSConn(nil)
+			conn.CompressionMethodFunc = func() uint8 { return tt.method }
+
+			value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsCompressionMethod")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.String())
+		})
+	}
+
+	t.Run("not implemented", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsCompressionMethod")
+		require.True(t, found)
+		assert.Equal(t, "null", value.String())
+	})
+}
+
+// The tlsHandshakeDone event includes tlsResetAfterServerHello when the
+// handshake fails and the conn implements TLSBytesReceivedReporter.
+func TestTLSHandshakeFuncLogsResetAfterServerHello(t *testing.T) {
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// handshakeErr is the error returned by the handshake.
+		handshakeErr error
+
+		// bytesReceived is the number of bytes reported by the conn.
+		bytesReceived int64
+
+		// wantFound indicates whether we expect tlsResetAfterServerHello.
+		wantFound bool
+
+		// want is the expected tlsResetAfterServerHello value.
+		want bool
+	}{
+		{name: "reset after ServerHello", handshakeErr: resetErr, bytesReceived: 1412, wantFound: true, want: true},
+		{name: "wrapped reset after ServerHello", handshakeErr: fmt.Errorf("tls: %w", resetErr), bytesReceived: 1412, wantFound: true, want: true},
+		{name: "reset before receiving bytes", handshakeErr: resetErr, bytesReceived: 0, wantFound: true, want: false},
+		{name: "other error after ServerHello", handshakeErr: errors.New("mocked error"), bytesReceived: 1412, wantFound: true, want: false},
+		{name: "success", handshakeErr: nil, bytesReceived: 4096, wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newInstrumentedTLSConn(tt.handshakeErr)
+			conn.BytesReceivedFunc = func() int64 { return tt.bytesReceived }
+
+			value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsResetAfterServerHello")
+			require.Equal(t, tt.wantFound, found)
+			if found {
+				assert.Equal(t, tt.want, value.Bool())
+			}
+		})
+	}
+
+	t.Run("not implemented", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(resetErr)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsResetAfterServerHello")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeStart event includes tlsOfferedExtensions when the conn
+// implements TLSOfferedExtensionsReporter and returns a non-nil list.
+func TestTLSHandshakeFuncLogsOfferedExtensions(t *testing.T) {
+	// handshakeStart performs a handshake using an engine returning the
+	// given conn and returns the tlsHandshakeStart record.
+	handshakeStart := func(t *testing.T, conn TLSConn) slog.Record {
+		logger, records := newCapturingLogger()
+		fn := NewTLSHandshakeFunc(NewConfig(), &tls.Config{ServerName: "example.com"}, logger)
+		fn.Engine = newMockTLSEngine(conn)
+		_, _ = fn.Call(context.Background(), newMinimalConn())
+		require.Len(t, *records, 2)
+		require.Equal(t, "tlsHandshakeStart", (*records)[0].Message)
+		return (*records)[0]
+	}
+
+	t.Run("reported extensions", func(t *testing.T) {
+		// server_name, supported_groups, signature_algorithms, ALPN,
+		// supported_versions, key_share, and a GREASE value
+		want := []uint16{0, 10, 13, 16, 43, 51, 0x0a0a}
+		conn := newInstrumentedTLSConn(nil)
+		conn.OfferedExtensionsFunc = func() []uint16 { return want }
+
+		value, found := findAttr(handshakeStart(t, conn), "tlsOfferedExtensions")
+		require.True(t, found)
+		assert.Equal(t, want, value.Any())
+	})
+
+	t.Run("nil extensions", func(t *testing.T) {
+		_, found := findAttr(handshakeStart(t, newInstrumentedTLSConn(nil)), "tlsOfferedExtensions")
+		assert.False(t, found)
+	})
+
+	t.Run("not implemented", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil).FuncTLSConn
+		_, found := findAttr(handshakeStart(t, conn), "tlsOfferedExtensions")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsJA4 when the conn implements
+// TLSClientHelloReporter and returns a valid ClientHello.
+func TestTLSHandshakeFuncLogsJA4(t *testing.T) {
+	t.Run("valid ClientHello", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+		conn.ClientHelloFunc = func() []byte { return newJA4ChromeHello().handshake() }
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsJA4")
+		require.True(t, found)
+		assert.Equal(t, "t13d1516h2_8daaf6152771_e5627efa2ab1", value.String())
+	})
+
+	t.Run("invalid ClientHello", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+		conn.ClientHelloFunc = func() []byte { return []byte{0x02} }
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn), "tlsJA4")
+		assert.False(t, found)
+	})
+
+	t.Run("nil ClientHello", func(t *testing.T) {
+		_, found := findAttr(runInstrumentedHandshake(t, newInstrumentedTLSConn(nil)), "tlsJA4")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsFirstRecord and tlsFirstRecordLen
+// regardless of the handshake outcome when the conn implements
+// TLSFirstRecordReporter and reports a record.
+func TestTLSHandshakeFuncLogsFirstRecord(t *testing.T) {
+	// alert is a fatal handshake_failure alert record.
+	alert := []byte{0x15, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}
+
+	for _, handshakeErr := range []error{nil, errors.New("mocked handshake error")} {
+		conn := newInstrumentedTLSConn(handshakeErr)
+		conn.FirstReceivedRecordFunc = func() []byte { return alert }
+
+		record := runInstrumentedHandshake(t, conn)
+
+		value, found := findAttr(record, "tlsFirstRecord")
+		require.True(t, found)
+		assert.Equal(t, alert, value.Any())
+		value, found = findAttr(record, "tlsFirstRecordLen")
+		require.True(t, found)
+		assert.Equal(t, int64(len(alert)), value.Int64())
+	}
+
+	t.Run("no record received", func(t *testing.T) {
+		record := runInstrumentedHandshake(t, newInstrumentedTLSConn(nil))
+
+		_, found := findAttr(record, "tlsFirstRecord")
+		assert.False(t, found)
+		_, found = findAttr(record, "tlsFirstRecordLen")
+		assert.False(t, found)
+	})
+
+	t.Run("conn not implementing the interface", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		_, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsFirstRecord")
+		assert.False(t, found)
+	})
+}
+
+// The tlsHandshakeDone event includes tlsSecureRenegotiation, which comes from
+// TLSSecureRenegotiationReporter or defaults to whether the handshake succeeded
+// using TLS 1.2 or later.
+func TestTLSHandshakeFuncLogsSecureRenegotiation(t *testing.T) {
+	t.Run("engine reporting secure renegotiation", func(t *testing.T) {
+		for _, want := range []bool{true, false} {
+			conn := newInstrumentedTLSConn(nil)
+			conn.SecureRenegotiationFunc = func() bool { return want }
+
+			value, found := findAttr(runInstrumentedHandshake(t, conn), "tlsSecureRenegotiation")
+			require.True(t, found)
+			assert.Equal(t, want, value.Bool())
+		}
+	})
+
+	t.Run("engine without instrumentation", func(t *testing.T) {
+		tests := []struct {
+			// name describes the scenario.
+			name string
+
+			// version is the negotiated TLS version.
+			version uint16
+
+			// handshakeErr is the handshake error.
+			handshakeErr error
+
+			// want is the expected tlsSecureRenegotiation.
+			want bool
+		}{
+			{name: "TLS 1.3", version: tls.VersionTLS13, want: true},
+			{name: "TLS 1.2", version: tls.VersionTLS12, want: true},
+			{name: "TLS 1.1", version: tls.VersionTLS11, want: false},
+			{name: "handshake failure", handshakeErr: errors.New("mocked error"), want: false},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				conn := newInstrumentedTLSConn(tt.handshakeErr)
+				conn.ConnectionStateFunc = func() tls.ConnectionState {
+					return tls.ConnectionState{Version: tt.version}
+				}
+
+				value, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tlsSecureRenegotiation")
+				require.True(t, found)
+				assert.Equal(t, tt.want, value.Bool())
+			})
+		}
+	})
+}
+
+// The tlsHandshakeDone event includes tls0RTTRejected, which is true only when
+// the handshake succeeds after the server rejected the early data we sent.
+func TestTLSHandshakeFuncLogsEarlyDataRejected(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// attempted is the value returned by EarlyDataAttempted.
+		attempted bool
+
+		// accepted is the value returned by EarlyDataAccepted.
+		accepted bool
+
+		// handshakeErr is the handshake error.
+		handshakeErr error
+
+		// want is the expected tls0RTTRejected value.
+		want bool
+	}{
+		{name: "attempted and rejected", attempted: true, accepted: false, want: true},
+		{name: "attempted and accepted", attempted: true, accepted: true, want: false},
+		{name: "not attempted", attempted: false, accepted: false, want: false},
+		{
+			name:         "attempted but the handshake failed",
+			attempted:    true,
+			accepted:     false,
+			handshakeErr: errors.New("mocked handshake error"),
+			want:         false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newInstrumentedTLSConn(tt.handshakeErr)
+			conn.EarlyDataAttemptedFunc = func() bool { return tt.attempted }
+			conn.EarlyDataAcceptedFunc = func() bool { return tt.accepted }
+
+			value, found := findAttr(runInstrumentedHandshake(t, conn), "tls0RTTRejected")
+			require.True(t, found)
+			assert.Equal(t, tt.want, value.Bool())
+		})
+	}
+
+	t.Run("engine without instrumentation", func(t *testing.T) {
+		conn := newInstrumentedTLSConn(nil)
+
+		value, found := findAttr(runInstrumentedHandshake(t, conn.FuncTLSConn), "tls0RTTRejected")
+		require.True(t, found)
+		assert.False(t, value.Bool())
+	})
+}
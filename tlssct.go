@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"log/slog"
+)
+
+// tlsSCTListOID is the OID of the X.509 extension containing the SCTs
+// embedded into a certificate (see RFC 6962, Section 3.3).
+var tlsSCTListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// tlsSCTAttrs returns the tlsHandshakeDone attributes describing the
+// Certificate Transparency compliance of the peer.
+//
+// We log the number of SCTs embedded into the leaf certificate as
+// tlsEmbeddedSCTCount and the number of SCTs delivered using the TLS
+// extension or the OCSP staple as tlsStapledSCTCount. Both are zero
+// when the handshake fails before we receive the certificates.
+func tlsSCTAttrs(state tls.ConnectionState) []any {
+	embedded := 0
+	if len(state.PeerCertificates) > 0 {
+		embedded = tlsEmbeddedSCTCount(state.PeerCertificates[0])
+	}
+	return []any{
+		slog.Int("tlsEmbeddedSCTCount", embedded),
+		slog.Int("tlsStapledSCTCount", len(state.SignedCertificateTimestamps)),
+	}
+}
+
+// tlsEmbeddedSCTCount returns the number of SCTs in the SCT list extension
+// of the given certificate, or zero when the extension is missing or malformed.
+func tlsEmbeddedSCTCount(cert *x509.Certificate) int {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(tlsSCTListOID) {
+			continue
+		}
+
+		// 1. Unwrap the OCTET STRING containing the TLS-encoded list
+		var list []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) > 0 {
+			return 0
+		}
+
+		// 2. Walk the length-prefixed SerializedSCT entries
+		if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+			return 0
+		}
+		count := 0
+		for entries := list[2:]; len(entries) > 0; count++ {
+			if len(entries) < 2 {
+				return 0
+			}
+			size := int(binary.BigEndian.Uint16(entries))
+			if size <= 0 || size > len(entries)-2 {
+				return 0
+			}
+			entries = entries[2+size:]
+		}
+		return count
+	}
+	return 0
+}
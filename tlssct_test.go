@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSCTCert returns a certificate whose SCT list extension contains
+// the given serialized SCTs.
+func newTestSCTCert(scts ...[]byte) *x509.Certificate {
+	var entries []byte
+	for _, sct := range scts {
+		entries = append(entries, byte(len(sct)>>8), byte(len(sct)))
+		entries = append(entries, sct...)
+	}
+	list := append([]byte{byte(len(entries) >> 8), byte(len(entries))}, entries...)
+	return &x509.Certificate{
+		Extensions: []pkix.Extension{{
+			Id:    tlsSCTListOID,
+			Value: runtimex.PanicOnError1(asn1.Marshal(list)),
+		}},
+	}
+}
+
+// tlsEmbeddedSCTCount counts the SCTs and tolerates malformed extensions.
+func TestTLSEmbeddedSCTCount(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// cert is the certificate to inspect.
+		cert *x509.Certificate
+
+		// want is the expected count.
+		want int
+	}{
+		{
+			name: "without extension",
+			cert: &x509.Certificate{},
+			want: 0,
+		},
+
+		{
+			name: "with three SCTs",
+			cert: newTestSCTCert([]byte{0x00, 0x01}, []byte{0x00, 0x02, 0x03}, []byte{0x00}),
+			want: 3,
+		},
+
+		{
+			name: "not an OCTET STRING",
+			cert: &x509.Certificate{Extensions: []pkix.Extension{{Id: tlsSCTListOID, Value: []byte{0x05, 0x00}}}},
+			want: 0,
+		},
+
+		{
+			name: "list length mismatch",
+			cert: &x509.Certificate{Extensions: []pkix.Extension{{
+				Id:    tlsSCTListOID,
+				Value: runtimex.PanicOnError1(asn1.Marshal([]byte{0x00, 0x05, 0x00, 0x01, 0x00})),
+			}}},
+			want: 0,
+		},
+
+		{
+			name: "truncated SCT",
+			cert: &x509.Certificate{Extensions: []pkix.Extension{{
+				Id:    tlsSCTListOID,
+				Value: runtimex.PanicOnError1(asn1.Marshal([]byte{0x00, 0x03, 0x00, 0x04, 0x00})),
+			}}},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tlsEmbeddedSCTCount(tt.cert))
+		})
+	}
+}
+
+// Call logs the embedded and stapled SCT counts on tlsHandshakeDone.
+func TestTLSHandshakeFuncLogsSCTCounts(t *testing.T) {
+	tests := []struct {
+		// name describes the scenario.
+		name string
+
+		// state is the connection state returned by the mock.
+		state tls.ConnectionState
+
+		// wantEmbedded is the expected tlsEmbeddedSCTCount.
+		wantEmbedded int64
+
+		// wantStapled is the expected tlsStapledSCTCount.
+		wantStapled int64
+	}{
+		{
+			name: "embedded and stapled SCTs",
+			state: tls.ConnectionState{
+				PeerCertificates:            []*x509.Certificate{newTestSCTCert([]byte{0x00}, []byte{0x01})},
+				SignedCertificateTimestamps: [][]byte{{0x00}},
+			},
+			wantEmbedded: 2,
+			wantStapled:  1,
+		},
+
+		{
+			name:         "without peer certificates",
+			state:        tls.ConnectionState{},
+			wantEmbedded: 0,
+			wantStapled:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, records := newCapturingLogger()
+			mockTLSConn := &tlsstub.FuncTLSConn{
+				FuncConn: newMinimalConn(),
+				ConnectionStateFunc: func() tls.ConnectionState {
+					return tt.state
+				},
+				HandshakeContextFunc: func(ctx context.Context) error {
+					return nil
+				},
+			}
+			fn := NewTLSHandshakeFunc(NewConfig(), &tls.Config{ServerName: "example.com"}, logger)
+			fn.Engine = newMockTLSEngine(mockTLSConn)
+
+			_, err := fn.Call(context.Background(), newMinimalConn())
+
+			require.NoError(t, err)
+			record, found := findRecord(*records, "tlsHandshakeDone")
+			require.True(t, found)
+			value, found := findAttr(record, "tlsEmbeddedSCTCount")
+			require.True(t, found)
+			assert.Equal(t, tt.wantEmbedded, value.Int64())
+			value, found = findAttr(record, "tlsStapledSCTCount")
+			require.True(t, found)
+			assert.Equal(t, tt.wantStapled, value.Int64())
+		})
+	}
+}
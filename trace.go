@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// NewTraceSLogger returns a new [SLogger] recording all the events it
+// receives, regardless of their level, into the returned [*Trace].
+//
+// This is a testing utility for asserting on the events emitted by whole
+// pipelines, including their order. The returned [SLogger] is a [*slog.Logger],
+// therefore [*slog.Logger.With] works as expected (e.g., to add a spanID).
+// Groups created with [*slog.Logger.WithGroup] are flattened.
+func NewTraceSLogger() (SLogger, *Trace) {
+	trace := &Trace{}
+	return slog.New(&traceHandler{trace: trace}), trace
+}
+
+// Trace is the ordered sequence of events recorded by the [SLogger]
+// returned by [NewTraceSLogger].
+//
+// Methods are safe for concurrent use.
+type Trace struct {
+	// mu protects records.
+	mu sync.Mutex
+
+	// records contains the recorded events in order of emission.
+	records []slog.Record
+}
+
+// Events returns the names of the recorded events in order of emission.
+func (t *Trace) Events() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := make([]string, 0, len(t.records))
+	for _, record := range t.records {
+		events = append(events, record.Message)
+	}
+	return events
+}
+
+// Find returns the first recorded event with the given name, if any.
+func (t *Trace) Find(name string) (slog.Record, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, record := range t.records {
+		if record.Message == name {
+			return record.Clone(), true
+		}
+	}
+	return slog.Record{}, false
+}
+
+func (t *Trace) append(record slog.Record) {
+	t.mu.Lock()
+	t.records = append(t.records, record)
+	t.mu.Unlock()
+}
+
+// snapshot returns a copy of the recorded events.
+func (t *Trace) snapshot() []slog.Record {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]slog.Record{}, t.records...)
+}
+
+// discard removes the first n recorded events.
+func (t *Trace) discard(n int) {
+	t.mu.Lock()
+	t.records = append([]slog.Record{}, t.records[n:]...)
+	t.mu.Unlock()
+}
+
+// traceHandler is the [slog.Handler] recording events into a [*Trace].
+type traceHandler struct {
+	attrs []slog.Attr
+	trace *Trace
+}
+
+var _ slog.Handler = &traceHandler{}
+
+// Enabled implements [slog.Handler].
+func (h *traceHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return true
+}
+
+// Handle implements [slog.Handler].
+func (h *traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	record = record.Clone()
+	record.AddAttrs(h.attrs...)
+	h.trace.append(record)
+	return nil
+}
+
+// WithAttrs implements [slog.Handler].
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{
+		attrs: append(append([]slog.Attr{}, h.attrs...), attrs...),
+		trace: h.trace,
+	}
+}
+
+// WithGroup implements [slog.Handler].
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return h
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/netstub"
+	"github.com/bassosimone/tlsstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTracePipeline returns a connect and TLS handshake pipeline logging
+// to the given logger, whose handshake fails with handshakeErr.
+func newTracePipeline(logger SLogger, handshakeErr error) Func[netip.AddrPort, TLSConn] {
+	cfg := NewConfig()
+	cfg.Dialer = &netstub.FuncDialer{
+		DialContextFunc: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return newMinimalConn(), nil
+		},
+	}
+	tcpConn := newMinimalConn()
+	tcpConn.CloseFunc = func() error {
+		return nil
+	}
+	mockTLSConn := &tlsstub.FuncTLSConn{
+		FuncConn: tcpConn,
+		ConnectionStateFunc: func() tls.ConnectionState {
+			return tls.ConnectionState{}
+		},
+		HandshakeContextFunc: func(ctx context.Context) error {
+			return handshakeErr
+		},
+	}
+	handshake := NewTLSHandshakeFunc(cfg, &tls.Config{ServerName: "example.com"}, logger)
+	handshake.Engine = newMockTLSEngine(mockTLSConn)
+	return Compose2(NewConnectFunc(cfg, "tcp", logger), handshake)
+}
+
+// The trace records the events emitted by a composed pipeline in order.
+func TestTraceSLoggerEventOrder(t *testing.T) {
+	logger, trace := NewTraceSLogger()
+
+	_, err := newTracePipeline(logger, nil).Call(
+		context.Background(), netip.MustParseAddrPort("93.184.216.34:443"))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"connectStart",
+		"connectDone",
+		"tlsHandshakeStart",
+		"tlsHandshakeDone",
+	}, trace.Events())
+}
+
+// Find returns the first event with the given name, allowing assertions
+// on the fields of the events emitted by a failing pipeline.
+func TestTraceSLoggerFind(t *testing.T) {
+	logger, trace := NewTraceSLogger()
+	wantErr := errors.New("mocked error")
+
+	_, err := newTracePipeline(logger, wantErr).Call(
+		context.Background(), netip.MustParseAddrPort("93.184.216.34:443"))
+	require.ErrorIs(t, err, wantErr)
+
+	record, found := trace.Find("tlsHandshakeDone")
+	require.True(t, found)
+	value, found := findAttr(record, "err")
+	require.True(t, found)
+	assert.Equal(t, wantErr, value.Any())
+
+	_, found = trace.Find("httpRoundTripStart")
+	assert.False(t, found)
+}
+
+// The trace records Debug events and the attributes added using With.
+func TestTraceSLoggerWith(t *testing.T) {
+	logger, trace := NewTraceSLogger()
+	spanID := NewSpanID()
+
+	logger.(*slog.Logger).With(slog.String("spanID", spanID)).Debug("read", slog.Int("ioBytesCount", 4))
+
+	assert.Equal(t, []string{"read"}, trace.Events())
+	record, found := trace.Find("read")
+	require.True(t, found)
+	value, found := findAttr(record, "ioBytesCount")
+	require.True(t, found)
+	assert.Equal(t, int64(4), value.Int64())
+	value, found = findAttr(record, "spanID")
+	require.True(t, found)
+	assert.Equal(t, spanID, value.String())
+}
@@ -0,0 +1,175 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/safeconn"
+)
+
+// NewWriteBatchFunc returns a new [*WriteBatchFunc].
+//
+// The cfg argument contains the common configuration for nop operations.
+//
+// The flushSize argument is the number of buffered bytes triggering a flush.
+//
+// The flushInterval argument is the maximum time written bytes remain buffered.
+//
+// The logger argument is the [SLogger] to use for structured logging.
+//
+// This function panics if flushSize or flushInterval is not positive.
+func NewWriteBatchFunc(cfg *Config, flushSize int, flushInterval time.Duration, logger SLogger) *WriteBatchFunc {
+	runtimex.Assert(flushSize > 0)
+	runtimex.Assert(flushInterval > 0)
+	return &WriteBatchFunc{
+		ErrClassifier: cfg.ErrClassifier,
+		FlushInterval: flushInterval,
+		FlushSize:     flushSize,
+		Logger:        logger,
+		TimeNow:       cfg.TimeNow,
+	}
+}
+
+// WriteBatchFunc wraps a [net.Conn] to coalesce small writes into larger ones.
+//
+// Each Write appends to a buffer and returns immediately. The buffer is
+// flushed with a single Write on the underlying connection when it contains
+// at least FlushSize bytes, when FlushInterval has elapsed since the first
+// buffered Write, or when the connection is closed. Each flush emits a
+// writeBatchFlush event whose writeBatchBytes field contains the number of
+// flushed bytes and whose writeBatchReason field is "size", "interval", or
+// "close". This reduces the number of syscalls made by protocols emitting
+// many tiny writes and allows studying their behavior under coalescing.
+//
+// Flushing respects the context passed to Call: once it is done, flushing
+// fails with the context error. Since Write returns before the data is
+// flushed, a flush error is returned by the next Write or by Close.
+//
+// All fields are safe to modify after construction but before first use.
+// Fields must not be mutated concurrently with calls to [Call].
+type WriteBatchFunc struct {
+	// ErrClassifier classifies errors for structured logging.
+	//
+	// Set by [NewWriteBatchFunc] from [Config.ErrClassifier].
+	ErrClassifier ErrClassifier
+
+	// FlushInterval is the maximum time written bytes remain buffered.
+	//
+	// Set by [NewWriteBatchFunc] to the user-provided value.
+	FlushInterval time.Duration
+
+	// FlushSize is the number of buffered bytes triggering a flush.
+	//
+	// Set by [NewWriteBatchFunc] to the user-provided value.
+	FlushSize int
+
+	// Logger is the [SLogger] to use (configurable for testing or custom logging).
+	//
+	// Set by [NewWriteBatchFunc] to the user-provided logger.
+	Logger SLogger
+
+	// TimeNow is the function to get the current time (configurable for testing).
+	//
+	// Set by [NewWriteBatchFunc] from [Config.TimeNow].
+	TimeNow func() time.Time
+}
+
+var _ Func[net.Conn, net.Conn] = &WriteBatchFunc{}
+
+// Call wraps the given [net.Conn] to coalesce small writes.
+func (op *WriteBatchFunc) Call(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	return &writeBatchConn{Conn: conn, ctx: ctx, op: op}, nil
+}
+
+// writeBatchConn coalesces small writes on a [net.Conn].
+type writeBatchConn struct {
+	net.Conn
+	ctx context.Context
+	op  *WriteBatchFunc
+
+	// mu protects the fields below.
+	mu     sync.Mutex
+	buffer []byte
+	err    error
+	timer  *time.Timer
+}
+
+// Write implements [net.Conn].
+func (c *writeBatchConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.buffer = append(c.buffer, b...)
+	if len(c.buffer) >= c.op.FlushSize {
+		if err := c.flushLocked("size"); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.op.FlushInterval, c.flushInterval)
+	}
+	return len(b), nil
+}
+
+// Close implements [net.Conn].
+func (c *writeBatchConn) Close() error {
+	c.mu.Lock()
+	err := c.flushLocked("close")
+	c.mu.Unlock()
+	if cerr := c.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// flushInterval flushes the buffer when FlushInterval has elapsed.
+func (c *writeBatchConn) flushInterval() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked("interval")
+}
+
+// flushLocked writes the buffered bytes, if any, on the underlying connection
+// and records the error, if any. The caller must hold the mutex.
+func (c *writeBatchConn) flushLocked(reason string) error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	if c.err != nil || len(c.buffer) <= 0 {
+		return c.err
+	}
+	t0 := c.op.TimeNow()
+	err := c.ctx.Err()
+	if err == nil {
+		_, err = c.Conn.Write(c.buffer)
+	}
+	c.logFlush(t0, reason, len(c.buffer), err)
+	c.buffer = nil
+	c.err = err
+	return err
+}
+
+func (c *writeBatchConn) logFlush(t0 time.Time, reason string, count int, err error) {
+	c.op.Logger.Info(
+		"writeBatchFlush",
+		slog.Any("err", err),
+		slog.String("errClass", c.op.ErrClassifier.Classify(err)),
+		slog.String("localAddr", connLocalAddr(c.Conn)),
+		slog.String("protocol", safeconn.Network(c.Conn)),
+		slog.String("remoteAddr", connRemoteAddr(c.Conn)),
+		slog.Time("t0", t0),
+		slog.Time("t", c.op.TimeNow()),
+		slog.Int("writeBatchBytes", count),
+		slog.String("writeBatchReason", reason),
+	)
+}
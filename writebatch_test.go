@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package nop
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/netstub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// NewWriteBatchFunc populates all fields from Config, the provided values, and logger.
+func TestNewWriteBatchFunc(t *testing.T) {
+	fn := NewWriteBatchFunc(NewConfig(), 1024, time.Second, DefaultSLogger())
+
+	require.NotNil(t, fn)
+	assert.NotNil(t, fn.ErrClassifier)
+	assert.Equal(t, time.Second, fn.FlushInterval)
+	assert.Equal(t, 1024, fn.FlushSize)
+	assert.NotNil(t, fn.Logger)
+	assert.NotNil(t, fn.TimeNow)
+}
+
+// NewWriteBatchFunc panics when flushSize or flushInterval is not positive.
+func TestNewWriteBatchFuncInvalidArguments(t *testing.T) {
+	assert.Panics(t, func() { NewWriteBatchFunc(NewConfig(), 0, time.Second, DefaultSLogger()) })
+	assert.Panics(t, func() { NewWriteBatchFunc(NewConfig(), 1024, 0, DefaultSLogger()) })
+}
+
+// newWriteBatchRecordingConn returns a mock conn recording each Write.
+func newWriteBatchRecordingConn() (*netstub.FuncConn, func() [][]byte) {
+	var (
+		mu     sync.Mutex
+		writes [][]byte
+	)
+	conn := newMinimalConn()
+	conn.CloseFunc = func() error {
+		return nil
+	}
+	conn.WriteFunc = func(b []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		writes = append(writes, append([]byte{}, b...))
+		return len(b), nil
+	}
+	getWrites := func() [][]byte {
+		mu.Lock()
+		defer mu.Unlock()
+		return writes
+	}
+	return conn, getWrites
+}
+
+// Small writes are coalesced into fewer underlying writes when the size is reached.
+func TestWriteBatchFuncFlushOnSize(t *testing.T) {
+	mockConn, writes := newWriteBatchRecordingConn()
+	logger, records := newCapturingLogger()
+	fn := NewWriteBatchFunc(NewConfig(), 4, time.Hour, logger)
+
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	for _, chunk := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		count, err := conn.Write([]byte(chunk))
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	}
+
+	assert.Equal(t, [][]byte{[]byte("abcd"), []byte("efgh")}, writes())
+	require.Len(t, *records, 2)
+	for _, record := range *records {
+		assert.Equal(t, "writeBatchFlush", record.Message)
+		value, found := findAttr(record, "writeBatchBytes")
+		require.True(t, found)
+		assert.Equal(t, int64(4), value.Int64())
+		value, found = findAttr(record, "writeBatchReason")
+		require.True(t, found)
+		assert.Equal(t, "size", value.String())
+	}
+}
+
+// Buffered writes are flushed when the interval elapses.
+func TestWriteBatchFuncFlushOnInterval(t *testing.T) {
+	mockConn, writes := newWriteBatchRecordingConn()
+	logger, records := newCapturingLogger()
+	fn := NewWriteBatchFunc(NewConfig(), 1024, 10*time.Millisecond, logger)
+
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	for _, chunk := range []string{"ab", "cd", "ef"} {
+		_, err := conn.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool { return len(writes()) > 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, [][]byte{[]byte("abcdef")}, writes())
+
+	// Close must not flush again since the buffer is empty
+	require.NoError(t, conn.Close())
+	require.Len(t, *records, 1)
+	value, found := findAttr((*records)[0], "writeBatchBytes")
+	require.True(t, found)
+	assert.Equal(t, int64(6), value.Int64())
+	value, found = findAttr((*records)[0], "writeBatchReason")
+	require.True(t, found)
+	assert.Equal(t, "interval", value.String())
+}
+
+// Close flushes the buffered writes before closing the connection.
+func TestWriteBatchFuncFlushOnClose(t *testing.T) {
+	mockConn, writes := newWriteBatchRecordingConn()
+	var closed bool
+	mockConn.CloseFunc = func() error {
+		assert.Len(t, writes(), 1, "should flush before closing")
+		closed = true
+		return nil
+	}
+	logger, records := newCapturingLogger()
+	fn := NewWriteBatchFunc(NewConfig(), 1024, time.Hour, logger)
+
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Empty(t, writes())
+
+	require.NoError(t, conn.Close())
+	assert.True(t, closed)
+	assert.Equal(t, [][]byte{[]byte("abc")}, writes())
+	require.Len(t, *records, 1)
+	value, found := findAttr((*records)[0], "writeBatchReason")
+	require.True(t, found)
+	assert.Equal(t, "close", value.String())
+}
+
+// Flushing fails with the context error once the context is done, and
+// the error is returned by subsequent writes.
+func TestWriteBatchFuncFlushRespectsContext(t *testing.T) {
+	mockConn, writes := newWriteBatchRecordingConn()
+	logger, records := newCapturingLogger()
+	fn := NewWriteBatchFunc(NewConfig(), 4, time.Hour, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := fn.Call(ctx, mockConn)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ab"))
+	require.NoError(t, err)
+	cancel()
+
+	_, err = conn.Write([]byte("cd"))
+	require.ErrorIs(t, err, context.Canceled)
+	_, err = conn.Write([]byte("ef"))
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, conn.Close(), context.Canceled)
+	assert.Empty(t, writes())
+	require.Len(t, *records, 1)
+	value, found := findAttr((*records)[0], "err")
+	require.True(t, found)
+	assert.ErrorIs(t, value.Any().(error), context.Canceled)
+}
+
+// A failed flush is logged and its error is returned by subsequent writes.
+func TestWriteBatchFuncFlushError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	mockConn, _ := newWriteBatchRecordingConn()
+	mockConn.WriteFunc = func(b []byte) (int, error) {
+		return 0, wantErr
+	}
+	logger, records := newCapturingLogger()
+	fn := NewWriteBatchFunc(NewConfig(), 2, time.Hour, logger)
+
+	conn, err := fn.Call(context.Background(), mockConn)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("ab"))
+	require.ErrorIs(t, err, wantErr)
+	_, err = conn.Write([]byte("cd"))
+	require.ErrorIs(t, err, wantErr)
+
+	require.Len(t, *records, 1)
+	value, found := findAttr((*records)[0], "err")
+	require.True(t, found)
+	assert.Equal(t, wantErr, value.Any())
+}